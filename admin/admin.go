@@ -0,0 +1,227 @@
+package admin
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/valyala/fasthttp"
+	"gitlab.bcc-hyperdev.org/bcc-hyperdev/realtime"
+	"gitlab.bcc-hyperdev.org/bcc-hyperdev/realtime/shared"
+)
+
+const DefaultHeartbeat = 15 * time.Second
+
+type Config struct {
+	Manager *realtime.SessionManager
+	// Token must be sent as a bearer token with every request, health and
+	// readiness checks included.
+	Token string
+	// BasePath prefixes every endpoint. Optional.
+	BasePath string
+	// Heartbeat is the interval of the comments keeping event streams alive.
+	Heartbeat time.Duration
+	// CloseTimeout bounds ending a session, realtime.DefaultCloseTimeout by
+	// default.
+	CloseTimeout time.Duration
+}
+
+// SessionInfo describes a live session.
+type SessionInfo struct {
+	Id        string    `json:"id"`
+	Tenant    string    `json:"tenant"`
+	StartedAt time.Time `json:"started_at"`
+	// DurationMs is how long the session has been running.
+	DurationMs int64  `json:"duration_ms"`
+	State      string `json:"state"`
+	// Config is the session config the server last reported.
+	Config           json.RawMessage `json:"config,omitempty"`
+	Usage            realtime.Usage  `json:"usage"`
+	PendingResponses []string        `json:"pending_responses"`
+}
+
+func newSessionInfo(s *realtime.ManagedSession, now time.Time) SessionInfo {
+	return SessionInfo{
+		Id:               s.Id,
+		Tenant:           s.Tenant,
+		StartedAt:        s.StartedAt,
+		DurationMs:       now.Sub(s.StartedAt).Milliseconds(),
+		State:            s.Session.State(),
+		Config:           s.Session.Config(),
+		Usage:            s.Session.Usage(),
+		PendingResponses: s.Session.PendingResponses(),
+	}
+}
+
+// Message is injected into a session by POST {BasePath}/sessions/{id}/messages.
+// A user message, the default, gets a response; a system message does not.
+type Message struct {
+	Role string `json:"role"`
+	Text string `json:"text"`
+}
+
+// Server is an HTTP API for operators to inspect and control the sessions of
+// a SessionManager:
+//
+//	GET    /healthz                     liveness
+//	GET    /readyz                      readiness, 503 once draining
+//	GET    /stats                       realtime.SessionStats
+//	GET    /sessions                    SessionInfo of every live session
+//	GET    /sessions/{id}               SessionInfo
+//	DELETE /sessions/{id}               ends the session, 500 if it fails to
+//	                                    within Config.CloseTimeout
+//	POST   /sessions/{id}/messages      injects a Message
+//	GET    /sessions/{id}/events        server-sent events of the session's traffic
+type Server struct {
+	logger *shared.Logger
+	cfg    *Config
+
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func NewServer(logger *shared.Logger, cfg *Config) (s *Server, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("failed to create admin server: %w", err)
+		}
+	}()
+	if cfg == nil || cfg.Manager == nil {
+		return nil, fmt.Errorf("manager is required")
+	}
+	if cfg.Token == "" {
+		return nil, fmt.Errorf("token is required")
+	}
+	if cfg.Heartbeat <= 0 {
+		cfg.Heartbeat = DefaultHeartbeat
+	}
+	if cfg.CloseTimeout <= 0 {
+		cfg.CloseTimeout = realtime.DefaultCloseTimeout
+	}
+	cfg.BasePath = strings.TrimSuffix(cfg.BasePath, "/")
+	return &Server{
+		logger: logger,
+		cfg:    cfg,
+		closed: make(chan struct{}),
+	}, nil
+}
+
+// Close ends the event streams, which would otherwise keep a server from
+// shutting down.
+func (s *Server) Close() {
+	s.closeOnce.Do(func() { close(s.closed) })
+}
+
+func (s *Server) Handle(ctx *fasthttp.RequestCtx) {
+	if !s.authorized(ctx) {
+		ctx.Response.Header.Set("WWW-Authenticate", "Bearer")
+		ctx.Error("unauthorized", fasthttp.StatusUnauthorized)
+		return
+	}
+	path, ok := strings.CutPrefix(strings.TrimSuffix(string(ctx.Path()), "/"), s.cfg.BasePath)
+	if !ok {
+		ctx.Error("not found", fasthttp.StatusNotFound)
+		return
+	}
+	switch {
+	case path == "/healthz" && ctx.IsGet():
+		ctx.SetBodyString("ok")
+	case path == "/readyz" && ctx.IsGet():
+		if s.cfg.Manager.Stats().Draining {
+			ctx.Error("draining", fasthttp.StatusServiceUnavailable)
+			return
+		}
+		ctx.SetBodyString("ok")
+	case path == "/stats" && ctx.IsGet():
+		s.writeJSON(ctx, s.cfg.Manager.Stats())
+	case path == "/sessions" && ctx.IsGet():
+		now := time.Now()
+		infos := []SessionInfo{}
+		for _, session := range s.cfg.Manager.Sessions() {
+			infos = append(infos, newSessionInfo(session, now))
+		}
+		s.writeJSON(ctx, infos)
+	case strings.HasPrefix(path, "/sessions/"):
+		id, action, _ := strings.Cut(strings.TrimPrefix(path, "/sessions/"), "/")
+		s.handleSession(ctx, id, action)
+	default:
+		ctx.Error("not found", fasthttp.StatusNotFound)
+	}
+}
+
+func (s *Server) authorized(ctx *fasthttp.RequestCtx) bool {
+	token, ok := strings.CutPrefix(string(ctx.Request.Header.Peek(fasthttp.HeaderAuthorization)), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(token), []byte(s.cfg.Token)) == 1
+}
+
+func (s *Server) handleSession(ctx *fasthttp.RequestCtx, id, action string) {
+	session, ok := s.cfg.Manager.Session(id)
+	if !ok {
+		ctx.Error("session not found", fasthttp.StatusNotFound)
+		return
+	}
+	switch {
+	case action == "" && ctx.IsGet():
+		s.writeJSON(ctx, newSessionInfo(session, time.Now()))
+	case action == "" && ctx.IsDelete():
+		// The request context has no deadline, and deriving from it races
+		// with the server shutting down.
+		closeCtx, cancel := context.WithTimeout(context.Background(), s.cfg.CloseTimeout)
+		defer cancel()
+		if err := session.Close(closeCtx); err != nil {
+			s.logger.Error(ctx, err, "failed to end session")
+			ctx.Error(err.Error(), fasthttp.StatusInternalServerError)
+			return
+		}
+		ctx.SetStatusCode(fasthttp.StatusNoContent)
+	case action == "messages" && ctx.IsPost():
+		s.handleMessage(ctx, session)
+	case action == "events" && ctx.IsGet():
+		s.handleEvents(ctx, session)
+	default:
+		ctx.Error("not found", fasthttp.StatusNotFound)
+	}
+}
+
+func (s *Server) handleMessage(ctx *fasthttp.RequestCtx, session *realtime.ManagedSession) {
+	var msg Message
+	if err := json.Unmarshal(ctx.PostBody(), &msg); err != nil || msg.Text == "" {
+		ctx.Error("a message with text is required", fasthttp.StatusBadRequest)
+		return
+	}
+	var err error
+	switch msg.Role {
+	case "", realtime.RoleUser:
+		err = session.Session.SendText(ctx, msg.Text)
+	case realtime.RoleSystem:
+		err = session.Session.Send(ctx, realtime.NewConversationItemCreateEvent("", realtime.Item{
+			Type:    realtime.ItemTypeMessage,
+			Role:    realtime.RoleSystem,
+			Content: []realtime.ContentPart{{Type: realtime.ContentTypeInputText, Text: msg.Text}},
+		}))
+	default:
+		ctx.Error("role must be user or system", fasthttp.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		s.logger.Error(ctx, err, "failed to inject message")
+		ctx.Error("failed to inject message", fasthttp.StatusBadGateway)
+		return
+	}
+	ctx.SetStatusCode(fasthttp.StatusAccepted)
+}
+
+func (s *Server) writeJSON(ctx *fasthttp.RequestCtx, v any) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		s.logger.Error(ctx, err, "failed to marshal response")
+		ctx.Error("internal error", fasthttp.StatusInternalServerError)
+		return
+	}
+	ctx.SetContentType("application/json")
+	ctx.SetBody(data)
+}
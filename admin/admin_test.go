@@ -0,0 +1,282 @@
+package admin
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/valyala/fasthttp"
+	"gitlab.bcc-hyperdev.org/bcc-hyperdev/realtime"
+	"gitlab.bcc-hyperdev.org/bcc-hyperdev/realtime/shared"
+)
+
+const testToken = "secret"
+
+// fakeTransport carries events only.
+type fakeTransport struct {
+	events chan []byte
+	audio  chan []byte
+	sent   chan []byte
+
+	mu       sync.Mutex
+	closed   bool
+	closeErr error
+}
+
+func newFakeTransport() *fakeTransport {
+	return &fakeTransport{
+		events: make(chan []byte, 16),
+		audio:  make(chan []byte),
+		sent:   make(chan []byte, 16),
+	}
+}
+
+func (t *fakeTransport) Send(ctx context.Context, event []byte) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return errors.New("closed")
+	}
+	t.sent <- event
+	return nil
+}
+
+func (t *fakeTransport) Events() <-chan []byte                              { return t.events }
+func (t *fakeTransport) WriteAudio(ctx context.Context, frame []byte) error { return nil }
+func (t *fakeTransport) Audio() <-chan []byte                               { return t.audio }
+
+func (t *fakeTransport) Close(ctx context.Context) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.closed {
+		t.closed = true
+		close(t.events)
+		close(t.audio)
+	}
+	return t.closeErr
+}
+
+type testServer struct {
+	url       string
+	client    *http.Client
+	manager   *realtime.SessionManager
+	session   *realtime.ManagedSession
+	transport *fakeTransport
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	logger := shared.NewLogger()
+	manager, err := realtime.NewSessionManager(logger, nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	transport := newFakeTransport()
+	session, err := manager.Start(context.Background(), "acme", func(ctx context.Context) (*realtime.Session, error) {
+		return realtime.NewSession(logger, transport, nil)
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	server, err := NewServer(logger, &Config{Manager: manager, Token: testToken, BasePath: "/admin/"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	httpServer := &fasthttp.Server{Handler: server.Handle}
+	go func() { _ = httpServer.Serve(ln) }()
+	// Shutdown waits for keep-alive connections, so each server gets its own.
+	client := &http.Client{Transport: &http.Transport{}}
+	t.Cleanup(func() {
+		client.CloseIdleConnections()
+		server.Close()
+		_ = httpServer.Shutdown()
+		_ = manager.Close(context.Background())
+	})
+	return &testServer{url: "http://" + ln.Addr().String() + "/admin", client: client, manager: manager, session: session, transport: transport}
+}
+
+func (s *testServer) do(t *testing.T, method, path, body string) (int, string) {
+	t.Helper()
+	req, err := http.NewRequest(method, s.url+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	resp, err := s.client.Do(req)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(data)
+}
+
+func TestServer(t *testing.T) {
+	t.Run("Auth", func(t *testing.T) {
+		s := newTestServer(t)
+		for _, header := range []string{"", "Bearer wrong", testToken} {
+			req, _ := http.NewRequest(http.MethodGet, s.url+"/healthz", nil)
+			if header != "" {
+				req.Header.Set("Authorization", header)
+			}
+			resp, err := s.client.Do(req)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusUnauthorized {
+				t.Errorf("Expected 401 for %q, got %d", header, resp.StatusCode)
+			}
+		}
+		if status, _ := s.do(t, http.MethodGet, "/healthz", ""); status != http.StatusOK {
+			t.Errorf("Expected 200, got %d", status)
+		}
+	})
+
+	t.Run("Readiness", func(t *testing.T) {
+		s := newTestServer(t)
+		if status, _ := s.do(t, http.MethodGet, "/readyz", ""); status != http.StatusOK {
+			t.Errorf("Expected 200, got %d", status)
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_ = s.manager.Drain(ctx)
+		if status, _ := s.do(t, http.MethodGet, "/readyz", ""); status != http.StatusServiceUnavailable {
+			t.Errorf("Expected 503 once draining, got %d", status)
+		}
+	})
+
+	t.Run("Sessions", func(t *testing.T) {
+		s := newTestServer(t)
+		s.transport.events <- []byte(`{"type":"session.created","session":{"voice":"alloy"}}`)
+		s.transport.events <- []byte(`{"type":"response.done","response":{"id":"resp_1","status":"completed","usage":{"total_tokens":12,"input_tokens":5,"output_tokens":7}}}`)
+		deadline := time.Now().Add(time.Second)
+		for s.session.Session.Usage().TotalTokens == 0 && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+
+		status, body := s.do(t, http.MethodGet, "/sessions", "")
+		var infos []SessionInfo
+		if err := json.Unmarshal([]byte(body), &infos); status != http.StatusOK || err != nil {
+			t.Fatalf("Expected a list of sessions, got %d %s", status, body)
+		}
+		if len(infos) != 1 {
+			t.Fatalf("Expected 1 session, got %+v", infos)
+		}
+		info := infos[0]
+		if info.Id != s.session.Id || info.Tenant != "acme" || info.State != "open" || string(info.Config) != `{"voice":"alloy"}` || info.Usage.TotalTokens != 12 {
+			t.Errorf("Expected the session's info, got %+v", info)
+		}
+
+		status, body = s.do(t, http.MethodGet, "/stats", "")
+		if status != http.StatusOK || !strings.Contains(body, `"Active":1`) {
+			t.Errorf("Expected 1 active session, got %d %s", status, body)
+		}
+		if status, _ := s.do(t, http.MethodGet, "/sessions/unknown", ""); status != http.StatusNotFound {
+			t.Errorf("Expected 404, got %d", status)
+		}
+	})
+
+	t.Run("Message", func(t *testing.T) {
+		s := newTestServer(t)
+		if status, body := s.do(t, http.MethodPost, "/sessions/"+s.session.Id+"/messages", `{"role":"system","text":"Wrap up."}`); status != http.StatusAccepted {
+			t.Fatalf("Expected 202, got %d %s", status, body)
+		}
+		var create realtime.ConversationItemCreateEvent
+		if err := json.Unmarshal(<-s.transport.sent, &create); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if create.Item.Role != realtime.RoleSystem || create.Item.Content[0].Text != "Wrap up." {
+			t.Errorf("Expected a system message, got %+v", create.Item)
+		}
+		if status, _ := s.do(t, http.MethodPost, "/sessions/"+s.session.Id+"/messages", `{"role":"tool","text":"x"}`); status != http.StatusBadRequest {
+			t.Errorf("Expected 400, got %d", status)
+		}
+	})
+
+	t.Run("End", func(t *testing.T) {
+		s := newTestServer(t)
+		if status, _ := s.do(t, http.MethodDelete, "/sessions/"+s.session.Id, ""); status != http.StatusNoContent {
+			t.Fatalf("Expected 204, got %d", status)
+		}
+		deadline := time.Now().Add(time.Second)
+		for s.manager.Stats().Active != 0 {
+			if time.Now().After(deadline) {
+				t.Fatal("Timed out waiting for the session to end")
+			}
+			time.Sleep(time.Millisecond)
+		}
+	})
+
+	t.Run("EndFailed", func(t *testing.T) {
+		s := newTestServer(t)
+		s.transport.mu.Lock()
+		s.transport.closeErr = errors.New("hangup failed")
+		s.transport.mu.Unlock()
+		status, body := s.do(t, http.MethodDelete, "/sessions/"+s.session.Id, "")
+		if status != http.StatusInternalServerError || !strings.Contains(body, "hangup failed") {
+			t.Errorf("Expected 500 with the error, got %d %q", status, body)
+		}
+	})
+
+	t.Run("Events", func(t *testing.T) {
+		s := newTestServer(t)
+		req, _ := http.NewRequest(http.MethodGet, s.url+"/sessions/"+s.session.Id+"/events", nil)
+		req.Header.Set("Authorization", "Bearer "+testToken)
+		resp, err := s.client.Do(req)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		defer resp.Body.Close()
+		if resp.Header.Get("Content-Type") != "text/event-stream" {
+			t.Errorf("Expected text/event-stream, got %s", resp.Header.Get("Content-Type"))
+		}
+
+		go func() {
+			// The stream is open once the headers arrived, and the tap with it.
+			_ = s.session.Session.SendText(context.Background(), "Hi")
+			s.transport.events <- []byte(`{"type":"session.created","session":{}}`)
+			_ = s.session.Close(context.Background())
+		}()
+		lines := make(chan string)
+		go func() {
+			defer close(lines)
+			scanner := bufio.NewScanner(resp.Body)
+			for scanner.Scan() {
+				lines <- scanner.Text()
+			}
+		}()
+		var got []string
+		timeout := time.After(5 * time.Second)
+		for done := false; !done; {
+			select {
+			case line, ok := <-lines:
+				if !ok {
+					done = true
+					break
+				}
+				if strings.HasPrefix(line, "event: ") {
+					got = append(got, strings.TrimPrefix(line, "event: "))
+				}
+			case <-timeout:
+				t.Fatal("Timed out reading the event stream")
+			}
+		}
+		want := []string{"client", "client", "server", "end"}
+		if strings.Join(got, " ") != strings.Join(want, " ") {
+			t.Errorf("Expected %v, got %v", want, got)
+		}
+	})
+}
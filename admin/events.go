@@ -0,0 +1,104 @@
+package admin
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/valyala/fasthttp"
+	"gitlab.bcc-hyperdev.org/bcc-hyperdev/realtime"
+)
+
+// tailBuffer is the number of events an event stream holds for a slow
+// client before dropping them.
+const tailBuffer = 256
+
+type tailEvent struct {
+	// direction is client or server.
+	direction string
+	data      []byte
+}
+
+// eventTail is a realtime.Tap queueing the events of a session for an event
+// stream.
+type eventTail struct {
+	events  chan tailEvent
+	dropped atomic.Int64
+}
+
+func newEventTail() *eventTail {
+	return &eventTail{events: make(chan tailEvent, tailBuffer)}
+}
+
+func (t *eventTail) InputAudio(frame []byte)  {}
+func (t *eventTail) OutputAudio(frame []byte) {}
+func (t *eventTail) ClientEvent(event []byte) { t.push("client", event) }
+func (t *eventTail) ServerEvent(event []byte) { t.push("server", event) }
+
+func (t *eventTail) push(direction string, event []byte) {
+	select {
+	case t.events <- tailEvent{direction: direction, data: bytes.Clone(event)}:
+	default:
+		t.dropped.Add(1)
+	}
+}
+
+// handleEvents streams the events of a session as server-sent events named
+// after their direction, client or server. Events dropped for a slow client
+// are reported with a dropped event, and the end of the session with an end
+// event.
+func (s *Server) handleEvents(ctx *fasthttp.RequestCtx, session *realtime.ManagedSession) {
+	tail := newEventTail()
+	remove := session.Session.AddTap(tail)
+	ctx.SetContentType("text/event-stream")
+	ctx.Response.Header.Set(fasthttp.HeaderCacheControl, "no-cache")
+	ctx.SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer remove()
+		heartbeat := time.NewTicker(s.cfg.Heartbeat)
+		defer heartbeat.Stop()
+		// The headers only go out along with the first bytes of the body.
+		w.WriteString(": connected\n\n")
+		if err := w.Flush(); err != nil {
+			return
+		}
+		for {
+			select {
+			case event := <-tail.events:
+				writeEvent(w, tail, event)
+			case <-heartbeat.C:
+				w.WriteString(": heartbeat\n\n")
+			case <-session.Session.Done():
+				for drained := false; !drained; {
+					select {
+					case event := <-tail.events:
+						writeEvent(w, tail, event)
+					default:
+						drained = true
+					}
+				}
+				w.WriteString("event: end\ndata: {}\n\n")
+				_ = w.Flush()
+				return
+			case <-s.closed:
+				return
+			}
+			// A failed flush means the client went away.
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
+	})
+}
+
+func writeEvent(w *bufio.Writer, tail *eventTail, event tailEvent) {
+	if dropped := tail.dropped.Swap(0); dropped > 0 {
+		fmt.Fprintf(w, "event: dropped\ndata: {\"count\":%d}\n\n", dropped)
+	}
+	fmt.Fprintf(w, "event: %s\n", event.direction)
+	for line := range bytes.SplitSeq(event.data, []byte("\n")) {
+		fmt.Fprintf(w, "data: %s\n", line)
+	}
+	w.WriteString("\n")
+}
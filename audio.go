@@ -0,0 +1,65 @@
+package realtime
+
+import (
+	"context"
+	"time"
+)
+
+// Audio exchanged between sources, sinks and transports is raw PCM: 16-bit
+// signed little-endian samples, mono, at 24 kHz (the "audio/pcm" format of the
+// Realtime API).
+const (
+	SampleRate     = 24000
+	Channels       = 1
+	BytesPerSample = 2
+)
+
+// AudioSource produces PCM frames. Read blocks until a frame is available, ctx
+// is done or the source is closed; Close must unblock any pending Read.
+type AudioSource interface {
+	Read(ctx context.Context) ([]byte, error)
+	Close() error
+}
+
+// AudioSink consumes PCM frames. Flush blocks until everything written so far
+// has been played (or persisted) and Close releases the underlying device.
+type AudioSink interface {
+	Write(ctx context.Context, frame []byte) error
+	Flush(ctx context.Context) error
+	Close() error
+}
+
+// InterruptibleSink is implemented by sinks that can stop playback at once,
+// which a session needs to handle barge-in.
+type InterruptibleSink interface {
+	AudioSink
+	// Interrupt discards the audio written but not played yet and returns
+	// its duration.
+	Interrupt(ctx context.Context) (discarded time.Duration, err error)
+}
+
+func AudioDuration(frame []byte) time.Duration {
+	samples := len(frame) / (BytesPerSample * Channels)
+	return time.Duration(samples) * time.Second / SampleRate
+}
+
+// VoiceDetector classifies captured frames for local turn detection.
+// Implementations apply their own hangover so that a short pause does not end
+// the turn.
+type VoiceDetector interface {
+	Detect(frame []byte) bool
+}
+
+// MonitoredSink reports audio as it reaches the speaker, after any queueing.
+// Echo cancellation needs it as its reference.
+type MonitoredSink interface {
+	AudioSink
+	OnPlayback(fn func(frame []byte))
+}
+
+// EchoCanceller removes the played audio picked up by the microphone from
+// captured frames. Reference receives the audio as it is played.
+type EchoCanceller interface {
+	Reference(frame []byte)
+	Cancel(frame []byte) []byte
+}
@@ -0,0 +1,149 @@
+package audio
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultEchoTail     = 100 * time.Millisecond
+	DefaultEchoStepSize = 0.5
+	// maxReferenceLag bounds the playback queued ahead of the microphone;
+	// beyond it the two streams have drifted apart and old audio is dropped.
+	maxReferenceLag = time.Second
+	// doubleTalkHold keeps adaptation frozen after double talk, since the
+	// near-end signal dips below the detector threshold between peaks.
+	doubleTalkHold = 50 * time.Millisecond
+)
+
+type EchoCancellerConfig struct {
+	// Tail is the longest echo path modelled, from the speaker write to the
+	// microphone read including device buffering.
+	Tail time.Duration
+	// StepSize is the NLMS adaptation rate, in (0, 1].
+	StepSize float64
+}
+
+// EchoCanceller removes the far-end signal, as played by the speaker, from
+// the microphone signal with a normalized LMS adaptive filter. Adaptation is
+// frozen during double talk (Geigel detector) so that the user's voice does
+// not make the filter diverge.
+//
+// Reference and Cancel may be called from different goroutines; both streams
+// are aligned by sample count, so Reference must be fed as audio is actually
+// played rather than as it is queued.
+type EchoCanceller struct {
+	stepSize float64
+	maxLag   int
+	holdLen  int
+
+	mu        sync.Mutex
+	reference []float64
+
+	taps    int
+	weights []float64
+	// history holds the last taps far-end samples twice, so that the window
+	// ending at pos is contiguous.
+	history []float64
+	pos     int
+	energy  float64
+	hold    int
+}
+
+func NewEchoCanceller(sampleRate int, cfg *EchoCancellerConfig) (*EchoCanceller, error) {
+	if sampleRate <= 0 {
+		return nil, fmt.Errorf("invalid sample rate %d", sampleRate)
+	}
+	tail, stepSize := DefaultEchoTail, DefaultEchoStepSize
+	if cfg != nil && cfg.Tail > 0 {
+		tail = cfg.Tail
+	}
+	if cfg != nil && cfg.StepSize > 0 {
+		stepSize = min(cfg.StepSize, 1)
+	}
+	taps := int(tail * time.Duration(sampleRate) / time.Second)
+	if taps < 1 {
+		return nil, fmt.Errorf("echo tail %s is too short", tail)
+	}
+	return &EchoCanceller{
+		stepSize: stepSize,
+		maxLag:   int(maxReferenceLag * time.Duration(sampleRate) / time.Second),
+		holdLen:  int(doubleTalkHold * time.Duration(sampleRate) / time.Second),
+		taps:     taps,
+		weights:  make([]float64, taps),
+		history:  make([]float64, 2*taps),
+	}, nil
+}
+
+// Reference records played PCM16 audio.
+func (e *EchoCanceller) Reference(frame []byte) {
+	samples := Samples(frame)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, s := range samples {
+		e.reference = append(e.reference, float64(s))
+	}
+	if over := len(e.reference) - e.maxLag; over > 0 {
+		e.reference = e.reference[over:]
+	}
+}
+
+// Cancel returns frame, a PCM16 microphone frame, with the echo removed.
+func (e *EchoCanceller) Cancel(frame []byte) []byte {
+	samples := Samples(frame)
+	e.mu.Lock()
+	n := min(len(samples), len(e.reference))
+	far := make([]float64, len(samples))
+	copy(far, e.reference[:n])
+	e.reference = e.reference[n:]
+	e.mu.Unlock()
+
+	out := make([]int16, len(samples))
+	for i, s := range samples {
+		v := e.process(far[i], float64(s))
+		out[i] = clamp16(int32(max(min(v, math.MaxInt16), math.MinInt16)))
+	}
+	return PCM(out)
+}
+
+func (e *EchoCanceller) process(far, near float64) float64 {
+	old := e.history[e.pos]
+	e.energy += far*far - old*old
+	if e.energy < 0 {
+		e.energy = 0
+	}
+	e.history[e.pos] = far
+	e.history[e.pos+e.taps] = far
+	// x[0] is the newest sample.
+	x := e.history[e.pos : e.pos+e.taps]
+	e.pos--
+	if e.pos < 0 {
+		e.pos = e.taps - 1
+	}
+
+	var estimate, peak float64
+	for k, w := range e.weights {
+		estimate += w * x[k]
+	}
+	for _, v := range x {
+		peak = max(peak, math.Abs(v))
+	}
+	residual := near - estimate
+	// Geigel: the near end is louder than any echo of the recent far end
+	// could be, assuming at least 6dB of loss on the echo path, so someone
+	// is talking.
+	if math.Abs(near) > 0.5*peak {
+		e.hold = e.holdLen
+	}
+	if e.hold > 0 || e.energy < 1 {
+		e.hold--
+		return residual
+	}
+	g := e.stepSize * residual / (e.energy + 1e-3)
+	for k := range e.weights {
+		e.weights[k] += g * x[k]
+	}
+	return residual
+}
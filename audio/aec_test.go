@@ -0,0 +1,111 @@
+package audio
+
+import (
+	"math"
+	"math/rand/v2"
+	"testing"
+	"time"
+)
+
+// echoPath delays and attenuates the far end like a speaker and a room.
+var echoPath = map[int]float64{40: 0.25, 55: -0.1, 90: 0.05}
+
+func energy(samples []float64) float64 {
+	var sum float64
+	for _, s := range samples {
+		sum += s * s
+	}
+	return sum
+}
+
+func TestEchoCanceller(t *testing.T) {
+	const rate = 8000
+	const frameSize = rate / 50
+	// simulate plays far through the echo path with near added at the
+	// microphone and returns what the canceller let through.
+	simulate := func(t *testing.T, far, near []float64) []float64 {
+		e, err := NewEchoCanceller(rate, &EchoCancellerConfig{Tail: 16 * time.Millisecond})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		mic := make([]float64, len(far))
+		for i := range mic {
+			for delay, gain := range echoPath {
+				if i >= delay {
+					mic[i] += gain * far[i-delay]
+				}
+			}
+			mic[i] += near[i]
+		}
+		var out []float64
+		for start := 0; start+frameSize <= len(far); start += frameSize {
+			ref := make([]int16, frameSize)
+			in := make([]int16, frameSize)
+			for i := range frameSize {
+				ref[i] = int16(far[start+i])
+				in[i] = int16(mic[start+i])
+			}
+			e.Reference(PCM(ref))
+			for _, s := range Samples(e.Cancel(PCM(in))) {
+				out = append(out, float64(s))
+			}
+		}
+		return out
+	}
+	noise := func(n int, amplitude float64) []float64 {
+		s := make([]float64, n)
+		for i := range s {
+			s[i] = amplitude * (rand.Float64()*2 - 1)
+		}
+		return s
+	}
+
+	t.Run("CancelsEcho", func(t *testing.T) {
+		n := 4 * rate
+		far := noise(n, 10000)
+		out := simulate(t, far, make([]float64, n))
+		echo := make([]float64, n)
+		for i := range echo {
+			for delay, gain := range echoPath {
+				if i >= delay {
+					echo[i] += gain * far[i-delay]
+				}
+			}
+		}
+		// Echo return loss enhancement over the last second.
+		erle := 10 * math.Log10(energy(echo[n-rate:])/energy(out[n-rate:]))
+		if erle < 20 {
+			t.Errorf("Expected at least 20dB of echo reduction, got %.1fdB", erle)
+		}
+	})
+
+	t.Run("KeepsNearEnd", func(t *testing.T) {
+		n := 4 * rate
+		far := noise(n, 10000)
+		near := make([]float64, n)
+		// The user speaks over the last second, after convergence.
+		for i := n - rate; i < n; i++ {
+			near[i] = 12000 * math.Sin(2*math.Pi*300*float64(i)/rate)
+		}
+		out := simulate(t, far, near)
+		diff := make([]float64, rate)
+		for i := range diff {
+			diff[i] = out[n-rate+i] - near[n-rate+i]
+		}
+		snr := 10 * math.Log10(energy(near[n-rate:])/energy(diff))
+		if snr < 15 {
+			t.Errorf("Expected the near end to survive within 15dB, got %.1fdB", snr)
+		}
+	})
+
+	t.Run("PassesThroughWithoutReference", func(t *testing.T) {
+		e, _ := NewEchoCanceller(rate, nil)
+		in := []int16{100, -200, 300}
+		out := Samples(e.Cancel(PCM(in)))
+		for i := range in {
+			if out[i] != in[i] {
+				t.Fatalf("Expected %v, got %v", in, out)
+			}
+		}
+	})
+}
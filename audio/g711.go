@@ -0,0 +1,113 @@
+package audio
+
+const (
+	ulawBias = 0x84
+	ulawClip = 32635
+)
+
+// EncodeUlaw compresses samples to G.711 µ-law.
+func EncodeUlaw(samples []int16) []byte {
+	out := make([]byte, len(samples))
+	for i, s := range samples {
+		out[i] = linearToUlaw(s)
+	}
+	return out
+}
+
+// DecodeUlaw expands G.711 µ-law bytes to samples.
+func DecodeUlaw(data []byte) []int16 {
+	out := make([]int16, len(data))
+	for i, b := range data {
+		out[i] = ulawToLinear(b)
+	}
+	return out
+}
+
+func linearToUlaw(sample int16) byte {
+	s := int32(sample)
+	sign := int32(0)
+	if s < 0 {
+		s = -s
+		sign = 0x80
+	}
+	if s > ulawClip {
+		s = ulawClip
+	}
+	s += ulawBias
+	exponent := int32(7)
+	for mask := int32(0x4000); s&mask == 0 && exponent > 0; mask >>= 1 {
+		exponent--
+	}
+	mantissa := (s >> (exponent + 3)) & 0x0f
+	return byte(^(sign | exponent<<4 | mantissa))
+}
+
+func ulawToLinear(b byte) int16 {
+	u := int32(^b)
+	sign := u & 0x80
+	exponent := (u >> 4) & 0x07
+	mantissa := u & 0x0f
+	s := ((mantissa << 3) + ulawBias) << exponent
+	s -= ulawBias
+	if sign != 0 {
+		return int16(-s)
+	}
+	return int16(s)
+}
+
+// EncodeAlaw compresses samples to G.711 A-law.
+func EncodeAlaw(samples []int16) []byte {
+	out := make([]byte, len(samples))
+	for i, s := range samples {
+		out[i] = linearToAlaw(s)
+	}
+	return out
+}
+
+// DecodeAlaw expands G.711 A-law bytes to samples.
+func DecodeAlaw(data []byte) []int16 {
+	out := make([]int16, len(data))
+	for i, b := range data {
+		out[i] = alawToLinear(b)
+	}
+	return out
+}
+
+func linearToAlaw(sample int16) byte {
+	s := int32(sample) >> 3
+	sign := byte(0x80)
+	if s < 0 {
+		s = -s - 1
+		sign = 0
+	}
+	if s > 0xfff {
+		s = 0xfff
+	}
+	var b byte
+	if s < 32 {
+		b = byte(s >> 1)
+	} else {
+		exponent := byte(1)
+		for v := s >> 5; v > 1; v >>= 1 {
+			exponent++
+		}
+		b = exponent<<4 | byte((s>>exponent)&0x0f)
+	}
+	return (b | sign) ^ 0x55
+}
+
+func alawToLinear(b byte) int16 {
+	b ^= 0x55
+	exponent := int32(b>>4) & 0x07
+	mantissa := int32(b) & 0x0f
+	var s int32
+	if exponent == 0 {
+		s = mantissa<<4 + 8
+	} else {
+		s = (mantissa<<4 + 0x108) << (exponent - 1)
+	}
+	if b&0x80 == 0 {
+		return int16(-s)
+	}
+	return int16(s)
+}
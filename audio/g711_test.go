@@ -0,0 +1,68 @@
+package audio
+
+import "testing"
+
+func TestG711(t *testing.T) {
+	codecs := map[string]struct {
+		encode func([]int16) []byte
+		decode func([]byte) []int16
+	}{
+		"Ulaw": {EncodeUlaw, DecodeUlaw},
+		"Alaw": {EncodeAlaw, DecodeAlaw},
+	}
+	for name, codec := range codecs {
+		t.Run(name, func(t *testing.T) {
+			for _, s := range []int16{0, 1, -1, 100, -100, 1000, -1000, 12345, -12345, 32767, -32768} {
+				got := codec.decode(codec.encode([]int16{s}))[0]
+				// G.711 keeps roughly 13 bits of precision.
+				tolerance := int32(s)/16 + 16
+				if tolerance < 0 {
+					tolerance = -tolerance
+				}
+				if diff := int32(got) - int32(s); diff > tolerance || diff < -tolerance {
+					t.Errorf("Expected %d to round-trip within %d, got %d", s, tolerance, got)
+				}
+			}
+		})
+	}
+
+	t.Run("KnownValues", func(t *testing.T) {
+		if b := EncodeUlaw([]int16{0})[0]; b != 0xff {
+			t.Errorf("Expected µ-law silence 0xff, got %#x", b)
+		}
+		if b := EncodeAlaw([]int16{0})[0]; b != 0xd5 {
+			t.Errorf("Expected A-law silence 0xd5, got %#x", b)
+		}
+	})
+}
+
+func TestResampler(t *testing.T) {
+	t.Run("FrameSizes", func(t *testing.T) {
+		down, _ := NewResampler(24000, 8000)
+		up, _ := NewResampler(8000, 24000)
+		total := 0
+		for range 10 {
+			n := len(down.Process(make([]int16, 480)))
+			if n != 160 {
+				t.Errorf("Expected 160 samples, got %d", n)
+			}
+			total += len(up.Process(make([]int16, 160)))
+		}
+		if total < 4790 || total > 4800 {
+			t.Errorf("Expected about 4800 samples, got %d", total)
+		}
+	})
+
+	t.Run("Continuity", func(t *testing.T) {
+		up, _ := NewResampler(8000, 24000)
+		var out []int16
+		for i := range 4 {
+			out = append(out, up.Process([]int16{int16(i * 300), int16(i*300 + 100), int16(i*300 + 200)})...)
+		}
+		for i := 1; i < len(out); i++ {
+			if d := out[i] - out[i-1]; d < 0 || d > 40 {
+				t.Fatalf("Expected a smooth ramp, got %v", out)
+			}
+		}
+	})
+}
@@ -0,0 +1,253 @@
+package portaudio
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	pa "github.com/gordonklaus/portaudio"
+	"gitlab.bcc-hyperdev.org/bcc-hyperdev/realtime"
+	"gitlab.bcc-hyperdev.org/bcc-hyperdev/realtime/audio"
+)
+
+// FrameSize is 20ms of audio at the session sample rate.
+const FrameSize = realtime.SampleRate / 50
+
+var ErrClosed = errors.New("audio device closed")
+
+// MicSource captures the default input device. PortAudio initialization is
+// reference counted, so sources and sinks can be opened independently.
+type MicSource struct {
+	mu     sync.Mutex
+	stream *pa.Stream
+	buf    []int16
+	closed chan struct{}
+	once   sync.Once
+}
+
+var _ realtime.AudioSource = (*MicSource)(nil)
+
+func NewMicSource() (m *MicSource, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("failed to open microphone: %w", err)
+		}
+	}()
+	if err := pa.Initialize(); err != nil {
+		return nil, err
+	}
+	m = &MicSource{
+		buf:    make([]int16, FrameSize),
+		closed: make(chan struct{}),
+	}
+	m.stream, err = pa.OpenDefaultStream(realtime.Channels, 0, realtime.SampleRate, FrameSize, m.buf)
+	if err != nil {
+		_ = pa.Terminate()
+		return nil, err
+	}
+	if err := m.stream.Start(); err != nil {
+		_ = m.stream.Close()
+		_ = pa.Terminate()
+		return nil, err
+	}
+	return m, nil
+}
+
+// Read blocks for at most one frame, so Close never waits longer than 20ms.
+func (m *MicSource) Read(ctx context.Context) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	select {
+	case <-m.closed:
+		return nil, ErrClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+	}
+	if err := m.stream.Read(); err != nil {
+		return nil, fmt.Errorf("failed to read microphone: %w", err)
+	}
+	return audio.PCM(m.buf), nil
+}
+
+func (m *MicSource) Close() (err error) {
+	m.once.Do(func() {
+		close(m.closed)
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		err = errors.Join(m.stream.Stop(), m.stream.Close(), pa.Terminate())
+	})
+	return err
+}
+
+// SpeakerSink plays frames on the default output device from a background
+// goroutine so that Write does not block on the device.
+type SpeakerSink struct {
+	stream *pa.Stream
+	buf    []int16
+	queue  chan any
+	closed chan struct{}
+	mu     sync.RWMutex
+	wg     sync.WaitGroup
+	once   sync.Once
+	// onPlayback is set by OnPlayback and called from the play goroutine.
+	onPlayback atomic.Pointer[func(frame []byte)]
+}
+
+var (
+	_ realtime.InterruptibleSink = (*SpeakerSink)(nil)
+	_ realtime.MonitoredSink     = (*SpeakerSink)(nil)
+)
+
+func NewSpeakerSink() (s *SpeakerSink, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("failed to open speaker: %w", err)
+		}
+	}()
+	if err := pa.Initialize(); err != nil {
+		return nil, err
+	}
+	s = &SpeakerSink{
+		buf:    make([]int16, FrameSize),
+		queue:  make(chan any, 256),
+		closed: make(chan struct{}),
+	}
+	s.stream, err = pa.OpenDefaultStream(0, realtime.Channels, realtime.SampleRate, FrameSize, s.buf)
+	if err != nil {
+		_ = pa.Terminate()
+		return nil, err
+	}
+	if err := s.stream.Start(); err != nil {
+		_ = s.stream.Close()
+		_ = pa.Terminate()
+		return nil, err
+	}
+	s.wg.Add(1)
+	go s.play()
+	return s, nil
+}
+
+func (s *SpeakerSink) Write(ctx context.Context, frame []byte) error {
+	return s.enqueue(ctx, audio.Samples(frame))
+}
+
+// Flush waits until every frame written before the call has been played.
+func (s *SpeakerSink) Flush(ctx context.Context) error {
+	played := make(chan struct{})
+	if err := s.enqueue(ctx, played); err != nil {
+		return err
+	}
+	select {
+	case <-played:
+		return nil
+	case <-s.closed:
+		return ErrClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Interrupt drops the queued frames. Audio already handed to the device, at
+// most a frame or two, still plays.
+func (s *SpeakerSink) Interrupt(ctx context.Context) (time.Duration, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	select {
+	case <-s.closed:
+		return 0, ErrClosed
+	default:
+	}
+	var discarded int
+	for {
+		select {
+		case item := <-s.queue:
+			switch v := item.(type) {
+			case chan struct{}:
+				close(v)
+			case []int16:
+				discarded += len(v)
+			}
+		default:
+			return time.Duration(discarded) * time.Second / realtime.SampleRate, nil
+		}
+	}
+}
+
+// OnPlayback registers fn to receive every frame once the device accepted
+// it, padding included. fn runs on the playback goroutine and must not block.
+func (s *SpeakerSink) OnPlayback(fn func(frame []byte)) {
+	s.onPlayback.Store(&fn)
+}
+
+func (s *SpeakerSink) Close() (err error) {
+	s.once.Do(func() {
+		close(s.closed)
+		s.mu.Lock()
+		close(s.queue)
+		s.mu.Unlock()
+		s.wg.Wait()
+		err = errors.Join(s.stream.Stop(), s.stream.Close(), pa.Terminate())
+	})
+	return err
+}
+
+func (s *SpeakerSink) enqueue(ctx context.Context, item any) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	select {
+	case <-s.closed:
+		return ErrClosed
+	default:
+	}
+	select {
+	case s.queue <- item:
+		return nil
+	case <-s.closed:
+		return ErrClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *SpeakerSink) play() {
+	defer s.wg.Done()
+	var pending []int16
+	for item := range s.queue {
+		switch v := item.(type) {
+		case chan struct{}:
+			if len(pending) > 0 {
+				s.writeFrame(pending)
+				pending = nil
+			}
+			close(v)
+		case []int16:
+			pending = append(pending, v...)
+			for len(pending) >= FrameSize {
+				s.writeFrame(pending[:FrameSize])
+				pending = pending[FrameSize:]
+			}
+		}
+	}
+}
+
+// writeFrame pads short frames with silence; the stream only accepts whole
+// buffers. Frames still queued when the sink is closed are dropped.
+func (s *SpeakerSink) writeFrame(samples []int16) {
+	select {
+	case <-s.closed:
+		return
+	default:
+	}
+	n := copy(s.buf, samples)
+	clear(s.buf[n:])
+	if err := s.stream.Write(); err != nil {
+		return
+	}
+	if fn := s.onPlayback.Load(); fn != nil {
+		(*fn)(audio.PCM(s.buf))
+	}
+}
@@ -0,0 +1,76 @@
+package audio
+
+import "fmt"
+
+// Resampler converts a mono stream between sample rates using linear
+// interpolation. It keeps state between calls so consecutive frames join
+// without discontinuities; use one Resampler per stream.
+type Resampler struct {
+	from, to int
+	// position of the next output sample, in input samples relative to the
+	// first sample of the next Process call (may be negative: -1 is last).
+	pos  float64
+	last int16
+	// averaging window used to low-pass before decimation.
+	window []int16
+}
+
+func NewResampler(from, to int) (*Resampler, error) {
+	if from <= 0 || to <= 0 {
+		return nil, fmt.Errorf("invalid sample rates %d -> %d", from, to)
+	}
+	return &Resampler{from: from, to: to}, nil
+}
+
+func (r *Resampler) Process(in []int16) []int16 {
+	if r.from == r.to {
+		out := make([]int16, len(in))
+		copy(out, in)
+		return out
+	}
+	if len(in) == 0 {
+		return nil
+	}
+	if r.to < r.from {
+		in = r.lowPass(in)
+	}
+	step := float64(r.from) / float64(r.to)
+	out := make([]int16, 0, int(float64(len(in))/step)+1)
+	for r.pos < float64(len(in)-1) {
+		i := int(r.pos)
+		frac := r.pos - float64(i)
+		var a, b int16
+		if r.pos < 0 {
+			a, b, frac = r.last, in[0], r.pos+1
+		} else {
+			a, b = in[i], in[i+1]
+		}
+		out = append(out, int16(float64(a)+(float64(b)-float64(a))*frac))
+		r.pos += step
+	}
+	r.pos -= float64(len(in))
+	r.last = in[len(in)-1]
+	return out
+}
+
+// lowPass applies a moving average over the decimation ratio, which is crude
+// but enough to keep speech intelligible when downsampling to telephony rates.
+func (r *Resampler) lowPass(in []int16) []int16 {
+	n := r.from / r.to
+	if n < 2 {
+		return in
+	}
+	out := make([]int16, len(in))
+	for i, s := range in {
+		r.window = append(r.window, s)
+		if len(r.window) > n {
+			r.window = r.window[1:]
+		}
+		var sum int32
+		for _, w := range r.window {
+			sum += int32(w)
+		}
+		out[i] = int16(sum / int32(len(r.window)))
+	}
+	return out
+}
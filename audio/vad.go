@@ -0,0 +1,139 @@
+package audio
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+const (
+	DefaultVADThreshold = 12
+	DefaultVADMinLevel  = -50
+	DefaultVADOnset     = 60 * time.Millisecond
+	DefaultVADHangover  = 600 * time.Millisecond
+	// DefaultVADMaxZeroCrossingRate rejects hiss and other broadband noise,
+	// which crosses zero far more often than voiced speech.
+	DefaultVADMaxZeroCrossingRate = 0.35
+)
+
+type VADConfig struct {
+	// Threshold is how far above the noise floor, in dB, a frame must be to
+	// count as speech.
+	Threshold float64
+	// MinLevel is the level in dBFS below which a frame is never speech.
+	MinLevel float64
+	// Onset is how long speech must last before an utterance starts.
+	Onset time.Duration
+	// Hangover keeps an utterance going through pauses shorter than this.
+	Hangover time.Duration
+	// MaxZeroCrossingRate is the share of samples changing sign above which
+	// a frame cannot start an utterance.
+	MaxZeroCrossingRate float64
+}
+
+// VAD is an energy based voice activity detector with an adaptive noise
+// floor and a zero-crossing check. It expects PCM16 frames from one stream.
+type VAD struct {
+	cfg        VADConfig
+	sampleRate int
+
+	noise    float64
+	speaking bool
+	above    time.Duration
+	below    time.Duration
+}
+
+func NewVAD(sampleRate int, cfg *VADConfig) (*VAD, error) {
+	if sampleRate <= 0 {
+		return nil, fmt.Errorf("invalid sample rate %d", sampleRate)
+	}
+	v := &VAD{sampleRate: sampleRate}
+	if cfg != nil {
+		v.cfg = *cfg
+	}
+	if v.cfg.Threshold <= 0 {
+		v.cfg.Threshold = DefaultVADThreshold
+	}
+	if v.cfg.MinLevel == 0 {
+		v.cfg.MinLevel = DefaultVADMinLevel
+	}
+	if v.cfg.Onset <= 0 {
+		v.cfg.Onset = DefaultVADOnset
+	}
+	if v.cfg.Hangover <= 0 {
+		v.cfg.Hangover = DefaultVADHangover
+	}
+	if v.cfg.MaxZeroCrossingRate <= 0 {
+		v.cfg.MaxZeroCrossingRate = DefaultVADMaxZeroCrossingRate
+	}
+	v.noise = v.cfg.MinLevel
+	return v, nil
+}
+
+// Detect reports whether frame belongs to an utterance.
+func (v *VAD) Detect(frame []byte) bool {
+	samples := Samples(frame)
+	if len(samples) == 0 {
+		return v.speaking
+	}
+	level := Level(samples)
+	speech := level > v.cfg.MinLevel && level > v.noise+v.cfg.Threshold
+	if speech && !v.speaking && zeroCrossingRate(samples) > v.cfg.MaxZeroCrossingRate {
+		speech = false
+	}
+
+	duration := time.Duration(len(samples)) * time.Second / time.Duration(v.sampleRate)
+	if speech {
+		v.above += duration
+		v.below = 0
+	} else {
+		v.below += duration
+		v.above = 0
+	}
+	switch {
+	case !v.speaking && v.above >= v.cfg.Onset:
+		v.speaking = true
+	case v.speaking && v.below >= v.cfg.Hangover:
+		v.speaking = false
+	}
+
+	// Follow the noise floor down quickly and up slowly, and only outside
+	// of speech so that the voice does not raise it.
+	if !speech && !v.speaking {
+		if level < v.noise {
+			v.noise += (level - v.noise) * 0.5
+		} else {
+			v.noise += (level - v.noise) * 0.02
+		}
+	}
+	return v.speaking
+}
+
+// Level is the RMS level of samples in dBFS, -100 for digital silence.
+func Level(samples []int16) float64 {
+	if len(samples) == 0 {
+		return -100
+	}
+	var sum float64
+	for _, s := range samples {
+		sum += float64(s) * float64(s)
+	}
+	rms := math.Sqrt(sum / float64(len(samples)))
+	if rms < 1 {
+		return -100
+	}
+	return 20 * math.Log10(rms/32768)
+}
+
+func zeroCrossingRate(samples []int16) float64 {
+	if len(samples) < 2 {
+		return 0
+	}
+	crossings := 0
+	for i := 1; i < len(samples); i++ {
+		if (samples[i-1] < 0) != (samples[i] < 0) {
+			crossings++
+		}
+	}
+	return float64(crossings) / float64(len(samples)-1)
+}
@@ -0,0 +1,71 @@
+package audio
+
+import (
+	"math"
+	"math/rand/v2"
+	"testing"
+)
+
+const testRate = 24000
+
+// frame is 20ms of a tone at amplitude plus white noise at noise.
+func frame(freq, amplitude, noise float64, offset int) []byte {
+	samples := make([]int16, testRate/50)
+	for i := range samples {
+		t := float64(offset+i) / testRate
+		v := amplitude*math.Sin(2*math.Pi*freq*t) + noise*(rand.Float64()*2-1)
+		samples[i] = int16(v)
+	}
+	return PCM(samples)
+}
+
+func TestVAD(t *testing.T) {
+	run := func(v *VAD, n int, freq, amplitude, noise float64) (speaking []bool) {
+		for i := range n {
+			speaking = append(speaking, v.Detect(frame(freq, amplitude, noise, i*testRate/50)))
+		}
+		return speaking
+	}
+
+	t.Run("SpeechOverNoise", func(t *testing.T) {
+		v, err := NewVAD(testRate, nil)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if got := run(v, 50, 0, 0, 30); got[len(got)-1] {
+			t.Errorf("Expected background noise not to be speech")
+		}
+		got := run(v, 10, 200, 8000, 30)
+		if got[0] {
+			t.Errorf("Expected onset to take more than one frame")
+		}
+		if !got[len(got)-1] {
+			t.Errorf("Expected a loud tone to be speech")
+		}
+		// A pause shorter than the hangover keeps the utterance going.
+		if got := run(v, 10, 0, 0, 30); !got[len(got)-1] {
+			t.Errorf("Expected a 200ms pause to be bridged")
+		}
+		if got := run(v, 30, 0, 0, 30); got[len(got)-1] {
+			t.Errorf("Expected the utterance to end after the hangover")
+		}
+	})
+
+	t.Run("RejectsHiss", func(t *testing.T) {
+		v, _ := NewVAD(testRate, nil)
+		run(v, 50, 0, 0, 30)
+		if got := run(v, 20, 0, 0, 6000); got[len(got)-1] {
+			t.Errorf("Expected loud white noise not to start an utterance")
+		}
+	})
+
+	t.Run("Level", func(t *testing.T) {
+		if got := Level(make([]int16, 10)); got != -100 {
+			t.Errorf("Expected -100 for silence, got %f", got)
+		}
+		full := []int16{32767, -32767}
+		if got := Level(full); math.Abs(got) > 0.01 {
+			t.Errorf("Expected 0 dBFS, got %f", got)
+		}
+	})
+}
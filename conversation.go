@@ -0,0 +1,359 @@
+package realtime
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"gitlab.bcc-hyperdev.org/bcc-hyperdev/realtime/shared"
+)
+
+const (
+	ItemTypeMessage            = "message"
+	ItemTypeFunctionCall       = "function_call"
+	ItemTypeFunctionCallOutput = "function_call_output"
+	// ItemTypeItemReference refers to an item of the conversation by Id,
+	// e.g. in the input of a response.
+	ItemTypeItemReference = "item_reference"
+
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+	RoleSystem    = "system"
+
+	ContentTypeInputText   = "input_text"
+	ContentTypeInputAudio  = "input_audio"
+	ContentTypeOutputText  = "output_text"
+	ContentTypeOutputAudio = "output_audio"
+)
+
+type ContentPart struct {
+	Type       string `json:"type"`
+	Text       string `json:"text,omitempty"`
+	Audio      string `json:"audio,omitempty"`
+	Transcript string `json:"transcript,omitempty"`
+	// Truncated is set once the server confirmed a truncation of the audio
+	// to AudioEndMs; the transcript is dropped along with it.
+	Truncated  bool `json:"-"`
+	AudioEndMs int  `json:"-"`
+}
+
+// Item is a conversation item as the server represents it.
+type Item struct {
+	Id        string        `json:"id,omitempty"`
+	Type      string        `json:"type"`
+	Status    string        `json:"status,omitempty"`
+	Role      string        `json:"role,omitempty"`
+	Content   []ContentPart `json:"content,omitempty"`
+	CallId    string        `json:"call_id,omitempty"`
+	Name      string        `json:"name,omitempty"`
+	Arguments string        `json:"arguments,omitempty"`
+	Output    string        `json:"output,omitempty"`
+}
+
+func (i Item) clone() Item {
+	i.Content = slices.Clone(i.Content)
+	return i
+}
+
+// part returns the content part at index, growing the content with parts of
+// type typ when deltas arrive before the part was announced.
+func (i *Item) part(index int, typ string) *ContentPart {
+	for len(i.Content) <= index {
+		i.Content = append(i.Content, ContentPart{Type: typ})
+	}
+	return &i.Content[index]
+}
+
+type ChangeType string
+
+const (
+	ChangeAdded     ChangeType = "added"
+	ChangeUpdated   ChangeType = "updated"
+	ChangeDeleted   ChangeType = "deleted"
+	ChangeTruncated ChangeType = "truncated"
+)
+
+// ConversationChange describes a change to the conversation. Item is a
+// snapshot taken after the change, or before it for deletions.
+type ConversationChange struct {
+	Type  ChangeType
+	Index int
+	Item  Item
+}
+
+type ChangeHandler func(change ConversationChange)
+
+type itemEvent struct {
+	ResponseId     string `json:"response_id"`
+	PreviousItemId string `json:"previous_item_id"`
+	Item           Item   `json:"item"`
+}
+
+type itemRefEvent struct {
+	ResponseId   string `json:"response_id"`
+	ItemId       string `json:"item_id"`
+	ContentIndex int    `json:"content_index"`
+	AudioEndMs   int    `json:"audio_end_ms"`
+	Delta        string `json:"delta"`
+	Transcript   string `json:"transcript"`
+	Arguments    string `json:"arguments"`
+}
+
+// Conversation mirrors the server-side conversation from the events of a
+// session. Items only change when the server reports it, so CreateItem,
+// DeleteItem and TruncateItem take effect once they are confirmed.
+type Conversation struct {
+	logger  *shared.Logger
+	session *Session
+	remove  func()
+
+	mu       sync.Mutex
+	items    []Item
+	handlers handlers[ChangeHandler]
+	// outOfBand holds the out-of-band responses in flight, whose output
+	// stays out of the conversation.
+	outOfBand *outOfBandResponses
+}
+
+// NewConversation tracks the conversation of session. session may be nil to
+// feed events through Handle, e.g. from a recording.
+func NewConversation(logger *shared.Logger, session *Session) *Conversation {
+	c := &Conversation{logger: logger, session: session, outOfBand: newOutOfBandResponses()}
+	if session != nil {
+		c.remove = session.OnEvent(c.Handle)
+	}
+	return c
+}
+
+// Close stops tracking the session.
+func (c *Conversation) Close() {
+	if c.remove != nil {
+		c.remove()
+	}
+}
+
+// Items returns a snapshot of the conversation in order.
+func (c *Conversation) Items() []Item {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	items := make([]Item, len(c.items))
+	for i, item := range c.items {
+		items[i] = item.clone()
+	}
+	return items
+}
+
+func (c *Conversation) Item(id string) (Item, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if i := c.index(id); i >= 0 {
+		return c.items[i].clone(), true
+	}
+	return Item{}, false
+}
+
+// OnChange registers a handler for conversation changes. Handlers run on the
+// session's event loop and must not block.
+func (c *Conversation) OnChange(handler ChangeHandler) (remove func()) {
+	return c.handlers.add(handler)
+}
+
+func (c *Conversation) CreateItem(ctx context.Context, previousItemId string, item Item) error {
+	return c.send(ctx, NewConversationItemCreateEvent(previousItemId, item))
+}
+
+func (c *Conversation) DeleteItem(ctx context.Context, itemId string) error {
+	return c.send(ctx, NewConversationItemDeleteEvent(itemId))
+}
+
+// TruncateItem drops the audio of an assistant item past audioEnd, typically
+// because the user interrupted playback.
+func (c *Conversation) TruncateItem(ctx context.Context, itemId string, contentIndex int, audioEnd time.Duration) error {
+	return c.send(ctx, NewConversationItemTruncateEvent(itemId, contentIndex, audioEnd))
+}
+
+func (c *Conversation) send(ctx context.Context, event any) error {
+	if c.session == nil {
+		return fmt.Errorf("conversation is not attached to a session")
+	}
+	return c.session.Send(ctx, event)
+}
+
+// Handle applies a server event to the conversation.
+func (c *Conversation) Handle(ctx context.Context, event Event) {
+	var changes []ConversationChange
+	var err error
+	switch event.Type {
+	case EventTypeResponseCreated, EventTypeResponseDone:
+		err = c.outOfBand.track(event)
+	case EventTypeConversationItemAdded, EventTypeConversationItemCreated, EventTypeResponseOutputItemAdded:
+		var payload itemEvent
+		if err = event.Decode(&payload); err == nil && !c.outOfBand.contains(payload.ResponseId) {
+			changes = c.insert(event.Type != EventTypeResponseOutputItemAdded, payload.PreviousItemId, payload.Item)
+		}
+	case EventTypeConversationItemDone, EventTypeConversationItemRetrieved, EventTypeResponseOutputItemDone:
+		var payload itemEvent
+		if err = event.Decode(&payload); err == nil && !c.outOfBand.contains(payload.ResponseId) {
+			changes = c.replace(payload.Item)
+		}
+	case EventTypeConversationItemDeleted:
+		var payload itemRefEvent
+		if err = event.Decode(&payload); err == nil {
+			changes = c.delete(payload.ItemId)
+		}
+	case EventTypeConversationItemTruncated:
+		var payload itemRefEvent
+		if err = event.Decode(&payload); err == nil {
+			changes = c.update(payload.ItemId, ChangeTruncated, func(item *Item) {
+				part := item.part(payload.ContentIndex, ContentTypeOutputAudio)
+				part.Truncated, part.AudioEndMs, part.Transcript = true, payload.AudioEndMs, ""
+			})
+		}
+	case EventTypeInputTranscriptionDelta, EventTypeInputTranscriptionCompleted:
+		var payload itemRefEvent
+		if err = event.Decode(&payload); err == nil {
+			changes = c.update(payload.ItemId, ChangeUpdated, func(item *Item) {
+				part := item.part(payload.ContentIndex, ContentTypeInputAudio)
+				if event.Type == EventTypeInputTranscriptionCompleted {
+					part.Transcript = payload.Transcript
+				} else {
+					part.Transcript += payload.Delta
+				}
+			})
+		}
+	case EventTypeResponseOutputAudioTranscriptDelta:
+		var payload itemRefEvent
+		if err = event.Decode(&payload); err == nil {
+			changes = c.update(payload.ItemId, ChangeUpdated, func(item *Item) {
+				item.part(payload.ContentIndex, ContentTypeOutputAudio).Transcript += payload.Delta
+			})
+		}
+	case EventTypeResponseOutputTextDelta:
+		var payload itemRefEvent
+		if err = event.Decode(&payload); err == nil {
+			changes = c.update(payload.ItemId, ChangeUpdated, func(item *Item) {
+				item.part(payload.ContentIndex, ContentTypeOutputText).Text += payload.Delta
+			})
+		}
+	case EventTypeResponseFunctionArgumentsDelta, EventTypeResponseFunctionArgumentsDone:
+		var payload itemRefEvent
+		if err = event.Decode(&payload); err == nil {
+			changes = c.update(payload.ItemId, ChangeUpdated, func(item *Item) {
+				if event.Type == EventTypeResponseFunctionArgumentsDone {
+					item.Arguments = payload.Arguments
+				} else {
+					item.Arguments += payload.Delta
+				}
+			})
+		}
+	}
+	if err != nil {
+		c.logger.NoCtxWarnf("failed to track conversation: %v", err)
+		return
+	}
+	c.notify(changes)
+}
+
+// insert places a new item after its predecessor. Items announced by
+// conversation.item.added without a predecessor go first; output items are
+// appended until the server tells where they belong.
+func (c *Conversation) insert(ordered bool, previousItemId string, item Item) []ConversationChange {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if i := c.index(item.Id); i >= 0 {
+		if !ordered || previousItemId == "" || (i > 0 && c.items[i-1].Id == previousItemId) {
+			merge(&c.items[i], item)
+			return []ConversationChange{{Type: ChangeUpdated, Index: i, Item: c.items[i].clone()}}
+		}
+		existing := c.items[i]
+		merge(&existing, item)
+		item = existing
+		c.items = slices.Delete(c.items, i, i+1)
+	}
+	index := len(c.items)
+	if ordered {
+		if previousItemId == "" {
+			index = 0
+		} else if i := c.index(previousItemId); i >= 0 {
+			index = i + 1
+		}
+	}
+	c.items = slices.Insert(c.items, index, item.clone())
+	return []ConversationChange{{Type: ChangeAdded, Index: index, Item: item.clone()}}
+}
+
+func (c *Conversation) replace(item Item) []ConversationChange {
+	c.mu.Lock()
+	i := c.index(item.Id)
+	c.mu.Unlock()
+	if i < 0 {
+		return c.insert(false, "", item)
+	}
+	return c.update(item.Id, ChangeUpdated, func(existing *Item) { merge(existing, item) })
+}
+
+func (c *Conversation) delete(id string) []ConversationChange {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	i := c.index(id)
+	if i < 0 {
+		return nil
+	}
+	item := c.items[i]
+	c.items = slices.Delete(c.items, i, i+1)
+	return []ConversationChange{{Type: ChangeDeleted, Index: i, Item: item}}
+}
+
+func (c *Conversation) update(id string, typ ChangeType, apply func(item *Item)) []ConversationChange {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	i := c.index(id)
+	if i < 0 {
+		return nil
+	}
+	apply(&c.items[i])
+	return []ConversationChange{{Type: typ, Index: i, Item: c.items[i].clone()}}
+}
+
+func (c *Conversation) index(id string) int {
+	return slices.IndexFunc(c.items, func(item Item) bool { return item.Id == id })
+}
+
+func (c *Conversation) notify(changes []ConversationChange) {
+	if len(changes) == 0 {
+		return
+	}
+	handlers := c.handlers.snapshot()
+	for _, change := range changes {
+		for _, handler := range handlers {
+			handler(change)
+		}
+	}
+}
+
+// merge replaces an item with a newer server representation, keeping what
+// the server leaves out: streamed text, transcripts and arguments, and
+// truncations.
+func merge(existing *Item, item Item) {
+	previous := *existing
+	*existing = item.clone()
+	if len(existing.Content) == 0 {
+		existing.Content = previous.Content
+	}
+	for i := range min(len(previous.Content), len(existing.Content)) {
+		part, old := &existing.Content[i], previous.Content[i]
+		if part.Text == "" {
+			part.Text = old.Text
+		}
+		if old.Truncated {
+			part.Truncated, part.AudioEndMs, part.Transcript = true, old.AudioEndMs, ""
+		} else if part.Transcript == "" {
+			part.Transcript = old.Transcript
+		}
+	}
+	if existing.Arguments == "" {
+		existing.Arguments = previous.Arguments
+	}
+}
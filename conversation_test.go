@@ -0,0 +1,140 @@
+package realtime
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"gitlab.bcc-hyperdev.org/bcc-hyperdev/realtime/shared"
+)
+
+func handleAll(t *testing.T, c *Conversation, events ...string) {
+	t.Helper()
+	for _, data := range events {
+		event, err := ParseEvent([]byte(data))
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		c.Handle(context.Background(), event)
+	}
+}
+
+func itemIds(items []Item) []string {
+	ids := make([]string, len(items))
+	for i, item := range items {
+		ids[i] = item.Id
+	}
+	return ids
+}
+
+func TestConversation(t *testing.T) {
+	t.Run("Order", func(t *testing.T) {
+		c := NewConversation(shared.NewLogger(), nil)
+		handleAll(t, c,
+			`{"type":"conversation.item.added","previous_item_id":null,"item":{"id":"a","type":"message","role":"user"}}`,
+			`{"type":"conversation.item.added","previous_item_id":"a","item":{"id":"c","type":"message","role":"user"}}`,
+			`{"type":"conversation.item.added","previous_item_id":"a","item":{"id":"b","type":"message","role":"user"}}`,
+			`{"type":"response.output_item.added","item":{"id":"d","type":"message","role":"assistant"}}`,
+			`{"type":"conversation.item.added","previous_item_id":"c","item":{"id":"d","type":"message","role":"assistant"}}`,
+		)
+		if got := itemIds(c.Items()); len(got) != 4 || got[0] != "a" || got[1] != "b" || got[2] != "c" || got[3] != "d" {
+			t.Errorf("Expected [a b c d], got %v", got)
+		}
+		handleAll(t, c, `{"type":"conversation.item.deleted","item_id":"b"}`)
+		if got := itemIds(c.Items()); len(got) != 3 || got[1] != "c" {
+			t.Errorf("Expected [a c d], got %v", got)
+		}
+	})
+
+	t.Run("Streaming", func(t *testing.T) {
+		c := NewConversation(shared.NewLogger(), nil)
+		handleAll(t, c,
+			`{"type":"conversation.item.added","item":{"id":"user","type":"message","role":"user","content":[{"type":"input_audio"}]}}`,
+			`{"type":"conversation.item.input_audio_transcription.delta","item_id":"user","content_index":0,"delta":"Hel"}`,
+			`{"type":"conversation.item.input_audio_transcription.completed","item_id":"user","content_index":0,"transcript":"Hello"}`,
+			`{"type":"response.output_item.added","item":{"id":"bot","type":"message","role":"assistant"}}`,
+			`{"type":"response.output_audio_transcript.delta","item_id":"bot","content_index":0,"delta":"Hi "}`,
+			`{"type":"response.output_audio_transcript.delta","item_id":"bot","content_index":0,"delta":"there"}`,
+			`{"type":"response.output_item.done","item":{"id":"bot","type":"message","role":"assistant","status":"completed","content":[{"type":"output_audio"}]}}`,
+			`{"type":"response.output_item.added","item":{"id":"fn","type":"function_call","name":"lookup","call_id":"call_1"}}`,
+			`{"type":"response.function_call_arguments.delta","item_id":"fn","delta":"{\"q\":"}`,
+			`{"type":"response.function_call_arguments.delta","item_id":"fn","delta":"1}"}`,
+		)
+		user, _ := c.Item("user")
+		if got := user.Content[0].Transcript; got != "Hello" {
+			t.Errorf("Expected Hello, got %q", got)
+		}
+		bot, _ := c.Item("bot")
+		if bot.Status != "completed" || bot.Content[0].Transcript != "Hi there" {
+			t.Errorf("Expected completed item with transcript Hi there, got %+v", bot)
+		}
+		fn, _ := c.Item("fn")
+		if fn.Arguments != `{"q":1}` {
+			t.Errorf("Expected arguments {\"q\":1}, got %q", fn.Arguments)
+		}
+	})
+
+	t.Run("Truncation", func(t *testing.T) {
+		c := NewConversation(shared.NewLogger(), nil)
+		var changes []ConversationChange
+		c.OnChange(func(change ConversationChange) { changes = append(changes, change) })
+		handleAll(t, c,
+			`{"type":"conversation.item.added","item":{"id":"bot","type":"message","role":"assistant","content":[{"type":"output_audio","transcript":"Long answer"}]}}`,
+			`{"type":"conversation.item.truncated","item_id":"bot","content_index":0,"audio_end_ms":1500}`,
+			`{"type":"conversation.item.done","item":{"id":"bot","type":"message","role":"assistant","content":[{"type":"output_audio","transcript":"Long answer"}]}}`,
+		)
+		bot, _ := c.Item("bot")
+		if part := bot.Content[0]; !part.Truncated || part.AudioEndMs != 1500 || part.Transcript != "" {
+			t.Errorf("Expected truncation at 1500ms without transcript, got %+v", part)
+		}
+		if len(changes) != 3 || changes[0].Type != ChangeAdded || changes[1].Type != ChangeTruncated {
+			t.Errorf("Expected added, truncated and updated changes, got %+v", changes)
+		}
+	})
+
+	t.Run("SnapshotsAreCopies", func(t *testing.T) {
+		c := NewConversation(shared.NewLogger(), nil)
+		handleAll(t, c, `{"type":"conversation.item.added","item":{"id":"a","type":"message","content":[{"type":"input_text","text":"x"}]}}`)
+		items := c.Items()
+		items[0].Content[0].Text = "changed"
+		if item, _ := c.Item("a"); item.Content[0].Text != "x" {
+			t.Errorf("Expected snapshot changes not to leak, got %q", item.Content[0].Text)
+		}
+	})
+
+	t.Run("SendsClientEvents", func(t *testing.T) {
+		session, transport, _, _ := newTestSession(t)
+		defer func() { _ = session.Close(context.Background()) }()
+		c := NewConversation(shared.NewLogger(), session)
+		defer c.Close()
+		if err := session.Start(); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		item := Item{Type: ItemTypeMessage, Role: "user", Content: []ContentPart{{Type: ContentTypeInputText, Text: "hi"}}}
+		if err := c.CreateItem(context.Background(), "root", item); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if err := c.TruncateItem(context.Background(), "bot", 0, 1250*time.Millisecond); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		transport.events <- []byte(`{"type":"conversation.item.added","item":{"id":"a","type":"message","role":"user"}}`)
+		waitFor(t, func() bool { return len(c.Items()) == 1 })
+
+		transport.mu.Lock()
+		defer transport.mu.Unlock()
+		if len(transport.sent) != 2 {
+			t.Fatalf("Expected 2 client events, got %d", len(transport.sent))
+		}
+		var create ConversationItemCreateEvent
+		_ = json.Unmarshal(transport.sent[0], &create)
+		if create.Type != EventTypeConversationItemCreate || create.PreviousItemId != "root" || create.Item.Content[0].Text != "hi" {
+			t.Errorf("Expected conversation.item.create, got %s", transport.sent[0])
+		}
+		var truncate ConversationItemTruncateEvent
+		_ = json.Unmarshal(transport.sent[1], &truncate)
+		if truncate.Type != EventTypeConversationItemTruncate || truncate.ItemId != "bot" || truncate.AudioEndMs != 1250 {
+			t.Errorf("Expected conversation.item.truncate at 1250ms, got %s", transport.sent[1])
+		}
+	})
+}
@@ -0,0 +1,299 @@
+package realtime
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+const (
+	EventTypeError           = "error"
+	EventTypeSessionCreated  = "session.created"
+	EventTypeSessionUpdated  = "session.updated"
+	EventTypeResponseCreated = "response.created"
+	EventTypeResponseDone    = "response.done"
+	EventTypeResponseCancel  = "response.cancel"
+
+	EventTypeConversationItemAdded     = "conversation.item.added"
+	EventTypeConversationItemCreated   = "conversation.item.created"
+	EventTypeConversationItemDone      = "conversation.item.done"
+	EventTypeConversationItemRetrieved = "conversation.item.retrieved"
+	EventTypeConversationItemDeleted   = "conversation.item.deleted"
+	EventTypeConversationItemTruncated = "conversation.item.truncated"
+	EventTypeConversationItemCreate    = "conversation.item.create"
+	EventTypeConversationItemDelete    = "conversation.item.delete"
+	EventTypeConversationItemTruncate  = "conversation.item.truncate"
+
+	EventTypeInputTranscriptionDelta     = "conversation.item.input_audio_transcription.delta"
+	EventTypeInputTranscriptionCompleted = "conversation.item.input_audio_transcription.completed"
+	EventTypeInputTranscriptionFailed    = "conversation.item.input_audio_transcription.failed"
+
+	EventTypeInputAudioBufferSpeechStarted = "input_audio_buffer.speech_started"
+	EventTypeInputAudioBufferSpeechStopped = "input_audio_buffer.speech_stopped"
+	EventTypeInputAudioBufferCommit        = "input_audio_buffer.commit"
+	EventTypeInputAudioBufferAppend        = "input_audio_buffer.append"
+	EventTypeSessionUpdate                 = "session.update"
+	EventTypeResponseCreate                = "response.create"
+
+	EventTypeResponseContentPartAdded           = "response.content_part.added"
+	EventTypeResponseOutputItemAdded            = "response.output_item.added"
+	EventTypeResponseOutputItemDone             = "response.output_item.done"
+	EventTypeResponseOutputTextDelta            = "response.output_text.delta"
+	EventTypeResponseOutputTextDone             = "response.output_text.done"
+	EventTypeResponseOutputAudioDelta           = "response.output_audio.delta"
+	EventTypeResponseOutputAudioTranscriptDelta = "response.output_audio_transcript.delta"
+	EventTypeResponseOutputAudioTranscriptDone  = "response.output_audio_transcript.done"
+	EventTypeResponseFunctionArgumentsDelta     = "response.function_call_arguments.delta"
+	EventTypeResponseFunctionArgumentsDone      = "response.function_call_arguments.done"
+)
+
+// Event is a server event received over the transport. Only the envelope is
+// decoded eagerly; use Decode to unmarshal the payload into a typed struct.
+type Event struct {
+	Type    string          `json:"type"`
+	EventId string          `json:"event_id,omitempty"`
+	Raw     json.RawMessage `json:"-"`
+}
+
+func ParseEvent(data []byte) (Event, error) {
+	var event Event
+	if err := json.Unmarshal(data, &event); err != nil {
+		return Event{}, fmt.Errorf("failed to parse event: %w", err)
+	}
+	if event.Type == "" {
+		return Event{}, fmt.Errorf("failed to parse event: missing type")
+	}
+	event.Raw = json.RawMessage(data)
+	return event, nil
+}
+
+func (e Event) Decode(v any) error {
+	if err := json.Unmarshal(e.Raw, v); err != nil {
+		return fmt.Errorf("failed to decode %s event: %w", e.Type, err)
+	}
+	return nil
+}
+
+type Response struct {
+	Id            string                 `json:"id"`
+	Status        string                 `json:"status"`
+	StatusDetails *ResponseStatusDetails `json:"status_details,omitempty"`
+	Output        []Item                 `json:"output,omitempty"`
+	Metadata      map[string]string      `json:"metadata,omitempty"`
+	Usage         *Usage                 `json:"usage,omitempty"`
+}
+
+// Usage counts the tokens of a response, or of a session once added up.
+type Usage struct {
+	TotalTokens        int                `json:"total_tokens"`
+	InputTokens        int                `json:"input_tokens"`
+	OutputTokens       int                `json:"output_tokens"`
+	InputTokenDetails  InputTokenDetails  `json:"input_token_details"`
+	OutputTokenDetails OutputTokenDetails `json:"output_token_details"`
+}
+
+// InputTokenDetails splits the input tokens by modality. Cached tokens are
+// included in the counts of their modality.
+type InputTokenDetails struct {
+	CachedTokens        int                 `json:"cached_tokens"`
+	TextTokens          int                 `json:"text_tokens"`
+	AudioTokens         int                 `json:"audio_tokens"`
+	ImageTokens         int                 `json:"image_tokens"`
+	CachedTokensDetails CachedTokensDetails `json:"cached_tokens_details"`
+}
+
+type CachedTokensDetails struct {
+	TextTokens  int `json:"text_tokens"`
+	AudioTokens int `json:"audio_tokens"`
+	ImageTokens int `json:"image_tokens"`
+}
+
+type OutputTokenDetails struct {
+	TextTokens  int `json:"text_tokens"`
+	AudioTokens int `json:"audio_tokens"`
+}
+
+// Add adds the tokens of other to u.
+func (u *Usage) Add(other Usage) {
+	u.TotalTokens += other.TotalTokens
+	u.InputTokens += other.InputTokens
+	u.OutputTokens += other.OutputTokens
+	u.InputTokenDetails.CachedTokens += other.InputTokenDetails.CachedTokens
+	u.InputTokenDetails.TextTokens += other.InputTokenDetails.TextTokens
+	u.InputTokenDetails.AudioTokens += other.InputTokenDetails.AudioTokens
+	u.InputTokenDetails.ImageTokens += other.InputTokenDetails.ImageTokens
+	u.InputTokenDetails.CachedTokensDetails.TextTokens += other.InputTokenDetails.CachedTokensDetails.TextTokens
+	u.InputTokenDetails.CachedTokensDetails.AudioTokens += other.InputTokenDetails.CachedTokensDetails.AudioTokens
+	u.InputTokenDetails.CachedTokensDetails.ImageTokens += other.InputTokenDetails.CachedTokensDetails.ImageTokens
+	u.OutputTokenDetails.TextTokens += other.OutputTokenDetails.TextTokens
+	u.OutputTokenDetails.AudioTokens += other.OutputTokenDetails.AudioTokens
+}
+
+// ResponseStatusDetails tells why a response did not complete.
+type ResponseStatusDetails struct {
+	Type   string       `json:"type"`
+	Reason string       `json:"reason,omitempty"`
+	Error  *ErrorDetail `json:"error,omitempty"`
+}
+
+type ResponseEvent struct {
+	Response Response `json:"response"`
+}
+
+type ContentPartEvent struct {
+	ResponseId   string      `json:"response_id"`
+	ItemId       string      `json:"item_id"`
+	ContentIndex int         `json:"content_index"`
+	Part         ContentPart `json:"part"`
+}
+
+type ErrorDetail struct {
+	Type    string `json:"type"`
+	Code    string `json:"code,omitempty"`
+	Message string `json:"message"`
+	Param   string `json:"param,omitempty"`
+	EventId string `json:"event_id,omitempty"`
+}
+
+type ErrorEvent struct {
+	Type    string      `json:"type"`
+	EventId string      `json:"event_id,omitempty"`
+	Error   ErrorDetail `json:"error"`
+}
+
+func NewErrorEvent(detail ErrorDetail) ErrorEvent {
+	return ErrorEvent{Type: EventTypeError, Error: detail}
+}
+
+// ServerError is an error event the server sent in reply to a client event.
+type ServerError struct {
+	ErrorDetail
+}
+
+func (e *ServerError) Error() string {
+	msg := "server returned an error event"
+	if e.Code != "" {
+		msg += " (" + e.Code + ")"
+	}
+	if e.Param != "" {
+		msg += " for " + e.Param
+	}
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	return msg
+}
+
+type ResponseCancelEvent struct {
+	Type       string `json:"type"`
+	ResponseId string `json:"response_id,omitempty"`
+}
+
+func NewResponseCancelEvent(responseId string) ResponseCancelEvent {
+	return ResponseCancelEvent{Type: EventTypeResponseCancel, ResponseId: responseId}
+}
+
+type InputAudioBufferCommitEvent struct {
+	Type string `json:"type"`
+}
+
+func NewInputAudioBufferCommitEvent() InputAudioBufferCommitEvent {
+	return InputAudioBufferCommitEvent{Type: EventTypeInputAudioBufferCommit}
+}
+
+// InputAudioBufferAppendEvent carries input audio in the session's input
+// format, for transports without an audio track.
+type InputAudioBufferAppendEvent struct {
+	Type  string `json:"type"`
+	Audio []byte `json:"audio"`
+}
+
+func NewInputAudioBufferAppendEvent(frame []byte) InputAudioBufferAppendEvent {
+	return InputAudioBufferAppendEvent{Type: EventTypeInputAudioBufferAppend, Audio: frame}
+}
+
+// ResponseOutputAudioDeltaEvent carries output audio in the session's output
+// format, for transports without an audio track.
+type ResponseOutputAudioDeltaEvent struct {
+	ResponseId string `json:"response_id"`
+	ItemId     string `json:"item_id"`
+	Delta      []byte `json:"delta"`
+}
+
+type ResponseCreateEvent struct {
+	Type     string          `json:"type"`
+	EventId  string          `json:"event_id,omitempty"`
+	Response *ResponseParams `json:"response,omitempty"`
+}
+
+// ResponseParams overrides the session config for a single response.
+type ResponseParams struct {
+	// Conversation is ConversationNone to keep the response out of the
+	// conversation.
+	Conversation string `json:"conversation,omitempty"`
+	Instructions string `json:"instructions,omitempty"`
+	// Input replaces the conversation as the context of the response; nil
+	// keeps the conversation.
+	Input            []Item            `json:"input,omitempty"`
+	OutputModalities []string          `json:"output_modalities,omitempty"`
+	Metadata         map[string]string `json:"metadata,omitempty"`
+}
+
+func NewResponseCreateEvent() ResponseCreateEvent {
+	return ResponseCreateEvent{Type: EventTypeResponseCreate}
+}
+
+// SessionUpdateEvent carries a partial session config; Session is marshalled
+// as is. EventId is echoed in the error event if the update is rejected.
+type SessionUpdateEvent struct {
+	Type    string `json:"type"`
+	EventId string `json:"event_id,omitempty"`
+	Session any    `json:"session"`
+}
+
+func NewSessionUpdateEvent(session any) SessionUpdateEvent {
+	return SessionUpdateEvent{Type: EventTypeSessionUpdate, Session: session}
+}
+
+// SessionUpdatedEvent carries the full session config in effect after an
+// update, as does session.created for the initial one.
+type SessionUpdatedEvent struct {
+	Session json.RawMessage `json:"session"`
+}
+
+type ConversationItemCreateEvent struct {
+	Type string `json:"type"`
+	// PreviousItemId is the item to insert after; empty appends, "root"
+	// inserts at the beginning.
+	PreviousItemId string `json:"previous_item_id,omitempty"`
+	Item           Item   `json:"item"`
+}
+
+func NewConversationItemCreateEvent(previousItemId string, item Item) ConversationItemCreateEvent {
+	return ConversationItemCreateEvent{Type: EventTypeConversationItemCreate, PreviousItemId: previousItemId, Item: item}
+}
+
+type ConversationItemDeleteEvent struct {
+	Type   string `json:"type"`
+	ItemId string `json:"item_id"`
+}
+
+func NewConversationItemDeleteEvent(itemId string) ConversationItemDeleteEvent {
+	return ConversationItemDeleteEvent{Type: EventTypeConversationItemDelete, ItemId: itemId}
+}
+
+type ConversationItemTruncateEvent struct {
+	Type         string `json:"type"`
+	ItemId       string `json:"item_id"`
+	ContentIndex int    `json:"content_index"`
+	AudioEndMs   int    `json:"audio_end_ms"`
+}
+
+func NewConversationItemTruncateEvent(itemId string, contentIndex int, audioEnd time.Duration) ConversationItemTruncateEvent {
+	return ConversationItemTruncateEvent{
+		Type:         EventTypeConversationItemTruncate,
+		ItemId:       itemId,
+		ContentIndex: contentIndex,
+		AudioEndMs:   int(audioEnd.Milliseconds()),
+	}
+}
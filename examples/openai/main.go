@@ -1,521 +1,293 @@
 package main
 
 import (
-	"bytes"
+	"bufio"
+	"context"
+	"errors"
 	"fmt"
-	"mime/multipart"
-	"net/textproto"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"syscall"
 	"time"
 
-	"encoding/binary"
-
-	"github.com/gordonklaus/portaudio"
-	"github.com/openai/openai-go/v3/packages/param"
-	"github.com/openai/openai-go/v3/realtime"
+	oairealtime "github.com/openai/openai-go/v3/realtime"
 	"github.com/pion/webrtc/v4"
-	"github.com/pion/webrtc/v4/pkg/media"
-	"github.com/valyala/fasthttp"
+	"gitlab.bcc-hyperdev.org/bcc-hyperdev/realtime"
+	"gitlab.bcc-hyperdev.org/bcc-hyperdev/realtime/audio"
+	"gitlab.bcc-hyperdev.org/bcc-hyperdev/realtime/audio/portaudio"
+	"gitlab.bcc-hyperdev.org/bcc-hyperdev/realtime/openai"
+	"gitlab.bcc-hyperdev.org/bcc-hyperdev/realtime/recording"
+	"gitlab.bcc-hyperdev.org/bcc-hyperdev/realtime/rtc"
 	"gitlab.bcc-hyperdev.org/bcc-hyperdev/realtime/shared"
 	"go.uber.org/zap"
 )
 
-type OpenaiRealtimeClient struct {
-	logger    *shared.Logger
-	apiKey    string
-	orgId     string
-	projectId string
-	baseUrl   string
-}
-
-func NewOpenaiRealtimeClient(logger *shared.Logger, apiKey, orgId, projectId, baseUrl string) (*OpenaiRealtimeClient, error) {
-	if apiKey == "" {
-		return nil, fmt.Errorf("apiKey is required")
-	}
-	if orgId == "" {
-		return nil, fmt.Errorf("orgId is required")
-	}
-	if projectId == "" {
-		return nil, fmt.Errorf("projectId is required")
-	}
-	if baseUrl == "" {
-		baseUrl = "https://api.openai.com/v1"
-	}
-	return &OpenaiRealtimeClient{
-		logger:    logger,
-		apiKey:    apiKey,
-		orgId:     orgId,
-		projectId: projectId,
-		baseUrl:   baseUrl,
-	}, nil
-}
-
-type OpenaiConfig struct {
-	ApiKey    string
-	OrgId     string
-	ProjectId string
-	BaseUrl   string
-}
-
-type OpenaiRealtimeService struct {
-	logger *shared.Logger
-	cfg    *OpenaiConfig
-}
-
-func NewOpenaiRealtimeService(logger *shared.Logger, cfg *OpenaiConfig) (s *OpenaiRealtimeService, err error) {
-	defer func() {
-		if err != nil {
-			err = fmt.Errorf("failed to create OpenAI Realtime Service: %w", err)
-		}
-	}()
-	return &OpenaiRealtimeService{
-		logger: logger,
-		cfg:    cfg,
-	}, nil
-}
-
-func (s *OpenaiRealtimeService) NewClient() (c *OpenaiRealtimeClient, err error) {
-	defer func() {
-		if err != nil {
-			err = fmt.Errorf("failed to create client: %w", err)
-		}
-	}()
-	return NewOpenaiRealtimeClient(
-		s.logger,
-		s.cfg.ApiKey,
-		s.cfg.OrgId,
-		s.cfg.ProjectId,
-		s.cfg.BaseUrl,
-	)
-}
-
-// NewMicAudioChannel creates a read-only channel that provides chunks of raw PCM audio data
-// from the laptop microphone at 24000 Hz, 16-bit signed, mono.
-// Each chunk is kept small for low latency (e.g., 1024 samples ~42ms, 2048 bytes),
-// but never exceeds 1MiB as per the requirement. The implementation can be abstracted
-// by creating similar functions for other audio sources (e.g., file, network) that return
-// the same channel type, allowing the WebRTC feeder to work with any source.
-func NewMicAudioChannel() <-chan []byte {
-	ch := make(chan []byte)
-
-	go func() {
-		defer close(ch)
-
-		err := portaudio.Initialize()
-		if err != nil {
-			fmt.Printf("Failed to initialize PortAudio: %v\n", err)
-			return
-		}
-		defer func() { _ = portaudio.Terminate() }()
-
-		const (
-			sampleRate   = 24000
-			framesPerBuf = 1024 // Small buffer for low latency (~42ms)
-			channels     = 1    // Mono
-			maxChunkSize = 1 << 20
-		)
-
-		// Buffer for int16 samples
-		samples := make([]int16, framesPerBuf)
-
-		stream, err := portaudio.OpenDefaultStream(channels, 0, float64(sampleRate), framesPerBuf, samples)
-		if err != nil {
-			fmt.Printf("Failed to open stream: %v\n", err)
-			return
-		}
-		defer func() { _ = stream.Close() }()
-
-		err = stream.Start()
-		if err != nil {
-			fmt.Printf("Failed to start stream: %v\n", err)
-			return
-		}
-
-		byteBuf := make([]byte, framesPerBuf*2) // 16-bit = 2 bytes per sample
-		for {
-			err = stream.Read()
-			if err != nil {
-				fmt.Printf("Stream read error: %v\n", err)
-				return
-			}
-
-			// Convert int16 samples to big-endian byte slice (for L16 compatibility)
-			for i, s := range samples {
-				binary.BigEndian.PutUint16(byteBuf[i*2:], uint16(s))
-			}
-
-			chunk := byteBuf
-			if len(chunk) > maxChunkSize {
-				// This shouldn't happen with small framesPerBuf, but truncate if needed
-				chunk = chunk[:maxChunkSize]
-			}
-
-			// Send a copy to avoid race conditions
-			cp := make([]byte, len(chunk))
-			copy(cp, chunk)
-			ch <- cp
-		}
-	}()
-
-	return ch
-}
-
 func main() {
 	logger := shared.NewLogger(
 		zap.String("package", "realtime"),
 		zap.String("example", "openai"),
 	)
-	svc, err := NewOpenaiRealtimeService(
-		logger,
-		&OpenaiConfig{
-			ApiKey:    shared.MustGetenv(shared.GetenvString, "OPENAI_API_KEY", true),
-			OrgId:     shared.MustGetenv(shared.GetenvString, "OPENAI_ORG_ID", true),
-			ProjectId: shared.MustGetenv(shared.GetenvString, "OPENAI_PROJECT_ID", true),
-			BaseUrl:   shared.MustGetenv(shared.GetenvString, "OPENAI_BASE_URL", false, "https://api.openai.com/v1"),
-		},
-	)
+	cfg := &openai.OpenaiConfig{
+		// OPENAI_PROXY_URL takes precedence over HTTPS_PROXY.
+		ProxyUrl:             shared.MustGetenv(shared.GetenvString, "OPENAI_PROXY_URL", false, ""),
+		ProxyFromEnvironment: true,
+	}
+	// AZURE_OPENAI_ENDPOINT switches to Azure OpenAI.
+	if endpoint := shared.MustGetenv(shared.GetenvString, "AZURE_OPENAI_ENDPOINT", false, ""); endpoint != "" {
+		cfg.ApiKey = shared.MustGetenv(shared.GetenvString, "AZURE_OPENAI_API_KEY", true)
+		cfg.Azure = &openai.AzureConfig{
+			Endpoint:   endpoint,
+			Deployment: shared.MustGetenv(shared.GetenvString, "AZURE_OPENAI_DEPLOYMENT", true),
+			ApiVersion: shared.MustGetenv(shared.GetenvString, "AZURE_OPENAI_API_VERSION", false, ""),
+		}
+	} else {
+		cfg.ApiKey = shared.MustGetenv(shared.GetenvString, "OPENAI_API_KEY", true)
+		cfg.OrgId = shared.MustGetenv(shared.GetenvString, "OPENAI_ORG_ID", true)
+		cfg.ProjectId = shared.MustGetenv(shared.GetenvString, "OPENAI_PROJECT_ID", true)
+		cfg.BaseUrl = shared.MustGetenv(shared.GetenvString, "OPENAI_BASE_URL", false, openai.DefaultBaseUrl)
+	}
+	svc, err := openai.NewOpenaiRealtimeService(logger, cfg)
 	if err != nil {
 		logger.NoCtxFatal(err.Error())
 	}
-	_, err = svc.NewClient()
+	client, err := svc.NewClient()
 	if err != nil {
 		logger.NoCtxFatal(err.Error())
 	}
-	request := realtime.RealtimeSessionCreateRequestParam{
-		Instructions: param.NewOpt("You are a helpful assistant."),
-		Model:        realtime.RealtimeSessionCreateRequestModelGPTRealtime,
-		Audio: realtime.RealtimeAudioConfigParam{
-			Input: realtime.RealtimeAudioConfigInputParam{
-				TurnDetection: realtime.RealtimeAudioInputTurnDetectionUnionParam{
-					OfSemanticVad: &realtime.RealtimeAudioInputTurnDetectionSemanticVadParam{
-						CreateResponse:    param.NewOpt(true),
-						InterruptResponse: param.NewOpt(true),
-						Eagerness:         "low",
-					},
-				},
-				Format: realtime.RealtimeAudioFormatsUnionParam{
-					OfAudioPCM: &realtime.RealtimeAudioFormatsAudioPCMParam{
-						Rate: 24000,
-						Type: "audio/pcm",
-					},
-				},
-				NoiseReduction: realtime.RealtimeAudioConfigInputNoiseReductionParam{
-					Type: realtime.NoiseReductionTypeNearField,
-				},
-				Transcription: realtime.AudioTranscriptionParam{
-					Language: param.NewOpt("fa"),
-					Prompt:   param.NewOpt("expect words related to web technologies"),
-					Model:    realtime.AudioTranscriptionModelWhisper1,
-				},
-			},
-			Output: realtime.RealtimeAudioConfigOutputParam{
-				Speed: param.NewOpt(0.9),
-				Format: realtime.RealtimeAudioFormatsUnionParam{
-					OfAudioPCM: &realtime.RealtimeAudioFormatsAudioPCMParam{
-						Rate: 24000,
-						Type: "audio/pcm",
-					},
-				},
-				Voice: realtime.RealtimeAudioConfigOutputVoiceCedar,
-			},
-		},
-		MaxOutputTokens: realtime.RealtimeSessionCreateRequestMaxOutputTokensUnionParam{
-			OfInt: param.NewOpt[int64](1024),
-		},
+	builder := openai.NewSessionBuilder(string(oairealtime.RealtimeSessionCreateRequestModelGPTRealtime)).
+		Instructions("You are a helpful assistant.").
+		SemanticVad("low", true, true).
+		InputFormat(openai.AudioFormat{Type: openai.AudioFormatPCM}).
+		NoiseReduction(oairealtime.NoiseReductionTypeNearField).
+		Transcription(oairealtime.AudioTranscriptionModelWhisper1, "fa", "expect words related to web technologies").
+		OutputFormat(openai.AudioFormat{Type: openai.AudioFormatPCM}).
+		Speed(0.9).
+		Voice(oairealtime.RealtimeAudioConfigOutputVoiceCedar).
+		MaxOutputTokens(1024).
+		Truncation(openai.TruncationAuto)
+	// OPENAI_PROMPT_ID uses a prompt from the dashboard on top of the
+	// instructions above.
+	if promptId := shared.MustGetenv(shared.GetenvString, "OPENAI_PROMPT_ID", false, ""); promptId != "" {
+		builder.Prompt(openai.PromptRef{Id: promptId})
 	}
-	sessionConfig, err := request.MarshalJSON()
-	if err != nil {
-		logger.NoCtxFatal(fmt.Errorf("failed to marshal request: %w", err).Error())
+	if shared.MustGetenv(shared.GetenvBool, "OPENAI_TRACING", false, "false") {
+		builder.TracingWorkflow("realtime-example", "", nil)
 	}
-	fmt.Println("Session Config\n------------\n", string(sessionConfig))
-
-	// Register Opus (48kHz stereo, but you can do mono too)
-	me := &webrtc.MediaEngine{}
-	err = me.RegisterCodec(webrtc.RTPCodecParameters{
-		RTPCodecCapability: webrtc.RTPCodecCapability{
-			MimeType:    webrtc.MimeTypeOpus,
-			ClockRate:   48000,
-			Channels:    2, // or 1 if you want mono
-			SDPFmtpLine: "minptime=10;useinbandfec=1",
-		},
-		PayloadType: 111, // Standard PT for Opus
-	}, webrtc.RTPCodecTypeAudio)
+	request, err := builder.Build()
 	if err != nil {
-		panic(err)
-	}
-
-	// Create a new API
-	api := webrtc.NewAPI(webrtc.WithMediaEngine(me))
-
-	// Create a new PeerConnection
-	pc, err := api.NewPeerConnection(webrtc.Configuration{})
-	if err != nil {
-		panic(err)
+		logger.NoCtxFatal(err.Error())
 	}
 
-	// Create data channel with label OpenAI uses in examples
-	dc, err := pc.CreateDataChannel("oai-events", nil)
+	mic, err := portaudio.NewMicSource()
 	if err != nil {
-		panic(err)
+		logger.NoCtxFatal(err.Error())
 	}
-
-	dc.OnMessage(func(msg webrtc.DataChannelMessage) {
-		fmt.Printf("Received message on data channel: %s\n", string(msg.Data))
-	})
-
-	dc.OnOpen(func() {
-		fmt.Println("Data channel opened.")
-	})
-	// Also accept incoming remote data channels (defensive)
-	pc.OnDataChannel(func(remote *webrtc.DataChannel) {
-		fmt.Printf("Remote data channel opened: %s\n", remote.Label())
-		remote.OnMessage(func(msg webrtc.DataChannelMessage) {
-			fmt.Printf("Message from remote (%s): %s\n", remote.Label(), string(msg.Data))
-		})
-	})
-
-	// Handle data channel messages if any
-	dc.OnMessage(func(msg webrtc.DataChannelMessage) {
-		fmt.Printf("Received message on data channel: %s\n", string(msg.Data))
-	})
-
-	dc.OnOpen(func() {
-		fmt.Println("Data channel opened.")
-		// No need to send audio here; using RTP
-		// Optionally send initial event if required
-	})
-
-	// Add transceiver for audio sendrecv
-	_, err = pc.AddTransceiverFromKind(webrtc.RTPCodecTypeAudio, webrtc.RTPTransceiverInit{
-		Direction: webrtc.RTPTransceiverDirectionSendrecv,
-	})
+	speaker, err := portaudio.NewSpeakerSink()
 	if err != nil {
-		panic(err)
+		_ = mic.Close()
+		logger.NoCtxFatal(err.Error())
 	}
 
-	// Initialize PortAudio
-	err = portaudio.Initialize()
+	// Opus needs a cgo encoder; G.711 keeps the example pure Go.
+	codec, err := rtc.NewPCMUCodec()
 	if err != nil {
-		panic(err)
+		logger.NoCtxFatal(err.Error())
 	}
-	defer func() { _ = portaudio.Terminate() }()
 
-	const sampleRate = 24000
-	const channels = 1
-	const frameSize = 480 // 20ms at 24kHz
-	inputBuffer := make([]int16, frameSize)
-	outputBuffer := make([]int16, frameSize)
-
-	// Open microphone stream
-	inputStream, err := portaudio.OpenDefaultStream(channels, 0, sampleRate, frameSize, inputBuffer)
+	// ICE_STUN_URLS, ICE_TURN_URLS and friends are needed behind strict NATs.
+	ice, err := rtc.IceConfigFromEnv("ICE_")
 	if err != nil {
-		panic(err)
+		logger.NoCtxFatal(err.Error())
 	}
-	defer func() { _ = inputStream.Close() }()
 
-	err = inputStream.Start()
-	if err != nil {
-		panic(err)
+	ctx := context.Background()
+	transportCfg := &rtc.Config{
+		Codec: codec,
+		Ice:   ice,
+		// OpenAI takes no trickled candidates; bound the wait for slow
+		// interfaces instead.
+		GatherTimeout: shared.MustGetenv(shared.GetenvDuration, "ICE_GATHER_TIMEOUT", false, "2s"),
+		OnStateChange: func(s webrtc.PeerConnectionState) {
+			fmt.Printf("Connection State has changed: %s\n", s.String())
+		},
 	}
-
-	// Open speaker stream
-	outputStream, err := portaudio.OpenDefaultStream(0, channels, sampleRate, frameSize, outputBuffer)
+	// Rate limits and server errors are retried; a bad key or session
+	// config is not.
+	transport, err := rtc.Dial(ctx, logger, transportCfg, client.Signaler(request, &openai.RetryPolicy{}))
 	if err != nil {
-		panic(err)
+		_ = mic.Close()
+		_ = speaker.Close()
+		var authErr *openai.AuthenticationError
+		var sessionErr *openai.InvalidSessionError
+		switch {
+		case errors.As(err, &authErr):
+			logger.NoCtxFatal("OpenAI rejected the API key, check OPENAI_API_KEY: " + err.Error())
+		case errors.As(err, &sessionErr):
+			logger.NoCtxFatal(fmt.Sprintf("OpenAI rejected the session config at %s: %s", sessionErr.Param, err))
+		}
+		logger.NoCtxFatal(err.Error())
 	}
-	defer func() { _ = outputStream.Close() }()
 
-	err = outputStream.Start()
-	if err != nil {
-		panic(err)
+	// TURN_DETECTION=vad gates the mic locally, ptt toggles talking with
+	// Enter; both take over from the server's turn detection.
+	turnDetection := realtime.TurnDetectionServer
+	switch mode := shared.MustGetenv(shared.GetenvString, "TURN_DETECTION", false, "server"); mode {
+	case "server":
+	case "vad":
+		turnDetection = realtime.TurnDetectionLocal
+	case "ptt":
+		turnDetection = realtime.TurnDetectionPushToTalk
+	default:
+		logger.NoCtxFatal(fmt.Sprintf("unknown TURN_DETECTION %q", mode))
 	}
 
-	// Create local track for sending mic audio
-	audioTrack, err := webrtc.NewTrackLocalStaticSample(
-		webrtc.RTPCodecCapability{
-			MimeType:  webrtc.MimeTypeOpus,
-			ClockRate: 48000,
-			Channels:  2, // stereo mic
-		},
-		"audio",
-		"pion",
-	)
-	if err != nil {
-		panic(err)
+	// Laptop speakers leak into the microphone; without cancellation the
+	// model interrupts itself.
+	var echoCanceller realtime.EchoCanceller
+	if shared.MustGetenv(shared.GetenvBool, "ECHO_CANCELLATION", false, "true") {
+		aec, err := audio.NewEchoCanceller(realtime.SampleRate, nil)
+		if err != nil {
+			logger.NoCtxFatal(err.Error())
+		}
+		echoCanceller = aec
 	}
 
-	_, err = pc.AddTrack(audioTrack)
+	session, err := realtime.NewSession(logger, transport, &realtime.SessionConfig{
+		Source: mic,
+		Sink:   speaker,
+		// Stop playback when the user talks over the assistant; pairs with
+		// interruptResponse of the semantic VAD above.
+		Interrupt:     true,
+		TurnDetection: turnDetection,
+		EchoCanceller: echoCanceller,
+	})
 	if err != nil {
-		panic(err)
+		logger.NoCtxFatal(err.Error())
 	}
-
-	go func() {
-		buf := make([]int16, 960) // 20ms @ 48kHz mono
-		for {
-			err := inputStream.Read()
-			if err != nil {
-				fmt.Println("mic read error:", err)
-				return
-			}
-
-			// Convert int16 -> []byte little-endian PCM
-			data := make([]byte, len(buf)*2)
-			for i, s := range buf {
-				data[2*i] = byte(s)
-				data[2*i+1] = byte(s >> 8)
-			}
-
-			// Write as a media.Sample (timestamping handled by Pion)
-			err = audioTrack.WriteSample(media.Sample{
-				Data:     data,
-				Duration: 20 * time.Millisecond,
-			})
-			if err != nil {
-				fmt.Println("track write error:", err)
-				return
-			}
+	session.OnEvent(func(ctx context.Context, event realtime.Event) {
+		if err := openai.EventError(event); err != nil {
+			logger.NoCtxError(err, "received error event")
+			return
+		}
+		fmt.Printf("Received event: %s\n", string(event.Raw))
+	})
+	transcript := realtime.NewTranscript(logger, session)
+	transcript.OnSegment(func(segment realtime.Segment) {
+		if segment.Final {
+			fmt.Printf("[%s] %s: %s\n", segment.Start.Truncate(time.Second), segment.Speaker, segment.Text)
+		}
+	})
+	realtime.NewTextStream(logger, session).OnText(func(output realtime.TextOutput) {
+		if output.Final {
+			fmt.Printf("assistant (text): %s\n", output.Text)
 		}
-	}()
-	// Set a handler for when a new remote track starts
-	pc.OnTrack(func(track *webrtc.TrackRemote, receiver *webrtc.RTPReceiver) {
-		fmt.Printf("Track has started, of type %d: %s\n", track.PayloadType(), track.Codec().MimeType)
-
-		go func() {
-			for {
-				pkt, _, readErr := track.ReadRTP()
-				if readErr != nil {
-					fmt.Printf("Error reading RTP: %v\n", readErr)
-					return
-				}
-
-				// Convert big-endian payload to int16 for PortAudio
-				for i := 0; i < len(pkt.Payload)/2; i++ {
-					outputBuffer[i] = int16(binary.BigEndian.Uint16(pkt.Payload[2*i:]))
-				}
-
-				writeErr := outputStream.Write()
-				if writeErr != nil {
-					fmt.Printf("Error writing to speaker: %v\n", writeErr)
-					return
-				}
-			}
-		}()
 	})
 
-	// Create offer
-	offer, err := pc.CreateOffer(nil)
-	if err != nil {
-		panic(err)
+	// RECORDING_DIR keeps a stereo WAV of the call and its events.
+	var recorder *recording.Recorder
+	if dir := shared.MustGetenv(shared.GetenvString, "RECORDING_DIR", false, ""); dir != "" {
+		storage, err := recording.NewDiskStorage(dir)
+		if err != nil {
+			logger.NoCtxFatal(err.Error())
+		}
+		recorder, err = recording.NewRecorder(logger, session, &recording.Config{Storage: storage, Layout: recording.LayoutStereo})
+		if err != nil {
+			logger.NoCtxFatal(err.Error())
+		}
 	}
-
-	// Set the local description
-	err = pc.SetLocalDescription(offer)
-	if err != nil {
-		panic(err)
+	if err := session.Start(); err != nil {
+		logger.NoCtxFatal(err.Error())
 	}
 
-	// Wait for ICE gathering to complete so the offer includes candidates.
-	// This mirrors typical browser behavior where offers include candidates
-	// or use trickle ICE. Pion provides GatheringCompletePromise.
-	<-webrtc.GatheringCompletePromise(pc)
-	local := pc.LocalDescription()
-	if local != nil {
-		offer = *local
+	fmt.Println("Session created successfully. Streaming audio...")
+	if turnDetection == realtime.TurnDetectionPushToTalk {
+		go pushToTalk(ctx, logger, session)
+	} else {
+		go typeText(ctx, logger, session)
 	}
 
-	// Create multipart form data
-	bodyBuffer := new(bytes.Buffer)
-	writer := multipart.NewWriter(bodyBuffer)
-
-	// For sdp with custom Content-Type
-	sdpHeaders := textproto.MIMEHeader{}
-	sdpHeaders.Set("Content-Disposition", `form-data; name="sdp"`)
-	sdpHeaders.Set("Content-Type", "application/sdp")
-	sdpPart, err := writer.CreatePart(sdpHeaders)
-	if err != nil {
-		panic(err)
-	}
-	_, err = sdpPart.Write([]byte(offer.SDP))
-	if err != nil {
-		panic(err)
+	// Wait for interrupt or for the remote side to hang up
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	select {
+	case <-sig:
+	case <-session.Done():
 	}
+	fmt.Println("Shutting down...")
 
-	// For session with custom Content-Type
-	sessionHeaders := textproto.MIMEHeader{}
-	sessionHeaders.Set("Content-Disposition", `form-data; name="session"`)
-	sessionHeaders.Set("Content-Type", "application/json")
-	sessionPart, err := writer.CreatePart(sessionHeaders)
-	if err != nil {
-		panic(err)
+	shutdownCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	if err := session.Close(shutdownCtx); err != nil {
+		logger.NoCtxError(err, "")
 	}
-	_, err = sessionPart.Write([]byte(sessionConfig))
-	if err != nil {
-		panic(err)
+	if recorder != nil {
+		if err := recorder.Close(); err != nil {
+			logger.NoCtxError(err, "")
+		}
 	}
-
-	err = writer.Close()
-	if err != nil {
-		panic(err)
+	// TRANSCRIPT_FILE keeps the transcript as subtitles or plain text,
+	// depending on its extension.
+	if path := shared.MustGetenv(shared.GetenvString, "TRANSCRIPT_FILE", false, ""); path != "" {
+		if err := writeTranscript(path, transcript.Segments()); err != nil {
+			logger.NoCtxError(err, "")
+		}
 	}
+}
 
-	// Send request to OpenAI
-	req := fasthttp.AcquireRequest()
-	resp := fasthttp.AcquireResponse()
-	defer fasthttp.ReleaseRequest(req)
-	defer fasthttp.ReleaseResponse(resp)
-
-	req.SetRequestURI("https://api.openai.com/v1/realtime/calls")
-	req.Header.SetMethod("POST")
-	req.Header.Set("Authorization", "Bearer "+os.Getenv("OPENAI_API_KEY"))
-	// req.Header.Set("OpenAI-Beta", "realtime=v1")
-	req.Header.SetContentType(writer.FormDataContentType())
-	req.SetBody(bodyBuffer.Bytes())
-
-	fmt.Println("Full Http Request\n------------")
-	fmt.Println(string(req.Header.Header()))
-	fmt.Println(string(req.Body()))
-
-	err = fasthttp.Do(req, resp)
+func writeTranscript(path string, segments []realtime.Segment) error {
+	f, err := os.Create(path)
 	if err != nil {
-		panic(fmt.Sprintf("Failed to send request to OpenAI: %v", err))
+		return fmt.Errorf("failed to create transcript: %w", err)
 	}
-
-	if resp.StatusCode() != fasthttp.StatusCreated {
-		panic(fmt.Sprintf("OpenAI returned status %d: %s", resp.StatusCode(), string(resp.Body())))
+	defer f.Close()
+	switch filepath.Ext(path) {
+	case ".srt":
+		err = realtime.WriteSRT(f, segments)
+	case ".vtt":
+		err = realtime.WriteVTT(f, segments)
+	default:
+		err = realtime.WriteText(f, segments)
 	}
-
-	answerSDP := string(resp.Body())
-	fmt.Println("Received SDP answer from OpenAI:\n", answerSDP)
-
-
-	// Set remote description
-	err = pc.SetRemoteDescription(webrtc.SessionDescription{Type: webrtc.SDPTypeAnswer, SDP: answerSDP})
 	if err != nil {
-		panic(err)
+		return err
 	}
+	return f.Close()
+}
 
-	pc.OnConnectionStateChange(func(s webrtc.PeerConnectionState) {
-		fmt.Printf("Connection State has changed: %s\n", s.String())
-	})
-
-	fmt.Println("Session created successfully. Streaming audio...")
-
-	// Wait for interrupt to stop
-	sig := make(chan os.Signal, 1)
-	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
-	<-sig
-	fmt.Println("Shutting down...")
+// pushToTalk toggles talking each time Enter is pressed.
+func pushToTalk(ctx context.Context, logger *shared.Logger, session *realtime.Session) {
+	fmt.Println("Press Enter to talk, and again when done.")
+	scanner := bufio.NewScanner(os.Stdin)
+	talking := false
+	for scanner.Scan() {
+		var err error
+		if talking {
+			err = session.StopTalking(ctx)
+			fmt.Println("Waiting for the response...")
+		} else {
+			err = session.StartTalking(ctx)
+			fmt.Println("Talking...")
+		}
+		if err != nil {
+			logger.NoCtxError(err, "push-to-talk failed")
+			return
+		}
+		talking = !talking
+	}
 }
 
-// TODO: support other fields
-// type RealtimeSessionCreateRequestParam struct {
-// 	Prompt responses.ResponsePromptParam `json:"prompt,omitzero"`
-// 	Tracing RealtimeTracingConfigUnionParam `json:"tracing,omitzero"`
-// 	Include []string `json:"include,omitzero"`
-// 	OutputModalities []string `json:"output_modalities,omitzero"`
-// 	ToolChoice RealtimeToolChoiceConfigUnionParam `json:"tool_choice,omitzero"`
-// 	Tools RealtimeToolsConfigParam `json:"tools,omitzero"`
-// 	Truncation RealtimeTruncationUnionParam `json:"truncation,omitzero"`
-// }
+// typeText sends each line typed on stdin as a user message.
+func typeText(ctx context.Context, logger *shared.Logger, session *realtime.Session) {
+	fmt.Println("Type a message and press Enter to send it.")
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		if scanner.Text() == "" {
+			continue
+		}
+		if err := session.SendText(ctx, scanner.Text()); err != nil {
+			logger.NoCtxError(err, "failed to send text")
+			return
+		}
+	}
+}
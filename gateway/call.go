@@ -0,0 +1,219 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"gitlab.bcc-hyperdev.org/bcc-hyperdev/realtime"
+)
+
+const hangupTimeout = 5 * time.Second
+
+type Direction int
+
+const (
+	// ClientToServer events come from the browser and go to the model.
+	ClientToServer Direction = iota
+	// ServerToClient events come from the model and go to the browser.
+	ServerToClient
+)
+
+func (d Direction) String() string {
+	if d == ClientToServer {
+		return "client_to_server"
+	}
+	return "server_to_client"
+}
+
+// Interceptor sees every event relayed through a call. It returns the event
+// to forward, possibly rewritten, or nil to drop it silently. An error drops
+// the event too; rejected client events are answered with an error event.
+type Interceptor func(ctx context.Context, call *Call, dir Direction, event realtime.Event) ([]byte, error)
+
+// Call is one relayed call: the browser leg terminated by the gateway and the
+// provider leg opened on its behalf.
+type Call struct {
+	Id        string
+	CreatedAt time.Time
+
+	gateway  *Gateway
+	client   realtime.Transport
+	upstream realtime.Transport
+	// candidates queues the gateway's candidates for a trickling browser.
+	candidates *candidateQueue
+
+	ctx       context.Context
+	cancel    context.CancelFunc
+	wg        sync.WaitGroup
+	ended     chan struct{}
+	endOnce   sync.Once
+	done      chan struct{}
+	closeOnce sync.Once
+	closeErr  error
+}
+
+func newCall(g *Gateway, id string) *Call {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Call{
+		Id:        id,
+		CreatedAt: time.Now(),
+		gateway:   g,
+		ctx:       ctx,
+		cancel:    cancel,
+		ended:     make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+}
+
+func (c *Call) start() {
+	c.wg.Add(4)
+	go c.relayEvents(c.client, c.upstream, ClientToServer)
+	go c.relayEvents(c.upstream, c.client, ServerToClient)
+	go c.relayAudio(c.client, c.upstream)
+	go c.relayAudio(c.upstream, c.client)
+	// Either leg hanging up ends the call.
+	go func() {
+		select {
+		case <-c.ended:
+			ctx, cancel := context.WithTimeout(context.Background(), hangupTimeout)
+			defer cancel()
+			if err := c.Close(ctx); err != nil {
+				c.gateway.logger.NoCtxError(err, "failed to hang up call")
+			}
+		case <-c.done:
+		}
+	}()
+}
+
+// Done is closed once both legs are closed.
+func (c *Call) Done() <-chan struct{} {
+	return c.done
+}
+
+// SendClient injects an event into the browser leg, bypassing interceptors.
+func (c *Call) SendClient(ctx context.Context, event any) error {
+	return send(ctx, c.client, event)
+}
+
+// SendUpstream injects an event into the provider leg, bypassing
+// interceptors.
+func (c *Call) SendUpstream(ctx context.Context, event any) error {
+	return send(ctx, c.upstream, event)
+}
+
+func send(ctx context.Context, transport realtime.Transport, event any) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+	return transport.Send(ctx, data)
+}
+
+func (c *Call) Close(ctx context.Context) error {
+	c.closeOnce.Do(func() {
+		c.cancel()
+		var errs []error
+		if err := c.client.Close(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close client leg: %w", err))
+		}
+		if err := c.upstream.Close(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close upstream leg: %w", err))
+		}
+		waited := make(chan struct{})
+		go func() {
+			c.wg.Wait()
+			close(waited)
+		}()
+		select {
+		case <-waited:
+		case <-ctx.Done():
+			errs = append(errs, ctx.Err())
+		}
+		close(c.done)
+		c.gateway.remove(c)
+		if err := errors.Join(errs...); err != nil {
+			c.closeErr = fmt.Errorf("failed to close call %s: %w", c.Id, err)
+		}
+	})
+	return c.closeErr
+}
+
+func (c *Call) end() {
+	c.endOnce.Do(func() { close(c.ended) })
+}
+
+func (c *Call) relayEvents(from, to realtime.Transport, dir Direction) {
+	defer c.wg.Done()
+	defer c.end()
+	for data := range from.Events() {
+		event, err := realtime.ParseEvent(data)
+		if err != nil {
+			c.gateway.logger.NoCtxWarnf("dropping malformed %s event: %v", dir, err)
+			continue
+		}
+		forward, err := c.intercept(dir, event)
+		if err != nil {
+			c.reject(dir, event, err)
+			continue
+		}
+		if forward == nil {
+			continue
+		}
+		if err := to.Send(c.ctx, forward); err != nil {
+			if c.ctx.Err() == nil {
+				c.gateway.logger.NoCtxError(err, "failed to relay event")
+			}
+			return
+		}
+	}
+}
+
+func (c *Call) intercept(dir Direction, event realtime.Event) ([]byte, error) {
+	data := []byte(event.Raw)
+	for _, interceptor := range c.gateway.cfg.Interceptors {
+		forward, err := interceptor(c.ctx, c, dir, event)
+		if err != nil || forward == nil {
+			return nil, err
+		}
+		if string(forward) != string(data) {
+			if event, err = realtime.ParseEvent(forward); err != nil {
+				return nil, fmt.Errorf("interceptor produced an invalid event: %w", err)
+			}
+			data = forward
+		}
+	}
+	return data, nil
+}
+
+func (c *Call) reject(dir Direction, event realtime.Event, err error) {
+	c.gateway.logger.NoCtxWarnf("rejected %s %s event: %v", dir, event.Type, err)
+	if dir != ClientToServer {
+		return
+	}
+	reply := realtime.NewErrorEvent(realtime.ErrorDetail{
+		Type:    "invalid_request_error",
+		Code:    "rejected_by_gateway",
+		Message: err.Error(),
+		EventId: event.EventId,
+	})
+	if err := c.SendClient(c.ctx, reply); err != nil && c.ctx.Err() == nil {
+		c.gateway.logger.NoCtxError(err, "failed to send error event")
+	}
+}
+
+func (c *Call) relayAudio(from, to realtime.Transport) {
+	defer c.wg.Done()
+	defer c.end()
+	for frame := range from.Audio() {
+		if err := to.WriteAudio(c.ctx, frame); err != nil {
+			if c.ctx.Err() == nil {
+				c.gateway.logger.NoCtxError(err, "failed to relay audio")
+			}
+			return
+		}
+	}
+}
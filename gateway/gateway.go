@@ -0,0 +1,242 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/valyala/fasthttp"
+	"gitlab.bcc-hyperdev.org/bcc-hyperdev/realtime"
+	"gitlab.bcc-hyperdev.org/bcc-hyperdev/realtime/rtc"
+	"gitlab.bcc-hyperdev.org/bcc-hyperdev/realtime/shared"
+)
+
+const (
+	DefaultBasePath     = "/calls"
+	DefaultSetupTimeout = 15 * time.Second
+)
+
+var ErrGatewayClosed = errors.New("gateway closed")
+
+// UpstreamFunc opens the provider leg of a call, typically with rtc.Dial.
+type UpstreamFunc func(ctx context.Context, call *Call) (realtime.Transport, error)
+
+type Config struct {
+	// NewCodec creates the codec of the browser leg, once per call.
+	NewCodec func() (rtc.Codec, error)
+	// Ice is the network policy of the browser leg, e.g. from
+	// rtc.IceConfigFromEnv. Optional.
+	Ice      *rtc.IceConfig
+	Upstream UpstreamFunc
+	// Interceptors run in order on every relayed event.
+	Interceptors []Interceptor
+	// Authorize rejects signaling requests by returning an error. Optional.
+	Authorize func(ctx *fasthttp.RequestCtx) error
+	// OnCallStart and OnCallEnd are optional lifecycle hooks.
+	OnCallStart func(call *Call)
+	OnCallEnd   func(call *Call)
+	// BasePath is where the signaling endpoint is served, /calls by default.
+	BasePath     string
+	SetupTimeout time.Duration
+	// Trickle answers offers advertising trickle ICE before gathering;
+	// candidates are then exchanged with PATCH {BasePath}/{id}.
+	Trickle bool
+	// GatherTimeout bounds the wait for gathering of calls without trickle.
+	GatherTimeout time.Duration
+}
+
+// Gateway terminates browser WebRTC calls and relays each of them to its own
+// provider call, so that events can be inspected and rewritten server-side.
+//
+// Signaling mirrors the provider's calls API: POST {BasePath} with an SDP
+// offer returns the SDP answer and the call's location, DELETE
+// {BasePath}/{id} hangs up. With trickle ICE, PATCH {BasePath}/{id} with
+// application/trickle-ice-sdpfrag candidates returns the gateway's, as in
+// WHIP.
+type Gateway struct {
+	logger *shared.Logger
+	cfg    *Config
+
+	mu     sync.Mutex
+	calls  map[string]*Call
+	closed bool
+	wg     sync.WaitGroup
+}
+
+func NewGateway(logger *shared.Logger, cfg *Config) (g *Gateway, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("failed to create gateway: %w", err)
+		}
+	}()
+	if cfg == nil || cfg.Upstream == nil {
+		return nil, fmt.Errorf("upstream is required")
+	}
+	if cfg.NewCodec == nil {
+		return nil, fmt.Errorf("codec is required")
+	}
+	if cfg.BasePath == "" {
+		cfg.BasePath = DefaultBasePath
+	}
+	if cfg.SetupTimeout <= 0 {
+		cfg.SetupTimeout = DefaultSetupTimeout
+	}
+	return &Gateway{
+		logger: logger,
+		cfg:    cfg,
+		calls:  make(map[string]*Call),
+	}, nil
+}
+
+func (g *Gateway) Handle(ctx *fasthttp.RequestCtx) {
+	path := strings.TrimSuffix(string(ctx.Path()), "/")
+	if g.cfg.Authorize != nil {
+		if err := g.cfg.Authorize(ctx); err != nil {
+			ctx.Error(err.Error(), fasthttp.StatusUnauthorized)
+			return
+		}
+	}
+	switch {
+	case path == g.cfg.BasePath && ctx.IsPost():
+		g.handleOffer(ctx)
+	case strings.HasPrefix(path, g.cfg.BasePath+"/") && ctx.IsDelete():
+		g.handleHangup(ctx, strings.TrimPrefix(path, g.cfg.BasePath+"/"))
+	case strings.HasPrefix(path, g.cfg.BasePath+"/") && ctx.IsPatch():
+		g.handleCandidates(ctx, strings.TrimPrefix(path, g.cfg.BasePath+"/"))
+	default:
+		ctx.Error("not found", fasthttp.StatusNotFound)
+	}
+}
+
+func (g *Gateway) handleOffer(ctx *fasthttp.RequestCtx) {
+	offer := string(ctx.PostBody())
+	if offer == "" {
+		ctx.Error("SDP offer is required", fasthttp.StatusBadRequest)
+		return
+	}
+	setupCtx, cancel := context.WithTimeout(ctx, g.cfg.SetupTimeout)
+	defer cancel()
+	call, answer, err := g.accept(setupCtx, offer)
+	if err != nil {
+		g.logger.Error(ctx, err, "failed to set up call")
+		if errors.Is(err, ErrGatewayClosed) {
+			ctx.Error(err.Error(), fasthttp.StatusServiceUnavailable)
+			return
+		}
+		ctx.Error("failed to set up call", fasthttp.StatusBadGateway)
+		return
+	}
+	ctx.Response.Header.Set("Location", g.cfg.BasePath+"/"+call.Id)
+	ctx.SetContentType("application/sdp")
+	ctx.SetStatusCode(fasthttp.StatusCreated)
+	ctx.SetBodyString(answer)
+}
+
+func (g *Gateway) handleHangup(ctx *fasthttp.RequestCtx, id string) {
+	call, ok := g.Call(id)
+	if !ok {
+		ctx.Error("call not found", fasthttp.StatusNotFound)
+		return
+	}
+	if err := call.Close(ctx); err != nil {
+		g.logger.Error(ctx, err, "failed to hang up call")
+	}
+	ctx.SetStatusCode(fasthttp.StatusNoContent)
+}
+
+func (g *Gateway) accept(ctx context.Context, offer string) (call *Call, answer string, err error) {
+	codec, err := g.cfg.NewCodec()
+	if err != nil {
+		return nil, "", err
+	}
+	call = newCall(g, uuid.NewString())
+	rtcCfg := &rtc.Config{Codec: codec, Ice: g.cfg.Ice, GatherTimeout: g.cfg.GatherTimeout}
+	if g.cfg.Trickle && rtc.SupportsTrickle(offer) {
+		call.candidates = newCandidateQueue()
+		rtcCfg.Trickle = call.candidates.push
+	}
+	call.client, answer, err = rtc.Accept(ctx, g.logger, rtcCfg, offer)
+	if err != nil {
+		return nil, "", err
+	}
+	call.upstream, err = g.cfg.Upstream(ctx, call)
+	if err != nil {
+		_ = call.client.Close(context.WithoutCancel(ctx))
+		return nil, "", fmt.Errorf("failed to open upstream: %w", err)
+	}
+
+	g.mu.Lock()
+	if g.closed {
+		g.mu.Unlock()
+		closeCtx := context.WithoutCancel(ctx)
+		_ = errors.Join(call.client.Close(closeCtx), call.upstream.Close(closeCtx))
+		return nil, "", ErrGatewayClosed
+	}
+	g.calls[call.Id] = call
+	g.wg.Add(1)
+	g.mu.Unlock()
+
+	call.start()
+	if g.cfg.OnCallStart != nil {
+		g.cfg.OnCallStart(call)
+	}
+	return call, answer, nil
+}
+
+func (g *Gateway) Call(id string) (*Call, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	call, ok := g.calls[id]
+	return call, ok
+}
+
+func (g *Gateway) Calls() []*Call {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	calls := make([]*Call, 0, len(g.calls))
+	for _, call := range g.calls {
+		calls = append(calls, call)
+	}
+	return calls
+}
+
+func (g *Gateway) remove(call *Call) {
+	g.mu.Lock()
+	delete(g.calls, call.Id)
+	g.mu.Unlock()
+	if g.cfg.OnCallEnd != nil {
+		g.cfg.OnCallEnd(call)
+	}
+	g.wg.Done()
+}
+
+// Close rejects new calls and hangs up the live ones.
+func (g *Gateway) Close(ctx context.Context) error {
+	g.mu.Lock()
+	g.closed = true
+	g.mu.Unlock()
+	var errs []error
+	for _, call := range g.Calls() {
+		if err := call.Close(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	done := make(chan struct{})
+	go func() {
+		g.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		errs = append(errs, ctx.Err())
+	}
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("failed to close gateway: %w", err)
+	}
+	return nil
+}
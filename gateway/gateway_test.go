@@ -0,0 +1,354 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+	"github.com/valyala/fasthttp"
+	"gitlab.bcc-hyperdev.org/bcc-hyperdev/realtime"
+	"gitlab.bcc-hyperdev.org/bcc-hyperdev/realtime/rtc"
+	"gitlab.bcc-hyperdev.org/bcc-hyperdev/realtime/shared"
+)
+
+// fakeUpstream stands in for the provider leg.
+type fakeUpstream struct {
+	events chan []byte
+	audio  chan []byte
+	sent   chan []byte
+	heard  chan []byte
+
+	mu     sync.Mutex
+	closed bool
+}
+
+func newFakeUpstream() *fakeUpstream {
+	return &fakeUpstream{
+		events: make(chan []byte, 16),
+		audio:  make(chan []byte, 16),
+		sent:   make(chan []byte, 16),
+		heard:  make(chan []byte, 1024),
+	}
+}
+
+func (u *fakeUpstream) Send(ctx context.Context, event []byte) error {
+	u.sent <- event
+	return nil
+}
+
+func (u *fakeUpstream) Events() <-chan []byte { return u.events }
+
+func (u *fakeUpstream) WriteAudio(ctx context.Context, frame []byte) error {
+	select {
+	case u.heard <- frame:
+	default:
+	}
+	return nil
+}
+
+func (u *fakeUpstream) Audio() <-chan []byte { return u.audio }
+
+func (u *fakeUpstream) Close(ctx context.Context) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if !u.closed {
+		u.closed = true
+		close(u.events)
+		close(u.audio)
+	}
+	return nil
+}
+
+func (u *fakeUpstream) isClosed() bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.closed
+}
+
+func serveGateway(t *testing.T, g *Gateway) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	server := &fasthttp.Server{Handler: g.Handle}
+	go func() { _ = server.Serve(ln) }()
+	t.Cleanup(func() { _ = server.Shutdown() })
+	return "http://" + ln.Addr().String()
+}
+
+func receive(t *testing.T, ch <-chan []byte) []byte {
+	t.Helper()
+	select {
+	case data := <-ch:
+		return data
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for data")
+		return nil
+	}
+}
+
+func TestGatewayRelay(t *testing.T) {
+	logger := shared.NewLogger()
+	upstream := newFakeUpstream()
+	var mu sync.Mutex
+	var transcripts []string
+	started := make(chan *Call, 1)
+	ended := make(chan *Call, 1)
+
+	g, err := NewGateway(logger, &Config{
+		NewCodec: func() (rtc.Codec, error) { return rtc.NewPCMUCodec() },
+		Upstream: func(ctx context.Context, call *Call) (realtime.Transport, error) {
+			return upstream, nil
+		},
+		Interceptors: []Interceptor{
+			func(ctx context.Context, call *Call, dir Direction, event realtime.Event) ([]byte, error) {
+				if dir == ClientToServer && strings.Contains(string(event.Raw), "forbidden") {
+					return nil, errors.New("forbidden content")
+				}
+				if dir == ClientToServer && event.Type == "session.update" {
+					return []byte(`{"type":"session.update","session":{"tools":[{"type":"function","name":"lookup"}]}}`), nil
+				}
+				if dir == ServerToClient && event.Type == "response.output_audio_transcript.done" {
+					mu.Lock()
+					transcripts = append(transcripts, string(event.Raw))
+					mu.Unlock()
+				}
+				return event.Raw, nil
+			},
+		},
+		OnCallStart: func(call *Call) { started <- call },
+		OnCallEnd:   func(call *Call) { ended <- call },
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	url := serveGateway(t, g)
+
+	var location string
+	signal := func(ctx context.Context, offer string) (string, error) {
+		req := fasthttp.AcquireRequest()
+		resp := fasthttp.AcquireResponse()
+		defer fasthttp.ReleaseRequest(req)
+		defer fasthttp.ReleaseResponse(resp)
+		req.SetRequestURI(url + "/calls")
+		req.Header.SetMethod(fasthttp.MethodPost)
+		req.Header.SetContentType("application/sdp")
+		req.SetBodyString(offer)
+		if err := fasthttp.Do(req, resp); err != nil {
+			return "", err
+		}
+		if resp.StatusCode() != fasthttp.StatusCreated {
+			return "", errors.New(string(resp.Body()))
+		}
+		location = string(resp.Header.Peek("Location"))
+		return string(resp.Body()), nil
+	}
+	codec, _ := rtc.NewPCMUCodec()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	browser, err := rtc.Dial(ctx, logger, &rtc.Config{Codec: codec}, signal)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer func() { _ = browser.Close(context.Background()) }()
+	call := <-started
+	if location != "/calls/"+call.Id {
+		t.Errorf("Expected location /calls/%s, got %s", call.Id, location)
+	}
+
+	t.Run("RewritesClientEvents", func(t *testing.T) {
+		if err := browser.Send(ctx, []byte(`{"type":"session.update","session":{}}`)); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if sent := string(receive(t, upstream.sent)); !strings.Contains(sent, `"lookup"`) {
+			t.Errorf("Expected injected tool, got %s", sent)
+		}
+	})
+
+	t.Run("RejectsClientEvents", func(t *testing.T) {
+		event := `{"type":"conversation.item.create","event_id":"evt_1","item":{"text":"forbidden"}}`
+		if err := browser.Send(ctx, []byte(event)); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		var reply realtime.ErrorEvent
+		_ = json.Unmarshal(receive(t, browser.Events()), &reply)
+		if reply.Type != realtime.EventTypeError || reply.Error.Code != "rejected_by_gateway" || reply.Error.EventId != "evt_1" {
+			t.Errorf("Expected rejection error event, got %+v", reply)
+		}
+		select {
+		case sent := <-upstream.sent:
+			t.Errorf("Expected rejected event not to be relayed, got %s", sent)
+		default:
+		}
+	})
+
+	t.Run("RelaysServerEvents", func(t *testing.T) {
+		event := `{"type":"response.output_audio_transcript.done","transcript":"hello"}`
+		upstream.events <- []byte(event)
+		if got := string(receive(t, browser.Events())); got != event {
+			t.Errorf("Expected %s, got %s", event, got)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if len(transcripts) != 1 {
+			t.Errorf("Expected 1 logged transcript, got %d", len(transcripts))
+		}
+	})
+
+	t.Run("RelaysAudio", func(t *testing.T) {
+		frame := make([]byte, 960)
+		for {
+			if err := browser.WriteAudio(ctx, frame); err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			select {
+			case <-upstream.heard:
+			case <-time.After(20 * time.Millisecond):
+				continue
+			}
+			break
+		}
+		for {
+			upstream.audio <- frame
+			select {
+			case <-browser.Audio():
+			case <-time.After(20 * time.Millisecond):
+				continue
+			}
+			break
+		}
+	})
+
+	t.Run("HangsUp", func(t *testing.T) {
+		req := fasthttp.AcquireRequest()
+		resp := fasthttp.AcquireResponse()
+		defer fasthttp.ReleaseRequest(req)
+		defer fasthttp.ReleaseResponse(resp)
+		req.SetRequestURI(url + location)
+		req.Header.SetMethod(fasthttp.MethodDelete)
+		if err := fasthttp.Do(req, resp); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if resp.StatusCode() != fasthttp.StatusNoContent {
+			t.Errorf("Expected status 204, got %d", resp.StatusCode())
+		}
+		if (<-ended).Id != call.Id {
+			t.Error("Expected OnCallEnd for the call")
+		}
+		if !upstream.isClosed() {
+			t.Error("Expected upstream to be closed")
+		}
+		if _, ok := g.Call(call.Id); ok {
+			t.Error("Expected call to be removed")
+		}
+		// The browser notices the remote hangup and closes itself.
+		for range browser.Events() {
+		}
+	})
+
+	if err := g.Close(ctx); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+}
+
+func TestGatewayTrickle(t *testing.T) {
+	logger := shared.NewLogger()
+	upstream := newFakeUpstream()
+	g, err := NewGateway(logger, &Config{
+		NewCodec: func() (rtc.Codec, error) { return rtc.NewPCMUCodec() },
+		Upstream: func(ctx context.Context, call *Call) (realtime.Transport, error) {
+			return upstream, nil
+		},
+		Trickle: true,
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	url := serveGateway(t, g)
+
+	var location, answer string
+	signal := func(ctx context.Context, offer string) (string, error) {
+		req := fasthttp.AcquireRequest()
+		resp := fasthttp.AcquireResponse()
+		defer fasthttp.ReleaseRequest(req)
+		defer fasthttp.ReleaseResponse(resp)
+		req.SetRequestURI(url + "/calls")
+		req.Header.SetMethod(fasthttp.MethodPost)
+		req.Header.SetContentType("application/sdp")
+		req.SetBodyString(offer)
+		if err := fasthttp.Do(req, resp); err != nil {
+			return "", err
+		}
+		location = string(resp.Header.Peek("Location"))
+		answer = string(resp.Body())
+		return answer, nil
+	}
+	var mu sync.Mutex
+	var patches, received int
+	send := func(ctx context.Context, candidate webrtc.ICECandidateInit) ([]webrtc.ICECandidateInit, error) {
+		req := fasthttp.AcquireRequest()
+		resp := fasthttp.AcquireResponse()
+		defer fasthttp.ReleaseRequest(req)
+		defer fasthttp.ReleaseResponse(resp)
+		req.SetRequestURI(url + location)
+		req.Header.SetMethod(fasthttp.MethodPatch)
+		// Parameters of the media type are ignored.
+		req.Header.SetContentType("application/trickle-ice-sdpfrag; charset=utf-8")
+		req.SetBodyString(rtc.CandidateFragment([]webrtc.ICECandidateInit{candidate}))
+		if err := fasthttp.Do(req, resp); err != nil {
+			return nil, err
+		}
+		if status := resp.StatusCode(); status != fasthttp.StatusOK && status != fasthttp.StatusNoContent {
+			return nil, errors.New(string(resp.Body()))
+		}
+		remote := rtc.ParseCandidateFragment(string(resp.Body()))
+		mu.Lock()
+		patches++
+		received += len(remote)
+		mu.Unlock()
+		return remote, nil
+	}
+	codec, _ := rtc.NewPCMUCodec()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	browser, err := rtc.Dial(ctx, logger, &rtc.Config{Codec: codec, Trickle: send}, signal)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer func() { _ = browser.Close(context.Background()) }()
+	if !rtc.SupportsTrickle(answer) {
+		t.Error("Expected a trickle answer")
+	}
+
+	if err := browser.Send(ctx, []byte(`{"type":"session.update","session":{}}`)); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	receive(t, upstream.sent)
+	mu.Lock()
+	if patches == 0 || received == 0 {
+		t.Errorf("Expected candidates both ways, got %d patches and %d gateway candidates", patches, received)
+	}
+	mu.Unlock()
+
+	req := fasthttp.AcquireRequest()
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseRequest(req)
+	defer fasthttp.ReleaseResponse(resp)
+	req.SetRequestURI(url + "/calls/unknown")
+	req.Header.SetMethod(fasthttp.MethodPatch)
+	req.Header.SetContentType("application/trickle-ice-sdpfrag")
+	if err := fasthttp.Do(req, resp); err != nil || resp.StatusCode() != fasthttp.StatusNotFound {
+		t.Errorf("Expected status 404 for an unknown call, got %d, %v", resp.StatusCode(), err)
+	}
+
+	if err := g.Close(ctx); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+}
@@ -0,0 +1,89 @@
+package gateway
+
+import (
+	"context"
+	"mime"
+	"sync"
+
+	"github.com/pion/webrtc/v4"
+	"github.com/valyala/fasthttp"
+	"gitlab.bcc-hyperdev.org/bcc-hyperdev/realtime/rtc"
+)
+
+const trickleContentType = "application/trickle-ice-sdpfrag"
+
+// candidateQueue holds the gateway's candidates of a call until the browser
+// collects them with its next PATCH.
+type candidateQueue struct {
+	mu       sync.Mutex
+	pending  []webrtc.ICECandidateInit
+	gathered chan struct{}
+	once     sync.Once
+}
+
+func newCandidateQueue() *candidateQueue {
+	return &candidateQueue{gathered: make(chan struct{})}
+}
+
+func (q *candidateQueue) push(ctx context.Context, candidate webrtc.ICECandidateInit) ([]webrtc.ICECandidateInit, error) {
+	q.mu.Lock()
+	q.pending = append(q.pending, candidate)
+	q.mu.Unlock()
+	if candidate.Candidate == "" {
+		q.once.Do(func() { close(q.gathered) })
+	}
+	return nil, nil
+}
+
+func (q *candidateQueue) drain() []webrtc.ICECandidateInit {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	pending := q.pending
+	q.pending = nil
+	return pending
+}
+
+// handleCandidates adds the browser's trickled candidates to the call and
+// answers with the gateway's gathered since the last PATCH, as in WHIP. Once
+// the browser is done, the answer waits for the gateway to finish gathering.
+func (g *Gateway) handleCandidates(ctx *fasthttp.RequestCtx, id string) {
+	call, ok := g.Call(id)
+	if !ok {
+		ctx.Error("call not found", fasthttp.StatusNotFound)
+		return
+	}
+	client, ok := call.client.(*rtc.Transport)
+	if !ok || call.candidates == nil {
+		ctx.Error("trickle ICE is not supported", fasthttp.StatusMethodNotAllowed)
+		return
+	}
+	if mediaType, _, err := mime.ParseMediaType(string(ctx.Request.Header.ContentType())); err != nil || mediaType != trickleContentType {
+		ctx.Error("unsupported content type", fasthttp.StatusUnsupportedMediaType)
+		return
+	}
+	final := false
+	for _, candidate := range rtc.ParseCandidateFragment(string(ctx.PostBody())) {
+		if err := client.AddRemoteCandidate(candidate); err != nil {
+			g.logger.Error(ctx, err, "failed to add browser candidate")
+			ctx.Error("invalid candidate", fasthttp.StatusBadRequest)
+			return
+		}
+		final = final || candidate.Candidate == ""
+	}
+	if final {
+		waitCtx, cancel := context.WithTimeout(ctx, g.cfg.SetupTimeout)
+		defer cancel()
+		select {
+		case <-call.candidates.gathered:
+		case <-waitCtx.Done():
+		}
+	}
+	candidates := call.candidates.drain()
+	if len(candidates) == 0 {
+		ctx.SetStatusCode(fasthttp.StatusNoContent)
+		return
+	}
+	ctx.SetContentType(trickleContentType)
+	ctx.SetStatusCode(fasthttp.StatusOK)
+	ctx.SetBodyString(rtc.CandidateFragment(candidates))
+}
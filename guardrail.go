@@ -0,0 +1,552 @@
+package realtime
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"gitlab.bcc-hyperdev.org/bcc-hyperdev/realtime/shared"
+)
+
+// RedactionMask replaces redacted content.
+const RedactionMask = "[redacted]"
+
+// guardrailKey marks the metadata of the responses a Guardrail creates, which
+// it does not check.
+const guardrailKey = "guardrail"
+
+// replyInstructions has the model say a canned reply.
+const replyInstructions = "Say exactly the following, and nothing else: %s"
+
+type Verdict int
+
+const (
+	VerdictAllow Verdict = iota
+	// VerdictFlag reports the content and lets it through.
+	VerdictFlag
+	// VerdictRedact reports the content along with a redacted copy, which
+	// Guardrail.RedactTranscript applies to a Transcript.
+	VerdictRedact
+	// VerdictBlock cancels the response, deletes the item from the
+	// conversation and says the canned reply instead.
+	VerdictBlock
+)
+
+func (v Verdict) String() string {
+	switch v {
+	case VerdictAllow:
+		return "allow"
+	case VerdictFlag:
+		return "flag"
+	case VerdictRedact:
+		return "redact"
+	case VerdictBlock:
+		return "block"
+	}
+	return fmt.Sprintf("verdict(%d)", int(v))
+}
+
+type ContentKind string
+
+const (
+	ContentUserTranscript      ContentKind = "user_transcript"
+	ContentAssistantTranscript ContentKind = "assistant_transcript"
+	ContentAssistantText       ContentKind = "assistant_text"
+	ContentFunctionArguments   ContentKind = "function_arguments"
+)
+
+// Content is the text of a content part, or the arguments of a function call,
+// as it streams in.
+type Content struct {
+	Kind ContentKind
+	// ResponseId is empty for user content.
+	ResponseId   string
+	ItemId       string
+	ContentIndex int
+	// Name is the function called, once the arguments are final.
+	Name string
+	// Delta is the text added by this update, empty once final.
+	Delta string
+	// Text is the text so far, or all of it once final.
+	Text  string
+	Final bool
+}
+
+func (c Content) key() contentKey {
+	return contentKey{kind: c.Kind, itemId: c.ItemId, contentIndex: c.ContentIndex}
+}
+
+type contentKey struct {
+	kind         ContentKind
+	itemId       string
+	contentIndex int
+}
+
+type Decision struct {
+	Verdict Verdict
+	Reason  string
+	// Redacted is the text with the objectionable parts masked, set with
+	// VerdictRedact.
+	Redacted string
+}
+
+// Policy decides on content as it streams in. Check sees the whole text so
+// far with every delta and runs on the session's event loop, so slow checks
+// delay the session's events.
+type Policy interface {
+	Name() string
+	Check(ctx context.Context, content Content) (Decision, error)
+}
+
+// Forgetter is implemented by policies keeping state per content. Forget is
+// called for content that ends without a final check, e.g. because it was
+// blocked or its response cancelled.
+type Forgetter interface {
+	Forget(content Content)
+}
+
+// Violation is a decision of a policy other than VerdictAllow.
+type Violation struct {
+	Policy   string
+	Content  Content
+	Decision Decision
+}
+
+type ViolationHandler func(violation Violation)
+
+type GuardrailConfig struct {
+	// Policies are checked in order; the strictest verdict applies.
+	Policies []Policy
+	// Reply is said instead of blocked content. Optional.
+	Reply string
+	// FailClosed blocks content a policy failed to check; by default it is
+	// let through.
+	FailClosed bool
+}
+
+type guardedContent struct {
+	responseId string
+	text       string
+	// reported holds the policies that objected to the content.
+	reported shared.Set[string]
+}
+
+type guardrailEvent struct {
+	ResponseId   string `json:"response_id"`
+	ItemId       string `json:"item_id"`
+	ContentIndex int    `json:"content_index"`
+	Name         string `json:"name"`
+	Delta        string `json:"delta"`
+	Transcript   string `json:"transcript"`
+	Text         string `json:"text"`
+	Arguments    string `json:"arguments"`
+}
+
+// Guardrail runs the user and assistant transcripts, the assistant text and
+// the function call arguments of a session through a pipeline of policies.
+// Violations are reported to handlers; content a policy blocks is cut off
+// mid-stream.
+//
+// Redaction reports a redacted copy, which RedactTranscript applies to a
+// Transcript; the events other handlers, taps and recordings see are
+// unchanged. Tool runners must check Blocked before running a call, which
+// holds once function_call_arguments.done reached handlers registered after
+// the guardrail.
+type Guardrail struct {
+	logger  *shared.Logger
+	session *Session
+	cfg     *GuardrailConfig
+	remove  func()
+
+	mu       sync.Mutex
+	contents map[contentKey]*guardedContent
+	// blockedItems and blockedResponses are ignored from then on, as are the
+	// exempt responses the guardrail created.
+	blockedItems     shared.Set[string]
+	blockedResponses shared.Set[string]
+	exempt           shared.Set[string]
+	handlers         handlers[ViolationHandler]
+}
+
+// NewGuardrail guards session from now on. session may be nil to feed events
+// through Handle, e.g. from a recording; blocking then only reports.
+func NewGuardrail(logger *shared.Logger, session *Session, cfg *GuardrailConfig) (g *Guardrail, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("failed to create guardrail: %w", err)
+		}
+	}()
+	if cfg == nil || len(cfg.Policies) == 0 {
+		return nil, fmt.Errorf("policies are required")
+	}
+	g = &Guardrail{
+		logger:           logger,
+		session:          session,
+		cfg:              cfg,
+		contents:         make(map[contentKey]*guardedContent),
+		blockedItems:     shared.NewSet[string](),
+		blockedResponses: shared.NewSet[string](),
+		exempt:           shared.NewSet[string](),
+	}
+	if session != nil {
+		g.remove = session.OnEvent(g.Handle)
+	}
+	return g, nil
+}
+
+// Close stops guarding the session.
+func (g *Guardrail) Close() {
+	if g.remove != nil {
+		g.remove()
+	}
+}
+
+// OnViolation registers a handler called once for each policy objecting to
+// a content, and again with the final redacted text for redactions. Handlers
+// run on the session's event loop and must not block.
+func (g *Guardrail) OnViolation(handler ViolationHandler) (remove func()) {
+	return g.handlers.add(handler)
+}
+
+// Blocked reports whether the item was blocked.
+func (g *Guardrail) Blocked(itemId string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.blockedItems.Contains(itemId)
+}
+
+// Handle applies a server event to the guardrail.
+func (g *Guardrail) Handle(ctx context.Context, event Event) {
+	var kind ContentKind
+	var final bool
+	switch event.Type {
+	case EventTypeResponseCreated:
+		g.trackExempt(event)
+		return
+	case EventTypeResponseDone:
+		g.release(event)
+		return
+	case EventTypeInputTranscriptionDelta, EventTypeInputTranscriptionCompleted:
+		kind, final = ContentUserTranscript, event.Type == EventTypeInputTranscriptionCompleted
+	case EventTypeResponseOutputAudioTranscriptDelta, EventTypeResponseOutputAudioTranscriptDone:
+		kind, final = ContentAssistantTranscript, event.Type == EventTypeResponseOutputAudioTranscriptDone
+	case EventTypeResponseOutputTextDelta, EventTypeResponseOutputTextDone:
+		kind, final = ContentAssistantText, event.Type == EventTypeResponseOutputTextDone
+	case EventTypeResponseFunctionArgumentsDelta, EventTypeResponseFunctionArgumentsDone:
+		kind, final = ContentFunctionArguments, event.Type == EventTypeResponseFunctionArgumentsDone
+	default:
+		return
+	}
+	var payload guardrailEvent
+	if err := event.Decode(&payload); err != nil {
+		g.logger.NoCtxWarnf("failed to guard content: %v", err)
+		return
+	}
+	content := Content{
+		Kind:         kind,
+		ResponseId:   payload.ResponseId,
+		ItemId:       payload.ItemId,
+		ContentIndex: payload.ContentIndex,
+		Name:         payload.Name,
+		Final:        final,
+	}
+
+	g.mu.Lock()
+	if g.blockedItems.Contains(content.ItemId) || g.blockedResponses.Contains(content.ResponseId) || g.exempt.Contains(content.ResponseId) {
+		g.mu.Unlock()
+		return
+	}
+	guarded, ok := g.contents[content.key()]
+	if !ok {
+		guarded = &guardedContent{responseId: content.ResponseId, reported: shared.NewSet[string]()}
+		g.contents[content.key()] = guarded
+	}
+	if final {
+		guarded.text = payload.Transcript + payload.Text + payload.Arguments
+		delete(g.contents, content.key())
+	} else {
+		guarded.text += payload.Delta
+		content.Delta = payload.Delta
+	}
+	content.Text = guarded.text
+	g.mu.Unlock()
+
+	verdict, violations := g.check(ctx, content, guarded)
+	if verdict == VerdictBlock {
+		g.mu.Lock()
+		g.blockedItems.Add(content.ItemId)
+		if content.ResponseId != "" {
+			g.blockedResponses.Add(content.ResponseId)
+		}
+		g.mu.Unlock()
+		g.forget(func(key contentKey, guarded *guardedContent) bool {
+			return key.itemId == content.ItemId || content.ResponseId != "" && guarded.responseId == content.ResponseId
+		})
+	}
+	if len(violations) > 0 {
+		handlers := g.handlers.snapshot()
+		for _, violation := range violations {
+			for _, handler := range handlers {
+				handler(violation)
+			}
+		}
+	}
+	if verdict == VerdictBlock && g.session != nil {
+		g.block(ctx, content)
+	}
+}
+
+// check runs content through the policies and returns the strictest verdict
+// along with the violations to report.
+func (g *Guardrail) check(ctx context.Context, content Content, guarded *guardedContent) (Verdict, []Violation) {
+	verdict := VerdictAllow
+	var violations []Violation
+	for _, policy := range g.cfg.Policies {
+		decision, err := policy.Check(ctx, content)
+		if err != nil {
+			g.logger.NoCtxError(err, fmt.Sprintf("policy %s failed to check content", policy.Name()))
+			if !g.cfg.FailClosed {
+				continue
+			}
+			decision = Decision{Verdict: VerdictBlock, Reason: err.Error()}
+		}
+		if decision.Verdict == VerdictAllow {
+			continue
+		}
+		verdict = max(verdict, decision.Verdict)
+		// Policies see every delta but report once, and redactions once more
+		// with the final text.
+		if guarded.reported.Add(policy.Name()) && !(content.Final && decision.Verdict == VerdictRedact) {
+			continue
+		}
+		violations = append(violations, Violation{Policy: policy.Name(), Content: content, Decision: decision})
+	}
+	return verdict, violations
+}
+
+func (g *Guardrail) trackExempt(event Event) {
+	var payload ResponseEvent
+	if err := event.Decode(&payload); err != nil {
+		g.logger.NoCtxWarnf("failed to guard response: %v", err)
+		return
+	}
+	if payload.Response.Metadata[guardrailKey] == "" {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.exempt.Add(payload.Response.Id)
+}
+
+// release drops the contents of a finished response, which a cancelled or
+// failed response leaves unfinished, and the sets the response was in.
+func (g *Guardrail) release(event Event) {
+	var payload ResponseEvent
+	if err := event.Decode(&payload); err != nil {
+		g.logger.NoCtxWarnf("failed to guard response: %v", err)
+		return
+	}
+	id := payload.Response.Id
+	g.mu.Lock()
+	g.blockedResponses.Remove(id)
+	g.exempt.Remove(id)
+	g.mu.Unlock()
+	g.forget(func(key contentKey, guarded *guardedContent) bool { return guarded.responseId == id })
+}
+
+// forget drops the contents matching match, along with the state policies
+// keep for them.
+func (g *Guardrail) forget(match func(key contentKey, guarded *guardedContent) bool) {
+	var forgotten []Content
+	g.mu.Lock()
+	for key, guarded := range g.contents {
+		if match(key, guarded) {
+			delete(g.contents, key)
+			forgotten = append(forgotten, Content{Kind: key.kind, ResponseId: guarded.responseId, ItemId: key.itemId, ContentIndex: key.contentIndex})
+		}
+	}
+	g.mu.Unlock()
+	for _, policy := range g.cfg.Policies {
+		if forgetter, ok := policy.(Forgetter); ok {
+			for _, content := range forgotten {
+				forgetter.Forget(content)
+			}
+		}
+	}
+}
+
+// RedactTranscript replaces the text of transcript segments with the
+// redacted copies the guardrail reports, until remove is called.
+func (g *Guardrail) RedactTranscript(transcript *Transcript) (remove func()) {
+	return g.OnViolation(func(violation Violation) {
+		content := violation.Content
+		if violation.Decision.Verdict != VerdictRedact {
+			return
+		}
+		switch content.Kind {
+		case ContentUserTranscript:
+			transcript.Redact(SpeakerUser, content.ItemId, content.ContentIndex, violation.Decision.Redacted)
+		case ContentAssistantTranscript:
+			transcript.Redact(SpeakerAssistant, content.ItemId, content.ContentIndex, violation.Decision.Redacted)
+		}
+	})
+}
+
+// block cancels the responses of blocked content, deletes its item so that
+// the model does not build on it and asks for the canned reply.
+func (g *Guardrail) block(ctx context.Context, content Content) {
+	responseIds := []string{content.ResponseId}
+	if content.Kind == ContentUserTranscript {
+		// Whatever the server is answering the user with goes too.
+		responseIds = g.session.PendingResponses()
+	}
+	for _, id := range responseIds {
+		if err := g.session.Send(ctx, NewResponseCancelEvent(id)); err != nil {
+			g.logger.NoCtxError(err, "failed to cancel blocked response")
+		}
+	}
+	if g.session.interrupter != nil {
+		g.session.interruptPlayback(ctx)
+	}
+	if err := g.session.Send(ctx, NewConversationItemDeleteEvent(content.ItemId)); err != nil {
+		g.logger.NoCtxError(err, "failed to delete blocked item")
+	}
+	if g.cfg.Reply == "" {
+		return
+	}
+	reply := NewResponseCreateEvent()
+	reply.Response = &ResponseParams{
+		Instructions: fmt.Sprintf(replyInstructions, g.cfg.Reply),
+		Metadata:     map[string]string{guardrailKey: "reply"},
+	}
+	if err := g.session.Send(ctx, reply); err != nil {
+		g.logger.NoCtxError(err, "failed to send canned reply")
+	}
+}
+
+// PatternPolicy objects to content matching any of its patterns. Patterns
+// are matched against the text so far, so a match may be reported before the
+// word it starts is complete.
+type PatternPolicy struct {
+	name     string
+	verdict  Verdict
+	patterns []*regexp.Regexp
+}
+
+// NewRegexPolicy objects to content matching any of patterns with verdict.
+func NewRegexPolicy(name string, verdict Verdict, patterns ...string) (*PatternPolicy, error) {
+	p := &PatternPolicy{name: name, verdict: verdict}
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compile pattern of policy %s: %w", name, err)
+		}
+		p.patterns = append(p.patterns, re)
+	}
+	return p, nil
+}
+
+// NewKeywordPolicy objects to content containing any of keywords as whole
+// words, regardless of case, with verdict.
+func NewKeywordPolicy(name string, verdict Verdict, keywords ...string) *PatternPolicy {
+	p := &PatternPolicy{name: name, verdict: verdict}
+	for _, keyword := range keywords {
+		p.patterns = append(p.patterns, regexp.MustCompile(`(?i)\b`+regexp.QuoteMeta(keyword)+`\b`))
+	}
+	return p
+}
+
+func (p *PatternPolicy) Name() string { return p.name }
+
+func (p *PatternPolicy) Check(ctx context.Context, content Content) (Decision, error) {
+	var matches []string
+	for _, re := range p.patterns {
+		if match := re.FindString(content.Text); match != "" {
+			matches = append(matches, fmt.Sprintf("%q", match))
+		}
+	}
+	if len(matches) == 0 {
+		return Decision{}, nil
+	}
+	decision := Decision{Verdict: p.verdict, Reason: "matched " + strings.Join(matches, ", ")}
+	if p.verdict == VerdictRedact {
+		decision.Redacted = content.Text
+		for _, re := range p.patterns {
+			decision.Redacted = re.ReplaceAllLiteralString(decision.Redacted, RedactionMask)
+		}
+	}
+	return decision, nil
+}
+
+type Classification struct {
+	Flagged    bool
+	Categories []string
+}
+
+// Classifier is an external moderation service.
+type Classifier interface {
+	Classify(ctx context.Context, text string) (Classification, error)
+}
+
+// ClassifierPolicy objects to content a Classifier flags. Classifying every
+// delta would be slow and costly, so partial content is only classified once
+// it grew by interval bytes since it last was; final content always is.
+type ClassifierPolicy struct {
+	name       string
+	classifier Classifier
+	verdict    Verdict
+	interval   int
+
+	mu      sync.Mutex
+	checked map[contentKey]int
+}
+
+// NewClassifierPolicy objects to content classifier flags with verdict. An
+// interval of zero only classifies final content.
+func NewClassifierPolicy(name string, classifier Classifier, verdict Verdict, interval int) *ClassifierPolicy {
+	return &ClassifierPolicy{
+		name:       name,
+		classifier: classifier,
+		verdict:    verdict,
+		interval:   interval,
+		checked:    make(map[contentKey]int),
+	}
+}
+
+func (p *ClassifierPolicy) Name() string { return p.name }
+
+var _ Forgetter = (*ClassifierPolicy)(nil)
+
+func (p *ClassifierPolicy) Forget(content Content) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.checked, content.key())
+}
+
+func (p *ClassifierPolicy) Check(ctx context.Context, content Content) (Decision, error) {
+	p.mu.Lock()
+	if content.Final {
+		delete(p.checked, content.key())
+	} else if p.interval <= 0 || len(content.Text)-p.checked[content.key()] < p.interval {
+		p.mu.Unlock()
+		return Decision{}, nil
+	} else {
+		p.checked[content.key()] = len(content.Text)
+	}
+	p.mu.Unlock()
+
+	classification, err := p.classifier.Classify(ctx, content.Text)
+	if err != nil {
+		return Decision{}, fmt.Errorf("failed to classify content: %w", err)
+	}
+	if !classification.Flagged {
+		return Decision{}, nil
+	}
+	decision := Decision{Verdict: p.verdict, Reason: "flagged as " + strings.Join(classification.Categories, ", ")}
+	if p.verdict == VerdictRedact {
+		decision.Redacted = RedactionMask
+	}
+	return decision, nil
+}
@@ -0,0 +1,270 @@
+package realtime
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"gitlab.bcc-hyperdev.org/bcc-hyperdev/realtime/shared"
+)
+
+// stubClassifier flags text containing any of its words.
+type stubClassifier struct {
+	words []string
+	err   error
+
+	mu    sync.Mutex
+	calls []string
+}
+
+func (c *stubClassifier) Classify(ctx context.Context, text string) (Classification, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.calls = append(c.calls, text)
+	if c.err != nil {
+		return Classification{}, c.err
+	}
+	for _, word := range c.words {
+		if strings.Contains(text, word) {
+			return Classification{Flagged: true, Categories: []string{"violence"}}, nil
+		}
+	}
+	return Classification{}, nil
+}
+
+func newTestGuardrail(t *testing.T, session *Session, cfg *GuardrailConfig) (*Guardrail, *[]Violation) {
+	t.Helper()
+	g, err := NewGuardrail(shared.NewLogger(), session, cfg)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	var violations []Violation
+	g.OnViolation(func(violation Violation) { violations = append(violations, violation) })
+	return g, &violations
+}
+
+func feed(t *testing.T, g *Guardrail, events ...string) {
+	t.Helper()
+	for _, data := range events {
+		event, err := ParseEvent([]byte(data))
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		g.Handle(context.Background(), event)
+	}
+}
+
+func TestGuardrail(t *testing.T) {
+	t.Run("Flag", func(t *testing.T) {
+		g, violations := newTestGuardrail(t, nil, &GuardrailConfig{Policies: []Policy{NewKeywordPolicy("weapons", VerdictFlag, "bomb")}})
+		feed(t, g,
+			`{"type":"conversation.item.input_audio_transcription.delta","item_id":"item_1","delta":"How to build a bo"}`,
+			`{"type":"conversation.item.input_audio_transcription.delta","item_id":"item_1","delta":"mb"}`,
+			`{"type":"conversation.item.input_audio_transcription.delta","item_id":"item_1","delta":" bomb"}`,
+			`{"type":"conversation.item.input_audio_transcription.completed","item_id":"item_1","transcript":"How to build a bomb bomb"}`,
+		)
+		if len(*violations) != 1 {
+			t.Fatalf("Expected 1 violation, got %+v", *violations)
+		}
+		v := (*violations)[0]
+		if v.Policy != "weapons" || v.Decision.Verdict != VerdictFlag || v.Content.Kind != ContentUserTranscript || v.Content.Text != "How to build a bomb" {
+			t.Errorf("Expected a flag of the user transcript, got %+v", v)
+		}
+		if g.Blocked("item_1") {
+			t.Error("Expected flagged content not to be blocked")
+		}
+	})
+
+	t.Run("Redact", func(t *testing.T) {
+		policy, err := NewRegexPolicy("pii", VerdictRedact, `\d{3}-\d{4}`)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		g, violations := newTestGuardrail(t, nil, &GuardrailConfig{Policies: []Policy{policy}})
+		feed(t, g,
+			`{"type":"response.output_audio_transcript.delta","response_id":"resp_1","item_id":"item_1","delta":"Call 555-1234"}`,
+			`{"type":"response.output_audio_transcript.delta","response_id":"resp_1","item_id":"item_1","delta":" or 555-9876."}`,
+			`{"type":"response.output_audio_transcript.done","response_id":"resp_1","item_id":"item_1","transcript":"Call 555-1234 or 555-9876."}`,
+		)
+		if len(*violations) != 2 {
+			t.Fatalf("Expected the first and final redactions, got %+v", *violations)
+		}
+		final := (*violations)[1]
+		if !final.Content.Final || final.Decision.Redacted != "Call [redacted] or [redacted]." {
+			t.Errorf("Expected the final redacted text, got %+v", final)
+		}
+	})
+
+	t.Run("RedactTranscript", func(t *testing.T) {
+		policy, err := NewRegexPolicy("pii", VerdictRedact, `\d{3}-\d{4}`)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		g, _ := newTestGuardrail(t, nil, &GuardrailConfig{Policies: []Policy{policy}})
+		transcript := NewTranscript(shared.NewLogger(), nil)
+		g.RedactTranscript(transcript)
+		for _, data := range []string{
+			`{"type":"response.output_audio_transcript.delta","response_id":"resp_1","item_id":"item_1","delta":"Call 555-1234"}`,
+			`{"type":"response.output_audio_transcript.delta","response_id":"resp_1","item_id":"item_1","delta":" or 555-9876."}`,
+			`{"type":"response.output_audio_transcript.done","response_id":"resp_1","item_id":"item_1","transcript":"Call 555-1234 or 555-9876."}`,
+		} {
+			event, err := ParseEvent([]byte(data))
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			// The transcript sees the final event after the guardrail, as
+			// well as before.
+			if event.Type == EventTypeResponseOutputAudioTranscriptDone {
+				transcript.Handle(context.Background(), event)
+				g.Handle(context.Background(), event)
+			} else {
+				g.Handle(context.Background(), event)
+				transcript.Handle(context.Background(), event)
+			}
+		}
+		segments := transcript.Segments()
+		if len(segments) != 1 || !segments[0].Final || segments[0].Text != "Call [redacted] or [redacted]." {
+			t.Errorf("Expected the final redacted segment, got %+v", segments)
+		}
+	})
+
+	t.Run("Forget", func(t *testing.T) {
+		classifier := &stubClassifier{}
+		policy := NewClassifierPolicy("moderation", classifier, VerdictFlag, 1)
+		g, _ := newTestGuardrail(t, nil, &GuardrailConfig{Policies: []Policy{NewKeywordPolicy("weapons", VerdictBlock, "bomb"), policy}})
+		feed(t, g,
+			`{"type":"response.output_text.delta","response_id":"resp_1","item_id":"item_1","delta":"Hello"}`,
+			`{"type":"response.output_audio_transcript.delta","response_id":"resp_2","item_id":"item_2","delta":"Sure"}`,
+			`{"type":"response.output_text.delta","response_id":"resp_2","item_id":"item_2","content_index":1,"delta":"A bomb"}`,
+		)
+		if len(g.contents) != 1 || len(policy.checked) != 1 {
+			t.Errorf("Expected the blocked response to be forgotten, got %d contents and %d checked", len(g.contents), len(policy.checked))
+		}
+		feed(t, g, `{"type":"response.done","response":{"id":"resp_1","status":"cancelled"}}`)
+		if len(g.contents) != 0 || len(policy.checked) != 0 {
+			t.Errorf("Expected the cancelled response to be forgotten, got %d contents and %d checked", len(g.contents), len(policy.checked))
+		}
+	})
+
+	t.Run("Block", func(t *testing.T) {
+		session, transport, _, _ := newTestSession(t)
+		if err := session.Start(); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		defer func() { _ = session.Close(context.Background()) }()
+		g, violations := newTestGuardrail(t, session, &GuardrailConfig{
+			Policies: []Policy{NewKeywordPolicy("weapons", VerdictBlock, "bomb")},
+			Reply:    "I can't help with that.",
+		})
+		transport.events <- []byte(`{"type":"response.created","response":{"id":"resp_1"}}`)
+		transport.events <- []byte(`{"type":"response.output_audio_transcript.delta","response_id":"resp_1","item_id":"item_1","delta":"Sure, a Bomb"}`)
+		transport.events <- []byte(`{"type":"response.output_audio_transcript.delta","response_id":"resp_1","item_id":"item_1","delta":" bomb needs"}`)
+		waitFor(t, func() bool { return len(sentTypes(transport)) == 3 })
+
+		want := []string{EventTypeResponseCancel, EventTypeConversationItemDelete, EventTypeResponseCreate}
+		if got := sentTypes(transport); strings.Join(got, " ") != strings.Join(want, " ") {
+			t.Errorf("Expected %v, got %v", want, got)
+		}
+		transport.mu.Lock()
+		var reply ResponseCreateEvent
+		_ = json.Unmarshal(transport.sent[2], &reply)
+		transport.mu.Unlock()
+		if reply.Response == nil || !strings.Contains(reply.Response.Instructions, "I can't help with that.") {
+			t.Errorf("Expected the canned reply, got %+v", reply.Response)
+		}
+		if !g.Blocked("item_1") {
+			t.Error("Expected item_1 to be blocked")
+		}
+
+		// The canned reply is not checked, nor is the rest of the blocked response.
+		transport.events <- []byte(`{"type":"response.created","response":{"id":"resp_2","metadata":{"guardrail":"reply"}}}`)
+		transport.events <- []byte(`{"type":"response.output_audio_transcript.delta","response_id":"resp_2","item_id":"item_2","delta":"No bomb talk."}`)
+		transport.events <- []byte(`{"type":"session.created","session":{}}`)
+		waitFor(t, func() bool { return session.Config() != nil })
+		g.Close()
+		if len(*violations) != 1 {
+			t.Errorf("Expected 1 violation, got %+v", *violations)
+		}
+		if got := len(sentTypes(transport)); got != 3 {
+			t.Errorf("Expected nothing more to be sent, got %d events", got)
+		}
+	})
+
+	t.Run("BlockUser", func(t *testing.T) {
+		session, transport, _, _ := newTestSession(t)
+		if err := session.Start(); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		defer func() { _ = session.Close(context.Background()) }()
+		newTestGuardrail(t, session, &GuardrailConfig{Policies: []Policy{NewKeywordPolicy("weapons", VerdictBlock, "bomb")}})
+		transport.events <- []byte(`{"type":"response.created","response":{"id":"resp_1"}}`)
+		transport.events <- []byte(`{"type":"conversation.item.input_audio_transcription.completed","item_id":"item_1","transcript":"a bomb"}`)
+		waitFor(t, func() bool { return len(sentTypes(transport)) == 2 })
+
+		transport.mu.Lock()
+		defer transport.mu.Unlock()
+		var cancel ResponseCancelEvent
+		_ = json.Unmarshal(transport.sent[0], &cancel)
+		var del ConversationItemDeleteEvent
+		_ = json.Unmarshal(transport.sent[1], &del)
+		if cancel.ResponseId != "resp_1" || del.ItemId != "item_1" {
+			t.Errorf("Expected resp_1 cancelled and item_1 deleted, got %+v %+v", cancel, del)
+		}
+	})
+
+	t.Run("FunctionArguments", func(t *testing.T) {
+		g, violations := newTestGuardrail(t, nil, &GuardrailConfig{Policies: []Policy{NewKeywordPolicy("destructive", VerdictBlock, "rm -rf")}})
+		feed(t, g,
+			`{"type":"response.function_call_arguments.delta","response_id":"resp_1","item_id":"item_1","call_id":"call_1","delta":"{\"cmd\":\"rm -rf"}`,
+			`{"type":"response.function_call_arguments.done","response_id":"resp_1","item_id":"item_1","call_id":"call_1","name":"shell","arguments":"{\"cmd\":\"rm -rf /\"}"}`,
+		)
+		if !g.Blocked("item_1") {
+			t.Error("Expected the call to be blocked")
+		}
+		if len(*violations) != 1 || (*violations)[0].Content.Kind != ContentFunctionArguments {
+			t.Errorf("Expected 1 violation of the arguments, got %+v", *violations)
+		}
+	})
+
+	t.Run("Classifier", func(t *testing.T) {
+		classifier := &stubClassifier{words: []string{"hurt"}}
+		g, violations := newTestGuardrail(t, nil, &GuardrailConfig{Policies: []Policy{NewClassifierPolicy("moderation", classifier, VerdictFlag, 10)}})
+		feed(t, g,
+			`{"type":"response.output_text.delta","response_id":"resp_1","item_id":"item_1","delta":"Hello"}`,
+			`{"type":"response.output_text.delta","response_id":"resp_1","item_id":"item_1","delta":" there, fr"}`,
+			`{"type":"response.output_text.delta","response_id":"resp_1","item_id":"item_1","delta":"iend"}`,
+			`{"type":"response.output_text.done","response_id":"resp_1","item_id":"item_1","text":"Hello there, friend, I hurt"}`,
+		)
+		want := []string{"Hello there, fr", "Hello there, friend, I hurt"}
+		if strings.Join(classifier.calls, "|") != strings.Join(want, "|") {
+			t.Errorf("Expected %q, got %q", want, classifier.calls)
+		}
+		if len(*violations) != 1 || (*violations)[0].Decision.Reason != "flagged as violence" {
+			t.Errorf("Expected 1 violation, got %+v", *violations)
+		}
+	})
+
+	t.Run("FailClosed", func(t *testing.T) {
+		classifier := &stubClassifier{err: errors.New("unavailable")}
+		policy := NewClassifierPolicy("moderation", classifier, VerdictFlag, 0)
+		for _, failClosed := range []bool{false, true} {
+			g, _ := newTestGuardrail(t, nil, &GuardrailConfig{Policies: []Policy{policy}, FailClosed: failClosed})
+			feed(t, g, `{"type":"response.output_text.done","response_id":"resp_1","item_id":"item_1","text":"Hi"}`)
+			if g.Blocked("item_1") != failClosed {
+				t.Errorf("Expected blocked to be %v, got %v", failClosed, !failClosed)
+			}
+		}
+	})
+
+	t.Run("InvalidConfig", func(t *testing.T) {
+		if _, err := NewGuardrail(shared.NewLogger(), nil, &GuardrailConfig{}); err == nil {
+			t.Error("Expected an error, got nil")
+		}
+		if _, err := NewRegexPolicy("bad", VerdictFlag, "("); err == nil {
+			t.Error("Expected an error, got nil")
+		}
+	})
+}
@@ -0,0 +1,47 @@
+package realtime
+
+import "sync"
+
+// handlers is a registry of callbacks of type T, called in registration
+// order. The zero value is ready to use.
+type handlers[T any] struct {
+	mu     sync.Mutex
+	list   []registeredHandler[T]
+	nextId int
+}
+
+type registeredHandler[T any] struct {
+	id      int
+	handler T
+}
+
+// add registers handler until remove is called.
+func (h *handlers[T]) add(handler T) (remove func()) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	id := h.nextId
+	h.nextId++
+	h.list = append(h.list, registeredHandler[T]{id: id, handler: handler})
+	return func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		for i, r := range h.list {
+			if r.id == id {
+				h.list = append(h.list[:i:i], h.list[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// snapshot returns the handlers registered now, to be called without the
+// lock held so that they may add and remove handlers themselves.
+func (h *handlers[T]) snapshot() []T {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	list := make([]T, len(h.list))
+	for i, r := range h.list {
+		list[i] = r.handler
+	}
+	return list
+}
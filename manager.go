@@ -0,0 +1,285 @@
+package realtime
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"gitlab.bcc-hyperdev.org/bcc-hyperdev/realtime/shared"
+)
+
+const DefaultCloseTimeout = 5 * time.Second
+
+var (
+	ErrManagerDraining = errors.New("session manager is draining")
+	ErrSessionLimit    = errors.New("session limit reached")
+	ErrTenantLimit     = errors.New("tenant session limit reached")
+)
+
+// OpenFunc opens a session, typically by dialing a provider and calling
+// NewSession. The session must not be started.
+type OpenFunc func(ctx context.Context) (*Session, error)
+
+type SessionManagerConfig struct {
+	// MaxSessions bounds the live sessions. Zero is unlimited.
+	MaxSessions int
+	// MaxSessionsPerTenant bounds the live sessions of each tenant, unless
+	// TenantLimits has one for the tenant. Zero is unlimited.
+	MaxSessionsPerTenant int
+	TenantLimits         map[string]int
+	// OnStart runs before the session starts, so that handlers and taps it
+	// adds see every event. OnEnd runs once the session is closed. Both are
+	// optional.
+	OnStart func(session *ManagedSession)
+	OnEnd   func(session *ManagedSession)
+	// CloseTimeout bounds closing a session that ended on its own.
+	CloseTimeout time.Duration
+}
+
+// ManagedSession is a session tracked by a SessionManager.
+type ManagedSession struct {
+	Id        string
+	Tenant    string
+	Session   *Session
+	StartedAt time.Time
+}
+
+// Close closes the session; the manager forgets it once closed.
+func (s *ManagedSession) Close(ctx context.Context) error {
+	return s.Session.Close(ctx)
+}
+
+// SessionStats is a snapshot of a SessionManager.
+type SessionStats struct {
+	// Active counts the live sessions, Opening those being opened.
+	Active   int
+	Opening  int
+	ByTenant map[string]int
+	// Started, Ended and Rejected count sessions since the manager was
+	// created.
+	Started  int
+	Ended    int
+	Rejected int
+	Draining bool
+}
+
+// SessionManager is a registry of the live sessions of a server, enforcing
+// global and per-tenant limits on them.
+type SessionManager struct {
+	logger *shared.Logger
+	cfg    *SessionManagerConfig
+
+	mu       sync.Mutex
+	sessions map[string]*ManagedSession
+	// reserved counts the live and opening sessions of each tenant.
+	reserved map[string]int
+	total    int
+	started  int
+	ended    int
+	rejected int
+	draining bool
+	wg       sync.WaitGroup
+}
+
+func NewSessionManager(logger *shared.Logger, cfg *SessionManagerConfig) (m *SessionManager, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("failed to create session manager: %w", err)
+		}
+	}()
+	if cfg == nil {
+		cfg = &SessionManagerConfig{}
+	}
+	if cfg.MaxSessions < 0 || cfg.MaxSessionsPerTenant < 0 {
+		return nil, fmt.Errorf("session limits must not be negative")
+	}
+	for tenant, limit := range cfg.TenantLimits {
+		if limit < 0 {
+			return nil, fmt.Errorf("session limit of tenant %s must not be negative", tenant)
+		}
+	}
+	if cfg.CloseTimeout <= 0 {
+		cfg.CloseTimeout = DefaultCloseTimeout
+	}
+	return &SessionManager{
+		logger:   logger,
+		cfg:      cfg,
+		sessions: make(map[string]*ManagedSession),
+		reserved: make(map[string]int),
+	}, nil
+}
+
+// Start reserves a slot for tenant, opens a session with open, runs OnStart
+// and starts the session. The session is tracked until it ends, either
+// because it was closed or because the remote side hung up.
+func (m *SessionManager) Start(ctx context.Context, tenant string, open OpenFunc) (s *ManagedSession, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("failed to start session: %w", err)
+		}
+	}()
+	if err := m.reserve(tenant); err != nil {
+		return nil, err
+	}
+	session, err := open(ctx)
+	if err != nil {
+		m.release(tenant)
+		return nil, err
+	}
+
+	s = &ManagedSession{Id: uuid.NewString(), Tenant: tenant, Session: session, StartedAt: time.Now()}
+	m.mu.Lock()
+	if m.draining {
+		m.rejected++
+		m.mu.Unlock()
+		m.release(tenant)
+		_ = session.Close(context.WithoutCancel(ctx))
+		return nil, ErrManagerDraining
+	}
+	m.sessions[s.Id] = s
+	m.started++
+	m.wg.Add(1)
+	m.mu.Unlock()
+
+	if m.cfg.OnStart != nil {
+		m.cfg.OnStart(s)
+	}
+	if err := session.Start(); err != nil {
+		_ = session.Close(context.WithoutCancel(ctx))
+		m.end(s)
+		return nil, err
+	}
+	go m.watch(s)
+	return s, nil
+}
+
+func (m *SessionManager) reserve(tenant string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var err error
+	switch {
+	case m.draining:
+		err = ErrManagerDraining
+	case m.cfg.MaxSessions > 0 && m.total >= m.cfg.MaxSessions:
+		err = ErrSessionLimit
+	case m.tenantLimit(tenant) > 0 && m.reserved[tenant] >= m.tenantLimit(tenant):
+		err = ErrTenantLimit
+	}
+	if err != nil {
+		m.rejected++
+		return err
+	}
+	m.total++
+	m.reserved[tenant]++
+	return nil
+}
+
+func (m *SessionManager) tenantLimit(tenant string) int {
+	if limit, ok := m.cfg.TenantLimits[tenant]; ok {
+		return limit
+	}
+	return m.cfg.MaxSessionsPerTenant
+}
+
+func (m *SessionManager) release(tenant string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.total--
+	if m.reserved[tenant]--; m.reserved[tenant] == 0 {
+		delete(m.reserved, tenant)
+	}
+}
+
+// watch closes the session once it ended and forgets it.
+func (m *SessionManager) watch(s *ManagedSession) {
+	<-s.Session.Done()
+	ctx, cancel := context.WithTimeout(context.Background(), m.cfg.CloseTimeout)
+	defer cancel()
+	if err := s.Session.Close(ctx); err != nil {
+		m.logger.NoCtxError(err, "failed to close ended session")
+	}
+	m.end(s)
+}
+
+func (m *SessionManager) end(s *ManagedSession) {
+	m.mu.Lock()
+	delete(m.sessions, s.Id)
+	m.ended++
+	m.mu.Unlock()
+	m.release(s.Tenant)
+	if m.cfg.OnEnd != nil {
+		m.cfg.OnEnd(s)
+	}
+	m.wg.Done()
+}
+
+func (m *SessionManager) Session(id string) (*ManagedSession, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.sessions[id]
+	return s, ok
+}
+
+func (m *SessionManager) Sessions() []*ManagedSession {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	sessions := make([]*ManagedSession, 0, len(m.sessions))
+	for _, s := range m.sessions {
+		sessions = append(sessions, s)
+	}
+	return sessions
+}
+
+func (m *SessionManager) Stats() SessionStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stats := SessionStats{
+		Active:   len(m.sessions),
+		Opening:  m.total - len(m.sessions),
+		ByTenant: make(map[string]int),
+		Started:  m.started,
+		Ended:    m.ended,
+		Rejected: m.rejected,
+		Draining: m.draining,
+	}
+	for _, s := range m.sessions {
+		stats.ByTenant[s.Tenant]++
+	}
+	return stats
+}
+
+// Drain rejects new sessions and waits for the live ones to end, e.g. ahead
+// of a deploy. If ctx is done first, the remaining sessions are left running
+// and ctx's error is returned.
+func (m *SessionManager) Drain(ctx context.Context) error {
+	m.mu.Lock()
+	m.draining = true
+	m.mu.Unlock()
+	if err := wait(ctx, &m.wg); err != nil {
+		return fmt.Errorf("failed to drain sessions: %w", err)
+	}
+	return nil
+}
+
+// Close rejects new sessions and closes the live ones.
+func (m *SessionManager) Close(ctx context.Context) error {
+	m.mu.Lock()
+	m.draining = true
+	m.mu.Unlock()
+	var errs []error
+	for _, s := range m.Sessions() {
+		if err := s.Close(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close session %s: %w", s.Id, err))
+		}
+	}
+	if err := wait(ctx, &m.wg); err != nil {
+		errs = append(errs, err)
+	}
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("failed to close session manager: %w", err)
+	}
+	return nil
+}
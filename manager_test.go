@@ -0,0 +1,199 @@
+package realtime
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"gitlab.bcc-hyperdev.org/bcc-hyperdev/realtime/shared"
+)
+
+// openFake returns an OpenFunc that opens sessions over fake transports,
+// collected in transports.
+func openFake(transports *[]*fakeTransport) OpenFunc {
+	var mu sync.Mutex
+	return func(ctx context.Context) (*Session, error) {
+		transport := newFakeTransport()
+		mu.Lock()
+		*transports = append(*transports, transport)
+		mu.Unlock()
+		return NewSession(shared.NewLogger(), transport, nil)
+	}
+}
+
+func newTestManager(t *testing.T, cfg *SessionManagerConfig) *SessionManager {
+	t.Helper()
+	m, err := NewSessionManager(shared.NewLogger(), cfg)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	t.Cleanup(func() { _ = m.Close(context.Background()) })
+	return m
+}
+
+func TestSessionManager(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Limits", func(t *testing.T) {
+		m := newTestManager(t, &SessionManagerConfig{MaxSessions: 3, MaxSessionsPerTenant: 2, TenantLimits: map[string]int{"vip": 3}})
+		var transports []*fakeTransport
+		open := openFake(&transports)
+		for _, tenant := range []string{"a", "a"} {
+			if _, err := m.Start(ctx, tenant, open); err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+		}
+		if _, err := m.Start(ctx, "a", open); !errors.Is(err, ErrTenantLimit) {
+			t.Errorf("Expected %v, got %v", ErrTenantLimit, err)
+		}
+		if _, err := m.Start(ctx, "vip", open); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if _, err := m.Start(ctx, "vip", open); !errors.Is(err, ErrSessionLimit) {
+			t.Errorf("Expected %v, got %v", ErrSessionLimit, err)
+		}
+		if len(transports) != 3 {
+			t.Errorf("Expected rejected sessions not to be opened, got %d opened", len(transports))
+		}
+		stats := m.Stats()
+		if stats.Active != 3 || stats.ByTenant["a"] != 2 || stats.ByTenant["vip"] != 1 || stats.Rejected != 2 || stats.Started != 3 {
+			t.Errorf("Expected 3 active sessions and 2 rejected, got %+v", stats)
+		}
+	})
+
+	t.Run("OpenFails", func(t *testing.T) {
+		m := newTestManager(t, &SessionManagerConfig{MaxSessions: 1})
+		fail := func(ctx context.Context) (*Session, error) { return nil, errors.New("dial failed") }
+		if _, err := m.Start(ctx, "a", fail); err == nil {
+			t.Fatal("Expected an error, got nil")
+		}
+		var transports []*fakeTransport
+		if _, err := m.Start(ctx, "a", openFake(&transports)); err != nil {
+			t.Errorf("Expected the slot to be released, got %v", err)
+		}
+	})
+
+	t.Run("Lifecycle", func(t *testing.T) {
+		var mu sync.Mutex
+		var events []string
+		ended := make(chan *ManagedSession, 1)
+		m := newTestManager(t, &SessionManagerConfig{
+			OnStart: func(s *ManagedSession) {
+				mu.Lock()
+				defer mu.Unlock()
+				events = append(events, "start "+s.Tenant)
+				s.Session.OnEvent(func(ctx context.Context, event Event) {
+					mu.Lock()
+					defer mu.Unlock()
+					events = append(events, event.Type)
+				})
+			},
+			OnEnd: func(s *ManagedSession) { ended <- s },
+		})
+		var transports []*fakeTransport
+		s, err := m.Start(ctx, "a", openFake(&transports))
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if got, ok := m.Session(s.Id); !ok || got != s {
+			t.Errorf("Expected session %s to be tracked", s.Id)
+		}
+
+		transports[0].events <- []byte(`{"type":"session.created"}`)
+		// The remote side hangs up.
+		_ = transports[0].Close(ctx)
+		select {
+		case got := <-ended:
+			if got != s {
+				t.Errorf("Expected session %s to end, got %s", s.Id, got.Id)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Timed out waiting for the session to end")
+		}
+		if _, ok := m.Session(s.Id); ok {
+			t.Error("Expected the ended session to be forgotten")
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if len(events) != 2 || events[0] != "start a" || events[1] != EventTypeSessionCreated {
+			t.Errorf("Expected [start a session.created], got %v", events)
+		}
+		if stats := m.Stats(); stats.Active != 0 || stats.Started != 1 || stats.Ended != 1 {
+			t.Errorf("Expected 1 started and ended session, got %+v", stats)
+		}
+	})
+
+	t.Run("Drain", func(t *testing.T) {
+		m := newTestManager(t, nil)
+		var transports []*fakeTransport
+		s, err := m.Start(ctx, "a", openFake(&transports))
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		drained := make(chan error, 1)
+		go func() { drained <- m.Drain(ctx) }()
+		waitFor(t, func() bool { return m.Stats().Draining })
+		if _, err := m.Start(ctx, "a", openFake(&transports)); !errors.Is(err, ErrManagerDraining) {
+			t.Errorf("Expected %v, got %v", ErrManagerDraining, err)
+		}
+		select {
+		case err := <-drained:
+			t.Fatalf("Expected to wait for the live session, got %v", err)
+		case <-time.After(20 * time.Millisecond):
+		}
+		if err := s.Close(ctx); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if err := <-drained; err != nil {
+			t.Errorf("Expected no error, got %v", err)
+		}
+	})
+
+	t.Run("DrainTimeout", func(t *testing.T) {
+		m := newTestManager(t, nil)
+		var transports []*fakeTransport
+		if _, err := m.Start(ctx, "a", openFake(&transports)); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		drainCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+		defer cancel()
+		if err := m.Drain(drainCtx); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Expected %v, got %v", context.DeadlineExceeded, err)
+		}
+		if stats := m.Stats(); stats.Active != 1 {
+			t.Errorf("Expected the session to keep running, got %+v", stats)
+		}
+	})
+
+	t.Run("Close", func(t *testing.T) {
+		m, err := NewSessionManager(shared.NewLogger(), nil)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		var transports []*fakeTransport
+		for range 3 {
+			if _, err := m.Start(ctx, "a", openFake(&transports)); err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+		}
+		if err := m.Close(ctx); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if stats := m.Stats(); stats.Active != 0 || stats.Ended != 3 {
+			t.Errorf("Expected every session closed, got %+v", stats)
+		}
+		for i, transport := range transports {
+			if !transport.closed {
+				t.Errorf("Expected transport %d to be closed", i)
+			}
+		}
+	})
+
+	t.Run("InvalidLimits", func(t *testing.T) {
+		if _, err := NewSessionManager(shared.NewLogger(), &SessionManagerConfig{TenantLimits: map[string]int{"a": -1}}); err == nil {
+			t.Error("Expected an error, got nil")
+		}
+	})
+}
@@ -0,0 +1,342 @@
+package realtime
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"gitlab.bcc-hyperdev.org/bcc-hyperdev/realtime/shared"
+)
+
+var ErrBudgetExceeded = errors.New("usage budget exceeded")
+
+// Price is the price of a model in USD per million tokens. Cached prices
+// apply to the cached part of the input of their modality.
+type Price struct {
+	TextInput        float64
+	CachedTextInput  float64
+	TextOutput       float64
+	AudioInput       float64
+	CachedAudioInput float64
+	AudioOutput      float64
+	ImageInput       float64
+	CachedImageInput float64
+}
+
+// Cost estimates the cost of usage in USD.
+func (p Price) Cost(usage Usage) float64 {
+	in, cached := usage.InputTokenDetails, usage.InputTokenDetails.CachedTokensDetails
+	out := usage.OutputTokenDetails
+	tokens := float64(in.TextTokens-cached.TextTokens)*p.TextInput +
+		float64(cached.TextTokens)*p.CachedTextInput +
+		float64(in.AudioTokens-cached.AudioTokens)*p.AudioInput +
+		float64(cached.AudioTokens)*p.CachedAudioInput +
+		float64(in.ImageTokens-cached.ImageTokens)*p.ImageInput +
+		float64(cached.ImageTokens)*p.CachedImageInput +
+		float64(out.TextTokens)*p.TextOutput +
+		float64(out.AudioTokens)*p.AudioOutput
+	return tokens / 1_000_000
+}
+
+type BudgetAction int
+
+const (
+	// BudgetActionEnd closes a session over budget.
+	BudgetActionEnd BudgetAction = iota
+	// BudgetActionDegrade hands a session over budget to MeterConfig.Degrade,
+	// e.g. to switch it to text output, and lets it run on.
+	BudgetActionDegrade
+)
+
+// UsageRecord is the usage of one response, for billing.
+type UsageRecord struct {
+	SessionId  string
+	Tenant     string
+	ResponseId string
+	Model      string
+	Usage      Usage
+	// Cost is the estimated cost in USD, zero if neither the model nor the
+	// default one has a price.
+	Cost float64
+	Time time.Time
+}
+
+type MeterConfig struct {
+	// Prices maps models to their price. Models without one take the price
+	// of the longest model they start with, e.g. a dated snapshot that of its
+	// model, or else that of DefaultModel. Either way a warning is logged once
+	// per model.
+	Prices map[string]Price
+	// DefaultModel prices the sessions whose config does not name a model,
+	// and those whose model has no price.
+	DefaultModel string
+	// SessionBudget bounds the cost of a session in USD. TenantBudget bounds
+	// the cost of the sessions of each tenant since the meter was created or
+	// the tenant reset, unless TenantBudgets has one for the tenant. Zero is
+	// unlimited.
+	SessionBudget float64
+	TenantBudget  float64
+	TenantBudgets map[string]float64
+	// Action is taken once per session, when its response goes over budget.
+	Action BudgetAction
+	// Degrade is required with BudgetActionDegrade. It runs off the event
+	// loop, so it may call Session.Update.
+	Degrade func(ctx context.Context, session *ManagedSession) error
+	// OnRecord receives the usage of every response, on the session's event
+	// loop. Optional.
+	OnRecord func(record UsageRecord)
+	// OnBudgetExceeded is called before the action is taken. Optional.
+	OnBudgetExceeded func(session *ManagedSession, cost float64)
+	// CloseTimeout bounds closing or degrading a session over budget.
+	CloseTimeout time.Duration
+}
+
+// TenantUsage is the accumulated usage of a tenant.
+type TenantUsage struct {
+	Usage Usage
+	Cost  float64
+}
+
+type meteredSession struct {
+	usage    Usage
+	cost     float64
+	exceeded bool
+}
+
+// Meter accounts the token usage of sessions per session and per tenant,
+// estimates its cost and enforces budgets. Sessions are metered from
+// SessionManagerConfig.OnStart with Track; Admit rejects sessions of tenants
+// over budget before they are opened.
+type Meter struct {
+	logger *shared.Logger
+	cfg    *MeterConfig
+
+	mu       sync.Mutex
+	sessions map[string]*meteredSession
+	tenants  map[string]*TenantUsage
+	// unpriced holds the models warned about for having no price.
+	unpriced shared.Set[string]
+}
+
+func NewMeter(logger *shared.Logger, cfg *MeterConfig) (m *Meter, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("failed to create meter: %w", err)
+		}
+	}()
+	if cfg == nil {
+		cfg = &MeterConfig{}
+	}
+	if cfg.SessionBudget < 0 || cfg.TenantBudget < 0 {
+		return nil, fmt.Errorf("budgets must not be negative")
+	}
+	for tenant, budget := range cfg.TenantBudgets {
+		if budget < 0 {
+			return nil, fmt.Errorf("budget of tenant %s must not be negative", tenant)
+		}
+	}
+	if cfg.Action == BudgetActionDegrade && cfg.Degrade == nil {
+		return nil, fmt.Errorf("degrade is required")
+	}
+	if cfg.CloseTimeout <= 0 {
+		cfg.CloseTimeout = DefaultCloseTimeout
+	}
+	return &Meter{
+		logger:   logger,
+		cfg:      cfg,
+		sessions: make(map[string]*meteredSession),
+		tenants:  make(map[string]*TenantUsage),
+		unpriced: shared.NewSet[string](),
+	}, nil
+}
+
+// Track meters session until it ends.
+func (m *Meter) Track(session *ManagedSession) {
+	m.mu.Lock()
+	m.sessions[session.Id] = &meteredSession{}
+	m.mu.Unlock()
+	remove := session.Session.OnEvent(func(ctx context.Context, event Event) {
+		if event.Type == EventTypeResponseDone {
+			m.handle(session, event)
+		}
+	})
+	go func() {
+		<-session.Session.Done()
+		remove()
+		m.mu.Lock()
+		delete(m.sessions, session.Id)
+		m.mu.Unlock()
+	}()
+}
+
+// Admit returns ErrBudgetExceeded if tenant is over budget.
+func (m *Meter) Admit(tenant string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if budget := m.tenantBudget(tenant); budget > 0 && m.tenants[tenant] != nil && m.tenants[tenant].Cost >= budget {
+		return fmt.Errorf("tenant %s: %w", tenant, ErrBudgetExceeded)
+	}
+	return nil
+}
+
+// SessionUsage returns the usage and cost of a tracked session.
+func (m *Meter) SessionUsage(id string) (Usage, float64, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.sessions[id]
+	if !ok {
+		return Usage{}, 0, false
+	}
+	return s.usage, s.cost, true
+}
+
+func (m *Meter) TenantUsage(tenant string) TenantUsage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if usage, ok := m.tenants[tenant]; ok {
+		return *usage
+	}
+	return TenantUsage{}
+}
+
+// ResetTenant clears the usage of tenant, e.g. at the start of a billing
+// period, and returns what it was.
+func (m *Meter) ResetTenant(tenant string) TenantUsage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	usage, ok := m.tenants[tenant]
+	if !ok {
+		return TenantUsage{}
+	}
+	delete(m.tenants, tenant)
+	return *usage
+}
+
+func (m *Meter) tenantBudget(tenant string) float64 {
+	if budget, ok := m.cfg.TenantBudgets[tenant]; ok {
+		return budget
+	}
+	return m.cfg.TenantBudget
+}
+
+func (m *Meter) handle(session *ManagedSession, event Event) {
+	var payload ResponseEvent
+	if err := event.Decode(&payload); err != nil {
+		m.logger.NoCtxWarnf("failed to meter response: %v", err)
+		return
+	}
+	if payload.Response.Usage == nil {
+		return
+	}
+	usage := *payload.Response.Usage
+	model := m.model(session.Session)
+	record := UsageRecord{
+		SessionId:  session.Id,
+		Tenant:     session.Tenant,
+		ResponseId: payload.Response.Id,
+		Model:      model,
+		Usage:      usage,
+		Time:       time.Now(),
+	}
+	if price, ok := m.price(model); ok {
+		record.Cost = price.Cost(usage)
+	}
+
+	m.mu.Lock()
+	s, ok := m.sessions[session.Id]
+	if !ok {
+		// The session ended already.
+		m.mu.Unlock()
+		return
+	}
+	s.usage.Add(usage)
+	s.cost += record.Cost
+	tenant, ok := m.tenants[session.Tenant]
+	if !ok {
+		tenant = &TenantUsage{}
+		m.tenants[session.Tenant] = tenant
+	}
+	tenant.Usage.Add(usage)
+	tenant.Cost += record.Cost
+	exceeded := !s.exceeded &&
+		(m.cfg.SessionBudget > 0 && s.cost >= m.cfg.SessionBudget ||
+			m.tenantBudget(session.Tenant) > 0 && tenant.Cost >= m.tenantBudget(session.Tenant))
+	if exceeded {
+		s.exceeded = true
+	}
+	cost := s.cost
+	m.mu.Unlock()
+
+	if m.cfg.OnRecord != nil {
+		m.cfg.OnRecord(record)
+	}
+	if exceeded {
+		if m.cfg.OnBudgetExceeded != nil {
+			m.cfg.OnBudgetExceeded(session, cost)
+		}
+		// Closing and updating the session wait on its event loop.
+		go m.enforce(session)
+	}
+}
+
+func (m *Meter) enforce(session *ManagedSession) {
+	ctx, cancel := context.WithTimeout(context.Background(), m.cfg.CloseTimeout)
+	defer cancel()
+	if m.cfg.Action == BudgetActionDegrade {
+		if err := m.cfg.Degrade(ctx, session); err != nil {
+			m.logger.NoCtxError(err, "failed to degrade session over budget")
+		}
+		return
+	}
+	if err := session.Close(ctx); err != nil {
+		m.logger.NoCtxError(err, "failed to end session over budget")
+	}
+}
+
+// price returns the price of model, that of the longest priced model it
+// starts with, or that of the default model. Models without a price of their
+// own are warned about once.
+func (m *Meter) price(model string) (Price, bool) {
+	if price, ok := m.cfg.Prices[model]; ok {
+		return price, true
+	}
+	priced := ""
+	for candidate := range m.cfg.Prices {
+		if strings.HasPrefix(model, candidate) && len(candidate) > len(priced) {
+			priced = candidate
+		}
+	}
+	if priced == "" {
+		priced = m.cfg.DefaultModel
+	}
+	price, ok := m.cfg.Prices[priced]
+	m.mu.Lock()
+	warn := !m.unpriced.Add(model)
+	m.mu.Unlock()
+	if warn {
+		if ok {
+			m.logger.NoCtxWarnf("model %s has no price, metering it as %s", model, priced)
+		} else {
+			m.logger.NoCtxWarnf("model %s has no price, metering it as free", model)
+		}
+	}
+	return price, ok
+}
+
+// model returns the model named by the session config, or the default one.
+func (m *Meter) model(session *Session) string {
+	var config struct {
+		Model string `json:"model"`
+	}
+	if raw := session.Config(); raw != nil {
+		_ = json.Unmarshal(raw, &config)
+	}
+	if config.Model == "" {
+		return m.cfg.DefaultModel
+	}
+	return config.Model
+}
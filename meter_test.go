@@ -0,0 +1,208 @@
+package realtime
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"testing"
+
+	"gitlab.bcc-hyperdev.org/bcc-hyperdev/realtime/shared"
+)
+
+var testPrices = map[string]Price{
+	"model": {TextInput: 4, CachedTextInput: 0.4, TextOutput: 16, AudioInput: 32, CachedAudioInput: 0.4, AudioOutput: 64},
+}
+
+// responseDone is a response.done event using 1000 uncached audio input tokens
+// and 1000 audio output tokens of "model", $0.096.
+const responseDone = `{"type":"response.done","response":{"id":"resp_1","status":"completed","usage":{"total_tokens":2000,"input_tokens":1000,"output_tokens":1000,"input_token_details":{"audio_tokens":1000},"output_token_details":{"audio_tokens":1000}}}}`
+
+func newTestMeter(t *testing.T, cfg *MeterConfig) (*Meter, *SessionManager) {
+	t.Helper()
+	meter, err := NewMeter(shared.NewLogger(), cfg)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	return meter, newTestManager(t, &SessionManagerConfig{OnStart: meter.Track})
+}
+
+func TestPriceCost(t *testing.T) {
+	usage := Usage{
+		InputTokenDetails: InputTokenDetails{
+			TextTokens:          1000,
+			AudioTokens:         2000,
+			CachedTokensDetails: CachedTokensDetails{TextTokens: 500, AudioTokens: 1000},
+		},
+		OutputTokenDetails: OutputTokenDetails{TextTokens: 100, AudioTokens: 1000},
+	}
+	// 500*4 + 500*0.4 + 1000*32 + 1000*0.4 + 100*16 + 1000*64 per million.
+	want := 0.1002
+	if got := testPrices["model"].Cost(usage); math.Abs(got-want) > 1e-9 {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+}
+
+func TestMeter(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Accounting", func(t *testing.T) {
+		var mu sync.Mutex
+		var records []UsageRecord
+		meter, m := newTestMeter(t, &MeterConfig{
+			Prices: testPrices,
+			OnRecord: func(record UsageRecord) {
+				mu.Lock()
+				defer mu.Unlock()
+				records = append(records, record)
+			},
+		})
+		var transports []*fakeTransport
+		open := openFake(&transports)
+		var sessions []*ManagedSession
+		for range 2 {
+			s, err := m.Start(ctx, "acme", open)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			sessions = append(sessions, s)
+		}
+		for _, transport := range transports {
+			transport.events <- []byte(`{"type":"session.created","session":{"model":"model"}}`)
+			transport.events <- []byte(responseDone)
+		}
+		waitFor(t, func() bool {
+			mu.Lock()
+			defer mu.Unlock()
+			return len(records) == 2
+		})
+
+		record := records[0]
+		if record.Tenant != "acme" || record.ResponseId != "resp_1" || record.Model != "model" || record.Usage.TotalTokens != 2000 || math.Abs(record.Cost-0.096) > 1e-9 {
+			t.Errorf("Expected a record of resp_1, got %+v", record)
+		}
+		usage, cost, ok := meter.SessionUsage(sessions[0].Id)
+		if !ok || usage.TotalTokens != 2000 || math.Abs(cost-0.096) > 1e-9 {
+			t.Errorf("Expected 2000 tokens for $0.096, got %v %d %v", ok, usage.TotalTokens, cost)
+		}
+		tenant := meter.TenantUsage("acme")
+		if tenant.Usage.TotalTokens != 4000 || math.Abs(tenant.Cost-0.192) > 1e-9 {
+			t.Errorf("Expected 4000 tokens for $0.192, got %+v", tenant)
+		}
+		if reset := meter.ResetTenant("acme"); reset.Usage.TotalTokens != 4000 {
+			t.Errorf("Expected the reset usage, got %+v", reset)
+		}
+		if tenant := meter.TenantUsage("acme"); tenant.Usage.TotalTokens != 0 {
+			t.Errorf("Expected no usage after a reset, got %+v", tenant)
+		}
+	})
+
+	t.Run("DefaultModel", func(t *testing.T) {
+		meter, m := newTestMeter(t, &MeterConfig{Prices: testPrices, DefaultModel: "model"})
+		var transports []*fakeTransport
+		s, err := m.Start(ctx, "acme", openFake(&transports))
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		transports[0].events <- []byte(responseDone)
+		waitFor(t, func() bool {
+			_, cost, _ := meter.SessionUsage(s.Id)
+			return cost > 0
+		})
+	})
+
+	t.Run("Unpriced", func(t *testing.T) {
+		prices := map[string]Price{"model": testPrices["model"], "model-mini": {AudioOutput: 1}}
+		meter, _ := newTestMeter(t, &MeterConfig{Prices: prices, DefaultModel: "model-mini"})
+		for model, want := range map[string]Price{
+			"model-2025-08-28":      prices["model"],
+			"model-mini-2025-10-06": prices["model-mini"],
+			"other":                 prices["model-mini"],
+		} {
+			if got, ok := meter.price(model); !ok || got != want {
+				t.Errorf("Expected %s to cost %+v, got %v %+v", model, want, ok, got)
+			}
+		}
+		// Each is warned about once, snapshots priced by prefix included.
+		if got := meter.unpriced.Size(); got != 3 {
+			t.Errorf("Expected 3 models warned about, got %d", got)
+		}
+		meter, _ = newTestMeter(t, &MeterConfig{Prices: prices})
+		if _, ok := meter.price("other"); ok {
+			t.Error("Expected no price without a default model")
+		}
+	})
+
+	t.Run("End", func(t *testing.T) {
+		exceeded := make(chan float64, 1)
+		meter, m := newTestMeter(t, &MeterConfig{
+			Prices:           testPrices,
+			DefaultModel:     "model",
+			SessionBudget:    0.05,
+			TenantBudgets:    map[string]float64{"acme": 0.05},
+			OnBudgetExceeded: func(session *ManagedSession, cost float64) { exceeded <- cost },
+		})
+		var transports []*fakeTransport
+		s, err := m.Start(ctx, "acme", openFake(&transports))
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		transports[0].events <- []byte(responseDone)
+		if cost := <-exceeded; math.Abs(cost-0.096) > 1e-9 {
+			t.Errorf("Expected $0.096, got %v", cost)
+		}
+		<-s.Session.Done()
+		waitFor(t, func() bool { return m.Stats().Active == 0 })
+		if err := meter.Admit("acme"); !errors.Is(err, ErrBudgetExceeded) {
+			t.Errorf("Expected %v, got %v", ErrBudgetExceeded, err)
+		}
+		if err := meter.Admit("other"); err != nil {
+			t.Errorf("Expected no error, got %v", err)
+		}
+	})
+
+	t.Run("Degrade", func(t *testing.T) {
+		degraded := make(chan *ManagedSession, 2)
+		meter, m := newTestMeter(t, &MeterConfig{
+			Prices:       testPrices,
+			DefaultModel: "model",
+			TenantBudget: 0.05,
+			Action:       BudgetActionDegrade,
+			Degrade:      func(ctx context.Context, session *ManagedSession) error { degraded <- session; return nil },
+		})
+		var transports []*fakeTransport
+		s, err := m.Start(ctx, "acme", openFake(&transports))
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		transports[0].events <- []byte(responseDone)
+		transports[0].events <- []byte(responseDone)
+		if got := <-degraded; got != s {
+			t.Errorf("Expected session %s to be degraded, got %s", s.Id, got.Id)
+		}
+		waitFor(t, func() bool {
+			usage, _, _ := meter.SessionUsage(s.Id)
+			return usage.TotalTokens == 4000
+		})
+		select {
+		case <-s.Session.Done():
+			t.Error("Expected the degraded session to keep running")
+		default:
+		}
+		if len(degraded) != 0 {
+			t.Error("Expected the session to be degraded once")
+		}
+	})
+
+	t.Run("InvalidConfig", func(t *testing.T) {
+		for _, cfg := range []*MeterConfig{
+			{SessionBudget: -1},
+			{TenantBudgets: map[string]float64{"a": -1}},
+			{Action: BudgetActionDegrade},
+		} {
+			if _, err := NewMeter(shared.NewLogger(), cfg); err == nil {
+				t.Errorf("Expected an error for %+v, got nil", cfg)
+			}
+		}
+	})
+}
@@ -0,0 +1,45 @@
+package openai
+
+import (
+	"net/url"
+	"strings"
+
+	oairealtime "github.com/openai/openai-go/v3/realtime"
+)
+
+// AzureConfig switches the client to Azure OpenAI, which authenticates with an
+// api-key header, addresses models by deployment name and serves the realtime
+// endpoints under the resource's /openai path.
+type AzureConfig struct {
+	// Endpoint is the resource endpoint, e.g. https://my-resource.openai.azure.com.
+	// OpenaiConfig.BaseUrl overrides the URL derived from it.
+	Endpoint string
+	// Deployment replaces the model of every session, Azure's model field
+	// holding the deployment name.
+	Deployment string
+	// ApiVersion is sent as the api-version query parameter of every request.
+	// The v1 API takes none; preview versions need one.
+	ApiVersion string
+}
+
+// azureBaseUrl is the base URL of the v1 API of the resource at endpoint.
+func azureBaseUrl(endpoint string) string {
+	return strings.TrimSuffix(endpoint, "/") + "/openai/v1"
+}
+
+// url returns the URL of the API path, e.g. /realtime/calls.
+func (c *OpenaiRealtimeClient) url(path string) string {
+	if c.azure == nil || c.azure.ApiVersion == "" {
+		return c.baseUrl + path
+	}
+	return c.baseUrl + path + "?api-version=" + url.QueryEscape(c.azure.ApiVersion)
+}
+
+// session returns session as the API expects it, with the model replaced by
+// the Azure deployment.
+func (c *OpenaiRealtimeClient) session(session oairealtime.RealtimeSessionCreateRequestParam) oairealtime.RealtimeSessionCreateRequestParam {
+	if c.azure != nil && c.azure.Deployment != "" {
+		session.Model = oairealtime.RealtimeSessionCreateRequestModel(c.azure.Deployment)
+	}
+	return session
+}
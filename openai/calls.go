@@ -0,0 +1,90 @@
+package openai
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"mime/multipart"
+	"net/textproto"
+
+	oairealtime "github.com/openai/openai-go/v3/realtime"
+	"github.com/valyala/fasthttp"
+	"gitlab.bcc-hyperdev.org/bcc-hyperdev/realtime/rtc"
+)
+
+// CreateCall posts an SDP offer and the session config to the calls endpoint
+// and returns the SDP answer.
+func (c *OpenaiRealtimeClient) CreateCall(ctx context.Context, offer string, session oairealtime.RealtimeSessionCreateRequestParam) (answer string, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("failed to create call: %w", err)
+		}
+	}()
+	sessionConfig, err := c.session(session).MarshalJSON()
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal session: %w", err)
+	}
+	body, contentType, err := callForm(offer, sessionConfig)
+	if err != nil {
+		return "", err
+	}
+
+	req := fasthttp.AcquireRequest()
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseRequest(req)
+	defer fasthttp.ReleaseResponse(resp)
+	req.SetRequestURI(c.url("/realtime/calls"))
+	req.Header.SetMethod(fasthttp.MethodPost)
+	req.Header.SetContentType(contentType)
+	c.authorize(req)
+	req.SetBody(body)
+
+	if err := c.do(ctx, req, resp); err != nil {
+		return "", err
+	}
+	if resp.StatusCode() != fasthttp.StatusCreated {
+		return "", ResponseError(resp)
+	}
+	return string(resp.Body()), nil
+}
+
+// callForm builds the multipart body of the calls endpoint: the offer as
+// application/sdp and the session as JSON.
+func callForm(offer string, sessionConfig []byte) (body []byte, contentType string, err error) {
+	buf := &bytes.Buffer{}
+	writer := multipart.NewWriter(buf)
+	for _, part := range []struct {
+		name, contentType string
+		data              []byte
+	}{
+		{"sdp", "application/sdp", []byte(offer)},
+		{"session", "application/json", sessionConfig},
+	} {
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"`, part.name))
+		header.Set("Content-Type", part.contentType)
+		w, err := writer.CreatePart(header)
+		if err != nil {
+			return nil, "", err
+		}
+		if _, err := w.Write(part.data); err != nil {
+			return nil, "", err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), writer.FormDataContentType(), nil
+}
+
+// Signaler returns an rtc.Signaler creating calls with session. Failures are
+// retried with retry, the default policy when nil.
+func (c *OpenaiRealtimeClient) Signaler(session oairealtime.RealtimeSessionCreateRequestParam, retry *RetryPolicy) rtc.Signaler {
+	return func(ctx context.Context, offer string) (answer string, err error) {
+		err = retry.Do(ctx, func(ctx context.Context) error {
+			answer, err = c.CreateCall(ctx, offer, session)
+			return err
+		})
+		return answer, err
+	}
+}
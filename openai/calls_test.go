@@ -0,0 +1,288 @@
+package openai
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/openai/openai-go/v3/packages/param"
+	oairealtime "github.com/openai/openai-go/v3/realtime"
+	"github.com/valyala/fasthttp"
+	"gitlab.bcc-hyperdev.org/bcc-hyperdev/realtime/shared"
+)
+
+// callsServer is a local stand-in for the calls endpoint.
+type callsServer struct {
+	url string
+
+	mu      sync.Mutex
+	path    string
+	query   string
+	headers http.Header
+	sdp     string
+	session string
+	delay   time.Duration
+	failure int
+}
+
+func newCallsServer(t *testing.T) *callsServer {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	s := &callsServer{url: "http://" + ln.Addr().String() + "/gateway/v1"}
+	server := &fasthttp.Server{Handler: s.handle}
+	go func() { _ = server.Serve(ln) }()
+	t.Cleanup(func() { _ = server.Shutdown() })
+	return s
+}
+
+func (s *callsServer) handle(ctx *fasthttp.RequestCtx) {
+	s.mu.Lock()
+	delay := s.delay
+	s.path = string(ctx.Path())
+	s.query = string(ctx.QueryArgs().QueryString())
+	s.headers = http.Header{}
+	ctx.Request.Header.VisitAll(func(key, value []byte) {
+		s.headers.Set(string(key), string(value))
+	})
+	if form, err := ctx.MultipartForm(); err == nil {
+		s.sdp = firstValue(form.Value["sdp"])
+		s.session = firstValue(form.Value["session"])
+	}
+	failure := s.failure
+	if s.failure > 0 {
+		s.failure--
+	}
+	s.mu.Unlock()
+
+	time.Sleep(delay)
+	if failure > 0 {
+		ctx.SetStatusCode(fasthttp.StatusServiceUnavailable)
+		ctx.SetBodyString(`{"error":{"message":"overloaded","type":"server_error"}}`)
+		return
+	}
+	ctx.SetStatusCode(fasthttp.StatusCreated)
+	ctx.SetContentType("application/sdp")
+	ctx.SetBodyString("v=0 answer")
+}
+
+func firstValue(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// connectProxy is an HTTP proxy supporting CONNECT only, counting tunnels.
+func connectProxy(t *testing.T) (url string, tunnels func() int) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+	var mu sync.Mutex
+	count := 0
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer func() { _ = conn.Close() }()
+				req, err := http.ReadRequest(bufio.NewReader(conn))
+				if err != nil || req.Method != http.MethodConnect {
+					return
+				}
+				upstream, err := net.Dial("tcp", req.Host)
+				if err != nil {
+					return
+				}
+				defer func() { _ = upstream.Close() }()
+				mu.Lock()
+				count++
+				mu.Unlock()
+				_, _ = conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+				go func() { _, _ = io.Copy(upstream, conn) }()
+				_, _ = io.Copy(conn, upstream)
+			}()
+		}
+	}()
+	return "http://" + ln.Addr().String(), func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return count
+	}
+}
+
+func testSession() oairealtime.RealtimeSessionCreateRequestParam {
+	return oairealtime.RealtimeSessionCreateRequestParam{
+		Instructions: param.NewOpt("Be brief."),
+		Model:        oairealtime.RealtimeSessionCreateRequestModelGPTRealtime,
+	}
+}
+
+func TestCreateCall(t *testing.T) {
+	t.Run("Request", func(t *testing.T) {
+		s := newCallsServer(t)
+		client, err := NewOpenaiRealtimeClientWithConfig(shared.NewLogger(), &OpenaiConfig{
+			ApiKey:    "sk-test",
+			OrgId:     "org-test",
+			ProjectId: "proj-test",
+			BaseUrl:   s.url + "/",
+			Headers:   map[string]string{"X-Gateway-Tenant": "acme"},
+		})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		answer, err := client.CreateCall(context.Background(), "v=0 offer", testSession())
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if answer != "v=0 answer" {
+			t.Errorf("Expected the answer, got %q", answer)
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.path != "/gateway/v1/realtime/calls" {
+			t.Errorf("Expected the path under the base URL, got %s", s.path)
+		}
+		for key, want := range map[string]string{
+			"Authorization":       "Bearer sk-test",
+			"Openai-Organization": "org-test",
+			"Openai-Project":      "proj-test",
+			"X-Gateway-Tenant":    "acme",
+		} {
+			if got := s.headers.Get(key); got != want {
+				t.Errorf("Expected %s %q, got %q", key, want, got)
+			}
+		}
+		if s.sdp != "v=0 offer" || s.session != `{"instructions":"Be brief.","model":"gpt-realtime","type":"realtime"}` {
+			t.Errorf("Expected the offer and session parts, got %q and %s", s.sdp, s.session)
+		}
+	})
+
+	t.Run("Proxy", func(t *testing.T) {
+		s := newCallsServer(t)
+		proxyUrl, tunnels := connectProxy(t)
+		client, err := NewOpenaiRealtimeClientWithConfig(shared.NewLogger(), &OpenaiConfig{
+			ApiKey: "sk-test", OrgId: "org-test", ProjectId: "proj-test", BaseUrl: s.url,
+			ProxyUrl: proxyUrl,
+		})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if _, err := client.CreateCall(context.Background(), "v=0 offer", testSession()); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if got := tunnels(); got != 1 {
+			t.Errorf("Expected the request through the proxy, got %d tunnels", got)
+		}
+	})
+
+	t.Run("Timeout", func(t *testing.T) {
+		s := newCallsServer(t)
+		s.delay = 300 * time.Millisecond
+		client, err := NewOpenaiRealtimeClientWithConfig(shared.NewLogger(), &OpenaiConfig{
+			ApiKey: "sk-test", OrgId: "org-test", ProjectId: "proj-test", BaseUrl: s.url,
+			Timeout: 50 * time.Millisecond,
+		})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		start := time.Now()
+		_, err = client.CreateCall(context.Background(), "v=0 offer", testSession())
+		var connErr *ConnectionError
+		if !errors.As(err, &connErr) || !errors.Is(err, fasthttp.ErrTimeout) {
+			t.Errorf("Expected a timeout, got %v", err)
+		}
+		if elapsed := time.Since(start); elapsed > 250*time.Millisecond {
+			t.Errorf("Expected to give up after 50ms, got %v", elapsed)
+		}
+	})
+
+	t.Run("InjectedClient", func(t *testing.T) {
+		s := newCallsServer(t)
+		client, err := NewOpenaiRealtimeClientWithConfig(shared.NewLogger(), &OpenaiConfig{
+			ApiKey: "sk-test", OrgId: "org-test", ProjectId: "proj-test", BaseUrl: s.url,
+			HttpClient: &fasthttp.Client{Name: "custom-agent"},
+		})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if _, err := client.CreateCall(context.Background(), "v=0 offer", testSession()); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if got := s.headers.Get("User-Agent"); got != "custom-agent" {
+			t.Errorf("Expected the injected client, got user agent %q", got)
+		}
+	})
+
+	t.Run("SignalerRetries", func(t *testing.T) {
+		s := newCallsServer(t)
+		s.failure = 1
+		client, err := NewOpenaiRealtimeClient(shared.NewLogger(), "sk-test", "org-test", "proj-test", s.url)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		answer, err := client.Signaler(testSession(), &RetryPolicy{BaseDelay: time.Millisecond})(context.Background(), "v=0 offer")
+		if err != nil || answer != "v=0 answer" {
+			t.Errorf("Expected the answer after a retry, got %q, %v", answer, err)
+		}
+	})
+
+	t.Run("Azure", func(t *testing.T) {
+		s := newCallsServer(t)
+		client, err := NewOpenaiRealtimeClientWithConfig(shared.NewLogger(), &OpenaiConfig{
+			ApiKey: "azure-key",
+			Azure: &AzureConfig{
+				Endpoint:   strings.TrimSuffix(s.url, "/gateway/v1") + "/",
+				Deployment: "my-realtime",
+				ApiVersion: "2025-08-28",
+			},
+		})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if _, err := client.CreateCall(context.Background(), "v=0 offer", testSession()); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.path != "/openai/v1/realtime/calls" || s.query != "api-version=2025-08-28" {
+			t.Errorf("Expected the Azure endpoint, got %s?%s", s.path, s.query)
+		}
+		if got := s.headers.Get("Api-Key"); got != "azure-key" {
+			t.Errorf("Expected api-key azure-key, got %q", got)
+		}
+		for _, key := range []string{"Authorization", "Openai-Organization", "Openai-Project"} {
+			if got := s.headers.Get(key); got != "" {
+				t.Errorf("Expected no %s header, got %q", key, got)
+			}
+		}
+		if s.session != `{"instructions":"Be brief.","model":"my-realtime","type":"realtime"}` {
+			t.Errorf("Expected the deployment as model, got %s", s.session)
+		}
+	})
+
+	t.Run("AzureValidation", func(t *testing.T) {
+		if _, err := NewOpenaiRealtimeClientWithConfig(shared.NewLogger(), &OpenaiConfig{ApiKey: "azure-key", Azure: &AzureConfig{}}); err == nil {
+			t.Error("Expected an error without endpoint, got nil")
+		}
+		if _, err := NewOpenaiRealtimeClientWithConfig(shared.NewLogger(), &OpenaiConfig{ApiKey: "azure-key", BaseUrl: "https://gateway.example/openai/v1", Azure: &AzureConfig{}}); err != nil {
+			t.Errorf("Expected the base URL to stand in for the endpoint, got %v", err)
+		}
+	})
+}
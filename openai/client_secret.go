@@ -0,0 +1,252 @@
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/openai/openai-go/v3/packages/param"
+	oairealtime "github.com/openai/openai-go/v3/realtime"
+	"github.com/valyala/fasthttp"
+	"gitlab.bcc-hyperdev.org/bcc-hyperdev/realtime/shared"
+)
+
+// OpenAI accepts client secret lifetimes between 10 seconds and 2 hours.
+const (
+	DefaultClientSecretTTL = 10 * time.Minute
+	MinClientSecretTTL     = 10 * time.Second
+	MaxClientSecretTTL     = 2 * time.Hour
+)
+
+func (c *OpenaiRealtimeClient) CreateClientSecret(ctx context.Context, session oairealtime.RealtimeSessionCreateRequestParam, ttl time.Duration) (res *oairealtime.ClientSecretNewResponse, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("failed to create client secret: %w", err)
+		}
+	}()
+	session = c.session(session)
+	body, err := json.Marshal(oairealtime.ClientSecretNewParams{
+		ExpiresAfter: oairealtime.ClientSecretNewParamsExpiresAfter{
+			Anchor:  "created_at",
+			Seconds: param.NewOpt(int64(clampTTL(ttl) / time.Second)),
+		},
+		Session: oairealtime.ClientSecretNewParamsSessionUnion{OfRealtime: &session},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req := fasthttp.AcquireRequest()
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseRequest(req)
+	defer fasthttp.ReleaseResponse(resp)
+	req.SetRequestURI(c.url("/realtime/client_secrets"))
+	req.Header.SetMethod(fasthttp.MethodPost)
+	req.Header.SetContentType("application/json")
+	c.authorize(req)
+	req.SetBody(body)
+
+	if err := c.do(ctx, req, resp); err != nil {
+		return nil, err
+	}
+	if resp.StatusCode() != fasthttp.StatusOK {
+		return nil, ResponseError(resp)
+	}
+	res = &oairealtime.ClientSecretNewResponse{}
+	if err := json.Unmarshal(resp.Body(), res); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+	return res, nil
+}
+
+func clampTTL(ttl time.Duration) time.Duration {
+	if ttl <= 0 {
+		return DefaultClientSecretTTL
+	}
+	return min(max(ttl, MinClientSecretTTL), MaxClientSecretTTL)
+}
+
+// ClientSecretPolicy bounds what a single caller may request.
+type ClientSecretPolicy struct {
+	// UserId keys the rate limiter. Without one, callers are limited by their
+	// IP address instead.
+	UserId string
+	// AllowedModels and AllowedVoices restrict overrides of the template; an
+	// empty list only allows the template's value.
+	AllowedModels []string
+	AllowedVoices []string
+	// MaxOutputTokens caps the session's max_output_tokens. Zero keeps the
+	// template's limit.
+	MaxOutputTokens int64
+	TTL             time.Duration
+}
+
+// ClientSecretPolicyFunc authenticates the request and returns the policy of
+// the caller. An error rejects the request as unauthorized; it is logged, not
+// sent to the caller.
+type ClientSecretPolicyFunc func(ctx *fasthttp.RequestCtx) (*ClientSecretPolicy, error)
+
+type ClientSecretConfig struct {
+	// Template is the server-side session config every secret is minted for.
+	Template oairealtime.RealtimeSessionCreateRequestParam
+	Policy   ClientSecretPolicyFunc
+	// RateLimit is the number of secrets per second a user may mint, with
+	// RateBurst requests allowed at once.
+	RateLimit float64
+	RateBurst int
+}
+
+// ClientSecretRequest is the optional JSON body browsers send to pick among
+// the values their policy allows.
+type ClientSecretRequest struct {
+	Model           string `json:"model,omitempty"`
+	Voice           string `json:"voice,omitempty"`
+	MaxOutputTokens int64  `json:"max_output_tokens,omitempty"`
+}
+
+type ClientSecretResponse struct {
+	Value     string `json:"value"`
+	ExpiresAt int64  `json:"expires_at"`
+}
+
+// ClientSecretHandler mints ephemeral client secrets so that browsers can
+// connect to the Realtime API without holding the API key.
+type ClientSecretHandler struct {
+	logger  *shared.Logger
+	client  *OpenaiRealtimeClient
+	cfg     *ClientSecretConfig
+	limiter *shared.RateLimiter
+}
+
+func NewClientSecretHandler(logger *shared.Logger, client *OpenaiRealtimeClient, cfg *ClientSecretConfig) (h *ClientSecretHandler, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("failed to create client secret handler: %w", err)
+		}
+	}()
+	if client == nil {
+		return nil, fmt.Errorf("client is required")
+	}
+	if cfg == nil || cfg.Policy == nil {
+		return nil, fmt.Errorf("policy is required")
+	}
+	if cfg.RateLimit <= 0 {
+		return nil, fmt.Errorf("rate limit must be positive")
+	}
+	return &ClientSecretHandler{
+		logger:  logger,
+		client:  client,
+		cfg:     cfg,
+		limiter: shared.NewRateLimiter(cfg.RateLimit, cfg.RateBurst),
+	}, nil
+}
+
+func (s *OpenaiRealtimeService) NewClientSecretHandler(cfg *ClientSecretConfig) (*ClientSecretHandler, error) {
+	client, err := s.NewClient()
+	if err != nil {
+		return nil, err
+	}
+	return NewClientSecretHandler(s.logger, client, cfg)
+}
+
+func (h *ClientSecretHandler) Handle(ctx *fasthttp.RequestCtx) {
+	if !ctx.IsPost() {
+		writeError(ctx, fasthttp.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	policy, err := h.cfg.Policy(ctx)
+	if err != nil {
+		h.logger.Warnf(ctx, "client secret request rejected: %v", err)
+		writeError(ctx, fasthttp.StatusUnauthorized, "unauthorized")
+		return
+	}
+	key := policy.UserId
+	if key == "" {
+		key = "ip:" + ctx.RemoteIP().String()
+	}
+	if ok, retryAfter := h.limiter.Allow(key); !ok {
+		ctx.Response.Header.Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		writeError(ctx, fasthttp.StatusTooManyRequests, "rate limit exceeded")
+		return
+	}
+
+	var req ClientSecretRequest
+	if body := ctx.PostBody(); len(body) > 0 {
+		if err := json.Unmarshal(body, &req); err != nil {
+			writeError(ctx, fasthttp.StatusBadRequest, "invalid request body")
+			return
+		}
+	}
+	session, err := applyPolicy(h.cfg.Template, &req, policy)
+	if err != nil {
+		writeError(ctx, fasthttp.StatusForbidden, err.Error())
+		return
+	}
+
+	secret, err := h.client.CreateClientSecret(ctx, session, policy.TTL)
+	if err != nil {
+		h.logger.Error(ctx, err, "failed to mint client secret")
+		writeError(ctx, fasthttp.StatusBadGateway, "failed to mint client secret")
+		return
+	}
+	writeJSON(ctx, fasthttp.StatusOK, ClientSecretResponse{Value: secret.Value, ExpiresAt: secret.ExpiresAt})
+}
+
+// applyPolicy returns a copy of the template with the requested overrides,
+// rejecting any the policy does not allow.
+func applyPolicy(template oairealtime.RealtimeSessionCreateRequestParam, req *ClientSecretRequest, policy *ClientSecretPolicy) (oairealtime.RealtimeSessionCreateRequestParam, error) {
+	session := template
+	if req.Model != "" && req.Model != string(session.Model) {
+		if !slices.Contains(policy.AllowedModels, req.Model) {
+			return session, fmt.Errorf("model %s is not allowed", req.Model)
+		}
+		session.Model = oairealtime.RealtimeSessionCreateRequestModel(req.Model)
+	}
+	if req.Voice != "" && req.Voice != string(session.Audio.Output.Voice) {
+		if !slices.Contains(policy.AllowedVoices, req.Voice) {
+			return session, fmt.Errorf("voice %s is not allowed", req.Voice)
+		}
+		session.Audio.Output.Voice = oairealtime.RealtimeAudioConfigOutputVoice(req.Voice)
+	}
+
+	limit := policy.MaxOutputTokens
+	if current := session.MaxOutputTokens.OfInt; current.Valid() && (limit <= 0 || current.Value < limit) {
+		limit = current.Value
+	}
+	if req.MaxOutputTokens > 0 && (limit <= 0 || req.MaxOutputTokens < limit) {
+		limit = req.MaxOutputTokens
+	}
+	if limit > 0 {
+		session.MaxOutputTokens = oairealtime.RealtimeSessionCreateRequestMaxOutputTokensUnionParam{
+			OfInt: param.NewOpt(limit),
+		}
+	}
+	return session, nil
+}
+
+type errorBody struct {
+	Error struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func writeError(ctx *fasthttp.RequestCtx, status int, message string) {
+	var body errorBody
+	body.Error.Message = message
+	writeJSON(ctx, status, body)
+}
+
+func writeJSON(ctx *fasthttp.RequestCtx, status int, v any) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		ctx.Error(err.Error(), fasthttp.StatusInternalServerError)
+		return
+	}
+	ctx.SetStatusCode(status)
+	ctx.SetContentType("application/json")
+	ctx.SetBody(data)
+}
@@ -0,0 +1,261 @@
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/openai/openai-go/v3/packages/param"
+	oairealtime "github.com/openai/openai-go/v3/realtime"
+	"github.com/valyala/fasthttp"
+	"gitlab.bcc-hyperdev.org/bcc-hyperdev/realtime/shared"
+)
+
+// fakeOpenai is a local stand-in for the client secrets endpoint.
+type fakeOpenai struct {
+	server *fasthttp.Server
+	url    string
+
+	mu      sync.Mutex
+	status  int
+	headers map[string]string
+	query   string
+	body    map[string]any
+}
+
+func newFakeOpenai(t *testing.T) *fakeOpenai {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	f := &fakeOpenai{url: "http://" + ln.Addr().String() + "/v1", status: fasthttp.StatusOK}
+	f.server = &fasthttp.Server{Handler: f.handle}
+	go func() { _ = f.server.Serve(ln) }()
+	t.Cleanup(func() { _ = f.server.Shutdown() })
+	return f
+}
+
+func (f *fakeOpenai) handle(ctx *fasthttp.RequestCtx) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if string(ctx.Path()) != "/v1/realtime/client_secrets" {
+		ctx.SetStatusCode(fasthttp.StatusNotFound)
+		return
+	}
+	f.headers = map[string]string{}
+	for _, key := range []string{"Authorization", "OpenAI-Organization", "OpenAI-Project", "api-key"} {
+		f.headers[key] = string(ctx.Request.Header.Peek(key))
+	}
+	f.query = string(ctx.QueryArgs().QueryString())
+	f.body = map[string]any{}
+	_ = json.Unmarshal(ctx.PostBody(), &f.body)
+	ctx.SetStatusCode(f.status)
+	if f.status != fasthttp.StatusOK {
+		ctx.SetBodyString(`{"error":{"message":"boom"}}`)
+		return
+	}
+	ctx.SetBodyString(`{"value":"ek_test","expires_at":1700000000,"session":{"type":"realtime"}}`)
+}
+
+func (f *fakeOpenai) lastBody() map[string]any {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.body
+}
+
+func newTestHandler(t *testing.T, f *fakeOpenai, rateBurst int) *ClientSecretHandler {
+	t.Helper()
+	logger := shared.NewLogger()
+	client, err := NewOpenaiRealtimeClient(logger, "sk-test", "org-test", "proj-test", f.url)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	handler, err := NewClientSecretHandler(logger, client, &ClientSecretConfig{
+		Template: oairealtime.RealtimeSessionCreateRequestParam{
+			Instructions: param.NewOpt("You are a helpful assistant."),
+			Model:        oairealtime.RealtimeSessionCreateRequestModelGPTRealtime,
+			Audio: oairealtime.RealtimeAudioConfigParam{
+				Output: oairealtime.RealtimeAudioConfigOutputParam{
+					Voice: oairealtime.RealtimeAudioConfigOutputVoiceCedar,
+				},
+			},
+			MaxOutputTokens: oairealtime.RealtimeSessionCreateRequestMaxOutputTokensUnionParam{
+				OfInt: param.NewOpt[int64](1024),
+			},
+		},
+		Policy: func(ctx *fasthttp.RequestCtx) (*ClientSecretPolicy, error) {
+			user := string(ctx.Request.Header.Peek("X-User"))
+			if user == "" {
+				return nil, errors.New("missing user")
+			}
+			return &ClientSecretPolicy{
+				UserId:          user,
+				AllowedVoices:   []string{"marin"},
+				MaxOutputTokens: 512,
+				TTL:             time.Minute,
+			}, nil
+		},
+		RateLimit: 0.001,
+		RateBurst: rateBurst,
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	return handler
+}
+
+func serve(handler *ClientSecretHandler, user, body string) *fasthttp.RequestCtx {
+	ctx := &fasthttp.RequestCtx{}
+	ctx.Request.Header.SetMethod(fasthttp.MethodPost)
+	if user != "" {
+		ctx.Request.Header.Set("X-User", user)
+	}
+	ctx.Request.SetBodyString(body)
+	handler.Handle(ctx)
+	return ctx
+}
+
+func TestClientSecretHandler(t *testing.T) {
+	t.Run("MintsSecretWithPolicy", func(t *testing.T) {
+		f := newFakeOpenai(t)
+		handler := newTestHandler(t, f, 1)
+		ctx := serve(handler, "alice", `{"voice":"marin","max_output_tokens":4096}`)
+		if ctx.Response.StatusCode() != fasthttp.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", ctx.Response.StatusCode(), ctx.Response.Body())
+		}
+		var res ClientSecretResponse
+		_ = json.Unmarshal(ctx.Response.Body(), &res)
+		if res.Value != "ek_test" || res.ExpiresAt != 1700000000 {
+			t.Errorf("Expected secret ek_test, got %+v", res)
+		}
+
+		if f.headers["Authorization"] != "Bearer sk-test" || f.headers["OpenAI-Project"] != "proj-test" {
+			t.Errorf("Expected auth headers, got %v", f.headers)
+		}
+		body := f.lastBody()
+		expires := body["expires_after"].(map[string]any)
+		if expires["seconds"] != float64(60) || expires["anchor"] != "created_at" {
+			t.Errorf("Expected 60s ttl, got %v", expires)
+		}
+		session := body["session"].(map[string]any)
+		if session["model"] != "gpt-realtime" || session["max_output_tokens"] != float64(512) {
+			t.Errorf("Expected template model and capped tokens, got %v", session)
+		}
+		voice := session["audio"].(map[string]any)["output"].(map[string]any)["voice"]
+		if voice != "marin" {
+			t.Errorf("Expected voice marin, got %v", voice)
+		}
+	})
+
+	t.Run("RejectsDisallowedOverrides", func(t *testing.T) {
+		f := newFakeOpenai(t)
+		handler := newTestHandler(t, f, 5)
+		for _, body := range []string{`{"voice":"ash"}`, `{"model":"gpt-4o-realtime-preview"}`} {
+			ctx := serve(handler, "alice", body)
+			if ctx.Response.StatusCode() != fasthttp.StatusForbidden {
+				t.Errorf("Expected status 403 for %s, got %d", body, ctx.Response.StatusCode())
+			}
+		}
+		if f.lastBody() != nil {
+			t.Error("Expected OpenAI not to be called")
+		}
+	})
+
+	t.Run("RejectsUnauthenticated", func(t *testing.T) {
+		handler := newTestHandler(t, newFakeOpenai(t), 1)
+		ctx := serve(handler, "", "")
+		if ctx.Response.StatusCode() != fasthttp.StatusUnauthorized {
+			t.Errorf("Expected status 401, got %d", ctx.Response.StatusCode())
+		}
+		if body := string(ctx.Response.Body()); strings.Contains(body, "missing user") {
+			t.Errorf("Expected the policy error not to be sent, got %s", body)
+		}
+	})
+
+	t.Run("RateLimitsAnonymousByIp", func(t *testing.T) {
+		handler := newTestHandler(t, newFakeOpenai(t), 1)
+		handler.cfg.Policy = func(ctx *fasthttp.RequestCtx) (*ClientSecretPolicy, error) {
+			return &ClientSecretPolicy{}, nil
+		}
+		serveFrom := func(ip string) int {
+			ctx := &fasthttp.RequestCtx{}
+			ctx.Request.Header.SetMethod(fasthttp.MethodPost)
+			ctx.SetRemoteAddr(&net.TCPAddr{IP: net.ParseIP(ip), Port: 50000})
+			handler.Handle(ctx)
+			return ctx.Response.StatusCode()
+		}
+		if got := serveFrom("192.0.2.1"); got != fasthttp.StatusOK {
+			t.Fatalf("Expected status 200, got %d", got)
+		}
+		if got := serveFrom("192.0.2.1"); got != fasthttp.StatusTooManyRequests {
+			t.Errorf("Expected status 429, got %d", got)
+		}
+		if got := serveFrom("192.0.2.2"); got != fasthttp.StatusOK {
+			t.Errorf("Expected status 200 for another address, got %d", got)
+		}
+	})
+
+	t.Run("RateLimitsPerUser", func(t *testing.T) {
+		handler := newTestHandler(t, newFakeOpenai(t), 1)
+		if ctx := serve(handler, "alice", ""); ctx.Response.StatusCode() != fasthttp.StatusOK {
+			t.Fatalf("Expected status 200, got %d", ctx.Response.StatusCode())
+		}
+		ctx := serve(handler, "alice", "")
+		if ctx.Response.StatusCode() != fasthttp.StatusTooManyRequests {
+			t.Errorf("Expected status 429, got %d", ctx.Response.StatusCode())
+		}
+		if len(ctx.Response.Header.Peek("Retry-After")) == 0 {
+			t.Error("Expected Retry-After header")
+		}
+		if ctx := serve(handler, "bob", ""); ctx.Response.StatusCode() != fasthttp.StatusOK {
+			t.Errorf("Expected status 200 for another user, got %d", ctx.Response.StatusCode())
+		}
+	})
+
+	t.Run("UpstreamFailure", func(t *testing.T) {
+		f := newFakeOpenai(t)
+		f.status = fasthttp.StatusInternalServerError
+		handler := newTestHandler(t, f, 1)
+		if ctx := serve(handler, "alice", ""); ctx.Response.StatusCode() != fasthttp.StatusBadGateway {
+			t.Errorf("Expected status 502, got %d", ctx.Response.StatusCode())
+		}
+	})
+}
+
+func TestCreateClientSecretAzure(t *testing.T) {
+	f := newFakeOpenai(t)
+	client, err := NewOpenaiRealtimeClientWithConfig(shared.NewLogger(), &OpenaiConfig{
+		ApiKey:  "azure-key",
+		BaseUrl: f.url,
+		Azure:   &AzureConfig{Deployment: "my-realtime", ApiVersion: "2025-04-01-preview"},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	secret, err := client.CreateClientSecret(context.Background(), oairealtime.RealtimeSessionCreateRequestParam{
+		Model: oairealtime.RealtimeSessionCreateRequestModelGPTRealtime,
+	}, time.Minute)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if secret.Value != "ek_test" {
+		t.Errorf("Expected secret ek_test, got %s", secret.Value)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.headers["api-key"] != "azure-key" || f.headers["Authorization"] != "" {
+		t.Errorf("Expected the api-key header only, got %v", f.headers)
+	}
+	if f.query != "api-version=2025-04-01-preview" {
+		t.Errorf("Expected the api version, got %q", f.query)
+	}
+	if model := f.body["session"].(map[string]any)["model"]; model != "my-realtime" {
+		t.Errorf("Expected the deployment as model, got %v", model)
+	}
+}
@@ -0,0 +1,185 @@
+package openai
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/valyala/fasthttp"
+	"gitlab.bcc-hyperdev.org/bcc-hyperdev/realtime"
+)
+
+// APIError is an error reported by OpenAI, either as an HTTP error response
+// or as an error event on the data channel. It is returned wrapped in one of
+// the typed errors below when it can be classified; errors.As finds both.
+type APIError struct {
+	// StatusCode is zero for error events.
+	StatusCode int
+	Type       string
+	Code       string
+	Message    string
+	// Param is the path of the offending parameter, e.g.
+	// session.audio.output.voice.
+	Param string
+	// EventId is the client event that caused an error event.
+	EventId   string
+	RequestId string
+}
+
+func (e *APIError) Error() string {
+	var b strings.Builder
+	if e.StatusCode != 0 {
+		fmt.Fprintf(&b, "OpenAI returned status %d", e.StatusCode)
+	} else {
+		b.WriteString("OpenAI returned an error event")
+	}
+	if e.Code != "" {
+		fmt.Fprintf(&b, " (%s)", e.Code)
+	}
+	if e.Param != "" {
+		fmt.Fprintf(&b, " for %s", e.Param)
+	}
+	if e.Message != "" {
+		b.WriteString(": " + e.Message)
+	}
+	return b.String()
+}
+
+// AuthenticationError is an invalid or missing API key.
+type AuthenticationError struct{ *APIError }
+
+func (e *AuthenticationError) Unwrap() error { return e.APIError }
+
+// PermissionError is a key without access to the model, project or
+// organization.
+type PermissionError struct{ *APIError }
+
+func (e *PermissionError) Unwrap() error { return e.APIError }
+
+// RateLimitError is a request over the rate limit or quota. RetryAfter is
+// zero when OpenAI did not say when to retry.
+type RateLimitError struct {
+	*APIError
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Unwrap() error { return e.APIError }
+
+// InvalidSessionError is a session config that OpenAI rejected; Param points
+// at the invalid field.
+type InvalidSessionError struct{ *APIError }
+
+func (e *InvalidSessionError) Unwrap() error { return e.APIError }
+
+// ServerError is a failure on OpenAI's side.
+type ServerError struct{ *APIError }
+
+func (e *ServerError) Unwrap() error { return e.APIError }
+
+// ConnectionError is a request that did not get a response.
+type ConnectionError struct {
+	Err error
+}
+
+func (e *ConnectionError) Error() string {
+	return fmt.Sprintf("failed to reach OpenAI: %v", e.Err)
+}
+
+func (e *ConnectionError) Unwrap() error { return e.Err }
+
+type apiErrorBody struct {
+	Error *struct {
+		Message string `json:"message"`
+		Type    string `json:"type"`
+		Code    any    `json:"code"`
+		Param   any    `json:"param"`
+	} `json:"error"`
+}
+
+// ResponseError returns the typed error of an HTTP error response.
+func ResponseError(resp *fasthttp.Response) error {
+	e := &APIError{
+		StatusCode: resp.StatusCode(),
+		RequestId:  string(resp.Header.Peek("X-Request-Id")),
+	}
+	var body apiErrorBody
+	if err := json.Unmarshal(resp.Body(), &body); err == nil && body.Error != nil {
+		e.Message, e.Type = body.Error.Message, body.Error.Type
+		e.Code, e.Param = stringValue(body.Error.Code), stringValue(body.Error.Param)
+	} else {
+		e.Message = strings.TrimSpace(string(resp.Body()))
+	}
+	if e.StatusCode == fasthttp.StatusBadRequest && isSessionParam(e.Param) {
+		return &InvalidSessionError{e}
+	}
+	return classify(e, retryAfter(&resp.Header))
+}
+
+// isSessionParam reports whether param is the session config or a field of
+// it, as opposed to e.g. the SDP or expires_after.
+func isSessionParam(param string) bool {
+	return param == "session" || strings.HasPrefix(param, "session.")
+}
+
+// EventError returns the typed error of an error event received on the data
+// channel, or nil for any other event.
+func EventError(event realtime.Event) error {
+	if event.Type != realtime.EventTypeError {
+		return nil
+	}
+	var errorEvent realtime.ErrorEvent
+	if err := event.Decode(&errorEvent); err != nil {
+		return err
+	}
+	d := errorEvent.Error
+	e := &APIError{Type: d.Type, Code: d.Code, Message: d.Message, Param: d.Param, EventId: d.EventId}
+	if e.Type == "invalid_request_error" && isSessionParam(e.Param) {
+		return &InvalidSessionError{e}
+	}
+	return classify(e, 0)
+}
+
+func classify(e *APIError, retryAfter time.Duration) error {
+	switch {
+	case e.StatusCode == fasthttp.StatusUnauthorized || e.Type == "authentication_error" || e.Code == "invalid_api_key":
+		return &AuthenticationError{e}
+	case e.StatusCode == fasthttp.StatusForbidden || e.Type == "permission_error":
+		return &PermissionError{e}
+	case e.StatusCode == fasthttp.StatusTooManyRequests || e.Type == "rate_limit_error" || e.Code == "rate_limit_exceeded":
+		return &RateLimitError{APIError: e, RetryAfter: retryAfter}
+	case e.StatusCode >= fasthttp.StatusInternalServerError || e.Type == "server_error":
+		return &ServerError{e}
+	}
+	return e
+}
+
+// retryAfter reads the retry-after-ms header OpenAI sends, falling back to
+// the standard Retry-After in seconds or as a date.
+func retryAfter(header *fasthttp.ResponseHeader) time.Duration {
+	if ms, err := strconv.ParseFloat(string(header.Peek("Retry-After-Ms")), 64); err == nil && ms > 0 {
+		return time.Duration(ms * float64(time.Millisecond))
+	}
+	value := string(header.Peek("Retry-After"))
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds > 0 {
+		return time.Duration(seconds * float64(time.Second))
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(time.Until(at), 0)
+	}
+	return 0
+}
+
+// stringValue reads code and param, which OpenAI sends as null, strings or
+// numbers.
+func stringValue(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return ""
+}
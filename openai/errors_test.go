@@ -0,0 +1,241 @@
+package openai
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	oairealtime "github.com/openai/openai-go/v3/realtime"
+	"github.com/valyala/fasthttp"
+	"gitlab.bcc-hyperdev.org/bcc-hyperdev/realtime"
+	"gitlab.bcc-hyperdev.org/bcc-hyperdev/realtime/shared"
+)
+
+func errorResponse(status int, body string, headers ...string) *fasthttp.Response {
+	resp := &fasthttp.Response{}
+	resp.SetStatusCode(status)
+	resp.SetBodyString(body)
+	for i := 0; i+1 < len(headers); i += 2 {
+		resp.Header.Set(headers[i], headers[i+1])
+	}
+	return resp
+}
+
+func TestResponseError(t *testing.T) {
+	t.Run("Authentication", func(t *testing.T) {
+		err := ResponseError(errorResponse(401, `{"error":{"message":"Incorrect API key provided.","type":"invalid_request_error","code":"invalid_api_key","param":null}}`, "X-Request-Id", "req_1"))
+		var authErr *AuthenticationError
+		if !errors.As(err, &authErr) {
+			t.Fatalf("Expected AuthenticationError, got %T", err)
+		}
+		if authErr.Code != "invalid_api_key" || authErr.RequestId != "req_1" {
+			t.Errorf("Expected code invalid_api_key from req_1, got %+v", authErr.APIError)
+		}
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) || apiErr.StatusCode != 401 {
+			t.Errorf("Expected the APIError to be found too, got %v", apiErr)
+		}
+		if got := err.Error(); got != "OpenAI returned status 401 (invalid_api_key): Incorrect API key provided." {
+			t.Errorf("Expected a readable message, got %q", got)
+		}
+	})
+
+	t.Run("Permission", func(t *testing.T) {
+		var target *PermissionError
+		if err := ResponseError(errorResponse(403, `{"error":{"message":"no access"}}`)); !errors.As(err, &target) {
+			t.Errorf("Expected PermissionError, got %T", err)
+		}
+	})
+
+	t.Run("RateLimit", func(t *testing.T) {
+		for _, c := range []struct {
+			name    string
+			headers []string
+			want    time.Duration
+		}{
+			{"Milliseconds", []string{"Retry-After-Ms", "1500", "Retry-After", "9"}, 1500 * time.Millisecond},
+			{"Seconds", []string{"Retry-After", "2"}, 2 * time.Second},
+			{"None", nil, 0},
+		} {
+			t.Run(c.name, func(t *testing.T) {
+				err := ResponseError(errorResponse(429, `{"error":{"message":"Slow down.","type":"rate_limit_error","code":"rate_limit_exceeded"}}`, c.headers...))
+				var target *RateLimitError
+				if !errors.As(err, &target) {
+					t.Fatalf("Expected RateLimitError, got %T", err)
+				}
+				if target.RetryAfter != c.want {
+					t.Errorf("Expected retry after %v, got %v", c.want, target.RetryAfter)
+				}
+			})
+		}
+	})
+
+	t.Run("InvalidSession", func(t *testing.T) {
+		err := ResponseError(errorResponse(400, `{"error":{"message":"Invalid value: 'robot'.","type":"invalid_request_error","code":"invalid_value","param":"session.audio.output.voice"}}`))
+		var target *InvalidSessionError
+		if !errors.As(err, &target) {
+			t.Fatalf("Expected InvalidSessionError, got %T", err)
+		}
+		if target.Param != "session.audio.output.voice" {
+			t.Errorf("Expected the parameter path, got %q", target.Param)
+		}
+	})
+
+	t.Run("InvalidRequest", func(t *testing.T) {
+		err := ResponseError(errorResponse(400, `{"error":{"message":"Invalid SDP.","type":"invalid_request_error","code":"invalid_value","param":"sdp"}}`))
+		var target *InvalidSessionError
+		if errors.As(err, &target) {
+			t.Errorf("Expected a parameter outside the session not to be blamed on it, got %v", err)
+		}
+	})
+
+	t.Run("Server", func(t *testing.T) {
+		err := ResponseError(errorResponse(502, "Bad Gateway\n"))
+		var target *ServerError
+		if !errors.As(err, &target) {
+			t.Fatalf("Expected ServerError, got %T", err)
+		}
+		if target.Message != "Bad Gateway" {
+			t.Errorf("Expected the plain body as message, got %q", target.Message)
+		}
+	})
+
+	t.Run("Unclassified", func(t *testing.T) {
+		err := ResponseError(errorResponse(404, `{"error":{"message":"Not found.","type":"invalid_request_error"}}`))
+		if _, ok := err.(*APIError); !ok {
+			t.Errorf("Expected a plain APIError, got %T", err)
+		}
+	})
+}
+
+func TestEventError(t *testing.T) {
+	parse := func(t *testing.T, data string) realtime.Event {
+		t.Helper()
+		event, err := realtime.ParseEvent([]byte(data))
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		return event
+	}
+
+	t.Run("InvalidSession", func(t *testing.T) {
+		err := EventError(parse(t, `{"type":"error","error":{"type":"invalid_request_error","code":"invalid_value","message":"Invalid voice.","param":"session.audio.output.voice","event_id":"evt_1"}}`))
+		var target *InvalidSessionError
+		if !errors.As(err, &target) {
+			t.Fatalf("Expected InvalidSessionError, got %T", err)
+		}
+		if target.EventId != "evt_1" || target.StatusCode != 0 {
+			t.Errorf("Expected the event id without status, got %+v", target.APIError)
+		}
+	})
+
+	t.Run("RateLimit", func(t *testing.T) {
+		var target *RateLimitError
+		if err := EventError(parse(t, `{"type":"error","error":{"type":"rate_limit_error","code":"rate_limit_exceeded","message":"Slow down."}}`)); !errors.As(err, &target) {
+			t.Errorf("Expected RateLimitError, got %T", err)
+		}
+	})
+
+	t.Run("OtherEvents", func(t *testing.T) {
+		if err := EventError(parse(t, `{"type":"response.done"}`)); err != nil {
+			t.Errorf("Expected nil, got %v", err)
+		}
+	})
+}
+
+func TestRetryPolicy(t *testing.T) {
+	serverErr := &ServerError{&APIError{StatusCode: 500}}
+
+	t.Run("RetriesRetryable", func(t *testing.T) {
+		calls := 0
+		err := (&RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond}).Do(context.Background(), func(ctx context.Context) error {
+			calls++
+			if calls < 3 {
+				return serverErr
+			}
+			return nil
+		})
+		if err != nil || calls != 3 {
+			t.Errorf("Expected success on the third call, got %v after %d calls", err, calls)
+		}
+	})
+
+	t.Run("GivesUp", func(t *testing.T) {
+		calls := 0
+		err := (&RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond}).Do(context.Background(), func(ctx context.Context) error {
+			calls++
+			return serverErr
+		})
+		if !errors.Is(err, serverErr) || calls != 2 {
+			t.Errorf("Expected the server error after 2 calls, got %v after %d calls", err, calls)
+		}
+	})
+
+	t.Run("StopsOnPermanent", func(t *testing.T) {
+		calls := 0
+		authErr := &AuthenticationError{&APIError{StatusCode: 401}}
+		_ = (&RetryPolicy{BaseDelay: time.Millisecond}).Do(context.Background(), func(ctx context.Context) error {
+			calls++
+			return authErr
+		})
+		quota := &RateLimitError{APIError: &APIError{StatusCode: 429, Code: "insufficient_quota"}}
+		_ = (&RetryPolicy{BaseDelay: time.Millisecond}).Do(context.Background(), func(ctx context.Context) error {
+			calls++
+			return quota
+		})
+		if calls != 2 {
+			t.Errorf("Expected no retries, got %d calls", calls)
+		}
+	})
+
+	t.Run("RespectsRetryAfter", func(t *testing.T) {
+		var times []time.Time
+		_ = (&RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond}).Do(context.Background(), func(ctx context.Context) error {
+			times = append(times, time.Now())
+			return &RateLimitError{APIError: &APIError{StatusCode: 429}, RetryAfter: 50 * time.Millisecond}
+		})
+		if len(times) != 2 || times[1].Sub(times[0]) < 50*time.Millisecond {
+			t.Errorf("Expected the retry after 50ms, got %v", times)
+		}
+	})
+
+	t.Run("Deadline", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		calls := 0
+		start := time.Now()
+		err := (&RetryPolicy{}).Do(ctx, func(ctx context.Context) error {
+			calls++
+			return &RateLimitError{APIError: &APIError{StatusCode: 429}, RetryAfter: time.Minute}
+		})
+		if calls != 1 || time.Since(start) > time.Second {
+			t.Errorf("Expected to give up at once, got %d calls", calls)
+		}
+		var target *RateLimitError
+		if !errors.As(err, &target) {
+			t.Errorf("Expected the rate limit error, got %v", err)
+		}
+	})
+}
+
+func TestCreateClientSecretErrors(t *testing.T) {
+	f := newFakeOpenai(t)
+	f.status = fasthttp.StatusServiceUnavailable
+	client, err := NewOpenaiRealtimeClient(shared.NewLogger(), "sk-test", "org-test", "proj-test", f.url)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	_, err = client.CreateClientSecret(context.Background(), oairealtime.RealtimeSessionCreateRequestParam{}, time.Minute)
+	var serverErr *ServerError
+	if !errors.As(err, &serverErr) || serverErr.Message != "boom" {
+		t.Errorf("Expected ServerError boom, got %v", err)
+	}
+
+	client, _ = NewOpenaiRealtimeClient(shared.NewLogger(), "sk-test", "org-test", "proj-test", "http://127.0.0.1:1/v1")
+	_, err = client.CreateClientSecret(context.Background(), oairealtime.RealtimeSessionCreateRequestParam{}, time.Minute)
+	var connErr *ConnectionError
+	if !errors.As(err, &connErr) || !IsRetryable(err) {
+		t.Errorf("Expected a retryable ConnectionError, got %v", err)
+	}
+}
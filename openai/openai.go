@@ -0,0 +1,189 @@
+package openai
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/valyala/fasthttp"
+	"github.com/valyala/fasthttp/fasthttpproxy"
+	"gitlab.bcc-hyperdev.org/bcc-hyperdev/realtime/shared"
+	"golang.org/x/net/http/httpproxy"
+)
+
+const (
+	DefaultBaseUrl = "https://api.openai.com/v1"
+	DefaultTimeout = 30 * time.Second
+)
+
+type OpenaiRealtimeClient struct {
+	logger     *shared.Logger
+	httpClient *fasthttp.Client
+	timeout    time.Duration
+	headers    map[string]string
+	azure      *AzureConfig
+	apiKey     string
+	orgId      string
+	projectId  string
+	baseUrl    string
+}
+
+func NewOpenaiRealtimeClient(logger *shared.Logger, apiKey, orgId, projectId, baseUrl string) (*OpenaiRealtimeClient, error) {
+	return NewOpenaiRealtimeClientWithConfig(logger, &OpenaiConfig{
+		ApiKey:    apiKey,
+		OrgId:     orgId,
+		ProjectId: projectId,
+		BaseUrl:   baseUrl,
+	})
+}
+
+func NewOpenaiRealtimeClientWithConfig(logger *shared.Logger, cfg *OpenaiConfig) (*OpenaiRealtimeClient, error) {
+	if cfg == nil || cfg.ApiKey == "" {
+		return nil, fmt.Errorf("apiKey is required")
+	}
+	baseUrl := cfg.BaseUrl
+	if cfg.Azure != nil {
+		if cfg.Azure.Endpoint == "" && baseUrl == "" {
+			return nil, fmt.Errorf("azure endpoint is required")
+		}
+		if baseUrl == "" {
+			baseUrl = azureBaseUrl(cfg.Azure.Endpoint)
+		}
+	} else {
+		if cfg.OrgId == "" {
+			return nil, fmt.Errorf("orgId is required")
+		}
+		if cfg.ProjectId == "" {
+			return nil, fmt.Errorf("projectId is required")
+		}
+	}
+	if baseUrl == "" {
+		baseUrl = DefaultBaseUrl
+	}
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	httpClient, err := newHttpClient(cfg, timeout)
+	if err != nil {
+		return nil, err
+	}
+	return &OpenaiRealtimeClient{
+		logger:     logger,
+		httpClient: httpClient,
+		timeout:    timeout,
+		headers:    cfg.Headers,
+		azure:      cfg.Azure,
+		apiKey:     cfg.ApiKey,
+		orgId:      cfg.OrgId,
+		projectId:  cfg.ProjectId,
+		baseUrl:    strings.TrimSuffix(baseUrl, "/"),
+	}, nil
+}
+
+// newHttpClient builds the client of cfg. timeout is the defaulted client
+// timeout, which also bounds dialing and the CONNECT of a proxy.
+func newHttpClient(cfg *OpenaiConfig, timeout time.Duration) (*fasthttp.Client, error) {
+	if cfg.HttpClient != nil {
+		return cfg.HttpClient, nil
+	}
+	client := &fasthttp.Client{TLSConfig: cfg.TlsConfig}
+	if cfg.ProxyUrl == "" && !cfg.ProxyFromEnvironment {
+		return client, nil
+	}
+	dialer := &fasthttpproxy.Dialer{
+		Config:         httpproxy.Config{HTTPProxy: cfg.ProxyUrl, HTTPSProxy: cfg.ProxyUrl},
+		Timeout:        timeout,
+		ConnectTimeout: timeout,
+	}
+	dial, err := dialer.GetDialFunc(cfg.ProxyUrl == "")
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy: %w", err)
+	}
+	client.Dial = dial
+	return client, nil
+}
+
+func (c *OpenaiRealtimeClient) authorize(req *fasthttp.Request) {
+	c.setHeaders(req.Header.Set)
+}
+
+// setHeaders sets the authentication and custom headers with set.
+func (c *OpenaiRealtimeClient) setHeaders(set func(key, value string)) {
+	if c.azure != nil {
+		set("api-key", c.apiKey)
+	} else {
+		set("Authorization", "Bearer "+c.apiKey)
+		set("OpenAI-Organization", c.orgId)
+		set("OpenAI-Project", c.projectId)
+	}
+	for key, value := range c.headers {
+		set(key, value)
+	}
+}
+
+// do sends req within the earlier of the context deadline and the client
+// timeout.
+func (c *OpenaiRealtimeClient) do(ctx context.Context, req *fasthttp.Request, resp *fasthttp.Response) error {
+	deadline := time.Now().Add(c.timeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	if err := c.httpClient.DoDeadline(req, resp, deadline); err != nil {
+		return &ConnectionError{Err: err}
+	}
+	return nil
+}
+
+type OpenaiConfig struct {
+	ApiKey string
+	// OrgId and ProjectId are required but in Azure mode, where they are
+	// ignored.
+	OrgId     string
+	ProjectId string
+	BaseUrl   string
+	// Azure switches to Azure OpenAI; ApiKey is then the resource key.
+	Azure *AzureConfig
+	// HttpClient replaces the client built from the fields below, which are
+	// then ignored but for Timeout and Headers.
+	HttpClient *fasthttp.Client
+	// Timeout bounds requests made without a context deadline; it also
+	// bounds the proxy handshake.
+	Timeout time.Duration
+	// ProxyUrl routes requests through an http:// or socks5:// proxy.
+	// ProxyFromEnvironment uses HTTP_PROXY, HTTPS_PROXY and NO_PROXY
+	// instead.
+	ProxyUrl             string
+	ProxyFromEnvironment bool
+	TlsConfig            *tls.Config
+	// Headers are sent with every request, e.g. for an internal gateway.
+	Headers map[string]string
+}
+
+type OpenaiRealtimeService struct {
+	logger *shared.Logger
+	cfg    *OpenaiConfig
+}
+
+func NewOpenaiRealtimeService(logger *shared.Logger, cfg *OpenaiConfig) (s *OpenaiRealtimeService, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("failed to create OpenAI Realtime Service: %w", err)
+		}
+	}()
+	return &OpenaiRealtimeService{
+		logger: logger,
+		cfg:    cfg,
+	}, nil
+}
+
+func (s *OpenaiRealtimeService) NewClient() (c *OpenaiRealtimeClient, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("failed to create client: %w", err)
+		}
+	}()
+	return NewOpenaiRealtimeClientWithConfig(s.logger, s.cfg)
+}
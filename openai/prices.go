@@ -0,0 +1,29 @@
+package openai
+
+import "gitlab.bcc-hyperdev.org/bcc-hyperdev/realtime"
+
+// Prices are the list prices of the realtime models as published by OpenAI,
+// for realtime.MeterConfig. Check them against the pricing page before
+// billing on them.
+var Prices = map[string]realtime.Price{
+	"gpt-realtime": {
+		TextInput:        4,
+		CachedTextInput:  0.4,
+		TextOutput:       16,
+		AudioInput:       32,
+		CachedAudioInput: 0.4,
+		AudioOutput:      64,
+		ImageInput:       5,
+		CachedImageInput: 0.5,
+	},
+	"gpt-realtime-mini": {
+		TextInput:        0.6,
+		CachedTextInput:  0.06,
+		TextOutput:       2.4,
+		AudioInput:       10,
+		CachedAudioInput: 0.3,
+		AudioOutput:      20,
+		ImageInput:       0.8,
+		CachedImageInput: 0.08,
+	},
+}
@@ -0,0 +1,87 @@
+package openai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"time"
+)
+
+const (
+	DefaultRetryMaxAttempts = 3
+	DefaultRetryBaseDelay   = 500 * time.Millisecond
+	DefaultRetryMaxDelay    = 30 * time.Second
+)
+
+// RetryPolicy retries calls failing with retryable errors, with exponential
+// backoff and full jitter. A rate limit's RetryAfter is waited instead of the
+// backoff, even beyond MaxDelay.
+type RetryPolicy struct {
+	// MaxAttempts counts the first call; 1 disables retries.
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	// Retryable decides which errors are retried. Defaults to IsRetryable.
+	Retryable func(err error) bool
+}
+
+// IsRetryable reports whether err is worth retrying as is: rate limits other
+// than an exhausted quota, server errors and connection failures.
+func IsRetryable(err error) bool {
+	var rateLimit *RateLimitError
+	if errors.As(err, &rateLimit) {
+		return rateLimit.Code != "insufficient_quota"
+	}
+	var server *ServerError
+	var connection *ConnectionError
+	return errors.As(err, &server) || errors.As(err, &connection)
+}
+
+// Do calls fn until it succeeds, fails with an error that is not retryable,
+// runs out of attempts or ctx is done. It returns the last error of fn.
+func (p *RetryPolicy) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	maxAttempts, retryable := DefaultRetryMaxAttempts, IsRetryable
+	if p != nil && p.MaxAttempts > 0 {
+		maxAttempts = p.MaxAttempts
+	}
+	if p != nil && p.Retryable != nil {
+		retryable = p.Retryable
+	}
+	for attempt := 1; ; attempt++ {
+		err := fn(ctx)
+		if err == nil || attempt >= maxAttempts || !retryable(err) {
+			return err
+		}
+		delay := p.delay(attempt, err)
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			return err
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("%w (gave up retrying: %w)", err, ctx.Err())
+		}
+	}
+}
+
+func (p *RetryPolicy) delay(attempt int, err error) time.Duration {
+	var rateLimit *RateLimitError
+	if errors.As(err, &rateLimit) && rateLimit.RetryAfter > 0 {
+		return rateLimit.RetryAfter
+	}
+	base, maxDelay := DefaultRetryBaseDelay, DefaultRetryMaxDelay
+	if p != nil && p.BaseDelay > 0 {
+		base = p.BaseDelay
+	}
+	if p != nil && p.MaxDelay > 0 {
+		maxDelay = p.MaxDelay
+	}
+	backoff := min(base<<(attempt-1), maxDelay)
+	if backoff <= 0 {
+		backoff = maxDelay
+	}
+	return rand.N(backoff) + 1
+}
@@ -0,0 +1,437 @@
+package openai
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/openai/openai-go/v3/packages/param"
+	oairealtime "github.com/openai/openai-go/v3/realtime"
+	"github.com/openai/openai-go/v3/responses"
+	"github.com/openai/openai-go/v3/shared/constant"
+)
+
+const (
+	AudioFormatPCM  = "audio/pcm"
+	AudioFormatPCMU = "audio/pcmu"
+	AudioFormatPCMA = "audio/pcma"
+	// PCMRate is the only rate audio/pcm is accepted at.
+	PCMRate = 24000
+
+	ModalityAudio = "audio"
+	ModalityText  = "text"
+
+	// IncludeInputAudioTranscriptionLogprobs adds the log probabilities of
+	// input transcriptions, the only value Include accepts.
+	IncludeInputAudioTranscriptionLogprobs = "item.input_audio_transcription.logprobs"
+
+	TruncationAuto     = "auto"
+	TruncationDisabled = "disabled"
+
+	MinOutputSpeed = 0.25
+	MaxOutputSpeed = 1.5
+	// MaxOutputTokensLimit is the highest finite max_output_tokens.
+	MaxOutputTokensLimit = 4096
+)
+
+var eagernessValues = []string{"low", "medium", "high", "auto"}
+
+// AudioFormat is an input or output audio format. Rate only applies to
+// audio/pcm, where it defaults to PCMRate.
+type AudioFormat struct {
+	Type string
+	Rate int64
+}
+
+func (f AudioFormat) param() oairealtime.RealtimeAudioFormatsUnionParam {
+	switch f.Type {
+	case AudioFormatPCMU:
+		return oairealtime.RealtimeAudioFormatsUnionParam{OfAudioPCMU: &oairealtime.RealtimeAudioFormatsAudioPCMUParam{Type: f.Type}}
+	case AudioFormatPCMA:
+		return oairealtime.RealtimeAudioFormatsUnionParam{OfAudioPCMA: &oairealtime.RealtimeAudioFormatsAudioPCMAParam{Type: f.Type}}
+	default:
+		rate := f.Rate
+		if rate == 0 {
+			rate = PCMRate
+		}
+		return oairealtime.RealtimeAudioFormatsUnionParam{OfAudioPCM: &oairealtime.RealtimeAudioFormatsAudioPCMParam{Type: f.Type, Rate: rate}}
+	}
+}
+
+// ServerVad detects turns from the volume of the input audio. Zero fields
+// keep the server defaults.
+type ServerVad struct {
+	Threshold         float64
+	PrefixPaddingMs   int64
+	SilenceDurationMs int64
+	IdleTimeoutMs     int64
+	CreateResponse    bool
+	InterruptResponse bool
+}
+
+// PromptRef references a reusable prompt stored with OpenAI. Variables
+// replace the prompt's placeholders.
+type PromptRef struct {
+	Id string
+	// Version defaults to the current version of the prompt.
+	Version   string
+	Variables map[string]string
+}
+
+// SessionBuilder assembles a session config field by field. Build validates
+// the result with ValidateSession.
+type SessionBuilder struct {
+	session oairealtime.RealtimeSessionCreateRequestParam
+}
+
+func NewSessionBuilder(model string) *SessionBuilder {
+	return &SessionBuilder{session: oairealtime.RealtimeSessionCreateRequestParam{
+		Model: oairealtime.RealtimeSessionCreateRequestModel(model),
+	}}
+}
+
+// NewSessionBuilderFrom starts from an existing config, e.g. a template.
+func NewSessionBuilderFrom(session oairealtime.RealtimeSessionCreateRequestParam) *SessionBuilder {
+	return &SessionBuilder{session: session}
+}
+
+func (b *SessionBuilder) Instructions(instructions string) *SessionBuilder {
+	b.session.Instructions = param.NewOpt(instructions)
+	return b
+}
+
+// Prompt uses a reusable prompt, whose instructions the session's own
+// Instructions are appended to.
+func (b *SessionBuilder) Prompt(prompt PromptRef) *SessionBuilder {
+	p := responses.ResponsePromptParam{ID: prompt.Id}
+	if prompt.Version != "" {
+		p.Version = param.NewOpt(prompt.Version)
+	}
+	if len(prompt.Variables) > 0 {
+		p.Variables = make(map[string]responses.ResponsePromptVariableUnionParam, len(prompt.Variables))
+		for name, value := range prompt.Variables {
+			p.Variables[name] = responses.ResponsePromptVariableUnionParam{OfString: param.NewOpt(value)}
+		}
+	}
+	b.session.Prompt = p
+	return b
+}
+
+// Tracing enables tracing with the dashboard's default workflow name, group
+// and metadata.
+func (b *SessionBuilder) Tracing() *SessionBuilder {
+	b.session.Tracing = oairealtime.RealtimeTracingConfigUnionParam{OfAuto: constant.ValueOf[constant.Auto]()}
+	return b
+}
+
+// TracingWorkflow enables tracing under the given workflow name and group,
+// either of which may be empty.
+func (b *SessionBuilder) TracingWorkflow(workflowName, groupId string, metadata map[string]string) *SessionBuilder {
+	cfg := &oairealtime.RealtimeTracingConfigTracingConfigurationParam{}
+	if workflowName != "" {
+		cfg.WorkflowName = param.NewOpt(workflowName)
+	}
+	if groupId != "" {
+		cfg.GroupID = param.NewOpt(groupId)
+	}
+	if len(metadata) > 0 {
+		cfg.Metadata = metadata
+	}
+	b.session.Tracing = oairealtime.RealtimeTracingConfigUnionParam{OfTracingConfiguration: cfg}
+	return b
+}
+
+func (b *SessionBuilder) Include(values ...string) *SessionBuilder {
+	b.session.Include = append(b.session.Include, values...)
+	return b
+}
+
+// OutputModalities sets what the model responds with, ModalityAudio or
+// ModalityText. Audio responses come with their transcript.
+func (b *SessionBuilder) OutputModalities(modalities ...string) *SessionBuilder {
+	b.session.OutputModalities = modalities
+	return b
+}
+
+// TextOnly makes the model respond with text and drops the output audio
+// config.
+func (b *SessionBuilder) TextOnly() *SessionBuilder {
+	b.session.OutputModalities = []string{ModalityText}
+	b.session.Audio.Output = oairealtime.RealtimeAudioConfigOutputParam{}
+	return b
+}
+
+func (b *SessionBuilder) MaxOutputTokens(n int64) *SessionBuilder {
+	b.session.MaxOutputTokens = oairealtime.RealtimeSessionCreateRequestMaxOutputTokensUnionParam{OfInt: param.NewOpt(n)}
+	return b
+}
+
+// UnlimitedOutputTokens lifts the limit on output tokens per response.
+func (b *SessionBuilder) UnlimitedOutputTokens() *SessionBuilder {
+	b.session.MaxOutputTokens = oairealtime.RealtimeSessionCreateRequestMaxOutputTokensUnionParam{OfInf: constant.ValueOf[constant.Inf]()}
+	return b
+}
+
+// FunctionTool declares a function the model may call. Parameters is its
+// JSON schema.
+func (b *SessionBuilder) FunctionTool(name, description string, parameters any) *SessionBuilder {
+	tool := &oairealtime.RealtimeFunctionToolParam{
+		Name:       param.NewOpt(name),
+		Parameters: parameters,
+		Type:       oairealtime.RealtimeFunctionToolTypeFunction,
+	}
+	if description != "" {
+		tool.Description = param.NewOpt(description)
+	}
+	b.session.Tools = append(b.session.Tools, oairealtime.RealtimeToolsConfigUnionParam{OfFunction: tool})
+	return b
+}
+
+// McpTool gives the model the tools of a remote MCP server or connector.
+func (b *SessionBuilder) McpTool(tool oairealtime.RealtimeToolsConfigUnionMcpParam) *SessionBuilder {
+	b.session.Tools = append(b.session.Tools, oairealtime.RealtimeToolsConfigUnionParam{OfMcp: &tool})
+	return b
+}
+
+// ToolChoice sets how the model picks tools: none, auto or required.
+func (b *SessionBuilder) ToolChoice(mode responses.ToolChoiceOptions) *SessionBuilder {
+	b.session.ToolChoice = oairealtime.RealtimeToolChoiceConfigUnionParam{OfToolChoiceMode: param.NewOpt(mode)}
+	return b
+}
+
+// ToolChoiceFunction forces the model to call the named function tool.
+func (b *SessionBuilder) ToolChoiceFunction(name string) *SessionBuilder {
+	b.session.ToolChoice = oairealtime.RealtimeToolChoiceConfigUnionParam{OfFunctionTool: &responses.ToolChoiceFunctionParam{Name: name}}
+	return b
+}
+
+// ToolChoiceMcp forces the model to call a tool of the labelled MCP server,
+// the named one if name is not empty.
+func (b *SessionBuilder) ToolChoiceMcp(serverLabel, name string) *SessionBuilder {
+	choice := &responses.ToolChoiceMcpParam{ServerLabel: serverLabel}
+	if name != "" {
+		choice.Name = param.NewOpt(name)
+	}
+	b.session.ToolChoice = oairealtime.RealtimeToolChoiceConfigUnionParam{OfMcpTool: choice}
+	return b
+}
+
+// Truncation sets how the conversation is cut when it exceeds the context:
+// TruncationAuto or TruncationDisabled.
+func (b *SessionBuilder) Truncation(strategy string) *SessionBuilder {
+	b.session.Truncation = oairealtime.RealtimeTruncationUnionParam{OfRealtimeTruncationStrategy: param.NewOpt(strategy)}
+	return b
+}
+
+// TruncationRetentionRatio keeps the given fraction of the conversation
+// after the instructions when truncating, which keeps the cache hit rate
+// higher than dropping the oldest items one by one.
+func (b *SessionBuilder) TruncationRetentionRatio(ratio float64) *SessionBuilder {
+	b.session.Truncation = oairealtime.RealtimeTruncationUnionParam{OfRetentionRatioTruncation: &oairealtime.RealtimeTruncationRetentionRatioParam{RetentionRatio: ratio}}
+	return b
+}
+
+func (b *SessionBuilder) InputFormat(format AudioFormat) *SessionBuilder {
+	b.session.Audio.Input.Format = format.param()
+	return b
+}
+
+func (b *SessionBuilder) OutputFormat(format AudioFormat) *SessionBuilder {
+	b.session.Audio.Output.Format = format.param()
+	return b
+}
+
+func (b *SessionBuilder) ServerVad(vad ServerVad) *SessionBuilder {
+	cfg := &oairealtime.RealtimeAudioInputTurnDetectionServerVadParam{
+		CreateResponse:    param.NewOpt(vad.CreateResponse),
+		InterruptResponse: param.NewOpt(vad.InterruptResponse),
+	}
+	if vad.Threshold != 0 {
+		cfg.Threshold = param.NewOpt(vad.Threshold)
+	}
+	if vad.PrefixPaddingMs != 0 {
+		cfg.PrefixPaddingMs = param.NewOpt(vad.PrefixPaddingMs)
+	}
+	if vad.SilenceDurationMs != 0 {
+		cfg.SilenceDurationMs = param.NewOpt(vad.SilenceDurationMs)
+	}
+	if vad.IdleTimeoutMs != 0 {
+		cfg.IdleTimeoutMs = param.NewOpt(vad.IdleTimeoutMs)
+	}
+	b.session.Audio.Input.TurnDetection = oairealtime.RealtimeAudioInputTurnDetectionUnionParam{OfServerVad: cfg}
+	return b
+}
+
+// SemanticVad detects turns from what the user says. Eagerness is one of
+// low, medium, high or auto.
+func (b *SessionBuilder) SemanticVad(eagerness string, createResponse, interruptResponse bool) *SessionBuilder {
+	b.session.Audio.Input.TurnDetection = oairealtime.RealtimeAudioInputTurnDetectionUnionParam{
+		OfSemanticVad: &oairealtime.RealtimeAudioInputTurnDetectionSemanticVadParam{
+			Eagerness:         eagerness,
+			CreateResponse:    param.NewOpt(createResponse),
+			InterruptResponse: param.NewOpt(interruptResponse),
+		},
+	}
+	return b
+}
+
+func (b *SessionBuilder) NoiseReduction(kind oairealtime.NoiseReductionType) *SessionBuilder {
+	b.session.Audio.Input.NoiseReduction = oairealtime.RealtimeAudioConfigInputNoiseReductionParam{Type: kind}
+	return b
+}
+
+// Transcription transcribes the input audio; language and prompt may be
+// empty.
+func (b *SessionBuilder) Transcription(model oairealtime.AudioTranscriptionModel, language, prompt string) *SessionBuilder {
+	cfg := oairealtime.AudioTranscriptionParam{Model: model}
+	if language != "" {
+		cfg.Language = param.NewOpt(language)
+	}
+	if prompt != "" {
+		cfg.Prompt = param.NewOpt(prompt)
+	}
+	b.session.Audio.Input.Transcription = cfg
+	return b
+}
+
+func (b *SessionBuilder) Voice(voice oairealtime.RealtimeAudioConfigOutputVoice) *SessionBuilder {
+	b.session.Audio.Output.Voice = voice
+	return b
+}
+
+func (b *SessionBuilder) Speed(speed float64) *SessionBuilder {
+	b.session.Audio.Output.Speed = param.NewOpt(speed)
+	return b
+}
+
+func (b *SessionBuilder) Build() (oairealtime.RealtimeSessionCreateRequestParam, error) {
+	return b.session, ValidateSession(b.session)
+}
+
+// ValidateSession checks the constraints the API enforces on a session config,
+// reporting every violation with the path of the offending parameter.
+func ValidateSession(session oairealtime.RealtimeSessionCreateRequestParam) error {
+	var errs []error
+	fail := func(path, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%s: %s", path, fmt.Sprintf(format, args...)))
+	}
+
+	if session.Model == "" {
+		fail("model", "is required")
+	}
+
+	validateFormat := func(path string, format oairealtime.RealtimeAudioFormatsUnionParam) {
+		if pcm := format.OfAudioPCM; pcm != nil {
+			if pcm.Type != "" && pcm.Type != AudioFormatPCM {
+				fail(path+".type", "expected %s, got %s", AudioFormatPCM, pcm.Type)
+			}
+			if pcm.Rate != 0 && pcm.Rate != PCMRate {
+				fail(path+".rate", "must be %d for %s, got %d", PCMRate, AudioFormatPCM, pcm.Rate)
+			}
+		}
+		if f := format.OfAudioPCMU; f != nil && f.Type != "" && f.Type != AudioFormatPCMU {
+			fail(path+".type", "expected %s, got %s", AudioFormatPCMU, f.Type)
+		}
+		if f := format.OfAudioPCMA; f != nil && f.Type != "" && f.Type != AudioFormatPCMA {
+			fail(path+".type", "expected %s, got %s", AudioFormatPCMA, f.Type)
+		}
+	}
+	validateFormat("audio.input.format", session.Audio.Input.Format)
+	validateFormat("audio.output.format", session.Audio.Output.Format)
+
+	if vad := session.Audio.Input.TurnDetection.OfSemanticVad; vad != nil && vad.Eagerness != "" && !slices.Contains(eagernessValues, vad.Eagerness) {
+		fail("audio.input.turn_detection.eagerness", "must be one of %v, got %s", eagernessValues, vad.Eagerness)
+	}
+	if vad := session.Audio.Input.TurnDetection.OfServerVad; vad != nil {
+		if vad.Threshold.Valid() && (vad.Threshold.Value < 0 || vad.Threshold.Value > 1) {
+			fail("audio.input.turn_detection.threshold", "must be between 0 and 1, got %v", vad.Threshold.Value)
+		}
+		for _, field := range []struct {
+			name string
+			opt  param.Opt[int64]
+		}{
+			{"prefix_padding_ms", vad.PrefixPaddingMs},
+			{"silence_duration_ms", vad.SilenceDurationMs},
+			{"idle_timeout_ms", vad.IdleTimeoutMs},
+		} {
+			if field.opt.Valid() && field.opt.Value < 0 {
+				fail("audio.input.turn_detection."+field.name, "must not be negative, got %d", field.opt.Value)
+			}
+		}
+	}
+	if speed := session.Audio.Output.Speed; speed.Valid() && (speed.Value < MinOutputSpeed || speed.Value > MaxOutputSpeed) {
+		fail("audio.output.speed", "must be between %v and %v, got %v", MinOutputSpeed, MaxOutputSpeed, speed.Value)
+	}
+
+	if modalities := session.OutputModalities; len(modalities) > 0 {
+		if len(modalities) != 1 || (modalities[0] != ModalityAudio && modalities[0] != ModalityText) {
+			fail("output_modalities", "must be either [%s] or [%s], got %v", ModalityAudio, ModalityText, modalities)
+		}
+	}
+	for _, value := range session.Include {
+		if value != IncludeInputAudioTranscriptionLogprobs {
+			fail("include", "unsupported value %s", value)
+		}
+	}
+	if tokens := session.MaxOutputTokens.OfInt; tokens.Valid() && (tokens.Value < 1 || tokens.Value > MaxOutputTokensLimit) {
+		fail("max_output_tokens", "must be between 1 and %d or inf, got %d", MaxOutputTokensLimit, tokens.Value)
+	}
+
+	functions, servers := map[string]bool{}, map[string]bool{}
+	for i, tool := range session.Tools {
+		path := fmt.Sprintf("tools[%d]", i)
+		switch {
+		case tool.OfFunction != nil:
+			name := tool.OfFunction.Name.Value
+			if name == "" {
+				fail(path+".name", "is required")
+			} else if functions[name] {
+				fail(path+".name", "duplicate function %s", name)
+			}
+			functions[name] = true
+		case tool.OfMcp != nil:
+			mcp := tool.OfMcp
+			if mcp.ServerLabel == "" {
+				fail(path+".server_label", "is required")
+			} else if servers[mcp.ServerLabel] {
+				fail(path+".server_label", "duplicate server %s", mcp.ServerLabel)
+			}
+			servers[mcp.ServerLabel] = true
+			if !mcp.ServerURL.Valid() && mcp.ConnectorID == "" {
+				fail(path, "either server_url or connector_id is required")
+			}
+		}
+	}
+	choice := session.ToolChoice
+	if mode := choice.OfToolChoiceMode; mode.Valid() {
+		switch mode.Value {
+		case responses.ToolChoiceOptionsNone, responses.ToolChoiceOptionsAuto, responses.ToolChoiceOptionsRequired:
+		default:
+			fail("tool_choice", "must be none, auto or required, got %s", mode.Value)
+		}
+		if mode.Value == responses.ToolChoiceOptionsRequired && len(session.Tools) == 0 {
+			fail("tool_choice", "required needs tools")
+		}
+	}
+	if fn := choice.OfFunctionTool; fn != nil && !functions[fn.Name] {
+		fail("tool_choice.name", "unknown function %s", fn.Name)
+	}
+	if mcp := choice.OfMcpTool; mcp != nil && !servers[mcp.ServerLabel] {
+		fail("tool_choice.server_label", "unknown server %s", mcp.ServerLabel)
+	}
+
+	if strategy := session.Truncation.OfRealtimeTruncationStrategy; strategy.Valid() && strategy.Value != TruncationAuto && strategy.Value != TruncationDisabled {
+		fail("truncation", "must be %s or %s, got %s", TruncationAuto, TruncationDisabled, strategy.Value)
+	}
+	if ratio := session.Truncation.OfRetentionRatioTruncation; ratio != nil && (ratio.RetentionRatio < 0 || ratio.RetentionRatio > 1) {
+		fail("truncation.retention_ratio", "must be between 0 and 1, got %v", ratio.RetentionRatio)
+	}
+	if prompt := session.Prompt; (prompt.Version.Valid() || len(prompt.Variables) > 0) && prompt.ID == "" {
+		fail("prompt.id", "is required")
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("invalid session: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package openai
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/openai/openai-go/v3/packages/param"
+	oairealtime "github.com/openai/openai-go/v3/realtime"
+	"github.com/openai/openai-go/v3/responses"
+)
+
+func marshalSession(t *testing.T, session oairealtime.RealtimeSessionCreateRequestParam) map[string]any {
+	t.Helper()
+	data, err := json.Marshal(session)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	var m map[string]any
+	if err := json.Unmarshal(data, &m); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	return m
+}
+
+func TestSessionBuilder(t *testing.T) {
+	t.Run("AllFields", func(t *testing.T) {
+		session, err := NewSessionBuilder("gpt-realtime").
+			Instructions("Be brief.").
+			Prompt(PromptRef{Id: "pmpt_1", Version: "2", Variables: map[string]string{"city": "Oslo"}}).
+			TracingWorkflow("support", "group_1", map[string]string{"team": "voice"}).
+			Include(IncludeInputAudioTranscriptionLogprobs).
+			OutputModalities(ModalityAudio).
+			MaxOutputTokens(1024).
+			FunctionTool("lookup", "Looks things up.", map[string]any{"type": "object"}).
+			McpTool(oairealtime.RealtimeToolsConfigUnionMcpParam{ServerLabel: "docs", ServerURL: param.NewOpt("https://mcp.example.org")}).
+			ToolChoiceFunction("lookup").
+			TruncationRetentionRatio(0.8).
+			InputFormat(AudioFormat{Type: AudioFormatPCM}).
+			OutputFormat(AudioFormat{Type: AudioFormatPCMU}).
+			SemanticVad("low", true, true).
+			NoiseReduction(oairealtime.NoiseReductionTypeNearField).
+			Transcription(oairealtime.AudioTranscriptionModelWhisper1, "fa", "").
+			Voice(oairealtime.RealtimeAudioConfigOutputVoiceCedar).
+			Speed(0.9).
+			Build()
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		m := marshalSession(t, session)
+		for key, want := range map[string]string{
+			"prompt":      `{"id":"pmpt_1","variables":{"city":"Oslo"},"version":"2"}`,
+			"tracing":     `{"group_id":"group_1","metadata":{"team":"voice"},"workflow_name":"support"}`,
+			"include":     `["item.input_audio_transcription.logprobs"]`,
+			"tool_choice": `{"name":"lookup","type":"function"}`,
+			"truncation":  `{"retention_ratio":0.8,"type":"retention_ratio"}`,
+			"tools":       `[{"description":"Looks things up.","name":"lookup","parameters":{"type":"object"},"type":"function"},{"server_label":"docs","server_url":"https://mcp.example.org","type":"mcp"}]`,
+		} {
+			got, _ := json.Marshal(m[key])
+			if string(got) != want {
+				t.Errorf("Expected %s %s, got %s", key, want, got)
+			}
+		}
+		audio, _ := json.Marshal(m["audio"])
+		for _, want := range []string{`"format":{"rate":24000,"type":"audio/pcm"}`, `"format":{"type":"audio/pcmu"}`, `"eagerness":"low"`, `"voice":"cedar"`} {
+			if !strings.Contains(string(audio), want) {
+				t.Errorf("Expected audio to contain %s, got %s", want, audio)
+			}
+		}
+	})
+
+	t.Run("TextOnly", func(t *testing.T) {
+		session, err := NewSessionBuilder("gpt-realtime").
+			Voice(oairealtime.RealtimeAudioConfigOutputVoiceMarin).
+			TextOnly().
+			UnlimitedOutputTokens().
+			Tracing().
+			Truncation(TruncationDisabled).
+			Build()
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		m := marshalSession(t, session)
+		modalities, _ := json.Marshal(m["output_modalities"])
+		if string(modalities) != `["text"]` || m["max_output_tokens"] != "inf" || m["tracing"] != "auto" || m["truncation"] != "disabled" {
+			t.Errorf("Expected a text-only session, got %v", m)
+		}
+		if _, ok := m["audio"]; ok {
+			t.Errorf("Expected no output audio config, got %v", m["audio"])
+		}
+	})
+
+	t.Run("Validation", func(t *testing.T) {
+		for _, c := range []struct {
+			name    string
+			builder *SessionBuilder
+			want    string
+		}{
+			{"PCMRate", NewSessionBuilder("gpt-realtime").InputFormat(AudioFormat{Type: AudioFormatPCM, Rate: 16000}), "audio.input.format.rate"},
+			{"Model", NewSessionBuilder(""), "model"},
+			{"Eagerness", NewSessionBuilder("gpt-realtime").SemanticVad("eager", true, true), "audio.input.turn_detection.eagerness"},
+			{"Threshold", NewSessionBuilder("gpt-realtime").ServerVad(ServerVad{Threshold: 1.5}), "audio.input.turn_detection.threshold"},
+			{"Speed", NewSessionBuilder("gpt-realtime").Speed(2), "audio.output.speed"},
+			{"Modalities", NewSessionBuilder("gpt-realtime").OutputModalities(ModalityAudio, ModalityText), "output_modalities"},
+			{"Include", NewSessionBuilder("gpt-realtime").Include("item.logprobs"), "include"},
+			{"MaxOutputTokens", NewSessionBuilder("gpt-realtime").MaxOutputTokens(5000), "max_output_tokens"},
+			{"UnknownFunction", NewSessionBuilder("gpt-realtime").ToolChoiceFunction("lookup"), "tool_choice.name"},
+			{"RequiredWithoutTools", NewSessionBuilder("gpt-realtime").ToolChoice(responses.ToolChoiceOptionsRequired), "tool_choice"},
+			{"DuplicateFunction", NewSessionBuilder("gpt-realtime").FunctionTool("a", "", nil).FunctionTool("a", "", nil), "tools[1].name"},
+			{"McpWithoutServer", NewSessionBuilder("gpt-realtime").McpTool(oairealtime.RealtimeToolsConfigUnionMcpParam{ServerLabel: "docs"}), "tools[0]"},
+			{"Truncation", NewSessionBuilder("gpt-realtime").Truncation("oldest"), "truncation"},
+			{"RetentionRatio", NewSessionBuilder("gpt-realtime").TruncationRetentionRatio(1.2), "truncation.retention_ratio"},
+			{"PromptId", NewSessionBuilder("gpt-realtime").Prompt(PromptRef{Version: "2"}), "prompt.id"},
+		} {
+			t.Run(c.name, func(t *testing.T) {
+				_, err := c.builder.Build()
+				if err == nil || !strings.Contains(err.Error(), c.want+":") {
+					t.Errorf("Expected an error for %s, got %v", c.want, err)
+				}
+			})
+		}
+	})
+
+	t.Run("ReportsEveryViolation", func(t *testing.T) {
+		err := ValidateSession(oairealtime.RealtimeSessionCreateRequestParam{
+			OutputModalities: []string{"video"},
+			Include:          []string{"nope"},
+		})
+		if err == nil || !strings.Contains(err.Error(), "output_modalities") || !strings.Contains(err.Error(), "include") {
+			t.Errorf("Expected both violations, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,235 @@
+package openai
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	oairealtime "github.com/openai/openai-go/v3/realtime"
+	"gitlab.bcc-hyperdev.org/bcc-hyperdev/realtime"
+	"gitlab.bcc-hyperdev.org/bcc-hyperdev/realtime/shared"
+	"golang.org/x/net/websocket"
+)
+
+var ErrTransportClosed = errors.New("transport closed")
+
+// WebsocketTransport is a realtime.Transport over the realtime WebSocket
+// endpoint, e.g. for servers that cannot run WebRTC. Events are text
+// messages; audio travels base64 encoded in input_audio_buffer.append and
+// response.output_audio.delta events, which Audio delivers decoded instead
+// of as events. Frames are in the session's audio formats, audio/pcm at
+// PCMRate by default.
+type WebsocketTransport struct {
+	logger *shared.Logger
+	conn   *websocket.Conn
+
+	events chan []byte
+	audio  chan []byte
+	closed chan struct{}
+	read   chan struct{}
+
+	closeOnce sync.Once
+	closeErr  error
+}
+
+var _ realtime.Transport = (*WebsocketTransport)(nil)
+
+// DialWebsocket connects to the realtime endpoint for the model of session
+// and sends the rest of session as a session.update. The connection goes
+// through the dialer of the HTTP client, and so through its proxy, and the
+// handshake is bounded by the client timeout.
+func (c *OpenaiRealtimeClient) DialWebsocket(ctx context.Context, session oairealtime.RealtimeSessionCreateRequestParam) (t *WebsocketTransport, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("failed to dial WebSocket transport: %w", err)
+		}
+	}()
+	session = c.session(session)
+	location, err := c.websocketUrl(string(session.Model))
+	if err != nil {
+		return nil, err
+	}
+	config, err := websocket.NewConfig(location.String(), c.baseUrl)
+	if err != nil {
+		return nil, fmt.Errorf("invalid url: %w", err)
+	}
+	c.setHeaders(config.Header.Set)
+	deadline := time.Now().Add(c.timeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	netConn, err := c.dialWebsocket(ctx, location, deadline)
+	if err != nil {
+		return nil, &ConnectionError{Err: err}
+	}
+	_ = netConn.SetDeadline(deadline)
+	conn, err := websocket.NewClient(config, netConn)
+	if err != nil {
+		_ = netConn.Close()
+		return nil, &ConnectionError{Err: err}
+	}
+	_ = netConn.SetDeadline(time.Time{})
+	t = &WebsocketTransport{
+		logger: c.logger,
+		conn:   conn,
+		events: make(chan []byte, 64),
+		audio:  make(chan []byte, 64),
+		closed: make(chan struct{}),
+		read:   make(chan struct{}),
+	}
+	go t.readLoop()
+	update, err := json.Marshal(realtime.NewSessionUpdateEvent(session))
+	if err != nil {
+		_ = t.Close(ctx)
+		return nil, fmt.Errorf("failed to marshal session: %w", err)
+	}
+	if err := t.Send(ctx, update); err != nil {
+		_ = t.Close(ctx)
+		return nil, fmt.Errorf("failed to update session: %w", err)
+	}
+	return t, nil
+}
+
+// websocketUrl returns the ws:// or wss:// URL of the realtime endpoint for
+// model.
+func (c *OpenaiRealtimeClient) websocketUrl(model string) (*url.URL, error) {
+	u, err := url.Parse(c.url("/realtime"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid base url: %w", err)
+	}
+	u.Scheme = strings.Replace(u.Scheme, "http", "ws", 1)
+	query := u.Query()
+	query.Set("model", model)
+	u.RawQuery = query.Encode()
+	return u, nil
+}
+
+// dialWebsocket opens the connection to the host of u with the dialer of the
+// HTTP client, the proxy dialer if one is configured, and adds TLS for wss.
+func (c *OpenaiRealtimeClient) dialWebsocket(ctx context.Context, u *url.URL, deadline time.Time) (net.Conn, error) {
+	addr := u.Host
+	if u.Port() == "" {
+		port := "80"
+		if u.Scheme == "wss" {
+			port = "443"
+		}
+		addr = net.JoinHostPort(u.Hostname(), port)
+	}
+	var conn net.Conn
+	var err error
+	switch {
+	case c.httpClient.Dial != nil:
+		conn, err = c.httpClient.Dial(addr)
+	case c.httpClient.DialTimeout != nil:
+		conn, err = c.httpClient.DialTimeout(addr, time.Until(deadline))
+	default:
+		dialer := &net.Dialer{Deadline: deadline}
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil || u.Scheme != "wss" {
+		return conn, err
+	}
+	tlsConfig := &tls.Config{}
+	if c.httpClient.TLSConfig != nil {
+		tlsConfig = c.httpClient.TLSConfig.Clone()
+	}
+	if tlsConfig.ServerName == "" {
+		tlsConfig.ServerName = u.Hostname()
+	}
+	tlsConn := tls.Client(conn, tlsConfig)
+	handshakeCtx, cancel := context.WithDeadline(ctx, deadline)
+	defer cancel()
+	if err := tlsConn.HandshakeContext(handshakeCtx); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+func (t *WebsocketTransport) Events() <-chan []byte {
+	return t.events
+}
+
+func (t *WebsocketTransport) Audio() <-chan []byte {
+	return t.audio
+}
+
+func (t *WebsocketTransport) Send(ctx context.Context, event []byte) error {
+	select {
+	case <-t.closed:
+		return ErrTransportClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+	}
+	return websocket.Message.Send(t.conn, string(event))
+}
+
+// WriteAudio appends frame to the input audio buffer.
+func (t *WebsocketTransport) WriteAudio(ctx context.Context, frame []byte) error {
+	event, err := json.Marshal(realtime.NewInputAudioBufferAppendEvent(frame))
+	if err != nil {
+		return fmt.Errorf("failed to encode audio: %w", err)
+	}
+	return t.Send(ctx, event)
+}
+
+// Close closes the connection and waits for the reader before closing Events
+// and Audio.
+func (t *WebsocketTransport) Close(ctx context.Context) error {
+	t.closeOnce.Do(func() {
+		close(t.closed)
+		if err := t.conn.Close(); err != nil {
+			t.closeErr = fmt.Errorf("failed to close connection: %w", err)
+		}
+		select {
+		case <-t.read:
+		case <-ctx.Done():
+			t.closeErr = errors.Join(t.closeErr, fmt.Errorf("failed to stop reader: %w", ctx.Err()))
+		}
+	})
+	return t.closeErr
+}
+
+// readLoop delivers messages until the connection closes, then closes the
+// transport if the server hung up.
+func (t *WebsocketTransport) readLoop() {
+	defer func() {
+		close(t.events)
+		close(t.audio)
+		close(t.read)
+	}()
+	for {
+		var data []byte
+		if err := websocket.Message.Receive(t.conn, &data); err != nil {
+			select {
+			case <-t.closed:
+			default:
+				t.logger.NoCtxWarnf("WebSocket connection lost: %v", err)
+				go func() { _ = t.Close(context.Background()) }()
+			}
+			return
+		}
+		ch, msg := t.events, data
+		if event, err := realtime.ParseEvent(data); err == nil && event.Type == realtime.EventTypeResponseOutputAudioDelta {
+			var payload realtime.ResponseOutputAudioDeltaEvent
+			if err := event.Decode(&payload); err != nil {
+				t.logger.NoCtxWarnf("failed to decode audio: %v", err)
+				continue
+			}
+			ch, msg = t.audio, payload.Delta
+		}
+		select {
+		case ch <- msg:
+		case <-t.closed:
+			return
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package openai
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"gitlab.bcc-hyperdev.org/bcc-hyperdev/realtime"
+	"gitlab.bcc-hyperdev.org/bcc-hyperdev/realtime/shared"
+	"golang.org/x/net/websocket"
+)
+
+// websocketServer is a local stand-in for the realtime WebSocket endpoint. It
+// answers response.create with a text response and echoes input audio.
+type websocketServer struct {
+	url string
+
+	mu       sync.Mutex
+	query    string
+	headers  http.Header
+	received []string
+}
+
+func newWebsocketServer(t *testing.T) *websocketServer {
+	t.Helper()
+	s := &websocketServer{}
+	server := httptest.NewServer(websocket.Server{Handler: s.handle})
+	t.Cleanup(server.Close)
+	s.url = server.URL + "/v1"
+	return s
+}
+
+func (s *websocketServer) handle(conn *websocket.Conn) {
+	s.mu.Lock()
+	s.query = conn.Request().URL.RawQuery
+	s.headers = conn.Request().Header.Clone()
+	s.mu.Unlock()
+	for {
+		var data []byte
+		if err := websocket.Message.Receive(conn, &data); err != nil {
+			return
+		}
+		event, err := realtime.ParseEvent(data)
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.received = append(s.received, event.Type)
+		s.mu.Unlock()
+		var replies []string
+		switch event.Type {
+		case realtime.EventTypeResponseCreate:
+			replies = []string{
+				`{"type":"response.output_text.delta","response_id":"resp_1","item_id":"item_1","delta":"Hel"}`,
+				`{"type":"response.output_text.delta","response_id":"resp_1","item_id":"item_1","delta":"lo"}`,
+				`{"type":"response.output_text.done","response_id":"resp_1","item_id":"item_1","text":"Hello"}`,
+			}
+		case realtime.EventTypeInputAudioBufferAppend:
+			var in realtime.InputAudioBufferAppendEvent
+			_ = json.Unmarshal(data, &in)
+			delta := base64.StdEncoding.EncodeToString(in.Audio)
+			replies = []string{`{"type":"response.output_audio.delta","response_id":"resp_1","item_id":"item_1","delta":"` + delta + `"}`}
+		}
+		for _, reply := range replies {
+			if err := websocket.Message.Send(conn, reply); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func newWebsocketClient(t *testing.T, s *websocketServer) *OpenaiRealtimeClient {
+	t.Helper()
+	client, err := NewOpenaiRealtimeClientWithConfig(shared.NewLogger(), &OpenaiConfig{
+		ApiKey:    "sk-test",
+		OrgId:     "org-test",
+		ProjectId: "proj-test",
+		BaseUrl:   s.url,
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	return client
+}
+
+func TestWebsocketTransport(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Text", func(t *testing.T) {
+		s := newWebsocketServer(t)
+		transport, err := newWebsocketClient(t, s).DialWebsocket(ctx, testSession())
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		session, err := realtime.NewSession(shared.NewLogger(), transport, nil)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		stream := realtime.NewTextStream(shared.NewLogger(), session)
+		defer stream.Close()
+		final := make(chan realtime.TextOutput, 1)
+		stream.OnText(func(output realtime.TextOutput) {
+			if output.Final {
+				final <- output
+			}
+		})
+		if err := session.Start(); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		defer func() { _ = session.Close(ctx) }()
+		if err := session.SendText(ctx, "Hi"); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if got := <-final; got.Text != "Hello" || got.ResponseId != "resp_1" {
+			t.Errorf("Expected the final text Hello, got %+v", got)
+		}
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		want := []string{realtime.EventTypeSessionUpdate, realtime.EventTypeConversationItemCreate, realtime.EventTypeResponseCreate}
+		if strings.Join(s.received, " ") != strings.Join(want, " ") {
+			t.Errorf("Expected %v, got %v", want, s.received)
+		}
+		if s.query != "model=gpt-realtime" {
+			t.Errorf("Expected model=gpt-realtime, got %s", s.query)
+		}
+		if got := s.headers.Get("Authorization"); got != "Bearer sk-test" {
+			t.Errorf("Expected Bearer sk-test, got %s", got)
+		}
+	})
+
+	t.Run("Proxy", func(t *testing.T) {
+		s := newWebsocketServer(t)
+		proxyUrl, tunnels := connectProxy(t)
+		client, err := NewOpenaiRealtimeClientWithConfig(shared.NewLogger(), &OpenaiConfig{
+			ApiKey: "sk-test", OrgId: "org-test", ProjectId: "proj-test", BaseUrl: s.url,
+			ProxyUrl: proxyUrl,
+		})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		transport, err := client.DialWebsocket(ctx, testSession())
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		defer func() { _ = transport.Close(ctx) }()
+		if got := tunnels(); got != 1 {
+			t.Errorf("Expected the connection through the proxy, got %d tunnels", got)
+		}
+	})
+
+	t.Run("Audio", func(t *testing.T) {
+		s := newWebsocketServer(t)
+		transport, err := newWebsocketClient(t, s).DialWebsocket(ctx, testSession())
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		frame := []byte{1, 2, 3, 4}
+		if err := transport.WriteAudio(ctx, frame); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if got := <-transport.Audio(); string(got) != string(frame) {
+			t.Errorf("Expected %v, got %v", frame, got)
+		}
+		if err := transport.Close(ctx); err != nil {
+			t.Errorf("Expected no error, got %v", err)
+		}
+		if err := transport.Send(ctx, []byte(`{}`)); err != ErrTransportClosed {
+			t.Errorf("Expected %v, got %v", ErrTransportClosed, err)
+		}
+		if _, ok := <-transport.Events(); ok {
+			t.Error("Expected events to be closed")
+		}
+	})
+}
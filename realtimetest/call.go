@@ -0,0 +1,310 @@
+package realtimetest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"gitlab.bcc-hyperdev.org/bcc-hyperdev/realtime"
+	"gitlab.bcc-hyperdev.org/bcc-hyperdev/realtime/audio"
+	"gitlab.bcc-hyperdev.org/bcc-hyperdev/realtime/rtc"
+)
+
+const (
+	frameDuration = 20 * time.Millisecond
+	frameSamples  = realtime.SampleRate / 50
+	// toneFrequency and toneAmplitude shape the synthesized speech.
+	toneFrequency = 440
+	toneAmplitude = 8000
+)
+
+// Call is a call answered by the server.
+type Call struct {
+	Id string
+	// Session is the session config posted with the offer, if any.
+	Session   json.RawMessage
+	CreatedAt time.Time
+
+	server    *Server
+	transport *rtc.Transport
+	scenario  *Scenario
+	ctx       context.Context
+	cancel    context.CancelFunc
+	wg        sync.WaitGroup
+	done      chan struct{}
+	sendMu    sync.Mutex
+
+	mu        sync.Mutex
+	received  []realtime.Event
+	audio     time.Duration
+	nextId    int
+	responses map[string]context.CancelFunc
+	phase     float64
+}
+
+func newCall(s *Server, id string, session json.RawMessage, transport *rtc.Transport, scenario *Scenario) *Call {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Call{
+		Id:        id,
+		Session:   session,
+		CreatedAt: time.Now(),
+		server:    s,
+		transport: transport,
+		scenario:  scenario,
+		ctx:       ctx,
+		cancel:    cancel,
+		done:      make(chan struct{}),
+		responses: make(map[string]context.CancelFunc),
+	}
+}
+
+func (c *Call) start() {
+	c.wg.Add(3)
+	go c.readEvents()
+	go c.readAudio()
+	go c.script()
+	go func() {
+		c.wg.Wait()
+		close(c.done)
+		c.server.remove(c)
+	}()
+}
+
+// Done is closed once the call has ended.
+func (c *Call) Done() <-chan struct{} {
+	return c.done
+}
+
+// Received returns the client events received so far.
+func (c *Call) Received() []realtime.Event {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]realtime.Event(nil), c.received...)
+}
+
+// ReceivedAudio returns how much audio the client has sent.
+func (c *Call) ReceivedAudio() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.audio
+}
+
+// Send sends a server event, filling in its event_id when it has none.
+func (c *Call) Send(ctx context.Context, event any) (err error) {
+	var data []byte
+	switch e := event.(type) {
+	case []byte:
+		data = e
+	case json.RawMessage:
+		data = e
+	default:
+		if data, err = json.Marshal(event); err != nil {
+			return fmt.Errorf("failed to marshal event: %w", err)
+		}
+	}
+	if data, err = c.withEventId(data); err != nil {
+		return err
+	}
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+	return c.transport.Send(ctx, data)
+}
+
+func (c *Call) withEventId(data []byte) ([]byte, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, fmt.Errorf("invalid event: %w", err)
+	}
+	if _, ok := fields["event_id"]; ok {
+		return data, nil
+	}
+	fields["event_id"], _ = json.Marshal(c.newId("event"))
+	return json.Marshal(fields)
+}
+
+func (c *Call) newId(prefix string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.nextId++
+	return fmt.Sprintf("%s_%d", prefix, c.nextId)
+}
+
+// SendAudio streams a tone standing in for speech, paced in real time.
+func (c *Call) SendAudio(ctx context.Context, duration time.Duration) error {
+	ticker := time.NewTicker(frameDuration)
+	defer ticker.Stop()
+	for sent := time.Duration(0); sent < duration; sent += frameDuration {
+		if err := c.transport.WriteAudio(ctx, c.tone()); err != nil {
+			return err
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-c.ctx.Done():
+			return ErrCallEnded
+		}
+	}
+	return nil
+}
+
+func (c *Call) tone() []byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	samples := make([]int16, frameSamples)
+	for i := range samples {
+		samples[i] = int16(toneAmplitude * math.Sin(c.phase))
+		c.phase += 2 * math.Pi * toneFrequency / realtime.SampleRate
+	}
+	c.phase = math.Mod(c.phase, 2*math.Pi)
+	return audio.PCM(samples)
+}
+
+// Respond plays a response made of an assistant message with that much
+// synthesized speech, framed by the events the provider sends. A
+// response.cancel from the client stops it with the cancelled status.
+func (c *Call) Respond(ctx context.Context, duration time.Duration) error {
+	responseId, itemId := c.newId("resp"), c.newId("item")
+	ctx, cancel := context.WithCancel(ctx)
+	c.mu.Lock()
+	c.responses[responseId] = cancel
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.responses, responseId)
+		c.mu.Unlock()
+		cancel()
+	}()
+
+	item := map[string]any{"id": itemId, "type": "message", "role": "assistant", "status": "in_progress", "content": []any{}}
+	response := map[string]any{"id": responseId, "object": "realtime.response", "status": "in_progress", "output": []any{}}
+	events := []any{
+		map[string]any{"type": realtime.EventTypeResponseCreated, "response": response},
+		map[string]any{"type": realtime.EventTypeResponseOutputItemAdded, "response_id": responseId, "output_index": 0, "item": item},
+		map[string]any{"type": realtime.EventTypeResponseContentPartAdded, "response_id": responseId, "item_id": itemId, "output_index": 0, "content_index": 0, "part": map[string]any{"type": "output_audio"}},
+	}
+	for _, event := range events {
+		if err := c.Send(c.ctx, event); err != nil {
+			return err
+		}
+	}
+
+	status := "completed"
+	if err := c.SendAudio(ctx, duration); err != nil {
+		if !errors.Is(err, context.Canceled) || c.ctx.Err() != nil {
+			return err
+		}
+		status = "cancelled"
+	}
+	item["status"] = "completed"
+	if status == "cancelled" {
+		item["status"] = "incomplete"
+	}
+	response["status"], response["output"] = status, []any{item}
+	if err := c.Send(c.ctx, map[string]any{"type": realtime.EventTypeResponseOutputItemDone, "response_id": responseId, "output_index": 0, "item": item}); err != nil {
+		return err
+	}
+	return c.Send(c.ctx, map[string]any{"type": realtime.EventTypeResponseDone, "response": response})
+}
+
+// Hangup ends the call from the server side.
+func (c *Call) Hangup(ctx context.Context) error {
+	c.cancel()
+	return c.transport.Close(ctx)
+}
+
+func (c *Call) readEvents() {
+	defer c.wg.Done()
+	defer c.cancel()
+	for data := range c.transport.Events() {
+		event, err := realtime.ParseEvent(data)
+		if err != nil {
+			c.server.logger.NoCtxWarnf("dropping malformed client event: %v", err)
+			continue
+		}
+		c.mu.Lock()
+		c.received = append(c.received, event)
+		c.mu.Unlock()
+		if event.Type == realtime.EventTypeResponseCancel {
+			c.cancelResponses(event)
+		}
+		if c.scenario.OnEvent != nil {
+			c.scenario.OnEvent(c.ctx, c, event)
+		}
+	}
+}
+
+func (c *Call) cancelResponses(event realtime.Event) {
+	var cancel realtime.ResponseCancelEvent
+	if err := event.Decode(&cancel); err != nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for id, fn := range c.responses {
+		if cancel.ResponseId == "" || cancel.ResponseId == id {
+			fn()
+		}
+	}
+}
+
+func (c *Call) readAudio() {
+	defer c.wg.Done()
+	for frame := range c.transport.Audio() {
+		c.mu.Lock()
+		c.audio += realtime.AudioDuration(frame)
+		c.mu.Unlock()
+	}
+}
+
+// script announces the session and runs the steps of the scenario.
+func (c *Call) script() {
+	defer c.wg.Done()
+	session := map[string]any{}
+	if len(c.Session) > 0 {
+		_ = json.Unmarshal(c.Session, &session)
+	}
+	session["id"], session["object"] = "sess_"+c.Id, "realtime.session"
+	if err := c.Send(c.ctx, map[string]any{"type": realtime.EventTypeSessionCreated, "session": session}); err != nil {
+		c.fail(err, "failed to send session.created")
+		return
+	}
+	for _, step := range c.scenario.Steps {
+		select {
+		case <-time.After(step.Delay):
+		case <-c.ctx.Done():
+			return
+		}
+		if err := c.run(step); err != nil {
+			c.fail(err, "failed to run scenario step")
+			return
+		}
+	}
+}
+
+func (c *Call) run(step Step) error {
+	if step.Event != nil {
+		if err := c.Send(c.ctx, step.Event); err != nil {
+			return err
+		}
+	}
+	if step.Audio > 0 {
+		if err := c.SendAudio(c.ctx, step.Audio); err != nil {
+			return err
+		}
+	}
+	if step.Hangup {
+		return c.Hangup(context.WithoutCancel(c.ctx))
+	}
+	return nil
+}
+
+func (c *Call) fail(err error, msg string) {
+	if c.ctx.Err() == nil {
+		c.server.logger.NoCtxError(err, msg)
+	}
+}
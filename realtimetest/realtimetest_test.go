@@ -0,0 +1,294 @@
+package realtimetest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"mime/multipart"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+	"github.com/valyala/fasthttp"
+	"gitlab.bcc-hyperdev.org/bcc-hyperdev/realtime"
+	"gitlab.bcc-hyperdev.org/bcc-hyperdev/realtime/rtc"
+	"gitlab.bcc-hyperdev.org/bcc-hyperdev/realtime/shared"
+)
+
+type testSink struct {
+	mu     sync.Mutex
+	frames int
+}
+
+func (s *testSink) Write(ctx context.Context, frame []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.frames++
+	return nil
+}
+
+func (s *testSink) Flush(ctx context.Context) error { return nil }
+func (s *testSink) Close() error                    { return nil }
+
+func (s *testSink) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.frames
+}
+
+func newTestServer(t *testing.T, cfg *Config) *Server {
+	t.Helper()
+	server, err := NewServer(shared.NewLogger(), cfg)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	t.Cleanup(func() { _ = server.Close(context.Background()) })
+	return server
+}
+
+func dial(t *testing.T, server *Server, onState func(webrtc.PeerConnectionState)) (*rtc.Transport, error) {
+	t.Helper()
+	codec, _ := rtc.NewPCMUCodec()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	transport, err := rtc.Dial(ctx, shared.NewLogger(), &rtc.Config{Codec: codec, OnStateChange: onState}, server.Signaler())
+	if err == nil {
+		t.Cleanup(func() { _ = transport.Close(context.Background()) })
+	}
+	return transport, err
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for condition")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestServer(t *testing.T) {
+	t.Run("Session", func(t *testing.T) {
+		calls := make(chan *Call, 1)
+		server := newTestServer(t, &Config{ApiKey: "sk-test", OnCall: func(call *Call) { calls <- call }})
+		server.SetScenario(&Scenario{OnEvent: AudioResponse(200 * time.Millisecond)})
+		transport, err := dial(t, server, nil)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		call := <-calls
+
+		sink := &testSink{}
+		session, err := realtime.NewSession(shared.NewLogger(), transport, &realtime.SessionConfig{Sink: sink})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		defer func() { _ = session.Close(context.Background()) }()
+		var mu sync.Mutex
+		var types []string
+		session.OnEvent(func(ctx context.Context, event realtime.Event) {
+			mu.Lock()
+			defer mu.Unlock()
+			types = append(types, event.Type)
+		})
+		if err := session.Start(); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if err := session.Send(context.Background(), realtime.NewResponseCreateEvent()); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		waitFor(t, func() bool {
+			mu.Lock()
+			defer mu.Unlock()
+			return len(types) > 0 && types[len(types)-1] == realtime.EventTypeResponseDone
+		})
+		mu.Lock()
+		if types[0] != realtime.EventTypeSessionCreated || types[1] != realtime.EventTypeResponseCreated {
+			t.Errorf("Expected session.created then response.created, got %v", types)
+		}
+		mu.Unlock()
+		if got := sink.count(); got < 5 {
+			t.Errorf("Expected about 10 frames of audio, got %d", got)
+		}
+		if got := call.Received(); len(got) != 1 || got[0].Type != realtime.EventTypeResponseCreate {
+			t.Errorf("Expected the response.create, got %v", got)
+		}
+	})
+
+	t.Run("Cancel", func(t *testing.T) {
+		server := newTestServer(t, &Config{Scenario: &Scenario{OnEvent: AudioResponse(10 * time.Second)}})
+		transport, err := dial(t, server, nil)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		ctx := context.Background()
+		_ = transport.Send(ctx, []byte(`{"type":"response.create"}`))
+		for data := range transport.Events() {
+			event, _ := realtime.ParseEvent(data)
+			switch event.Type {
+			case realtime.EventTypeResponseCreated:
+				_ = transport.Send(ctx, []byte(`{"type":"response.cancel"}`))
+			case realtime.EventTypeResponseDone:
+				var done realtime.ResponseEvent
+				_ = event.Decode(&done)
+				if done.Response.Status != "cancelled" {
+					t.Errorf("Expected a cancelled response, got %s", done.Response.Status)
+				}
+				return
+			}
+		}
+		t.Fatal("Expected response.done")
+	})
+
+	t.Run("ScriptAndHangup", func(t *testing.T) {
+		server := newTestServer(t, &Config{Scenario: &Scenario{Steps: []Step{
+			{Event: map[string]any{"type": "input_audio_buffer.speech_started", "audio_start_ms": 0}},
+			{Delay: 20 * time.Millisecond, Audio: 100 * time.Millisecond, Hangup: true},
+		}}})
+		transport, err := dial(t, server, nil)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		var types []string
+		for data := range transport.Events() {
+			event, _ := realtime.ParseEvent(data)
+			if event.EventId == "" {
+				t.Errorf("Expected an event_id, got %s", data)
+			}
+			types = append(types, event.Type)
+		}
+		if len(types) != 2 || types[1] != realtime.EventTypeInputAudioBufferSpeechStarted {
+			t.Errorf("Expected session.created and speech_started, got %v", types)
+		}
+		waitFor(t, func() bool { return len(server.Calls()) == 0 })
+	})
+
+	t.Run("MultipartOffer", func(t *testing.T) {
+		calls := make(chan *Call, 1)
+		server := newTestServer(t, &Config{OnCall: func(call *Call) { calls <- call }})
+		codec, _ := rtc.NewPCMUCodec()
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		transport, err := rtc.Dial(ctx, shared.NewLogger(), &rtc.Config{Codec: codec}, func(ctx context.Context, offer string) (string, error) {
+			body := &bytes.Buffer{}
+			writer := multipart.NewWriter(body)
+			_ = writer.WriteField("sdp", offer)
+			_ = writer.WriteField("session", `{"type":"realtime","instructions":"Be brief."}`)
+			_ = writer.Close()
+			req := fasthttp.AcquireRequest()
+			resp := fasthttp.AcquireResponse()
+			defer fasthttp.ReleaseRequest(req)
+			defer fasthttp.ReleaseResponse(resp)
+			req.SetRequestURI(server.Url() + "/realtime/calls")
+			req.Header.SetMethod(fasthttp.MethodPost)
+			req.Header.SetContentType(writer.FormDataContentType())
+			req.SetBody(body.Bytes())
+			if err := fasthttp.Do(req, resp); err != nil {
+				return "", err
+			}
+			return string(resp.Body()), nil
+		})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		defer func() { _ = transport.Close(context.Background()) }()
+		call := <-calls
+		var created struct {
+			Session map[string]any `json:"session"`
+		}
+		_ = json.Unmarshal(<-transport.Events(), &created)
+		if created.Session["instructions"] != "Be brief." || created.Session["id"] != "sess_"+call.Id {
+			t.Errorf("Expected the posted session in session.created, got %v", created.Session)
+		}
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		server := newTestServer(t, &Config{Scenario: &Scenario{
+			Error: &APIError{Status: fasthttp.StatusTooManyRequests, Type: "rate_limit_error", Code: "rate_limit_exceeded", Message: "Slow down."},
+		}})
+		_, err := dial(t, server, nil)
+		if err == nil || !strings.Contains(err.Error(), "429") || !strings.Contains(err.Error(), "rate_limit_exceeded") {
+			t.Errorf("Expected a 429 error, got %v", err)
+		}
+	})
+
+	t.Run("ErrorParam", func(t *testing.T) {
+		server := newTestServer(t, &Config{Scenario: &Scenario{
+			Error: &APIError{Status: fasthttp.StatusBadRequest, Type: "invalid_request_error", Message: "Invalid voice.", Param: "session.audio.output.voice"},
+		}})
+		req := fasthttp.AcquireRequest()
+		resp := fasthttp.AcquireResponse()
+		defer fasthttp.ReleaseRequest(req)
+		defer fasthttp.ReleaseResponse(resp)
+		req.SetRequestURI(server.Url() + "/realtime/calls")
+		req.Header.SetMethod(fasthttp.MethodPost)
+		req.SetBodyString("v=0")
+		if err := fasthttp.Do(req, resp); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		var body errorBody
+		_ = json.Unmarshal(resp.Body(), &body)
+		if resp.StatusCode() != fasthttp.StatusBadRequest || body.Error.Param == nil || *body.Error.Param != "session.audio.output.voice" {
+			t.Errorf("Expected 400 with the param, got %d %s", resp.StatusCode(), resp.Body())
+		}
+	})
+
+	t.Run("Unauthorized", func(t *testing.T) {
+		server := newTestServer(t, &Config{ApiKey: "sk-test"})
+		req := fasthttp.AcquireRequest()
+		resp := fasthttp.AcquireResponse()
+		defer fasthttp.ReleaseRequest(req)
+		defer fasthttp.ReleaseResponse(resp)
+		req.SetRequestURI(server.Url() + "/realtime/calls")
+		req.Header.SetMethod(fasthttp.MethodPost)
+		req.Header.Set("Authorization", "Bearer sk-wrong")
+		req.SetBodyString("v=0")
+		if err := fasthttp.Do(req, resp); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		var body errorBody
+		_ = json.Unmarshal(resp.Body(), &body)
+		if resp.StatusCode() != fasthttp.StatusUnauthorized || body.Error.Code == nil || *body.Error.Code != "invalid_api_key" {
+			t.Errorf("Expected 401 invalid_api_key, got %d %s", resp.StatusCode(), resp.Body())
+		}
+	})
+
+	t.Run("Latency", func(t *testing.T) {
+		server := newTestServer(t, &Config{Scenario: &Scenario{Latency: 200 * time.Millisecond}})
+		start := time.Now()
+		if _, err := dial(t, server, nil); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+			t.Errorf("Expected the answer after 200ms, got %v", elapsed)
+		}
+	})
+
+	t.Run("DropICE", func(t *testing.T) {
+		server := newTestServer(t, &Config{Scenario: &Scenario{DropICE: true}})
+		connected := make(chan struct{}, 1)
+		transport, err := dial(t, server, func(state webrtc.PeerConnectionState) {
+			if state == webrtc.PeerConnectionStateConnected {
+				connected <- struct{}{}
+			}
+		})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if strings.Contains(transport.PeerConnection().RemoteDescription().SDP, "a=candidate:") {
+			t.Error("Expected an answer without candidates")
+		}
+		select {
+		case <-connected:
+			t.Error("Expected the connection never to be established")
+		case <-time.After(500 * time.Millisecond):
+		}
+		if got := len(server.Calls()); got != 0 {
+			t.Errorf("Expected no call, got %d", got)
+		}
+	})
+}
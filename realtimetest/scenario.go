@@ -0,0 +1,65 @@
+package realtimetest
+
+import (
+	"context"
+	"time"
+
+	"gitlab.bcc-hyperdev.org/bcc-hyperdev/realtime"
+)
+
+// EventHandler reacts to a client event of a call. It runs on the goroutine
+// reading the call's events, so long work such as streaming a response must
+// be started on a goroutine of its own.
+type EventHandler func(ctx context.Context, call *Call, event realtime.Event)
+
+// Step is an action of a scripted call. Its parts run in the order of the
+// fields.
+type Step struct {
+	// Delay waits before the step, from the end of the previous one.
+	Delay time.Duration
+	// Event is sent as a server event; []byte and json.RawMessage are sent
+	// as is, anything else is marshalled.
+	Event any
+	// Audio streams that much synthesized speech, in real time.
+	Audio time.Duration
+	// Hangup ends the call from the server side.
+	Hangup bool
+}
+
+// APIError is the error response of the calls endpoint.
+type APIError struct {
+	Status  int
+	Type    string
+	Code    string
+	Message string
+	// Param names the offending request parameter, e.g. session.voice.
+	Param string
+}
+
+// Scenario programs how the server answers calls.
+type Scenario struct {
+	// Latency delays the SDP answer.
+	Latency time.Duration
+	// Error rejects offers when set.
+	Error *APIError
+	// DropICE answers with an SDP stripped of candidates and never takes
+	// part in connectivity checks, so the client's ICE agent fails as if
+	// the media path were blocked.
+	DropICE bool
+	// Steps run in order once the data channel is open, after
+	// session.created.
+	Steps []Step
+	// OnEvent handles the client events of every call. Optional.
+	OnEvent EventHandler
+}
+
+// AudioResponse answers every response.create with a response made of an
+// assistant message with that much synthesized speech.
+func AudioResponse(audio time.Duration) EventHandler {
+	return func(ctx context.Context, call *Call, event realtime.Event) {
+		if event.Type != realtime.EventTypeResponseCreate {
+			return
+		}
+		go func() { _ = call.Respond(ctx, audio) }()
+	}
+}
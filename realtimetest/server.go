@@ -0,0 +1,345 @@
+package realtimetest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/valyala/fasthttp"
+	"gitlab.bcc-hyperdev.org/bcc-hyperdev/realtime/rtc"
+	"gitlab.bcc-hyperdev.org/bcc-hyperdev/realtime/shared"
+)
+
+const (
+	CallsPath           = "/v1/realtime/calls"
+	DefaultSetupTimeout = 10 * time.Second
+)
+
+var (
+	ErrServerClosed = errors.New("server closed")
+	ErrCallEnded    = errors.New("call ended")
+)
+
+type Config struct {
+	// Scenario programs the calls; it can be changed with SetScenario.
+	Scenario *Scenario
+	// NewCodec creates the codec of each call, PCMU by default.
+	NewCodec func() (rtc.Codec, error)
+	// ApiKey, when set, must be sent as the bearer token.
+	ApiKey string
+	// OnCall is called with every call once it is answered. Optional.
+	OnCall       func(call *Call)
+	SetupTimeout time.Duration
+}
+
+// Server is a fake of the OpenAI Realtime API on localhost. It answers
+// POST /v1/realtime/calls with a real SDP answer, terminates the WebRTC call
+// with pion, and plays the scenario on the oai-events data channel and the
+// audio track. Offers are taken as application/sdp or as the multipart form
+// of the API, whose session part is kept on the call.
+type Server struct {
+	logger *shared.Logger
+	cfg    *Config
+	ln     net.Listener
+	http   *fasthttp.Server
+
+	mu       sync.Mutex
+	scenario *Scenario
+	calls    map[string]*Call
+	closed   bool
+	closing  chan struct{}
+	wg       sync.WaitGroup
+}
+
+func NewServer(logger *shared.Logger, cfg *Config) (s *Server, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("failed to create fake realtime server: %w", err)
+		}
+	}()
+	if cfg == nil {
+		cfg = &Config{}
+	}
+	if cfg.NewCodec == nil {
+		cfg.NewCodec = func() (rtc.Codec, error) { return rtc.NewPCMUCodec() }
+	}
+	if cfg.SetupTimeout <= 0 {
+		cfg.SetupTimeout = DefaultSetupTimeout
+	}
+	scenario := cfg.Scenario
+	if scenario == nil {
+		scenario = &Scenario{}
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s = &Server{
+		logger:   logger,
+		cfg:      cfg,
+		ln:       ln,
+		scenario: scenario,
+		calls:    make(map[string]*Call),
+		closing:  make(chan struct{}),
+	}
+	s.http = &fasthttp.Server{Handler: s.Handle}
+	go func() { _ = s.http.Serve(ln) }()
+	return s, nil
+}
+
+// Url is the base URL of the API, to use in place of
+// https://api.openai.com/v1.
+func (s *Server) Url() string {
+	return "http://" + s.ln.Addr().String() + "/v1"
+}
+
+// SetScenario programs the calls answered from now on.
+func (s *Server) SetScenario(scenario *Scenario) {
+	if scenario == nil {
+		scenario = &Scenario{}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.scenario = scenario
+}
+
+// Signaler posts offers to the server, for rtc.Dial.
+func (s *Server) Signaler() rtc.Signaler {
+	return func(ctx context.Context, offer string) (string, error) {
+		req := fasthttp.AcquireRequest()
+		resp := fasthttp.AcquireResponse()
+		defer fasthttp.ReleaseRequest(req)
+		defer fasthttp.ReleaseResponse(resp)
+		req.SetRequestURI(s.Url() + strings.TrimPrefix(CallsPath, "/v1"))
+		req.Header.SetMethod(fasthttp.MethodPost)
+		req.Header.Set("Authorization", "Bearer "+s.cfg.ApiKey)
+		req.Header.SetContentType("application/sdp")
+		req.SetBodyString(offer)
+		if err := fasthttp.Do(req, resp); err != nil {
+			return "", err
+		}
+		if resp.StatusCode() != fasthttp.StatusCreated {
+			return "", fmt.Errorf("fake realtime server returned status %d: %s", resp.StatusCode(), resp.Body())
+		}
+		return string(resp.Body()), nil
+	}
+}
+
+func (s *Server) Handle(ctx *fasthttp.RequestCtx) {
+	path := strings.TrimSuffix(string(ctx.Path()), "/")
+	if s.cfg.ApiKey != "" && string(ctx.Request.Header.Peek("Authorization")) != "Bearer "+s.cfg.ApiKey {
+		writeError(ctx, &APIError{Status: fasthttp.StatusUnauthorized, Type: "invalid_request_error", Code: "invalid_api_key", Message: "Incorrect API key provided."})
+		return
+	}
+	switch {
+	case path == CallsPath && ctx.IsPost():
+		s.handleOffer(ctx)
+	case strings.HasPrefix(path, CallsPath+"/") && strings.HasSuffix(path, "/hangup") && ctx.IsPost():
+		s.handleHangup(ctx, strings.TrimSuffix(strings.TrimPrefix(path, CallsPath+"/"), "/hangup"))
+	default:
+		writeError(ctx, &APIError{Status: fasthttp.StatusNotFound, Type: "invalid_request_error", Message: "Not found."})
+	}
+}
+
+func (s *Server) handleOffer(ctx *fasthttp.RequestCtx) {
+	s.mu.Lock()
+	scenario := s.scenario
+	s.mu.Unlock()
+
+	if scenario.Latency > 0 {
+		select {
+		case <-time.After(scenario.Latency):
+		case <-s.closing:
+		}
+	}
+	if scenario.Error != nil {
+		writeError(ctx, scenario.Error)
+		return
+	}
+	offer, session, err := parseOffer(ctx)
+	if err != nil {
+		writeError(ctx, &APIError{Status: fasthttp.StatusBadRequest, Type: "invalid_request_error", Message: err.Error()})
+		return
+	}
+	setupCtx, cancel := context.WithTimeout(ctx, s.cfg.SetupTimeout)
+	defer cancel()
+	call, answer, err := s.accept(setupCtx, offer, session, scenario)
+	if err != nil {
+		s.logger.Error(ctx, err, "failed to answer call")
+		status := fasthttp.StatusInternalServerError
+		if errors.Is(err, ErrServerClosed) {
+			status = fasthttp.StatusServiceUnavailable
+		}
+		writeError(ctx, &APIError{Status: status, Type: "server_error", Message: err.Error()})
+		return
+	}
+	ctx.Response.Header.Set("Location", CallsPath+"/"+call.Id)
+	ctx.SetContentType("application/sdp")
+	ctx.SetStatusCode(fasthttp.StatusCreated)
+	ctx.SetBodyString(answer)
+}
+
+func parseOffer(ctx *fasthttp.RequestCtx) (offer string, session json.RawMessage, err error) {
+	if !strings.HasPrefix(string(ctx.Request.Header.ContentType()), "multipart/form-data") {
+		offer = string(ctx.PostBody())
+	} else {
+		form, err := ctx.MultipartForm()
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid multipart form: %w", err)
+		}
+		if values := form.Value["sdp"]; len(values) > 0 {
+			offer = values[0]
+		}
+		if values := form.Value["session"]; len(values) > 0 {
+			if !json.Valid([]byte(values[0])) {
+				return "", nil, fmt.Errorf("session is not valid JSON")
+			}
+			session = json.RawMessage(values[0])
+		}
+	}
+	if offer == "" {
+		return "", nil, fmt.Errorf("SDP offer is required")
+	}
+	return offer, session, nil
+}
+
+func (s *Server) accept(ctx context.Context, offer string, session json.RawMessage, scenario *Scenario) (call *Call, answer string, err error) {
+	codec, err := s.cfg.NewCodec()
+	if err != nil {
+		return nil, "", err
+	}
+	transport, answer, err := rtc.Accept(ctx, s.logger, &rtc.Config{Codec: codec}, offer)
+	if err != nil {
+		return nil, "", err
+	}
+	call = newCall(s, "rtc_"+strings.ReplaceAll(uuid.NewString(), "-", ""), session, transport, scenario)
+	if scenario.DropICE {
+		// Without candidates, and without an agent answering the client's
+		// checks, the media path can never be established.
+		_ = transport.Close(context.WithoutCancel(ctx))
+		return call, stripCandidates(answer), nil
+	}
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		_ = transport.Close(context.WithoutCancel(ctx))
+		return nil, "", ErrServerClosed
+	}
+	s.calls[call.Id] = call
+	s.wg.Add(1)
+	s.mu.Unlock()
+
+	call.start()
+	if s.cfg.OnCall != nil {
+		s.cfg.OnCall(call)
+	}
+	return call, answer, nil
+}
+
+func stripCandidates(sdp string) string {
+	lines := strings.SplitAfter(sdp, "\n")
+	kept := lines[:0]
+	for _, line := range lines {
+		if !strings.HasPrefix(line, "a=candidate:") && !strings.HasPrefix(line, "a=end-of-candidates") {
+			kept = append(kept, line)
+		}
+	}
+	return strings.Join(kept, "")
+}
+
+func (s *Server) handleHangup(ctx *fasthttp.RequestCtx, id string) {
+	call, ok := s.Call(id)
+	if !ok {
+		writeError(ctx, &APIError{Status: fasthttp.StatusNotFound, Type: "invalid_request_error", Message: "Call not found."})
+		return
+	}
+	if err := call.Hangup(ctx); err != nil {
+		s.logger.Error(ctx, err, "failed to hang up call")
+	}
+	ctx.SetStatusCode(fasthttp.StatusOK)
+}
+
+func (s *Server) Call(id string) (*Call, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	call, ok := s.calls[id]
+	return call, ok
+}
+
+func (s *Server) Calls() []*Call {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	calls := make([]*Call, 0, len(s.calls))
+	for _, call := range s.calls {
+		calls = append(calls, call)
+	}
+	return calls
+}
+
+func (s *Server) remove(call *Call) {
+	s.mu.Lock()
+	delete(s.calls, call.Id)
+	s.mu.Unlock()
+	s.wg.Done()
+}
+
+// Close hangs up the live calls and stops listening.
+func (s *Server) Close(ctx context.Context) error {
+	s.mu.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.closing)
+	}
+	s.mu.Unlock()
+	var errs []error
+	for _, call := range s.Calls() {
+		if err := call.Hangup(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	errs = append(errs, s.http.ShutdownWithContext(ctx))
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		errs = append(errs, ctx.Err())
+	}
+	return errors.Join(errs...)
+}
+
+type errorBody struct {
+	Error errorDetail `json:"error"`
+}
+
+type errorDetail struct {
+	Message string  `json:"message"`
+	Type    string  `json:"type"`
+	Code    *string `json:"code"`
+	Param   *string `json:"param"`
+}
+
+// writeError answers with the error body of the OpenAI API.
+func writeError(ctx *fasthttp.RequestCtx, e *APIError) {
+	detail := errorDetail{Message: e.Message, Type: e.Type}
+	if e.Code != "" {
+		detail.Code = &e.Code
+	}
+	if e.Param != "" {
+		detail.Param = &e.Param
+	}
+	body, _ := json.Marshal(errorBody{Error: detail})
+	ctx.SetContentType("application/json")
+	ctx.SetStatusCode(e.Status)
+	ctx.SetBody(body)
+}
@@ -0,0 +1,177 @@
+package recording
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4/pkg/media/oggwriter"
+	"gitlab.bcc-hyperdev.org/bcc-hyperdev/realtime"
+	"gitlab.bcc-hyperdev.org/bcc-hyperdev/realtime/audio"
+)
+
+const (
+	wavHeaderSize = 44
+	// opusFrameSize is 20ms at the session sample rate; Ogg granules count
+	// 48 kHz samples regardless of the input rate.
+	opusFrameSize    = realtime.SampleRate / 50
+	opusGranuleFrame = 48000 / 50
+)
+
+// OpusEncoder compresses 20ms frames of interleaved PCM16 at the session
+// sample rate into Opus packets. There is no pure Go Opus encoder, so one
+// must be supplied for FormatOggOpus.
+type OpusEncoder interface {
+	Encode(pcm []int16) ([]byte, error)
+}
+
+// audioFile is an audio track on storage. Samples are interleaved when the
+// file has two channels.
+type audioFile interface {
+	write(samples []int16) error
+	size() int64
+	close() error
+}
+
+// countingWriter buffers writes to storage and counts the bytes written.
+type countingWriter struct {
+	file io.WriteCloser
+	buf  *bufio.Writer
+	n    int64
+}
+
+func newCountingWriter(file io.WriteCloser) *countingWriter {
+	return &countingWriter{file: file, buf: bufio.NewWriter(file)}
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.buf.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+func (w *countingWriter) Close() error {
+	return errors.Join(w.buf.Flush(), w.file.Close())
+}
+
+type wavFile struct {
+	w        *countingWriter
+	channels int
+}
+
+func newWAVFile(file io.WriteCloser, channels int) (*wavFile, error) {
+	f := &wavFile{w: newCountingWriter(file), channels: channels}
+	// The sizes are placeholders until close, as for a streamed WAV.
+	if _, err := f.w.Write(wavHeader(channels, math.MaxUint32-wavHeaderSize)); err != nil {
+		return nil, fmt.Errorf("failed to write WAV header: %w", err)
+	}
+	return f, nil
+}
+
+func wavHeader(channels int, dataSize uint32) []byte {
+	h := make([]byte, wavHeaderSize)
+	blockAlign := channels * realtime.BytesPerSample
+	copy(h[0:], "RIFF")
+	binary.LittleEndian.PutUint32(h[4:], dataSize+wavHeaderSize-8)
+	copy(h[8:], "WAVEfmt ")
+	binary.LittleEndian.PutUint32(h[16:], 16)
+	binary.LittleEndian.PutUint16(h[20:], 1)
+	binary.LittleEndian.PutUint16(h[22:], uint16(channels))
+	binary.LittleEndian.PutUint32(h[24:], realtime.SampleRate)
+	binary.LittleEndian.PutUint32(h[28:], uint32(realtime.SampleRate*blockAlign))
+	binary.LittleEndian.PutUint16(h[32:], uint16(blockAlign))
+	binary.LittleEndian.PutUint16(h[34:], 8*realtime.BytesPerSample)
+	copy(h[36:], "data")
+	binary.LittleEndian.PutUint32(h[40:], dataSize)
+	return h
+}
+
+func (f *wavFile) write(samples []int16) error {
+	_, err := f.w.Write(audio.PCM(samples))
+	return err
+}
+
+func (f *wavFile) size() int64 {
+	return f.w.n
+}
+
+func (f *wavFile) close() error {
+	if err := f.w.buf.Flush(); err != nil {
+		return errors.Join(err, f.w.file.Close())
+	}
+	if seeker, ok := f.w.file.(io.WriteSeeker); ok {
+		dataSize := uint32(min(f.w.n-wavHeaderSize, math.MaxUint32-wavHeaderSize))
+		if _, err := seeker.Seek(0, io.SeekStart); err == nil {
+			if _, err := seeker.Write(wavHeader(f.channels, dataSize)); err != nil {
+				return errors.Join(err, f.w.file.Close())
+			}
+		}
+	}
+	return f.w.file.Close()
+}
+
+type oggFile struct {
+	w        *countingWriter
+	ogg      *oggwriter.OggWriter
+	encoder  OpusEncoder
+	channels int
+	pending  []int16
+	packet   rtp.Packet
+}
+
+func newOggFile(file io.WriteCloser, channels int, encoder OpusEncoder) (*oggFile, error) {
+	w := newCountingWriter(file)
+	ogg, err := oggwriter.NewWith(w, realtime.SampleRate, uint16(channels))
+	if err != nil {
+		return nil, fmt.Errorf("failed to write Ogg headers: %w", err)
+	}
+	return &oggFile{
+		w:        w,
+		ogg:      ogg,
+		encoder:  encoder,
+		channels: channels,
+		packet:   rtp.Packet{Header: rtp.Header{Version: 2, Timestamp: 1}},
+	}, nil
+}
+
+func (f *oggFile) write(samples []int16) error {
+	f.pending = append(f.pending, samples...)
+	frame := opusFrameSize * f.channels
+	for len(f.pending) >= frame {
+		if err := f.encode(f.pending[:frame]); err != nil {
+			return err
+		}
+		f.pending = f.pending[frame:]
+	}
+	return nil
+}
+
+func (f *oggFile) encode(samples []int16) error {
+	payload, err := f.encoder.Encode(samples)
+	if err != nil {
+		return fmt.Errorf("failed to encode Opus: %w", err)
+	}
+	f.packet.Payload = payload
+	f.packet.Timestamp += opusGranuleFrame
+	f.packet.SequenceNumber++
+	return f.ogg.WriteRTP(&f.packet)
+}
+
+func (f *oggFile) size() int64 {
+	return f.w.n
+}
+
+// close pads the last frame with silence; the Ogg writer closes the file.
+func (f *oggFile) close() error {
+	var err error
+	if len(f.pending) > 0 {
+		frame := make([]int16, opusFrameSize*f.channels)
+		copy(frame, f.pending)
+		err = f.encode(frame)
+	}
+	return errors.Join(err, f.ogg.Close())
+}
@@ -0,0 +1,364 @@
+package recording
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"gitlab.bcc-hyperdev.org/bcc-hyperdev/realtime"
+	"gitlab.bcc-hyperdev.org/bcc-hyperdev/realtime/audio"
+	"gitlab.bcc-hyperdev.org/bcc-hyperdev/realtime/shared"
+)
+
+type Format int
+
+const (
+	FormatWAV Format = iota
+	FormatOggOpus
+)
+
+type Layout int
+
+const (
+	// LayoutSeparate writes the user and the assistant to their own mono
+	// files.
+	LayoutSeparate Layout = iota
+	// LayoutStereo writes a single file with the user on the left and the
+	// assistant on the right.
+	LayoutStereo
+)
+
+// gapTolerance is the timing jitter, in samples, absorbed before silence is
+// inserted to keep the tracks aligned with the wall clock.
+const gapTolerance = realtime.SampleRate / 10
+
+type Config struct {
+	// Name prefixes the files of the recording. Defaults to the start time.
+	Name    string
+	Storage Storage
+	Format  Format
+	Layout  Layout
+	// NewOpusEncoder is required for FormatOggOpus.
+	NewOpusEncoder func(channels int) (OpusEncoder, error)
+	// MaxDuration and MaxBytes rotate to a new set of files once a segment
+	// holds that much audio, or one of its files grows that large. Zero
+	// disables the limit.
+	MaxDuration time.Duration
+	MaxBytes    int64
+}
+
+// track is the audio of one direction in the current segment.
+type track struct {
+	file    audioFile
+	pos     int
+	pending []int16
+}
+
+const (
+	DirectionClient = "client"
+	DirectionServer = "server"
+)
+
+// EventLine is a line of the JSONL event log. OffsetMs is the time since the
+// start of the segment, on the timeline of its audio files.
+type EventLine struct {
+	Time      time.Time       `json:"time"`
+	OffsetMs  int64           `json:"offset_ms"`
+	Direction string          `json:"direction"`
+	Event     json.RawMessage `json:"event"`
+}
+
+// Recorder taps a session and writes its audio and events to storage. Audio
+// files of a segment share a timeline that starts with the segment, and
+// every event line carries its offset on that timeline.
+type Recorder struct {
+	logger  *shared.Logger
+	cfg     Config
+	session *realtime.Session
+	remove  func()
+	// now is replaced in tests.
+	now func() time.Time
+
+	mu      sync.Mutex
+	segment int
+	start   time.Time
+	input   track
+	output  track
+	stereo  audioFile
+	events  *countingWriter
+	encoder *json.Encoder
+	opened  bool
+	closed  bool
+	err     error
+}
+
+var _ realtime.Tap = (*Recorder)(nil)
+
+// NewRecorder starts recording session. Close must be called to finalize the
+// files.
+func NewRecorder(logger *shared.Logger, session *realtime.Session, cfg *Config) (r *Recorder, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("failed to create recorder: %w", err)
+		}
+	}()
+	if cfg == nil || cfg.Storage == nil {
+		return nil, fmt.Errorf("storage is required")
+	}
+	if cfg.Format == FormatOggOpus && cfg.NewOpusEncoder == nil {
+		return nil, fmt.Errorf("an Opus encoder is required for Ogg")
+	}
+	r = &Recorder{logger: logger, cfg: *cfg, session: session, now: time.Now}
+	if r.cfg.Name == "" {
+		r.cfg.Name = time.Now().UTC().Format("20060102T150405Z")
+	}
+	if err := r.open(r.now()); err != nil {
+		return nil, err
+	}
+	if session != nil {
+		r.remove = session.AddTap(r)
+	}
+	return r, nil
+}
+
+func (r *Recorder) InputAudio(frame []byte) {
+	r.audio(&r.input, &r.output, frame)
+}
+
+func (r *Recorder) OutputAudio(frame []byte) {
+	r.audio(&r.output, &r.input, frame)
+}
+
+func (r *Recorder) ClientEvent(event []byte) {
+	r.event(DirectionClient, event)
+}
+
+func (r *Recorder) ServerEvent(event []byte) {
+	r.event(DirectionServer, event)
+}
+
+// Close stops recording and finalizes the files. It returns the first error
+// the recording ran into.
+func (r *Recorder) Close() error {
+	if r.remove != nil {
+		r.remove()
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return r.err
+	}
+	r.closed = true
+	if r.opened {
+		r.fail(r.closeSegment())
+	}
+	if r.err != nil {
+		return fmt.Errorf("failed to record: %w", r.err)
+	}
+	return nil
+}
+
+func (r *Recorder) audio(t, other *track, frame []byte) {
+	now := r.now()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed || r.err != nil {
+		return
+	}
+	samples := audio.Samples(frame)
+	// The frame ends now; pad the tracks to where it starts if they fell
+	// behind, as when nobody talks.
+	start := r.position(now) - len(samples)
+	t.pad(start, gapTolerance)
+	t.pending = append(t.pending, samples...)
+	t.pos += len(samples)
+	if r.stereo != nil {
+		other.pad(start, gapTolerance)
+	}
+	r.fail(r.flush())
+	r.fail(r.rotate(now))
+}
+
+func (r *Recorder) event(direction string, data []byte) {
+	now := r.now()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed || r.err != nil {
+		return
+	}
+	if !json.Valid(data) {
+		r.logger.NoCtxWarnf("not recording malformed %s event", direction)
+		return
+	}
+	r.fail(r.encoder.Encode(EventLine{
+		Time:      now,
+		OffsetMs:  now.Sub(r.start).Milliseconds(),
+		Direction: direction,
+		Event:     data,
+	}))
+	r.fail(r.rotate(now))
+}
+
+// position is the number of samples between the segment start and t.
+func (r *Recorder) position(t time.Time) int {
+	return int(t.Sub(r.start) * realtime.SampleRate / time.Second)
+}
+
+func (t *track) pad(to, tolerance int) {
+	if gap := to - t.pos; gap > tolerance {
+		t.pending = append(t.pending, make([]int16, gap)...)
+		t.pos = to
+	}
+}
+
+// flush writes the pending samples, interleaving the tracks in stereo.
+func (r *Recorder) flush() error {
+	if r.stereo == nil {
+		for _, t := range []*track{&r.input, &r.output} {
+			if len(t.pending) > 0 {
+				if err := t.file.write(t.pending); err != nil {
+					return err
+				}
+				t.pending = t.pending[:0]
+			}
+		}
+		return nil
+	}
+	n := min(len(r.input.pending), len(r.output.pending))
+	if n == 0 {
+		return nil
+	}
+	samples := make([]int16, 2*n)
+	for i := range n {
+		samples[2*i], samples[2*i+1] = r.input.pending[i], r.output.pending[i]
+	}
+	r.input.pending = r.input.pending[n:]
+	r.output.pending = r.output.pending[n:]
+	return r.stereo.write(samples)
+}
+
+func (r *Recorder) rotate(now time.Time) error {
+	full := false
+	if r.cfg.MaxDuration > 0 {
+		limit := int(r.cfg.MaxDuration * realtime.SampleRate / time.Second)
+		full = max(r.input.pos, r.output.pos) >= limit
+	}
+	if r.cfg.MaxBytes > 0 {
+		for _, f := range r.files() {
+			full = full || f.size() >= r.cfg.MaxBytes
+		}
+		full = full || r.events.n >= r.cfg.MaxBytes
+	}
+	if !full {
+		return nil
+	}
+	if err := r.closeSegment(); err != nil {
+		return err
+	}
+	r.segment++
+	return r.open(now)
+}
+
+func (r *Recorder) files() []audioFile {
+	if r.stereo != nil {
+		return []audioFile{r.stereo}
+	}
+	return []audioFile{r.input.file, r.output.file}
+}
+
+func (r *Recorder) open(now time.Time) (err error) {
+	r.start = now
+	r.input, r.output, r.stereo = track{}, track{}, nil
+	var created []io.Closer
+	defer func() {
+		if err != nil {
+			for _, c := range created {
+				_ = c.Close()
+			}
+		}
+	}()
+	file, err := r.cfg.Storage.Create(r.fileName("events", "jsonl"))
+	if err != nil {
+		return err
+	}
+	r.events = newCountingWriter(file)
+	r.encoder = json.NewEncoder(r.events)
+	r.encoder.SetEscapeHTML(false)
+	created = append(created, r.events)
+
+	if r.cfg.Layout == LayoutStereo {
+		if r.stereo, err = r.openAudio("stereo", 2); err != nil {
+			return err
+		}
+	} else {
+		if r.input.file, err = r.openAudio("input", 1); err != nil {
+			return err
+		}
+		created = append(created, closerFunc(r.input.file.close))
+		if r.output.file, err = r.openAudio("output", 1); err != nil {
+			return err
+		}
+	}
+	r.opened = true
+	return nil
+}
+
+func (r *Recorder) openAudio(kind string, channels int) (audioFile, error) {
+	ext := "wav"
+	if r.cfg.Format == FormatOggOpus {
+		ext = "ogg"
+	}
+	file, err := r.cfg.Storage.Create(r.fileName(kind, ext))
+	if err != nil {
+		return nil, err
+	}
+	var f audioFile
+	if r.cfg.Format == FormatWAV {
+		f, err = newWAVFile(file, channels)
+	} else {
+		var encoder OpusEncoder
+		if encoder, err = r.cfg.NewOpusEncoder(channels); err == nil {
+			f, err = newOggFile(file, channels, encoder)
+		}
+	}
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+func (r *Recorder) fileName(kind, ext string) string {
+	return fmt.Sprintf("%s-%03d-%s.%s", r.cfg.Name, r.segment, kind, ext)
+}
+
+// closeSegment lines the tracks up and closes the files.
+func (r *Recorder) closeSegment() error {
+	r.opened = false
+	end := max(r.input.pos, r.output.pos)
+	if r.stereo != nil {
+		r.input.pad(end, 0)
+		r.output.pad(end, 0)
+	}
+	errs := []error{r.flush()}
+	for _, f := range r.files() {
+		errs = append(errs, f.close())
+	}
+	errs = append(errs, r.events.Close())
+	return errors.Join(errs...)
+}
+
+// fail keeps the first error; recording stops after it.
+func (r *Recorder) fail(err error) {
+	if err != nil && r.err == nil {
+		r.err = err
+		r.logger.NoCtxError(err, "recording failed")
+	}
+}
+
+type closerFunc func() error
+
+func (f closerFunc) Close() error { return f() }
@@ -0,0 +1,263 @@
+package recording
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gitlab.bcc-hyperdev.org/bcc-hyperdev/realtime/audio"
+	"gitlab.bcc-hyperdev.org/bcc-hyperdev/realtime/shared"
+)
+
+type memFile struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (f *memFile) Close() error {
+	f.closed = true
+	return nil
+}
+
+type memStorage struct {
+	mu    sync.Mutex
+	files map[string]*memFile
+}
+
+func newMemStorage() *memStorage {
+	return &memStorage{files: map[string]*memFile{}}
+}
+
+func (s *memStorage) Create(name string) (io.WriteCloser, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f := &memFile{}
+	s.files[name] = f
+	return f, nil
+}
+
+func newTestRecorder(t *testing.T, cfg *Config) (*Recorder, func(time.Duration)) {
+	t.Helper()
+	start := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	r, err := NewRecorder(shared.NewLogger(), nil, cfg)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	// The first segment started at the real time; restart it on the clock.
+	r.start = start
+	offset := time.Duration(0)
+	r.now = func() time.Time { return start.Add(offset) }
+	return r, func(d time.Duration) { offset = d }
+}
+
+func frame(value int16, n int) []byte {
+	samples := make([]int16, n)
+	for i := range samples {
+		samples[i] = value
+	}
+	return audio.PCM(samples)
+}
+
+// wavData checks the WAV header and returns the samples.
+func wavData(t *testing.T, data []byte, channels int) []int16 {
+	t.Helper()
+	if len(data) < wavHeaderSize || string(data[0:4]) != "RIFF" || string(data[8:16]) != "WAVEfmt " {
+		t.Fatalf("Expected a WAV header, got %q", data[:min(len(data), wavHeaderSize)])
+	}
+	if got := int(binary.LittleEndian.Uint16(data[22:])); got != channels {
+		t.Errorf("Expected %d channels, got %d", channels, got)
+	}
+	return audio.Samples(data[wavHeaderSize:])
+}
+
+func TestRecorder(t *testing.T) {
+	t.Run("Validation", func(t *testing.T) {
+		if _, err := NewRecorder(shared.NewLogger(), nil, &Config{}); err == nil {
+			t.Error("Expected an error without storage")
+		}
+		if _, err := NewRecorder(shared.NewLogger(), nil, &Config{Storage: newMemStorage(), Format: FormatOggOpus}); err == nil {
+			t.Error("Expected an error for Ogg without an encoder")
+		}
+	})
+
+	t.Run("SeparateFilesOnDisk", func(t *testing.T) {
+		dir := t.TempDir()
+		storage, err := NewDiskStorage(dir)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		r, advance := newTestRecorder(t, &Config{Name: "call", Storage: storage})
+		advance(20 * time.Millisecond)
+		r.InputAudio(frame(1, 480))
+		// The assistant starts talking a second in; the silence before it
+		// is written out.
+		advance(time.Second)
+		r.OutputAudio(frame(2, 480))
+		if err := r.Close(); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		input, _ := os.ReadFile(filepath.Join(dir, "call-000-input.wav"))
+		if got := binary.LittleEndian.Uint32(input[40:]); got != 960 {
+			t.Errorf("Expected a patched data size of 960, got %d", got)
+		}
+		if got := wavData(t, input, 1); len(got) != 480 || got[0] != 1 {
+			t.Errorf("Expected 480 input samples, got %d", len(got))
+		}
+		output, _ := os.ReadFile(filepath.Join(dir, "call-000-output.wav"))
+		got := wavData(t, output, 1)
+		if len(got) != 24000 || got[0] != 0 || got[23519] != 0 || got[23520] != 2 {
+			t.Errorf("Expected 23520 samples of silence then the frame, got %d samples", len(got))
+		}
+	})
+
+	t.Run("StreamedHeader", func(t *testing.T) {
+		storage := newMemStorage()
+		r, _ := newTestRecorder(t, &Config{Name: "call", Storage: storage})
+		r.InputAudio(frame(1, 480))
+		_ = r.Close()
+		f := storage.files["call-000-input.wav"]
+		if !f.closed {
+			t.Error("Expected the file to be closed")
+		}
+		if got := binary.LittleEndian.Uint32(f.Bytes()[40:]); got != math.MaxUint32-wavHeaderSize {
+			t.Errorf("Expected the placeholder data size, got %d", got)
+		}
+	})
+
+	t.Run("Stereo", func(t *testing.T) {
+		storage := newMemStorage()
+		r, advance := newTestRecorder(t, &Config{Name: "call", Storage: storage, Layout: LayoutStereo})
+		advance(20 * time.Millisecond)
+		r.InputAudio(frame(1, 480))
+		advance(40 * time.Millisecond)
+		r.OutputAudio(frame(2, 480))
+		advance(time.Second)
+		r.OutputAudio(frame(3, 480))
+		if err := r.Close(); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		got := wavData(t, storage.files["call-000-stereo.wav"].Bytes(), 2)
+		if len(got) != 2*24000 {
+			t.Fatalf("Expected 24000 stereo samples, got %d", len(got)/2)
+		}
+		if got[0] != 1 || got[1] != 2 {
+			t.Errorf("Expected [1 2] first, got %v", got[:2])
+		}
+		if left, right := got[2*23520], got[2*23520+1]; left != 0 || right != 3 {
+			t.Errorf("Expected [0 3] after the gap, got [%d %d]", left, right)
+		}
+	})
+
+	t.Run("Events", func(t *testing.T) {
+		storage := newMemStorage()
+		r, advance := newTestRecorder(t, &Config{Name: "call", Storage: storage})
+		advance(250 * time.Millisecond)
+		r.ClientEvent([]byte(`{"type":"response.create"}`))
+		r.ServerEvent([]byte(`not json`))
+		advance(time.Second)
+		r.ServerEvent([]byte(`{"type":"response.done","text":"<b>"}`))
+		_ = r.Close()
+
+		var lines []EventLine
+		scanner := bufio.NewScanner(bytes.NewReader(storage.files["call-000-events.jsonl"].Bytes()))
+		for scanner.Scan() {
+			var line EventLine
+			if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if strings.Contains(scanner.Text(), `\u003c`) {
+				t.Errorf("Expected events to be written verbatim, got %s", scanner.Text())
+			}
+			lines = append(lines, line)
+		}
+		if len(lines) != 2 {
+			t.Fatalf("Expected 2 event lines, got %d", len(lines))
+		}
+		if lines[0].Direction != "client" || lines[0].OffsetMs != 250 {
+			t.Errorf("Expected client event at 250ms, got %s at %dms", lines[0].Direction, lines[0].OffsetMs)
+		}
+		if lines[1].Direction != "server" || lines[1].OffsetMs != 1000 {
+			t.Errorf("Expected server event at 1000ms, got %s at %dms", lines[1].Direction, lines[1].OffsetMs)
+		}
+	})
+
+	t.Run("Rotation", func(t *testing.T) {
+		storage := newMemStorage()
+		r, advance := newTestRecorder(t, &Config{Name: "call", Storage: storage, MaxDuration: time.Second})
+		for i := 1; i <= 60; i++ {
+			advance(time.Duration(i) * 20 * time.Millisecond)
+			r.InputAudio(frame(1, 480))
+		}
+		advance(1200 * time.Millisecond)
+		r.ClientEvent([]byte(`{"type":"response.create"}`))
+		if err := r.Close(); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		first := wavData(t, storage.files["call-000-input.wav"].Bytes(), 1)
+		if len(first) != 24000 {
+			t.Errorf("Expected 1s in the first segment, got %d samples", len(first))
+		}
+		second, ok := storage.files["call-001-input.wav"]
+		if !ok {
+			t.Fatal("Expected a second segment")
+		}
+		if got := wavData(t, second.Bytes(), 1); len(got) != 4800 {
+			t.Errorf("Expected 200ms in the second segment, got %d samples", len(got))
+		}
+		if !strings.Contains(storage.files["call-001-events.jsonl"].String(), `"offset_ms":200`) {
+			t.Errorf("Expected the event offset from the segment start, got %s", storage.files["call-001-events.jsonl"])
+		}
+	})
+
+	t.Run("OggOpus", func(t *testing.T) {
+		storage := newMemStorage()
+		encoder := &fakeEncoder{}
+		r, advance := newTestRecorder(t, &Config{
+			Name:           "call",
+			Storage:        storage,
+			Format:         FormatOggOpus,
+			NewOpusEncoder: func(channels int) (OpusEncoder, error) { return encoder, nil },
+		})
+		advance(50 * time.Millisecond)
+		r.InputAudio(frame(1, 1200))
+		if err := r.Close(); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		data := storage.files["call-000-input.ogg"].Bytes()
+		if !bytes.HasPrefix(data, []byte("OggS")) || !bytes.Contains(data, []byte("OpusHead")) {
+			t.Errorf("Expected an Ogg Opus stream, got %q", data[:min(len(data), 64)])
+		}
+		// 50ms is two full frames and a padded one, for each track.
+		if encoder.frames != 3 {
+			t.Errorf("Expected 3 encoded frames, got %d", encoder.frames)
+		}
+	})
+}
+
+type fakeEncoder struct {
+	mu     sync.Mutex
+	frames int
+}
+
+func (e *fakeEncoder) Encode(pcm []int16) ([]byte, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if len(pcm) != opusFrameSize {
+		return nil, nil
+	}
+	e.frames++
+	return []byte{0xf8, 0xff, 0xfe}, nil
+}
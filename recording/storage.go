@@ -0,0 +1,40 @@
+package recording
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Storage creates the files of a recording. WAV headers are finalized on
+// close when the returned writer also implements io.Seeker; otherwise they
+// keep the placeholder sizes of a streamed WAV.
+type Storage interface {
+	Create(name string) (io.WriteCloser, error)
+}
+
+// DiskStorage stores recordings in a local directory.
+type DiskStorage struct {
+	dir string
+}
+
+var _ Storage = (*DiskStorage)(nil)
+
+func NewDiskStorage(dir string) (d *DiskStorage, err error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create recording directory: %w", err)
+	}
+	return &DiskStorage{dir: dir}, nil
+}
+
+func (d *DiskStorage) Create(name string) (io.WriteCloser, error) {
+	if name != filepath.Base(name) {
+		return nil, fmt.Errorf("invalid recording file name %q", name)
+	}
+	f, err := os.Create(filepath.Join(d.dir, name))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create recording file: %w", err)
+	}
+	return f, nil
+}
@@ -0,0 +1,142 @@
+package replay
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"gitlab.bcc-hyperdev.org/bcc-hyperdev/realtime"
+	"gitlab.bcc-hyperdev.org/bcc-hyperdev/realtime/audio"
+	"gitlab.bcc-hyperdev.org/bcc-hyperdev/realtime/recording"
+)
+
+// maxEventLine bounds a line of the event log; session.updated events with
+// long instructions and tools exceed bufio's default.
+const maxEventLine = 4 << 20
+
+// Fixture is a recorded session segment, as written by recording.Recorder.
+type Fixture struct {
+	// Events are the lines of the event log in order. Only server events are
+	// replayed; client events are up to the application under test.
+	Events []recording.EventLine
+	// Output is the assistant audio, on the timeline of the events.
+	Output []int16
+}
+
+// LoadFixture reads a segment of a recording from dir. The assistant audio is
+// taken from the output WAV file or the right channel of the stereo one; Ogg
+// recordings cannot be decoded, so their audio is not replayed.
+func LoadFixture(dir, name string, segment int) (f *Fixture, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("failed to load fixture: %w", err)
+		}
+	}()
+	prefix := filepath.Join(dir, fmt.Sprintf("%s-%03d", name, segment))
+	events, err := os.Open(prefix + "-events.jsonl")
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = events.Close() }()
+
+	var output io.Reader
+	for _, kind := range []string{"output", "stereo"} {
+		file, err := os.Open(prefix + "-" + kind + ".wav")
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		defer func() { _ = file.Close() }()
+		output = file
+		break
+	}
+	return ReadFixture(events, output)
+}
+
+// ReadFixture parses an event log and an optional WAV file of the assistant
+// audio.
+func ReadFixture(events io.Reader, output io.Reader) (*Fixture, error) {
+	f := &Fixture{}
+	scanner := bufio.NewScanner(events)
+	scanner.Buffer(nil, maxEventLine)
+	for n := 1; scanner.Scan(); n++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var line recording.EventLine
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			return nil, fmt.Errorf("invalid event log line %d: %w", n, err)
+		}
+		f.Events = append(f.Events, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read event log: %w", err)
+	}
+	if output != nil {
+		samples, err := readWAV(output)
+		if err != nil {
+			return nil, err
+		}
+		f.Output = samples
+	}
+	return f, nil
+}
+
+// readWAV returns the assistant track of a PCM16 WAV file at the session
+// sample rate: the file itself when mono, the right channel when stereo.
+// Streamed files keep placeholder sizes, so the data runs to the end of file.
+func readWAV(r io.Reader) ([]int16, error) {
+	var riff [12]byte
+	if _, err := io.ReadFull(r, riff[:]); err != nil || string(riff[0:4]) != "RIFF" || string(riff[8:12]) != "WAVE" {
+		return nil, fmt.Errorf("not a WAV file")
+	}
+	channels := 0
+	for {
+		var header [8]byte
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			return nil, fmt.Errorf("WAV file has no data")
+		}
+		id, size := string(header[0:4]), binary.LittleEndian.Uint32(header[4:])
+		switch id {
+		case "fmt ":
+			format := make([]byte, size)
+			if _, err := io.ReadFull(r, format); err != nil || size < 16 {
+				return nil, fmt.Errorf("invalid WAV format")
+			}
+			channels = int(binary.LittleEndian.Uint16(format[2:]))
+			rate := binary.LittleEndian.Uint32(format[4:])
+			bits := binary.LittleEndian.Uint16(format[14:])
+			if binary.LittleEndian.Uint16(format[0:]) != 1 || bits != 16 || rate != realtime.SampleRate || channels < 1 || channels > 2 {
+				return nil, fmt.Errorf("unsupported WAV format: %d channels of %d bit at %d Hz", channels, bits, rate)
+			}
+		case "data":
+			if channels == 0 {
+				return nil, fmt.Errorf("WAV data before format")
+			}
+			data, err := io.ReadAll(io.LimitReader(r, int64(size)))
+			if err != nil {
+				return nil, fmt.Errorf("failed to read WAV data: %w", err)
+			}
+			samples := audio.Samples(data)
+			if channels == 1 {
+				return samples, nil
+			}
+			right := make([]int16, len(samples)/2)
+			for i := range right {
+				right[i] = samples[2*i+1]
+			}
+			return right, nil
+		default:
+			if _, err := io.CopyN(io.Discard, r, int64(size+size%2)); err != nil {
+				return nil, fmt.Errorf("WAV file has no data")
+			}
+		}
+	}
+}
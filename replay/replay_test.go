@@ -0,0 +1,257 @@
+package replay
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gitlab.bcc-hyperdev.org/bcc-hyperdev/realtime"
+	"gitlab.bcc-hyperdev.org/bcc-hyperdev/realtime/audio"
+	"gitlab.bcc-hyperdev.org/bcc-hyperdev/realtime/recording"
+	"gitlab.bcc-hyperdev.org/bcc-hyperdev/realtime/shared"
+)
+
+type testSink struct {
+	mu     sync.Mutex
+	frames [][]byte
+}
+
+func (s *testSink) Write(ctx context.Context, frame []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.frames = append(s.frames, frame)
+	return nil
+}
+
+func (s *testSink) Flush(ctx context.Context) error { return nil }
+func (s *testSink) Close() error                    { return nil }
+
+func (s *testSink) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.frames)
+}
+
+func eventLog(lines ...string) string {
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// speech is a frame of assistant audio.
+func speech(value int16) []byte {
+	samples := make([]int16, frameSamples)
+	for i := range samples {
+		samples[i] = value
+	}
+	return audio.PCM(samples)
+}
+
+func TestReadFixture(t *testing.T) {
+	t.Run("Events", func(t *testing.T) {
+		f, err := ReadFixture(strings.NewReader(eventLog(
+			`{"time":"2026-01-02T03:04:05Z","offset_ms":0,"direction":"server","event":{"type":"session.created"}}`,
+			``,
+			`{"time":"2026-01-02T03:04:06Z","offset_ms":1000,"direction":"client","event":{"type":"response.create"}}`,
+		)), nil)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(f.Events) != 2 || f.Events[1].OffsetMs != 1000 || f.Events[1].Direction != recording.DirectionClient {
+			t.Errorf("Expected 2 events, got %+v", f.Events)
+		}
+	})
+
+	t.Run("InvalidLine", func(t *testing.T) {
+		if _, err := ReadFixture(strings.NewReader("{}\nnot json\n"), nil); err == nil || !strings.Contains(err.Error(), "line 2") {
+			t.Errorf("Expected an error on line 2, got %v", err)
+		}
+	})
+
+	t.Run("NotWAV", func(t *testing.T) {
+		if _, err := ReadFixture(strings.NewReader(""), bytes.NewReader([]byte("OggS"))); err == nil {
+			t.Error("Expected an error for a non-WAV file")
+		}
+	})
+}
+
+func TestLoadFixture(t *testing.T) {
+	dir := t.TempDir()
+	storage, err := recording.NewDiskStorage(dir)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	r, err := recording.NewRecorder(shared.NewLogger(), nil, &recording.Config{Name: "call", Storage: storage, Layout: recording.LayoutStereo})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	r.ServerEvent([]byte(`{"type":"session.created"}`))
+	r.InputAudio(speech(1))
+	r.OutputAudio(speech(2))
+	if err := r.Close(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	f, err := LoadFixture(dir, "call", 0)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(f.Events) != 1 || string(f.Events[0].Event) != `{"type":"session.created"}` {
+		t.Errorf("Expected the session.created event, got %+v", f.Events)
+	}
+	if len(f.Output) != frameSamples || f.Output[0] != 2 {
+		t.Errorf("Expected the right channel, got %d samples", len(f.Output))
+	}
+	if _, err := LoadFixture(dir, "call", 1); err == nil {
+		t.Error("Expected an error for a missing segment")
+	}
+}
+
+func TestTransport(t *testing.T) {
+	fixture := func(t *testing.T) *Fixture {
+		t.Helper()
+		output := make([]int16, 10*frameSamples)
+		copy(output[5*frameSamples:], audio.Samples(speech(3)))
+		copy(output[6*frameSamples:], audio.Samples(speech(4)))
+		f, err := ReadFixture(strings.NewReader(eventLog(
+			`{"offset_ms":0,"direction":"server","event":{"type":"session.created"}}`,
+			`{"offset_ms":40,"direction":"client","event":{"type":"response.create"}}`,
+			`{"offset_ms":100,"direction":"server","event":{"type":"response.created","response":{"id":"resp_1"}}}`,
+			`{"offset_ms":250,"direction":"server","event":{"type":"response.done","response":{"id":"resp_1"}}}`,
+		)), nil)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		f.Output = output
+		return f
+	}
+
+	t.Run("DrivesSession", func(t *testing.T) {
+		transport, err := NewTransport(shared.NewLogger(), &Config{Fixture: fixture(t), Speed: -1})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		sink := &testSink{}
+		session, err := realtime.NewSession(shared.NewLogger(), transport, &realtime.SessionConfig{Sink: sink})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		var mu sync.Mutex
+		var types []string
+		session.OnEvent(func(ctx context.Context, event realtime.Event) {
+			mu.Lock()
+			defer mu.Unlock()
+			types = append(types, event.Type)
+		})
+		if err := session.Start(); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if err := session.Send(context.Background(), realtime.NewResponseCreateEvent()); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		select {
+		case <-session.Done():
+		case <-time.After(time.Second):
+			t.Fatal("Expected the session to end with the replay")
+		}
+		_ = session.Close(context.Background())
+
+		mu.Lock()
+		defer mu.Unlock()
+		if len(types) != 3 || types[0] != "session.created" || types[2] != "response.done" {
+			t.Errorf("Expected the 3 server events, got %v", types)
+		}
+		// Playback may still be draining when the events are done.
+		deadline := time.Now().Add(time.Second)
+		for sink.count() < 2 && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+		if got := sink.count(); got != 2 {
+			t.Errorf("Expected the 2 frames of speech without the silence, got %d", got)
+		}
+		sent := transport.Sent()
+		var create realtime.ResponseCreateEvent
+		if len(sent) != 1 || json.Unmarshal(sent[0], &create) != nil || create.Type != realtime.EventTypeResponseCreate {
+			t.Errorf("Expected the response.create sent by the application, got %q", sent)
+		}
+	})
+
+	t.Run("Timing", func(t *testing.T) {
+		start := time.Now()
+		transport, err := NewTransport(shared.NewLogger(), &Config{Fixture: fixture(t), Speed: 5})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		defer func() { _ = transport.Close(context.Background()) }()
+		var offsets []time.Duration
+		for range transport.Events() {
+			offsets = append(offsets, time.Since(start))
+		}
+		if len(offsets) != 3 {
+			t.Fatalf("Expected 3 events, got %d", len(offsets))
+		}
+		// 100ms and 250ms at five times the speed.
+		if offsets[1] < 20*time.Millisecond || offsets[2] < 50*time.Millisecond {
+			t.Errorf("Expected events at 20ms and 50ms, got %v", offsets)
+		}
+		if offsets[2] > 500*time.Millisecond {
+			t.Errorf("Expected the replay to be accelerated, got %v", offsets)
+		}
+	})
+
+	t.Run("Close", func(t *testing.T) {
+		transport, err := NewTransport(shared.NewLogger(), &Config{Fixture: fixture(t)})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		<-transport.Events()
+		if err := transport.Close(context.Background()); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if _, ok := <-transport.Events(); ok {
+			t.Error("Expected the events to be closed")
+		}
+		if err := transport.Send(context.Background(), []byte(`{}`)); err != ErrTransportClosed {
+			t.Errorf("Expected ErrTransportClosed, got %v", err)
+		}
+	})
+
+	t.Run("PausesWithinResponses", func(t *testing.T) {
+		output := make([]int16, 20*frameSamples)
+		for _, n := range []int{5, 7, 15} {
+			copy(output[n*frameSamples:], audio.Samples(speech(1)))
+		}
+		f, err := ReadFixture(strings.NewReader(eventLog(
+			`{"offset_ms":100,"direction":"server","event":{"type":"response.created","response":{"id":"resp_1"}}}`,
+			`{"offset_ms":200,"direction":"server","event":{"type":"response.done","response":{"id":"resp_1"}}}`,
+			`{"offset_ms":280,"direction":"server","event":{"type":"response.created","response":{"id":"resp_2"}}}`,
+		)), nil)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		f.Output = output
+		items := audioSchedule(f)
+		var offsets []time.Duration
+		for _, item := range items {
+			offsets = append(offsets, item.offset)
+		}
+		// The pause between the frames of resp_1 is kept, the gap before
+		// resp_2 is not.
+		want := []time.Duration{100 * time.Millisecond, 120 * time.Millisecond, 140 * time.Millisecond, 300 * time.Millisecond}
+		if !slices.Equal(offsets, want) {
+			t.Errorf("Expected frames at %v, got %v", want, offsets)
+		}
+		if silence := items[1].data; !bytes.Equal(silence, make([]byte, len(silence))) {
+			t.Errorf("Expected the pause to be silence, got %v", silence)
+		}
+	})
+
+	t.Run("FixtureRequired", func(t *testing.T) {
+		if _, err := NewTransport(shared.NewLogger(), &Config{}); err == nil {
+			t.Error("Expected an error without a fixture")
+		}
+	})
+}
@@ -0,0 +1,232 @@
+package replay
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"gitlab.bcc-hyperdev.org/bcc-hyperdev/realtime"
+	"gitlab.bcc-hyperdev.org/bcc-hyperdev/realtime/audio"
+	"gitlab.bcc-hyperdev.org/bcc-hyperdev/realtime/recording"
+	"gitlab.bcc-hyperdev.org/bcc-hyperdev/realtime/shared"
+)
+
+// frameSamples is 20ms of audio, the frame size of the WebRTC transport.
+const frameSamples = realtime.SampleRate / 50
+
+var ErrTransportClosed = errors.New("transport closed")
+
+type Config struct {
+	Fixture *Fixture
+	// Speed scales the recorded timing: 2 replays twice as fast. Zero replays
+	// in real time and a negative speed replays without waiting.
+	Speed float64
+}
+
+// Transport is a realtime.Transport that plays a recorded session back in
+// place of a provider, so that a realtime.Session on top of it behaves as it
+// did when recorded. Server events and assistant audio are delivered at their
+// recorded offsets from the creation of the transport; events and audio are
+// scheduled independently, as over a real connection. Both channels close
+// after their last item, which ends the session like a hangup.
+//
+// Client events are not checked against the recording; they are kept for
+// assertions and the input audio is discarded.
+type Transport struct {
+	logger *shared.Logger
+	speed  float64
+
+	events chan []byte
+	audio  chan []byte
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu     sync.Mutex
+	sent   [][]byte
+	input  time.Duration
+	closed bool
+}
+
+var _ realtime.Transport = (*Transport)(nil)
+
+// scheduled is an item of the replay due at offset on the recorded timeline.
+type scheduled struct {
+	offset time.Duration
+	data   []byte
+}
+
+func NewTransport(logger *shared.Logger, cfg *Config) (t *Transport, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("failed to create replay transport: %w", err)
+		}
+	}()
+	if cfg == nil || cfg.Fixture == nil {
+		return nil, fmt.Errorf("fixture is required")
+	}
+	speed := cfg.Speed
+	if speed == 0 {
+		speed = 1
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t = &Transport{
+		logger: logger,
+		speed:  speed,
+		events: make(chan []byte),
+		audio:  make(chan []byte),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	start := time.Now()
+	t.wg.Add(2)
+	go t.play(start, t.events, eventSchedule(cfg.Fixture))
+	go t.play(start, t.audio, audioSchedule(cfg.Fixture))
+	return t, nil
+}
+
+func eventSchedule(f *Fixture) []scheduled {
+	var items []scheduled
+	for _, line := range f.Events {
+		if line.Direction == recording.DirectionServer {
+			items = append(items, scheduled{
+				offset: time.Duration(line.OffsetMs) * time.Millisecond,
+				data:   line.Event,
+			})
+		}
+	}
+	// Lines are written as events arrive, but keep the replay monotonic if
+	// a log was edited by hand.
+	slices.SortStableFunc(items, func(a, b scheduled) int {
+		return cmp.Compare(a.offset, b.offset)
+	})
+	return items
+}
+
+// audioSchedule cuts the output track into frames. The recorder fills the
+// track with silence while the assistant is quiet, so the silence around the
+// speech of each response is skipped while pauses within it are kept.
+// Responses are told apart by their response.created events.
+func audioSchedule(f *Fixture) []scheduled {
+	frames := (len(f.Output) + frameSamples - 1) / frameSamples
+	bounds := []int{0, frames}
+	for _, line := range f.Events {
+		if line.Direction != recording.DirectionServer {
+			continue
+		}
+		if event, err := realtime.ParseEvent(line.Event); err == nil && event.Type == realtime.EventTypeResponseCreated {
+			bounds = append(bounds, min(int(line.OffsetMs*realtime.SampleRate/1000)/frameSamples, frames))
+		}
+	}
+	slices.Sort(bounds)
+	frame := func(n int) []int16 {
+		return f.Output[n*frameSamples : min((n+1)*frameSamples, len(f.Output))]
+	}
+	silent := func(n int) bool {
+		return !slices.ContainsFunc(frame(n), func(s int16) bool { return s != 0 })
+	}
+	var items []scheduled
+	for i := 1; i < len(bounds); i++ {
+		first, last := bounds[i-1], bounds[i]
+		for first < last && silent(first) {
+			first++
+		}
+		for last > first && silent(last-1) {
+			last--
+		}
+		for n := first; n < last; n++ {
+			items = append(items, scheduled{
+				offset: time.Duration(n*frameSamples) * time.Second / realtime.SampleRate,
+				data:   audio.PCM(frame(n)),
+			})
+		}
+	}
+	return items
+}
+
+func (t *Transport) play(start time.Time, ch chan<- []byte, items []scheduled) {
+	defer t.wg.Done()
+	defer close(ch)
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for _, item := range items {
+		if t.speed > 0 {
+			timer.Reset(time.Until(start.Add(time.Duration(float64(item.offset) / t.speed))))
+			select {
+			case <-timer.C:
+			case <-t.ctx.Done():
+				return
+			}
+		}
+		select {
+		case ch <- item.data:
+		case <-t.ctx.Done():
+			return
+		}
+	}
+}
+
+func (t *Transport) Send(ctx context.Context, event []byte) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return ErrTransportClosed
+	}
+	t.sent = append(t.sent, slices.Clone(event))
+	return nil
+}
+
+func (t *Transport) Events() <-chan []byte {
+	return t.events
+}
+
+func (t *Transport) WriteAudio(ctx context.Context, frame []byte) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return ErrTransportClosed
+	}
+	t.input += realtime.AudioDuration(frame)
+	return nil
+}
+
+func (t *Transport) Audio() <-chan []byte {
+	return t.audio
+}
+
+// Sent returns the client events sent so far.
+func (t *Transport) Sent() [][]byte {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return slices.Clone(t.sent)
+}
+
+// InputDuration returns how much audio the session has sent.
+func (t *Transport) InputDuration() time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.input
+}
+
+// Close stops the replay. The channels are closed once it returns.
+func (t *Transport) Close(ctx context.Context) error {
+	t.mu.Lock()
+	t.closed = true
+	t.mu.Unlock()
+	t.cancel()
+	done := make(chan struct{})
+	go func() {
+		t.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
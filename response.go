@@ -0,0 +1,225 @@
+package realtime
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+	"gitlab.bcc-hyperdev.org/bcc-hyperdev/realtime/shared"
+)
+
+const (
+	ConversationAuto = "auto"
+	ConversationNone = "none"
+
+	ResponseStatusCompleted = "completed"
+
+	// outOfBandKey is the response metadata identifying an out-of-band
+	// response.
+	outOfBandKey = "out_of_band_id"
+)
+
+// IsOutOfBand reports whether response was created by
+// CreateOutOfBandResponse.
+func IsOutOfBand(response Response) bool {
+	return response.Metadata[outOfBandKey] != ""
+}
+
+// outOfBandResponses follows the out-of-band responses in flight, whose
+// output the trackers of a session leave out.
+type outOfBandResponses struct {
+	mu  sync.Mutex
+	ids shared.Set[string]
+}
+
+func newOutOfBandResponses() *outOfBandResponses {
+	return &outOfBandResponses{ids: shared.NewSet[string]()}
+}
+
+// track applies a response.created or response.done event.
+func (o *outOfBandResponses) track(event Event) error {
+	var payload ResponseEvent
+	if err := event.Decode(&payload); err != nil {
+		return err
+	}
+	if !IsOutOfBand(payload.Response) {
+		return nil
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if event.Type == EventTypeResponseCreated {
+		o.ids.Add(payload.Response.Id)
+	} else {
+		o.ids.Remove(payload.Response.Id)
+	}
+	return nil
+}
+
+func (o *outOfBandResponses) contains(responseId string) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.ids.Contains(responseId)
+}
+
+// ResponseError is a response that ended with a status other than
+// completed, e.g. cancelled or failed.
+type ResponseError struct {
+	Response Response
+}
+
+func (e *ResponseError) Error() string {
+	msg := fmt.Sprintf("response %s ended %s", e.Response.Id, e.Response.Status)
+	if d := e.Response.StatusDetails; d != nil {
+		if d.Reason != "" {
+			msg += " (" + d.Reason + ")"
+		}
+		if d.Error != nil && d.Error.Message != "" {
+			msg += ": " + d.Error.Message
+		}
+	}
+	return msg
+}
+
+// OutOfBandResponse is the future result of CreateOutOfBandResponse.
+type OutOfBandResponse struct {
+	session  *Session
+	remove   func()
+	done     chan struct{}
+	response Response
+	err      error
+}
+
+// CreateOutOfBandResponse asks for a text response that is kept out of the
+// conversation, e.g. to classify or summarize it while the dialogue goes on.
+// instructions replace the session's for this response. input replaces the
+// conversation as its context, and may refer to conversation items with
+// ItemTypeItemReference; nil keeps the conversation. The response is told
+// apart from others by its metadata, so it does not disturb responses in
+// flight.
+func (s *Session) CreateOutOfBandResponse(ctx context.Context, instructions string, input []Item) (*OutOfBandResponse, error) {
+	id := strings.ReplaceAll(uuid.NewString(), "-", "")
+	eventId := "event_" + id
+	r := &OutOfBandResponse{session: s, done: make(chan struct{})}
+	r.remove = s.OnEvent(func(_ context.Context, event Event) {
+		switch event.Type {
+		case EventTypeResponseDone:
+			var payload ResponseEvent
+			if event.Decode(&payload) != nil || payload.Response.Metadata[outOfBandKey] != id {
+				return
+			}
+			var err error
+			if payload.Response.Status != ResponseStatusCompleted {
+				err = &ResponseError{Response: payload.Response}
+			}
+			r.finish(payload.Response, err)
+		case EventTypeError:
+			var payload ErrorEvent
+			if event.Decode(&payload) != nil || payload.Error.EventId != eventId {
+				return
+			}
+			r.finish(Response{}, &ServerError{payload.Error})
+		}
+	})
+	err := s.Send(ctx, ResponseCreateEvent{
+		Type:    EventTypeResponseCreate,
+		EventId: eventId,
+		Response: &ResponseParams{
+			Conversation:     ConversationNone,
+			Instructions:     instructions,
+			Input:            input,
+			OutputModalities: []string{"text"},
+			Metadata:         map[string]string{outOfBandKey: id},
+		},
+	})
+	if err != nil {
+		r.remove()
+		return nil, fmt.Errorf("failed to create out-of-band response: %w", err)
+	}
+	return r, nil
+}
+
+// finish runs on the event loop, which delivers a single response.done for
+// the response.
+func (r *OutOfBandResponse) finish(response Response, err error) {
+	r.remove()
+	r.response, r.err = response, err
+	close(r.done)
+}
+
+// Done is closed once the response finished.
+func (r *OutOfBandResponse) Done() <-chan struct{} {
+	return r.done
+}
+
+// Response waits for the response and returns it as the server reported it.
+func (r *OutOfBandResponse) Response(ctx context.Context) (Response, error) {
+	select {
+	case <-r.done:
+		return r.response, r.err
+	case <-r.session.Done():
+		// The response may have finished with the last events.
+		select {
+		case <-r.done:
+			return r.response, r.err
+		default:
+		}
+		return Response{}, ErrSessionClosed
+	case <-ctx.Done():
+		return Response{}, ctx.Err()
+	}
+}
+
+// Text waits for the response and returns its text.
+func (r *OutOfBandResponse) Text(ctx context.Context) (string, error) {
+	response, err := r.Response(ctx)
+	if err != nil {
+		return "", err
+	}
+	return ResponseText(response), nil
+}
+
+// Decode waits for the response and unmarshals its text as JSON into v, for
+// instructions asking for JSON. A Markdown code fence around the JSON is
+// ignored.
+func (r *OutOfBandResponse) Decode(ctx context.Context, v any) error {
+	text, err := r.Text(ctx)
+	if err != nil {
+		return err
+	}
+	text = strings.TrimSpace(text)
+	if fenced, ok := strings.CutPrefix(text, "```"); ok {
+		fenced = strings.TrimSuffix(fenced, "```")
+		// Skip the language tag, if any.
+		if i := strings.IndexByte(fenced, '\n'); i >= 0 && !strings.ContainsAny(fenced[:i], "{[") {
+			fenced = fenced[i+1:]
+		}
+		text = fenced
+	}
+	if err := json.Unmarshal([]byte(text), v); err != nil {
+		return fmt.Errorf("failed to decode response text: %w", err)
+	}
+	return nil
+}
+
+// ResponseText returns the text of the messages a response produced, or their
+// transcript for audio.
+func ResponseText(response Response) string {
+	var b strings.Builder
+	for _, item := range response.Output {
+		if item.Type != ItemTypeMessage {
+			continue
+		}
+		for _, part := range item.Content {
+			switch part.Type {
+			case ContentTypeOutputText:
+				b.WriteString(part.Text)
+			case ContentTypeOutputAudio:
+				b.WriteString(part.Transcript)
+			}
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,163 @@
+package realtime
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+
+	"gitlab.bcc-hyperdev.org/bcc-hyperdev/realtime/shared"
+)
+
+// sentResponseCreate returns the last response.create sent.
+func sentResponseCreate(t *testing.T, transport *fakeTransport) ResponseCreateEvent {
+	t.Helper()
+	transport.mu.Lock()
+	defer transport.mu.Unlock()
+	var create ResponseCreateEvent
+	if len(transport.sent) == 0 {
+		t.Fatal("Expected a response.create, got nothing")
+	}
+	if err := json.Unmarshal(transport.sent[len(transport.sent)-1], &create); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	return create
+}
+
+func TestSessionOutOfBandResponse(t *testing.T) {
+	input := []Item{{Type: ItemTypeItemReference, Id: "item_1"}}
+
+	t.Run("Result", func(t *testing.T) {
+		session, transport, _, _ := newTestSession(t)
+		defer func() { _ = session.Close(context.Background()) }()
+		conversation := NewConversation(shared.NewLogger(), session)
+		defer conversation.Close()
+		transcript := NewTranscript(shared.NewLogger(), session)
+		defer transcript.Close()
+		stream := NewTextStream(shared.NewLogger(), session)
+		defer stream.Close()
+		var mu sync.Mutex
+		var texts []string
+		stream.OnText(func(output TextOutput) {
+			mu.Lock()
+			defer mu.Unlock()
+			texts = append(texts, output.ResponseId)
+		})
+		if err := session.Start(); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		future, err := session.CreateOutOfBandResponse(context.Background(), "Tag the intent as JSON.", input)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		create := sentResponseCreate(t, transport)
+		params := create.Response
+		if create.EventId == "" || params == nil || params.Conversation != ConversationNone || params.Instructions != "Tag the intent as JSON." ||
+			len(params.Input) != 1 || params.Input[0].Id != "item_1" || len(params.OutputModalities) != 1 || params.OutputModalities[0] != "text" {
+			t.Fatalf("Expected an out-of-band response.create, got %+v", create)
+		}
+		id := params.Metadata[outOfBandKey]
+		metadata := `{"` + outOfBandKey + `":"` + id + `"}`
+
+		transport.events <- []byte(`{"type":"response.created","response":{"id":"resp_oob","status":"in_progress","metadata":` + metadata + `}}`)
+		transport.events <- []byte(`{"type":"response.created","response":{"id":"resp_1","status":"in_progress"}}`)
+		transport.events <- []byte(`{"type":"response.output_item.added","response_id":"resp_oob","item":{"id":"item_oob","type":"message","role":"assistant"}}`)
+		transport.events <- []byte(`{"type":"response.output_item.added","response_id":"resp_1","item":{"id":"item_2","type":"message","role":"assistant"}}`)
+		transport.events <- []byte(`{"type":"response.output_text.done","response_id":"resp_oob","item_id":"item_oob","text":"{}"}`)
+		transport.events <- []byte(`{"type":"response.output_audio_transcript.done","response_id":"resp_oob","item_id":"item_oob","transcript":"{}"}`)
+		transport.events <- []byte(`{"type":"response.output_text.done","response_id":"resp_1","item_id":"item_2","text":"Hi"}`)
+		// Turns cancel the pending responses, which the out-of-band one is
+		// not part of.
+		waitFor(t, func() bool {
+			pending := session.PendingResponses()
+			return len(pending) == 1 && pending[0] == "resp_1"
+		})
+		transport.events <- []byte(`{"type":"response.done","response":{"id":"resp_1","status":"completed"}}`)
+		transport.events <- []byte(`{"type":"response.done","response":{"id":"resp_oob","status":"completed","metadata":` + metadata + `,` +
+			`"output":[{"id":"item_oob","type":"message","role":"assistant","content":[{"type":"output_text","text":"` + "```json\\n{\\\"intent\\\":\\\"billing\\\"}\\n```" + `"}]}]}}`)
+
+		var result struct {
+			Intent string `json:"intent"`
+		}
+		if err := future.Decode(context.Background(), &result); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if result.Intent != "billing" {
+			t.Errorf("Expected billing, got %q", result.Intent)
+		}
+		if got := itemIds(conversation.Items()); len(got) != 1 || got[0] != "item_2" {
+			t.Errorf("Expected the out-of-band output to stay out of the conversation, got %v", got)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if len(texts) != 1 || texts[0] != "resp_1" {
+			t.Errorf("Expected the text of resp_1 only, got %v", texts)
+		}
+		if segments := transcript.Segments(); len(segments) != 0 {
+			t.Errorf("Expected the out-of-band output to stay out of the transcript, got %+v", segments)
+		}
+	})
+
+	t.Run("Failed", func(t *testing.T) {
+		session, transport, _, _ := newTestSession(t)
+		defer func() { _ = session.Close(context.Background()) }()
+		if err := session.Start(); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		future, err := session.CreateOutOfBandResponse(context.Background(), "Summarize.", nil)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		id := sentResponseCreate(t, transport).Response.Metadata[outOfBandKey]
+		transport.events <- []byte(`{"type":"response.done","response":{"id":"resp_oob","status":"failed","status_details":{"type":"failed","error":{"type":"server_error","message":"boom"}},"metadata":{"` + outOfBandKey + `":"` + id + `"}}}`)
+		var responseErr *ResponseError
+		if _, err := future.Text(context.Background()); !errors.As(err, &responseErr) || responseErr.Response.Status != "failed" {
+			t.Errorf("Expected a failed ResponseError, got %v", err)
+		}
+	})
+
+	t.Run("Rejected", func(t *testing.T) {
+		session, transport, _, _ := newTestSession(t)
+		defer func() { _ = session.Close(context.Background()) }()
+		if err := session.Start(); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		future, err := session.CreateOutOfBandResponse(context.Background(), "Summarize.", nil)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		eventId := sentResponseCreate(t, transport).EventId
+		transport.events <- []byte(`{"type":"error","error":{"type":"invalid_request_error","message":"Invalid input.","event_id":"` + eventId + `"}}`)
+		var serverErr *ServerError
+		if _, err := future.Text(context.Background()); !errors.As(err, &serverErr) || serverErr.Message != "Invalid input." {
+			t.Errorf("Expected a ServerError, got %v", err)
+		}
+	})
+
+	t.Run("Closed", func(t *testing.T) {
+		session, transport, _, _ := newTestSession(t)
+		if err := session.Start(); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		future, err := session.CreateOutOfBandResponse(context.Background(), "Summarize.", nil)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		_ = transport.Close(context.Background())
+		if _, err := future.Text(context.Background()); !errors.Is(err, ErrSessionClosed) {
+			t.Errorf("Expected %v, got %v", ErrSessionClosed, err)
+		}
+		_ = session.Close(context.Background())
+	})
+}
+
+func TestResponseText(t *testing.T) {
+	response := Response{Output: []Item{
+		{Type: ItemTypeFunctionCall, Arguments: "{}"},
+		{Type: ItemTypeMessage, Content: []ContentPart{{Type: ContentTypeOutputAudio, Transcript: "Hello. "}, {Type: ContentTypeOutputText, Text: "Bye."}}},
+	}}
+	if got := ResponseText(response); got != "Hello. Bye." {
+		t.Errorf("Expected %q, got %q", "Hello. Bye.", got)
+	}
+}
@@ -0,0 +1,60 @@
+package rtc
+
+import (
+	"fmt"
+
+	"github.com/pion/webrtc/v4"
+	"gitlab.bcc-hyperdev.org/bcc-hyperdev/realtime"
+	"gitlab.bcc-hyperdev.org/bcc-hyperdev/realtime/audio"
+)
+
+// Codec converts between the session's PCM frames and RTP payloads. Codecs
+// are stateful (resamplers, encoder state) and must not be shared between
+// transports. Opus requires a cgo encoder and is left to callers; G.711 is
+// provided here.
+type Codec interface {
+	Parameters() webrtc.RTPCodecParameters
+	Encode(pcm []byte) ([]byte, error)
+	Decode(payload []byte) ([]byte, error)
+}
+
+type PCMUCodec struct {
+	down *audio.Resampler
+	up   *audio.Resampler
+}
+
+func NewPCMUCodec() (c *PCMUCodec, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("failed to create PCMU codec: %w", err)
+		}
+	}()
+	down, err := audio.NewResampler(realtime.SampleRate, 8000)
+	if err != nil {
+		return nil, err
+	}
+	up, err := audio.NewResampler(8000, realtime.SampleRate)
+	if err != nil {
+		return nil, err
+	}
+	return &PCMUCodec{down: down, up: up}, nil
+}
+
+func (c *PCMUCodec) Parameters() webrtc.RTPCodecParameters {
+	return webrtc.RTPCodecParameters{
+		RTPCodecCapability: webrtc.RTPCodecCapability{
+			MimeType:  webrtc.MimeTypePCMU,
+			ClockRate: 8000,
+			Channels:  1,
+		},
+		PayloadType: 0,
+	}
+}
+
+func (c *PCMUCodec) Encode(pcm []byte) ([]byte, error) {
+	return audio.EncodeUlaw(c.down.Process(audio.Samples(pcm))), nil
+}
+
+func (c *PCMUCodec) Decode(payload []byte) ([]byte, error) {
+	return audio.PCM(c.up.Process(audio.DecodeUlaw(payload))), nil
+}
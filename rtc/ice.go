@@ -0,0 +1,192 @@
+package rtc
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+	"gitlab.bcc-hyperdev.org/bcc-hyperdev/realtime/shared"
+)
+
+const DefaultTurnTTL = 24 * time.Hour
+
+// IceServer is a STUN or TURN server.
+type IceServer struct {
+	// Urls are stun:, turn: or turns: URLs sharing the credentials below.
+	Urls       []string
+	Username   string
+	Credential string
+	// TurnSecret derives time-limited credentials as in the TURN REST API,
+	// e.g. coturn's static-auth-secret, replacing Credential. Username is
+	// then the optional user the credentials are issued to.
+	TurnSecret string
+	// TurnTTL is the lifetime of derived credentials. Defaults to
+	// DefaultTurnTTL.
+	TurnTTL time.Duration
+}
+
+// IceConfig is the network policy of the PeerConnection: the servers used to
+// gather candidates and where it may gather them.
+type IceConfig struct {
+	Servers []IceServer
+	// RelayOnly only uses TURN relayed candidates, hiding the host's
+	// addresses.
+	RelayOnly bool
+	// PortMin and PortMax bound the local UDP ports; zero leaves them
+	// ephemeral.
+	PortMin uint16
+	PortMax uint16
+	// Interfaces restricts gathering to the named network interfaces; empty
+	// allows all.
+	Interfaces []string
+}
+
+// IceConfigFromEnv loads the config from environment variables named after
+// prefix, e.g. ICE_ for ICE_STUN_URLS:
+//
+//	STUN_URLS        comma-separated stun: URLs
+//	TURN_URLS        comma-separated turn: or turns: URLs
+//	TURN_USERNAME    TURN username
+//	TURN_CREDENTIAL  static TURN password
+//	TURN_SECRET      shared secret deriving time-limited credentials
+//	TURN_TTL         lifetime of derived credentials, e.g. 1h
+//	RELAY_ONLY       only use relayed candidates
+//	PORT_MIN         lowest local UDP port
+//	PORT_MAX         highest local UDP port
+//	INTERFACES       comma-separated network interfaces to use
+func IceConfigFromEnv(prefix string) (cfg *IceConfig, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("failed to load ICE config: %w", err)
+		}
+	}()
+	cfg = &IceConfig{}
+	stun, err := shared.Getenv(shared.GetenvStrings, prefix+"STUN_URLS", false)
+	if err != nil {
+		return nil, err
+	}
+	if len(stun) > 0 {
+		cfg.Servers = append(cfg.Servers, IceServer{Urls: stun})
+	}
+	turn := IceServer{}
+	if turn.Urls, err = shared.Getenv(shared.GetenvStrings, prefix+"TURN_URLS", false); err != nil {
+		return nil, err
+	}
+	if turn.Username, err = shared.Getenv(shared.GetenvString, prefix+"TURN_USERNAME", false); err != nil {
+		return nil, err
+	}
+	if turn.Credential, err = shared.Getenv(shared.GetenvString, prefix+"TURN_CREDENTIAL", false); err != nil {
+		return nil, err
+	}
+	if turn.TurnSecret, err = shared.Getenv(shared.GetenvString, prefix+"TURN_SECRET", false); err != nil {
+		return nil, err
+	}
+	if turn.TurnTTL, err = shared.Getenv(shared.GetenvDuration, prefix+"TURN_TTL", false); err != nil {
+		return nil, err
+	}
+	if len(turn.Urls) > 0 {
+		cfg.Servers = append(cfg.Servers, turn)
+	}
+	if cfg.RelayOnly, err = shared.Getenv(shared.GetenvBool, prefix+"RELAY_ONLY", false, "false"); err != nil {
+		return nil, err
+	}
+	if cfg.PortMin, err = shared.Getenv(shared.GetenvUint16, prefix+"PORT_MIN", false, "0"); err != nil {
+		return nil, err
+	}
+	if cfg.PortMax, err = shared.Getenv(shared.GetenvUint16, prefix+"PORT_MAX", false, "0"); err != nil {
+		return nil, err
+	}
+	if cfg.Interfaces, err = shared.Getenv(shared.GetenvStrings, prefix+"INTERFACES", false); err != nil {
+		return nil, err
+	}
+	return cfg, cfg.validate()
+}
+
+func (c *IceConfig) validate() error {
+	if c == nil {
+		return nil
+	}
+	hasTurn := false
+	for _, server := range c.Servers {
+		if len(server.Urls) == 0 {
+			return fmt.Errorf("ICE server URLs are required")
+		}
+		for _, url := range server.Urls {
+			switch {
+			case strings.HasPrefix(url, "turn:"), strings.HasPrefix(url, "turns:"):
+				hasTurn = true
+			case strings.HasPrefix(url, "stun:"), strings.HasPrefix(url, "stuns:"):
+			default:
+				return fmt.Errorf("invalid ICE server URL %s", url)
+			}
+		}
+	}
+	if c.RelayOnly && !hasTurn {
+		return fmt.Errorf("relay only requires a TURN server")
+	}
+	if (c.PortMin == 0) != (c.PortMax == 0) || c.PortMin > c.PortMax {
+		return fmt.Errorf("invalid port range %d-%d", c.PortMin, c.PortMax)
+	}
+	return nil
+}
+
+// settings returns the PeerConnection configuration and setting engine,
+// deriving TURN credentials valid from now.
+func (c *IceConfig) settings(now time.Time) (webrtc.Configuration, webrtc.SettingEngine, error) {
+	var cfg webrtc.Configuration
+	se := webrtc.SettingEngine{}
+	if c == nil {
+		return cfg, se, nil
+	}
+	if err := c.validate(); err != nil {
+		return cfg, se, err
+	}
+	for _, server := range c.Servers {
+		username, credential := server.Username, server.Credential
+		if server.TurnSecret != "" {
+			username, credential = TurnCredentials(server.TurnSecret, server.Username, now, server.TurnTTL)
+		}
+		cfg.ICEServers = append(cfg.ICEServers, webrtc.ICEServer{
+			URLs:       server.Urls,
+			Username:   username,
+			Credential: credential,
+		})
+	}
+	if c.RelayOnly {
+		cfg.ICETransportPolicy = webrtc.ICETransportPolicyRelay
+	}
+	if c.PortMin != 0 {
+		if err := se.SetEphemeralUDPPortRange(c.PortMin, c.PortMax); err != nil {
+			return cfg, se, fmt.Errorf("failed to set port range: %w", err)
+		}
+	}
+	if len(c.Interfaces) > 0 {
+		interfaces := slices.Clone(c.Interfaces)
+		se.SetInterfaceFilter(func(name string) bool {
+			return slices.Contains(interfaces, name)
+		})
+	}
+	return cfg, se, nil
+}
+
+// TurnCredentials derives credentials as in the TURN REST API: the username
+// is the expiry as a Unix time, followed by the user if any, and the
+// credential is its base64 HMAC-SHA1 keyed with the shared secret.
+func TurnCredentials(secret, user string, now time.Time, ttl time.Duration) (username, credential string) {
+	if ttl <= 0 {
+		ttl = DefaultTurnTTL
+	}
+	username = strconv.FormatInt(now.Add(ttl).Unix(), 10)
+	if user != "" {
+		username += ":" + user
+	}
+	mac := hmac.New(sha1.New, []byte(secret))
+	mac.Write([]byte(username))
+	return username, base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
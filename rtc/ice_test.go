@@ -0,0 +1,155 @@
+package rtc
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+	"gitlab.bcc-hyperdev.org/bcc-hyperdev/realtime/shared"
+)
+
+// hostPorts returns the ports of the host candidates in sdp.
+func hostPorts(t *testing.T, sdp string) []int {
+	t.Helper()
+	var ports []int
+	for _, line := range strings.Split(sdp, "\r\n") {
+		fields := strings.Fields(strings.TrimPrefix(line, "a=candidate:"))
+		if !strings.HasPrefix(line, "a=candidate:") || len(fields) < 8 || fields[7] != "host" {
+			continue
+		}
+		port, err := strconv.Atoi(fields[5])
+		if err != nil {
+			t.Fatalf("Expected a port, got %q", line)
+		}
+		ports = append(ports, port)
+	}
+	return ports
+}
+
+func TestIceConfig(t *testing.T) {
+	t.Run("TurnCredentials", func(t *testing.T) {
+		now := time.Unix(1700000000, 0)
+		username, credential := TurnCredentials("secret", "alice", now, time.Hour)
+		if username != "1700003600:alice" {
+			t.Errorf("Expected the expiry and user, got %s", username)
+		}
+		if credential != "LLPLO4qjdVL2qZhwr3eImhn7J20=" {
+			t.Errorf("Expected the HMAC of the username, got %s", credential)
+		}
+		if username, _ := TurnCredentials("secret", "", now, 0); username != "1700086400" {
+			t.Errorf("Expected the default ttl without user, got %s", username)
+		}
+	})
+
+	t.Run("Settings", func(t *testing.T) {
+		now := time.Unix(1700000000, 0)
+		cfg, _, err := (&IceConfig{
+			Servers: []IceServer{
+				{Urls: []string{"stun:stun.example.org:3478"}},
+				{Urls: []string{"turn:turn.example.org:3478?transport=udp", "turns:turn.example.org:5349"}, Username: "alice", TurnSecret: "secret", TurnTTL: time.Hour},
+			},
+			RelayOnly: true,
+			PortMin:   40000,
+			PortMax:   40100,
+		}).settings(now)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(cfg.ICEServers) != 2 || cfg.ICETransportPolicy != webrtc.ICETransportPolicyRelay {
+			t.Fatalf("Expected 2 servers and relay policy, got %+v", cfg)
+		}
+		wantUser, wantCredential := TurnCredentials("secret", "alice", now, time.Hour)
+		if turn := cfg.ICEServers[1]; turn.Username != wantUser || turn.Credential != wantCredential || len(turn.URLs) != 2 {
+			t.Errorf("Expected derived TURN credentials, got %+v", turn)
+		}
+	})
+
+	t.Run("Validation", func(t *testing.T) {
+		for name, cfg := range map[string]*IceConfig{
+			"NoUrls":        {Servers: []IceServer{{}}},
+			"BadScheme":     {Servers: []IceServer{{Urls: []string{"http://turn.example.org"}}}},
+			"RelayNoTurn":   {Servers: []IceServer{{Urls: []string{"stun:stun.example.org"}}}, RelayOnly: true},
+			"HalfRange":     {PortMin: 40000},
+			"InvertedRange": {PortMin: 40100, PortMax: 40000},
+		} {
+			if _, _, err := cfg.settings(time.Now()); err == nil {
+				t.Errorf("Expected an error for %s, got nil", name)
+			}
+		}
+	})
+
+	t.Run("FromEnv", func(t *testing.T) {
+		t.Setenv("ICE_STUN_URLS", "stun:a.example.org, stun:b.example.org")
+		t.Setenv("ICE_TURN_URLS", "turn:turn.example.org")
+		t.Setenv("ICE_TURN_SECRET", "secret")
+		t.Setenv("ICE_TURN_TTL", "1h")
+		t.Setenv("ICE_RELAY_ONLY", "true")
+		t.Setenv("ICE_PORT_MIN", "40000")
+		t.Setenv("ICE_PORT_MAX", "40100")
+		t.Setenv("ICE_INTERFACES", "eth0")
+		cfg, err := IceConfigFromEnv("ICE_")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(cfg.Servers) != 2 || len(cfg.Servers[0].Urls) != 2 || cfg.Servers[1].TurnTTL != time.Hour {
+			t.Errorf("Expected STUN and TURN servers, got %+v", cfg.Servers)
+		}
+		if !cfg.RelayOnly || cfg.PortMin != 40000 || cfg.PortMax != 40100 || len(cfg.Interfaces) != 1 {
+			t.Errorf("Expected the network policy, got %+v", cfg)
+		}
+
+		t.Setenv("ICE_PORT_MAX", "")
+		if _, err := IceConfigFromEnv("ICE_"); err == nil {
+			t.Error("Expected an error for a half range, got nil")
+		}
+	})
+
+	t.Run("Gathering", func(t *testing.T) {
+		var name string
+		interfaces, _ := net.Interfaces()
+		for _, iface := range interfaces {
+			if iface.Flags&net.FlagUp != 0 && iface.Flags&net.FlagLoopback == 0 {
+				name = iface.Name
+				break
+			}
+		}
+		if name == "" {
+			t.Skip("no network interface to gather on")
+		}
+
+		var offer string
+		codec, _ := NewPCMUCodec()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		ice := &IceConfig{PortMin: 41000, PortMax: 41020, Interfaces: []string{name}}
+		_, err := Dial(ctx, shared.NewLogger(), &Config{Codec: codec, Ice: ice}, func(ctx context.Context, sdp string) (string, error) {
+			offer = sdp
+			return "", context.Canceled
+		})
+		if err == nil {
+			t.Fatal("Expected the signaler error, got nil")
+		}
+		ports := hostPorts(t, offer)
+		if len(ports) == 0 {
+			t.Fatalf("Expected host candidates, got %s", offer)
+		}
+		for _, port := range ports {
+			if port < 41000 || port > 41020 {
+				t.Errorf("Expected ports within 41000-41020, got %d", port)
+			}
+		}
+
+		ice = &IceConfig{Interfaces: []string{"no-such-interface"}}
+		_, _ = Dial(ctx, shared.NewLogger(), &Config{Codec: codec, Ice: ice}, func(ctx context.Context, sdp string) (string, error) {
+			offer = sdp
+			return "", context.Canceled
+		})
+		if ports := hostPorts(t, offer); len(ports) != 0 {
+			t.Errorf("Expected no host candidates, got %v", ports)
+		}
+	})
+}
@@ -0,0 +1,427 @@
+package rtc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+	"github.com/pion/webrtc/v4/pkg/media"
+	"gitlab.bcc-hyperdev.org/bcc-hyperdev/realtime"
+	"gitlab.bcc-hyperdev.org/bcc-hyperdev/realtime/shared"
+)
+
+const DefaultDataChannelLabel = "oai-events"
+
+var ErrTransportClosed = errors.New("transport closed")
+
+// Signaler exchanges the local SDP offer for the remote SDP answer, typically
+// by posting it to the provider's calls endpoint.
+type Signaler func(ctx context.Context, offer string) (answer string, err error)
+
+type Config struct {
+	Codec            Codec
+	DataChannelLabel string
+	// Ice configures STUN/TURN servers and the network policy. Without it
+	// only host candidates are gathered.
+	Ice *IceConfig
+	// Trickle enables trickle ICE: the description is signaled at once and
+	// local candidates are sent with Trickle as they are gathered. Dial falls
+	// back to full gathering when the signaler returns
+	// ErrTrickleUnsupported, Accept when the offer does not advertise
+	// trickle.
+	Trickle CandidateSender
+	// GatherTimeout bounds the wait for full gathering, after which the
+	// description carries the candidates gathered so far. Zero waits for
+	// gathering to complete.
+	GatherTimeout time.Duration
+	// OnStateChange observes the PeerConnection state. The transport closes
+	// itself when the connection fails or the remote side hangs up.
+	OnStateChange func(webrtc.PeerConnectionState)
+}
+
+// Transport is a realtime.Transport over a pion PeerConnection: audio goes
+// over a single sendrecv track and events over a data channel.
+type Transport struct {
+	logger *shared.Logger
+	codec  Codec
+	label  string
+	// trickle and timeout are the ICE signaling options of the Config.
+	trickle CandidateSender
+	timeout time.Duration
+	pc      *webrtc.PeerConnection
+	dc      *webrtc.DataChannel
+	track   *webrtc.TrackLocalStaticSample
+
+	events   chan []byte
+	audio    chan []byte
+	opened   chan struct{}
+	openOnce sync.Once
+	closed   chan struct{}
+
+	mu        sync.RWMutex
+	done      bool
+	wg        sync.WaitGroup
+	closeOnce sync.Once
+	closeErr  error
+}
+
+var _ realtime.StatefulTransport = (*Transport)(nil)
+
+func newTransport(logger *shared.Logger, cfg *Config) (t *Transport, err error) {
+	if cfg == nil || cfg.Codec == nil {
+		return nil, fmt.Errorf("codec is required")
+	}
+	me := &webrtc.MediaEngine{}
+	if err := me.RegisterCodec(cfg.Codec.Parameters(), webrtc.RTPCodecTypeAudio); err != nil {
+		return nil, fmt.Errorf("failed to register codec: %w", err)
+	}
+	pcCfg, se, err := cfg.Ice.settings(time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("invalid ICE config: %w", err)
+	}
+	api := webrtc.NewAPI(webrtc.WithMediaEngine(me), webrtc.WithSettingEngine(se))
+	pc, err := api.NewPeerConnection(pcCfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create peer connection: %w", err)
+	}
+	t = &Transport{
+		logger:  logger,
+		codec:   cfg.Codec,
+		trickle: cfg.Trickle,
+		timeout: cfg.GatherTimeout,
+		label:   cfg.DataChannelLabel,
+		pc:      pc,
+		events:  make(chan []byte, 64),
+		audio:   make(chan []byte, 64),
+		opened:  make(chan struct{}),
+		closed:  make(chan struct{}),
+	}
+	if t.label == "" {
+		t.label = DefaultDataChannelLabel
+	}
+	pc.OnTrack(func(track *webrtc.TrackRemote, _ *webrtc.RTPReceiver) {
+		t.spawn(func() { t.readTrack(track) })
+	})
+	pc.OnConnectionStateChange(func(state webrtc.PeerConnectionState) {
+		if cfg.OnStateChange != nil {
+			cfg.OnStateChange(state)
+		}
+		switch state {
+		case webrtc.PeerConnectionStateFailed, webrtc.PeerConnectionStateClosed:
+			t.hangup()
+		}
+	})
+	return t, nil
+}
+
+// Dial creates the offering side of a call, as a client of the provider.
+func Dial(ctx context.Context, logger *shared.Logger, cfg *Config, signal Signaler) (t *Transport, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("failed to dial WebRTC transport: %w", err)
+		}
+	}()
+	if signal == nil {
+		return nil, fmt.Errorf("signaler is required")
+	}
+	t, err = newTransport(logger, cfg)
+	if err != nil {
+		return nil, err
+	}
+	// t is passed in since the error returns below clear it.
+	defer func(t *Transport) {
+		if err != nil {
+			_ = t.Close(context.WithoutCancel(ctx))
+		}
+	}(t)
+
+	dc, err := t.pc.CreateDataChannel(t.label, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create data channel: %w", err)
+	}
+	t.bindDataChannel(dc)
+	if err := t.addTrack(); err != nil {
+		return nil, err
+	}
+
+	var tr *trickler
+	if t.trickle != nil {
+		tr = t.gatherCandidates()
+	}
+	offer, err := t.pc.CreateOffer(nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create offer: %w", err)
+	}
+	if err := t.pc.SetLocalDescription(offer); err != nil {
+		return nil, fmt.Errorf("failed to set local description: %w", err)
+	}
+	var answer string
+	if tr != nil {
+		// The local description would carry the candidates gathered so far,
+		// which are trickled as well.
+		answer, err = signal(ctx, advertiseTrickle(offer.SDP))
+		if errors.Is(err, ErrTrickleUnsupported) {
+			t.logger.NoCtxWarnf("remote does not support trickle ICE, waiting for gathering")
+			t.stopTrickle()
+			tr = nil
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to signal offer: %w", err)
+		}
+	}
+	if tr == nil {
+		if err := t.waitGathering(ctx, t.timeout); err != nil {
+			return nil, err
+		}
+		answer, err = signal(ctx, t.pc.LocalDescription().SDP)
+		if err != nil {
+			return nil, fmt.Errorf("failed to signal offer: %w", err)
+		}
+	}
+	err = t.pc.SetRemoteDescription(webrtc.SessionDescription{Type: webrtc.SDPTypeAnswer, SDP: answer})
+	if err != nil {
+		return nil, fmt.Errorf("failed to set remote description: %w", err)
+	}
+	if tr != nil {
+		t.sendCandidates(tr, t.trickle)
+	}
+	return t, nil
+}
+
+// Accept creates the answering side of a call for a remote offer, e.g. from a
+// browser. The remote side is expected to open the data channel.
+func Accept(ctx context.Context, logger *shared.Logger, cfg *Config, offer string) (t *Transport, answer string, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("failed to accept WebRTC transport: %w", err)
+		}
+	}()
+	t, err = newTransport(logger, cfg)
+	if err != nil {
+		return nil, "", err
+	}
+	// t is passed in since the error returns below clear it.
+	defer func(t *Transport) {
+		if err != nil {
+			_ = t.Close(context.WithoutCancel(ctx))
+		}
+	}(t)
+
+	t.pc.OnDataChannel(func(dc *webrtc.DataChannel) {
+		if dc.Label() != t.label {
+			t.logger.NoCtxWarnf("ignoring unexpected data channel %s", dc.Label())
+			return
+		}
+		t.bindDataChannel(dc)
+	})
+	err = t.pc.SetRemoteDescription(webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: offer})
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to set remote description: %w", err)
+	}
+	if err := t.addTrack(); err != nil {
+		return nil, "", err
+	}
+	var tr *trickler
+	if t.trickle != nil && SupportsTrickle(offer) {
+		tr = t.gatherCandidates()
+	}
+	desc, err := t.pc.CreateAnswer(nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create answer: %w", err)
+	}
+	if err := t.pc.SetLocalDescription(desc); err != nil {
+		return nil, "", fmt.Errorf("failed to set local description: %w", err)
+	}
+	if tr != nil {
+		t.sendCandidates(tr, t.trickle)
+		return t, advertiseTrickle(desc.SDP), nil
+	}
+	if err := t.waitGathering(ctx, t.timeout); err != nil {
+		return nil, "", err
+	}
+	return t, t.pc.LocalDescription().SDP, nil
+}
+
+func (t *Transport) bindDataChannel(dc *webrtc.DataChannel) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.dc != nil || t.done {
+		return
+	}
+	t.dc = dc
+	dc.OnOpen(func() {
+		t.openOnce.Do(func() { close(t.opened) })
+	})
+	dc.OnMessage(func(msg webrtc.DataChannelMessage) {
+		t.deliver(t.events, msg.Data)
+	})
+	dc.OnClose(t.hangup)
+}
+
+// hangup closes the transport from pion callbacks, which must not block on
+// the PeerConnection they are called from.
+func (t *Transport) hangup() {
+	select {
+	case <-t.closed:
+		return
+	default:
+	}
+	go func() { _ = t.Close(context.Background()) }()
+}
+
+func (t *Transport) addTrack() (err error) {
+	t.track, err = webrtc.NewTrackLocalStaticSample(t.codec.Parameters().RTPCodecCapability, "audio", "realtime")
+	if err != nil {
+		return fmt.Errorf("failed to create local track: %w", err)
+	}
+	sender, err := t.pc.AddTrack(t.track)
+	if err != nil {
+		return fmt.Errorf("failed to add local track: %w", err)
+	}
+	t.spawn(func() {
+		buf := make([]byte, 1500)
+		for {
+			if _, _, err := sender.Read(buf); err != nil {
+				return
+			}
+		}
+	})
+	return nil
+}
+
+func (t *Transport) PeerConnection() *webrtc.PeerConnection {
+	return t.pc
+}
+
+// State returns the PeerConnection state, e.g. connected.
+func (t *Transport) State() string {
+	return t.pc.ConnectionState().String()
+}
+
+func (t *Transport) Events() <-chan []byte {
+	return t.events
+}
+
+func (t *Transport) Audio() <-chan []byte {
+	return t.audio
+}
+
+// Send waits for the data channel to open before writing the event.
+func (t *Transport) Send(ctx context.Context, event []byte) error {
+	select {
+	case <-t.opened:
+	case <-t.closed:
+		return ErrTransportClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	t.mu.RLock()
+	dc := t.dc
+	t.mu.RUnlock()
+	return dc.SendText(string(event))
+}
+
+func (t *Transport) WriteAudio(ctx context.Context, frame []byte) error {
+	select {
+	case <-t.closed:
+		return ErrTransportClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+	}
+	payload, err := t.codec.Encode(frame)
+	if err != nil {
+		return fmt.Errorf("failed to encode audio: %w", err)
+	}
+	return t.track.WriteSample(media.Sample{Data: payload, Duration: realtime.AudioDuration(frame)})
+}
+
+// Close closes the data channel and the PeerConnection, which stops both
+// tracks, then waits for the reader goroutines before closing Events and
+// Audio.
+func (t *Transport) Close(ctx context.Context) error {
+	t.closeOnce.Do(func() {
+		close(t.closed)
+		var errs []error
+		t.mu.RLock()
+		dc := t.dc
+		t.mu.RUnlock()
+		if dc != nil {
+			if err := dc.Close(); err != nil {
+				errs = append(errs, fmt.Errorf("failed to close data channel: %w", err))
+			}
+		}
+		closed := make(chan error, 1)
+		go func() { closed <- t.pc.GracefulClose() }()
+		select {
+		case err := <-closed:
+			if err != nil {
+				errs = append(errs, fmt.Errorf("failed to close peer connection: %w", err))
+			}
+		case <-ctx.Done():
+			errs = append(errs, fmt.Errorf("failed to close peer connection: %w", ctx.Err()))
+		}
+
+		t.mu.Lock()
+		t.done = true
+		t.mu.Unlock()
+		waited := make(chan struct{})
+		go func() {
+			t.wg.Wait()
+			close(waited)
+		}()
+		select {
+		case <-waited:
+		case <-ctx.Done():
+			errs = append(errs, fmt.Errorf("failed to stop track readers: %w", ctx.Err()))
+		}
+		close(t.events)
+		close(t.audio)
+		t.closeErr = errors.Join(errs...)
+	})
+	return t.closeErr
+}
+
+func (t *Transport) spawn(fn func()) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.done {
+		return
+	}
+	t.wg.Add(1)
+	go func() {
+		defer t.wg.Done()
+		fn()
+	}()
+}
+
+func (t *Transport) readTrack(track *webrtc.TrackRemote) {
+	for {
+		pkt, _, err := track.ReadRTP()
+		if err != nil {
+			return
+		}
+		pcm, err := t.codec.Decode(pkt.Payload)
+		if err != nil {
+			t.logger.NoCtxWarnf("failed to decode audio: %v", err)
+			continue
+		}
+		t.deliver(t.audio, pcm)
+	}
+}
+
+// deliver hands data to a consumer unless the transport is closing. Holding
+// the read lock keeps Close from closing the channel mid-send.
+func (t *Transport) deliver(ch chan []byte, data []byte) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if t.done {
+		return
+	}
+	select {
+	case ch <- data:
+	case <-t.closed:
+	}
+}
@@ -0,0 +1,124 @@
+package rtc
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+	"gitlab.bcc-hyperdev.org/bcc-hyperdev/realtime/shared"
+	"go.uber.org/goleak"
+)
+
+// newEchoPeer answers offers with a PeerConnection that echoes data channel
+// messages and counts received RTP packets.
+func newEchoPeer(t *testing.T) (*webrtc.PeerConnection, Signaler, <-chan struct{}) {
+	t.Helper()
+	me := &webrtc.MediaEngine{}
+	codec, err := NewPCMUCodec()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := me.RegisterCodec(codec.Parameters(), webrtc.RTPCodecTypeAudio); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	pc, err := webrtc.NewAPI(webrtc.WithMediaEngine(me)).NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := pc.AddTransceiverFromKind(webrtc.RTPCodecTypeAudio); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	pc.OnDataChannel(func(dc *webrtc.DataChannel) {
+		dc.OnMessage(func(msg webrtc.DataChannelMessage) {
+			_ = dc.SendText(string(msg.Data))
+		})
+	})
+	gotAudio := make(chan struct{})
+	pc.OnTrack(func(track *webrtc.TrackRemote, _ *webrtc.RTPReceiver) {
+		if _, _, err := track.ReadRTP(); err == nil {
+			close(gotAudio)
+		}
+		for {
+			if _, _, err := track.ReadRTP(); err != nil {
+				return
+			}
+		}
+	})
+	signal := func(ctx context.Context, offer string) (string, error) {
+		err := pc.SetRemoteDescription(webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: offer})
+		if err != nil {
+			return "", err
+		}
+		answer, err := pc.CreateAnswer(nil)
+		if err != nil {
+			return "", err
+		}
+		gathered := webrtc.GatheringCompletePromise(pc)
+		if err := pc.SetLocalDescription(answer); err != nil {
+			return "", err
+		}
+		<-gathered
+		return pc.LocalDescription().SDP, nil
+	}
+	return pc, signal, gotAudio
+}
+
+func TestTransportClose(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	remote, signal, gotAudio := newEchoPeer(t)
+	codec, err := NewPCMUCodec()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	transport, err := Dial(ctx, shared.NewLogger(), &Config{Codec: codec}, signal)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if err := transport.Send(ctx, []byte(`{"type":"ping"}`)); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	select {
+	case event := <-transport.Events():
+		if string(event) != `{"type":"ping"}` {
+			t.Errorf("Expected echoed event, got %s", event)
+		}
+	case <-ctx.Done():
+		t.Fatal("Timed out waiting for echoed event")
+	}
+
+	frame := make([]byte, 960)
+	for {
+		if err := transport.WriteAudio(ctx, frame); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		select {
+		case <-gotAudio:
+		case <-time.After(20 * time.Millisecond):
+			continue
+		case <-ctx.Done():
+			t.Fatal("Timed out waiting for audio")
+		}
+		break
+	}
+
+	if err := transport.Close(ctx); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+	if _, ok := <-transport.Events(); ok {
+		t.Error("Expected Events to be closed")
+	}
+	if _, ok := <-transport.Audio(); ok {
+		t.Error("Expected Audio to be closed")
+	}
+	if err := transport.WriteAudio(ctx, frame); err != ErrTransportClosed {
+		t.Errorf("Expected ErrTransportClosed, got %v", err)
+	}
+	if err := remote.GracefulClose(); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+}
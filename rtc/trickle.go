@@ -0,0 +1,188 @@
+package rtc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// ErrTrickleUnsupported is returned by signalers whose remote side rejects an
+// offer without candidates, so that Dial falls back to full gathering.
+var ErrTrickleUnsupported = errors.New("remote does not support trickle ICE")
+
+// CandidateSender trickles a local candidate to the remote side. An empty
+// candidate marks the end of gathering, as in AddICECandidate. Remote
+// candidates it returns, e.g. from the response to a WHIP PATCH, are added to
+// the transport; those pushed by the remote side are added with
+// AddRemoteCandidate.
+type CandidateSender func(ctx context.Context, candidate webrtc.ICECandidateInit) (remote []webrtc.ICECandidateInit, err error)
+
+// trickler queues the local candidates gathered until they are sent.
+type trickler struct {
+	mu      sync.Mutex
+	pending []webrtc.ICECandidateInit
+	notify  chan struct{}
+}
+
+func (t *Transport) gatherCandidates() *trickler {
+	tr := &trickler{notify: make(chan struct{}, 1)}
+	t.pc.OnICECandidate(func(c *webrtc.ICECandidate) {
+		var candidate webrtc.ICECandidateInit
+		if c != nil {
+			candidate = c.ToJSON()
+		}
+		tr.mu.Lock()
+		tr.pending = append(tr.pending, candidate)
+		tr.mu.Unlock()
+		select {
+		case tr.notify <- struct{}{}:
+		default:
+		}
+	})
+	return tr
+}
+
+// stopTrickle drops the candidates gathered from now on.
+func (t *Transport) stopTrickle() {
+	t.pc.OnICECandidate(func(*webrtc.ICECandidate) {})
+}
+
+// sendCandidates sends the queued candidates with send until the end of
+// gathering or until the transport closes.
+func (t *Transport) sendCandidates(tr *trickler, send CandidateSender) {
+	t.spawn(func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go func() {
+			select {
+			case <-t.closed:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+		for {
+			tr.mu.Lock()
+			pending := tr.pending
+			tr.pending = nil
+			tr.mu.Unlock()
+			for _, candidate := range pending {
+				remote, err := send(ctx, candidate)
+				if err != nil {
+					if ctx.Err() != nil || errors.Is(err, ErrTrickleUnsupported) {
+						return
+					}
+					t.logger.NoCtxWarnf("failed to send ICE candidate: %v", err)
+				}
+				for _, c := range remote {
+					if err := t.AddRemoteCandidate(c); err != nil {
+						t.logger.NoCtxWarnf("failed to add remote ICE candidate: %v", err)
+					}
+				}
+				if candidate.Candidate == "" {
+					return
+				}
+			}
+			select {
+			case <-tr.notify:
+			case <-t.closed:
+				return
+			}
+		}
+	})
+}
+
+// AddRemoteCandidate adds a candidate trickled by the remote side. An empty
+// candidate marks the end of the remote's candidates.
+func (t *Transport) AddRemoteCandidate(candidate webrtc.ICECandidateInit) error {
+	if err := t.pc.AddICECandidate(candidate); err != nil {
+		return fmt.Errorf("failed to add ICE candidate: %w", err)
+	}
+	return nil
+}
+
+// waitGathering waits for ICE gathering to complete, or for timeout after
+// which the local description carries the candidates gathered so far.
+func (t *Transport) waitGathering(ctx context.Context, timeout time.Duration) error {
+	gathered := webrtc.GatheringCompletePromise(t.pc)
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+	select {
+	case <-gathered:
+	case <-expired:
+		t.logger.NoCtxWarnf("ICE gathering timed out after %v, signaling the candidates gathered so far", timeout)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return nil
+}
+
+// SupportsTrickle reports whether sdp advertises trickle ICE with
+// a=ice-options, at session or media level.
+func SupportsTrickle(sdp string) bool {
+	for _, line := range strings.Split(sdp, "\n") {
+		options, ok := strings.CutPrefix(strings.TrimSpace(line), "a=ice-options:")
+		if ok && slices.Contains(strings.Fields(options), "trickle") {
+			return true
+		}
+	}
+	return false
+}
+
+// advertiseTrickle adds a=ice-options:trickle to the session section of sdp,
+// which pion leaves out.
+func advertiseTrickle(sdp string) string {
+	if SupportsTrickle(sdp) {
+		return sdp
+	}
+	i := strings.Index(sdp, "\r\nt=")
+	if i < 0 {
+		return sdp
+	}
+	end := strings.Index(sdp[i+2:], "\r\n")
+	if end < 0 {
+		return sdp
+	}
+	at := i + 2 + end + 2
+	return sdp[:at] + "a=ice-options:trickle\r\n" + sdp[at:]
+}
+
+// ParseCandidateFragment returns the candidates of an SDP fragment as sent in
+// application/trickle-ice-sdpfrag bodies (RFC 8840), with a=end-of-candidates
+// as an empty candidate. Other lines are ignored.
+func ParseCandidateFragment(frag string) []webrtc.ICECandidateInit {
+	var candidates []webrtc.ICECandidateInit
+	for _, line := range strings.Split(frag, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "a=candidate:"):
+			candidates = append(candidates, webrtc.ICECandidateInit{Candidate: strings.TrimPrefix(line, "a=")})
+		case line == "a=end-of-candidates":
+			candidates = append(candidates, webrtc.ICECandidateInit{})
+		}
+	}
+	return candidates
+}
+
+// CandidateFragment formats candidates as an SDP fragment, the inverse of
+// ParseCandidateFragment.
+func CandidateFragment(candidates []webrtc.ICECandidateInit) string {
+	var b strings.Builder
+	for _, c := range candidates {
+		if c.Candidate == "" {
+			b.WriteString("a=end-of-candidates\r\n")
+			continue
+		}
+		b.WriteString("a=" + c.Candidate + "\r\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,185 @@
+package rtc
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+	"gitlab.bcc-hyperdev.org/bcc-hyperdev/realtime/shared"
+)
+
+// candidateRelay stands in for WHIP-style signaling: the answerer's
+// candidates are queued and returned in response to the offerer's.
+type candidateRelay struct {
+	queue chan webrtc.ICECandidateInit
+}
+
+func newCandidateRelay() *candidateRelay {
+	return &candidateRelay{queue: make(chan webrtc.ICECandidateInit, 64)}
+}
+
+func (r *candidateRelay) push(ctx context.Context, candidate webrtc.ICECandidateInit) ([]webrtc.ICECandidateInit, error) {
+	r.queue <- candidate
+	return nil, nil
+}
+
+// drain returns the queued candidates, waiting for the end of them when
+// final.
+func (r *candidateRelay) drain(ctx context.Context, final bool) []webrtc.ICECandidateInit {
+	var candidates []webrtc.ICECandidateInit
+	for {
+		select {
+		case c := <-r.queue:
+			candidates = append(candidates, c)
+			if c.Candidate == "" {
+				return candidates
+			}
+			continue
+		default:
+		}
+		if !final {
+			return candidates
+		}
+		select {
+		case c := <-r.queue:
+			candidates = append(candidates, c)
+			if c.Candidate == "" {
+				return candidates
+			}
+		case <-ctx.Done():
+			return candidates
+		}
+	}
+}
+
+func TestTrickle(t *testing.T) {
+	logger := shared.NewLogger()
+	codec, err := NewPCMUCodec()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	connect := func(t *testing.T, dialer, answerer *Transport) {
+		t.Helper()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := dialer.Send(ctx, []byte(`{"type":"ping"}`)); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		select {
+		case event := <-answerer.Events():
+			if string(event) != `{"type":"ping"}` {
+				t.Errorf("Expected ping, got %s", event)
+			}
+		case <-ctx.Done():
+			t.Fatal("Timed out waiting for the event")
+		}
+	}
+
+	t.Run("Trickles", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		relay := newCandidateRelay()
+		var answerer *Transport
+		var offer, answer string
+		signal := func(ctx context.Context, sdp string) (string, error) {
+			offer = sdp
+			var err error
+			answerer, answer, err = Accept(ctx, logger, &Config{Codec: codec, Trickle: relay.push}, sdp)
+			return answer, err
+		}
+		send := func(ctx context.Context, candidate webrtc.ICECandidateInit) ([]webrtc.ICECandidateInit, error) {
+			if err := answerer.AddRemoteCandidate(candidate); err != nil {
+				return nil, err
+			}
+			return relay.drain(ctx, candidate.Candidate == ""), nil
+		}
+		dialer, err := Dial(ctx, logger, &Config{Codec: codec, Trickle: send}, signal)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		defer func() { _ = dialer.Close(context.Background()) }()
+		defer func() { _ = answerer.Close(context.Background()) }()
+
+		if !SupportsTrickle(offer) || !SupportsTrickle(answer) {
+			t.Error("Expected both descriptions to advertise trickle")
+		}
+		if strings.Contains(offer, "a=candidate:") {
+			t.Error("Expected the offer to be sent before gathering")
+		}
+		connect(t, dialer, answerer)
+	})
+
+	t.Run("FallsBack", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		var answerer *Transport
+		offers := 0
+		signal := func(ctx context.Context, sdp string) (string, error) {
+			offers++
+			if SupportsTrickle(sdp) {
+				return "", ErrTrickleUnsupported
+			}
+			if !strings.Contains(sdp, "a=candidate:") {
+				t.Error("Expected the fallback offer to carry candidates")
+			}
+			var answer string
+			var err error
+			answerer, answer, err = Accept(ctx, logger, &Config{Codec: codec, Trickle: newCandidateRelay().push}, sdp)
+			return answer, err
+		}
+		send := func(ctx context.Context, candidate webrtc.ICECandidateInit) ([]webrtc.ICECandidateInit, error) {
+			t.Error("Expected no candidate to be trickled")
+			return nil, nil
+		}
+		dialer, err := Dial(ctx, logger, &Config{Codec: codec, Trickle: send}, signal)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		defer func() { _ = dialer.Close(context.Background()) }()
+		defer func() { _ = answerer.Close(context.Background()) }()
+		if offers != 2 {
+			t.Errorf("Expected 2 offers, got %d", offers)
+		}
+		connect(t, dialer, answerer)
+	})
+
+	t.Run("GatherTimeout", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		var offer string
+		start := time.Now()
+		_, err := Dial(ctx, logger, &Config{
+			Codec:         codec,
+			Ice:           &IceConfig{Servers: []IceServer{{Urls: []string{"stun:127.0.0.1:9"}}}},
+			GatherTimeout: 100 * time.Millisecond,
+		}, func(ctx context.Context, sdp string) (string, error) {
+			offer = sdp
+			return "", context.Canceled
+		})
+		if err == nil {
+			t.Fatal("Expected the signaler error, got nil")
+		}
+		if elapsed := time.Since(start); elapsed > 2*time.Second {
+			t.Errorf("Expected to stop waiting after 100ms, got %v", elapsed)
+		}
+		if !strings.Contains(offer, "a=candidate:") {
+			t.Errorf("Expected the host candidates gathered so far, got %s", offer)
+		}
+	})
+}
+
+func TestCandidateFragment(t *testing.T) {
+	frag := "a=ice-ufrag:abcd\r\na=ice-pwd:secret\r\nm=audio 9 UDP/TLS/RTP/SAVPF 0\r\na=mid:0\r\n" +
+		"a=candidate:1 1 udp 2130706431 192.0.2.1 50000 typ host\r\na=end-of-candidates\r\n"
+	candidates := ParseCandidateFragment(frag)
+	if len(candidates) != 2 || candidates[0].Candidate != "candidate:1 1 udp 2130706431 192.0.2.1 50000 typ host" || candidates[1].Candidate != "" {
+		t.Fatalf("Expected a candidate and the end marker, got %+v", candidates)
+	}
+	want := "a=candidate:1 1 udp 2130706431 192.0.2.1 50000 typ host\r\na=end-of-candidates\r\n"
+	if got := CandidateFragment(candidates); got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
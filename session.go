@@ -0,0 +1,707 @@
+package realtime
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"gitlab.bcc-hyperdev.org/bcc-hyperdev/realtime/audio"
+	"gitlab.bcc-hyperdev.org/bcc-hyperdev/realtime/shared"
+)
+
+var (
+	ErrSessionClosed        = errors.New("session closed")
+	ErrSessionStarted       = errors.New("session already started")
+	ErrTransportRequired    = errors.New("transport is required")
+	ErrSinkNotInterruptible = errors.New("sink does not support interruption")
+	ErrSourceRequired       = errors.New("source is required for local turn detection")
+	ErrSinkNotMonitored     = errors.New("sink does not report playback for echo cancellation")
+	ErrNotPushToTalk        = errors.New("session is not in push-to-talk mode")
+	// ErrEventLoop is returned by Update when called from an event handler,
+	// whose event loop would have to deliver the confirmation.
+	ErrEventLoop = errors.New("called from the event loop")
+)
+
+// TurnDetection selects who decides when the user's turn is over.
+type TurnDetection int
+
+const (
+	// TurnDetectionServer streams all audio and leaves turns to the
+	// session's server side turn detection.
+	TurnDetectionServer TurnDetection = iota
+	// TurnDetectionLocal only streams audio the Detector classifies as
+	// speech and commits the turn once the speech stops.
+	TurnDetectionLocal
+	// TurnDetectionPushToTalk only streams audio between StartTalking and
+	// StopTalking, which commits the turn.
+	TurnDetectionPushToTalk
+)
+
+// preRoll is the audio kept ahead of detected speech, since detection lags
+// the actual onset.
+const preRoll = 300 * time.Millisecond
+
+type EventHandler func(ctx context.Context, event Event)
+
+type SessionConfig struct {
+	// Source is streamed to the transport once the session starts. Optional.
+	Source AudioSource
+	// Sink receives the audio produced by the model. Optional.
+	Sink AudioSink
+	// Interrupt discards the audio queued in the sink when the user starts
+	// speaking and truncates the assistant's item to what was actually
+	// played. The sink must implement InterruptibleSink.
+	Interrupt bool
+	// TurnDetection other than TurnDetectionServer requires a Source and
+	// disables server side turn detection when the session starts.
+	TurnDetection TurnDetection
+	// Detector classifies Source frames for TurnDetectionLocal. Defaults to
+	// an audio.VAD.
+	Detector VoiceDetector
+	// EchoCanceller, e.g. an audio.EchoCanceller, is applied to Source frames
+	// before anything else. The sink must implement MonitoredSink to provide
+	// the reference.
+	EchoCanceller EchoCanceller
+}
+
+// playback is the assistant audio currently being written to the sink.
+type playback struct {
+	itemId       string
+	contentIndex int
+	written      time.Duration
+}
+
+// Tap observes the traffic of a session, e.g. to record it. Methods are
+// called from the session's goroutines and must neither block nor modify
+// their arguments.
+type Tap interface {
+	// InputAudio receives the frames sent to the transport.
+	InputAudio(frame []byte)
+	// OutputAudio receives the frames received from the transport.
+	OutputAudio(frame []byte)
+	ClientEvent(event []byte)
+	ServerEvent(event []byte)
+}
+
+// Session ties a Transport to an audio source and sink and dispatches server
+// events to the registered handlers. A session must be closed with Close to
+// release the transport and the audio devices.
+type Session struct {
+	logger    *shared.Logger
+	transport Transport
+	source    AudioSource
+	sink      AudioSink
+	// interrupter is nil unless interruption is enabled.
+	interrupter   InterruptibleSink
+	turnDetection TurnDetection
+	detector      VoiceDetector
+	echoCanceller EchoCanceller
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	// loopCtx is passed to event handlers, marking the calls made from the
+	// event loop.
+	loopCtx      context.Context
+	sourceCtx    context.Context
+	sourceCancel context.CancelFunc
+	sourceWg     sync.WaitGroup
+	wg           sync.WaitGroup
+
+	mu       sync.Mutex
+	started  bool
+	closed   bool
+	handlers handlers[EventHandler]
+	// taps is replaced rather than modified, so it can be read without
+	// copying.
+	taps      []Tap
+	tapIds    []int
+	nextTapId int
+	pending   shared.Set[string]
+	playing   *playback
+	// config is the session config the server last reported.
+	config json.RawMessage
+	usage  Usage
+	// internalUpdates counts the session's own session.update events not yet
+	// confirmed, and internalReply marks the session.updated being
+	// dispatched as confirming one of them.
+	internalUpdates int
+	internalReply   bool
+
+	// turnMu serializes forwarding source audio with turn changes, so that
+	// no frame is sent after its turn was committed.
+	turnMu  sync.Mutex
+	talking bool
+	held    [][]byte
+
+	// updateMu serializes Update, one session.update in flight at a time.
+	updateMu sync.Mutex
+
+	done      chan struct{}
+	closeOnce sync.Once
+	closeErr  error
+}
+
+func NewSession(logger *shared.Logger, transport Transport, cfg *SessionConfig) (s *Session, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("failed to create session: %w", err)
+		}
+	}()
+	if transport == nil {
+		return nil, ErrTransportRequired
+	}
+	if cfg == nil {
+		cfg = &SessionConfig{}
+	}
+	var interrupter InterruptibleSink
+	if cfg.Interrupt {
+		var ok bool
+		if interrupter, ok = cfg.Sink.(InterruptibleSink); !ok {
+			return nil, ErrSinkNotInterruptible
+		}
+	}
+	if cfg.EchoCanceller != nil {
+		monitored, ok := cfg.Sink.(MonitoredSink)
+		if !ok {
+			return nil, ErrSinkNotMonitored
+		}
+		monitored.OnPlayback(cfg.EchoCanceller.Reference)
+	}
+	detector := cfg.Detector
+	if cfg.TurnDetection != TurnDetectionServer {
+		if cfg.Source == nil {
+			return nil, ErrSourceRequired
+		}
+		if cfg.TurnDetection == TurnDetectionLocal && detector == nil {
+			if detector, err = audio.NewVAD(SampleRate, nil); err != nil {
+				return nil, err
+			}
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	sourceCtx, sourceCancel := context.WithCancel(ctx)
+	s = &Session{
+		logger:        logger,
+		transport:     transport,
+		source:        cfg.Source,
+		sink:          cfg.Sink,
+		interrupter:   interrupter,
+		turnDetection: cfg.TurnDetection,
+		detector:      detector,
+		echoCanceller: cfg.EchoCanceller,
+		ctx:           ctx,
+		cancel:        cancel,
+		sourceCtx:     sourceCtx,
+		sourceCancel:  sourceCancel,
+		pending:       shared.NewSet[string](),
+		done:          make(chan struct{}),
+	}
+	s.loopCtx = context.WithValue(ctx, eventLoopKey{}, s)
+	return s, nil
+}
+
+// OnEvent registers a handler for every server event. Handlers run
+// sequentially on the session's event loop, in registration order.
+func (s *Session) OnEvent(handler EventHandler) (remove func()) {
+	return s.handlers.add(handler)
+}
+
+// AddTap registers tap for the traffic from now on.
+func (s *Session) AddTap(tap Tap) (remove func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := s.nextTapId
+	s.nextTapId++
+	s.taps = append(slices.Clip(s.taps), tap)
+	s.tapIds = append(s.tapIds, id)
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if i := slices.Index(s.tapIds, id); i >= 0 {
+			s.taps = slices.Delete(slices.Clone(s.taps), i, i+1)
+			s.tapIds = slices.Delete(s.tapIds, i, i+1)
+		}
+	}
+}
+
+func (s *Session) tapped() []Tap {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.taps
+}
+
+func (s *Session) Start() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrSessionClosed
+	}
+	if s.started {
+		return ErrSessionStarted
+	}
+	s.started = true
+	s.wg.Add(2)
+	go s.readEvents()
+	go s.playAudio()
+	if s.source != nil {
+		s.sourceWg.Add(1)
+		go s.streamSource()
+	}
+	return nil
+}
+
+// Done is closed once the transport stops delivering events, either because
+// the session was closed or because the remote side hung up.
+func (s *Session) Done() <-chan struct{} {
+	return s.done
+}
+
+func (s *Session) Send(ctx context.Context, event any) error {
+	s.mu.Lock()
+	closed := s.closed
+	s.mu.Unlock()
+	if closed {
+		return ErrSessionClosed
+	}
+	return s.send(ctx, event)
+}
+
+func (s *Session) send(ctx context.Context, event any) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+	if err := s.transport.Send(ctx, data); err != nil {
+		return fmt.Errorf("failed to send event: %w", err)
+	}
+	for _, tap := range s.tapped() {
+		tap.ClientEvent(data)
+	}
+	return nil
+}
+
+// PendingResponses returns the ids of responses the server has created but
+// not yet finished, out-of-band responses aside.
+func (s *Session) PendingResponses() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.pending.ToSlice()
+}
+
+// Config returns the session config the server last reported with
+// session.created or session.updated, or nil before.
+func (s *Session) Config() json.RawMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.config
+}
+
+// Usage returns the tokens used by the responses done so far.
+func (s *Session) Usage() Usage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.usage
+}
+
+// State returns the connection state of a StatefulTransport, and otherwise
+// open or closed.
+func (s *Session) State() string {
+	select {
+	case <-s.done:
+		return "closed"
+	default:
+	}
+	if transport, ok := s.transport.(StatefulTransport); ok {
+		return transport.State()
+	}
+	return "open"
+}
+
+// Close cancels pending responses, stops the source, closes the transport and
+// flushes and closes the sink, in that order. It waits for every goroutine
+// owned by the session to exit or for ctx to be done, whichever comes first.
+// Subsequent calls return the result of the first one.
+func (s *Session) Close(ctx context.Context) error {
+	s.closeOnce.Do(func() {
+		s.closeErr = s.close(ctx)
+	})
+	return s.closeErr
+}
+
+func (s *Session) close(ctx context.Context) (err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("failed to close session: %w", err)
+		}
+	}()
+	var errs []error
+
+	s.mu.Lock()
+	s.closed = true
+	pending := s.pending.ToSlice()
+	s.mu.Unlock()
+
+	for _, id := range pending {
+		if err := s.send(ctx, NewResponseCancelEvent(id)); err != nil {
+			errs = append(errs, fmt.Errorf("failed to cancel response %s: %w", id, err))
+		}
+	}
+
+	s.sourceCancel()
+	if s.source != nil {
+		if err := s.source.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close source: %w", err))
+		}
+	}
+	if err := wait(ctx, &s.sourceWg); err != nil {
+		errs = append(errs, fmt.Errorf("failed to stop source: %w", err))
+	}
+
+	if err := s.transport.Close(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("failed to close transport: %w", err))
+	}
+	if err := wait(ctx, &s.wg); err != nil {
+		errs = append(errs, fmt.Errorf("failed to stop event loop: %w", err))
+	}
+
+	if s.sink != nil {
+		if err := s.sink.Flush(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("failed to flush sink: %w", err))
+		}
+		if err := s.sink.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close sink: %w", err))
+		}
+	}
+
+	s.cancel()
+	s.mu.Lock()
+	if !s.started {
+		close(s.done)
+	}
+	s.mu.Unlock()
+	return errors.Join(errs...)
+}
+
+func (s *Session) readEvents() {
+	defer s.wg.Done()
+	defer close(s.done)
+	for data := range s.transport.Events() {
+		for _, tap := range s.tapped() {
+			tap.ServerEvent(data)
+		}
+		event, err := ParseEvent(data)
+		if err != nil {
+			s.logger.NoCtxWarnf("dropping malformed event: %v", err)
+			continue
+		}
+		s.track(event)
+		if s.interrupter != nil {
+			s.trackPlayback(event)
+		}
+		s.dispatch(event)
+	}
+}
+
+func (s *Session) track(event Event) {
+	switch event.Type {
+	case EventTypeSessionCreated, EventTypeSessionUpdated:
+		var payload SessionUpdatedEvent
+		if err := event.Decode(&payload); err != nil {
+			s.logger.NoCtxWarnf("failed to track session config: %v", err)
+			return
+		}
+		s.mu.Lock()
+		s.config = payload.Session
+		s.internalReply = event.Type == EventTypeSessionUpdated && s.internalUpdates > 0
+		if s.internalReply {
+			s.internalUpdates--
+		}
+		s.mu.Unlock()
+		return
+	case EventTypeError:
+		var payload ErrorEvent
+		if err := event.Decode(&payload); err == nil && strings.HasPrefix(payload.Error.EventId, internalUpdatePrefix) {
+			s.mu.Lock()
+			s.internalUpdates = max(s.internalUpdates-1, 0)
+			s.mu.Unlock()
+		}
+		return
+	case EventTypeResponseCreated, EventTypeResponseDone:
+	default:
+		return
+	}
+	var payload ResponseEvent
+	if err := event.Decode(&payload); err != nil {
+		s.logger.NoCtxWarnf("failed to track response: %v", err)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if event.Type == EventTypeResponseCreated {
+		// Out-of-band responses run alongside the turns, which must not
+		// cancel them.
+		if !IsOutOfBand(payload.Response) {
+			s.pending.Add(payload.Response.Id)
+		}
+	} else {
+		s.pending.Remove(payload.Response.Id)
+		if payload.Response.Usage != nil {
+			s.usage.Add(*payload.Response.Usage)
+		}
+	}
+}
+
+// trackPlayback follows the assistant audio written to the sink and, when the
+// user starts speaking, stops playback and tells the server how much of the
+// item was heard so that its transcript matches. Audio and events travel on
+// separate channels, so the played duration is an estimate to a frame or so.
+func (s *Session) trackPlayback(event Event) {
+	switch event.Type {
+	case EventTypeResponseContentPartAdded:
+		var payload ContentPartEvent
+		if err := event.Decode(&payload); err != nil {
+			s.logger.NoCtxWarnf("failed to track playback: %v", err)
+			return
+		}
+		if payload.Part.Type != "audio" && payload.Part.Type != ContentTypeOutputAudio {
+			return
+		}
+		s.mu.Lock()
+		s.playing = &playback{itemId: payload.ItemId, contentIndex: payload.ContentIndex}
+		s.mu.Unlock()
+	case EventTypeInputAudioBufferSpeechStarted:
+		s.interruptPlayback(s.ctx)
+	}
+}
+
+func (s *Session) interruptPlayback(ctx context.Context) {
+	s.mu.Lock()
+	playing := s.playing
+	s.playing = nil
+	s.mu.Unlock()
+	if playing == nil {
+		return
+	}
+	discarded, err := s.interrupter.Interrupt(ctx)
+	if err != nil {
+		s.logger.NoCtxError(err, "failed to interrupt playback")
+		return
+	}
+	// Nothing was pending, so the whole item was heard.
+	if discarded <= 0 {
+		return
+	}
+	played := max(playing.written-discarded, 0)
+	if err := s.send(ctx, NewConversationItemTruncateEvent(playing.itemId, playing.contentIndex, played)); err != nil {
+		s.logger.NoCtxError(err, "failed to truncate interrupted item")
+	}
+}
+
+// StartTalking opens the user's turn in push-to-talk mode. With Interrupt
+// set it also stops the assistant, as server side turn detection would.
+func (s *Session) StartTalking(ctx context.Context) error {
+	if s.turnDetection != TurnDetectionPushToTalk {
+		return ErrNotPushToTalk
+	}
+	s.turnMu.Lock()
+	defer s.turnMu.Unlock()
+	if s.talking {
+		return nil
+	}
+	if err := s.startTurn(ctx); err != nil {
+		return err
+	}
+	s.talking = true
+	return nil
+}
+
+// StopTalking commits the audio sent since StartTalking and asks for a
+// response.
+func (s *Session) StopTalking(ctx context.Context) error {
+	if s.turnDetection != TurnDetectionPushToTalk {
+		return ErrNotPushToTalk
+	}
+	s.turnMu.Lock()
+	defer s.turnMu.Unlock()
+	if !s.talking {
+		return nil
+	}
+	s.talking = false
+	return s.endTurn(ctx)
+}
+
+// startTurn is called with turnMu held.
+func (s *Session) startTurn(ctx context.Context) error {
+	s.mu.Lock()
+	closed := s.closed
+	pending := s.pending.ToSlice()
+	s.mu.Unlock()
+	if closed {
+		return ErrSessionClosed
+	}
+	if s.interrupter == nil {
+		return nil
+	}
+	s.interruptPlayback(ctx)
+	for _, id := range pending {
+		if err := s.send(ctx, NewResponseCancelEvent(id)); err != nil {
+			return fmt.Errorf("failed to cancel response %s: %w", id, err)
+		}
+	}
+	return nil
+}
+
+// endTurn is called with turnMu held.
+func (s *Session) endTurn(ctx context.Context) error {
+	if err := s.Send(ctx, NewInputAudioBufferCommitEvent()); err != nil {
+		return err
+	}
+	return s.Send(ctx, NewResponseCreateEvent())
+}
+
+func (s *Session) dispatch(event Event) {
+	for _, handler := range s.handlers.snapshot() {
+		handler(s.loopCtx, event)
+	}
+}
+
+func (s *Session) playAudio() {
+	defer s.wg.Done()
+	for frame := range s.transport.Audio() {
+		for _, tap := range s.tapped() {
+			tap.OutputAudio(frame)
+		}
+		if s.sink == nil {
+			continue
+		}
+		if err := s.sink.Write(s.ctx, frame); err != nil {
+			s.logger.NoCtxError(err, "failed to write audio to sink")
+			continue
+		}
+		s.mu.Lock()
+		if s.playing != nil {
+			s.playing.written += AudioDuration(frame)
+		}
+		s.mu.Unlock()
+	}
+}
+
+func (s *Session) streamSource() {
+	defer s.sourceWg.Done()
+	if s.turnDetection != TurnDetectionServer {
+		if err := s.sendInternalUpdate(s.sourceCtx, disableTurnDetection); err != nil {
+			s.logger.NoCtxError(err, "failed to disable server turn detection")
+		}
+	}
+	for {
+		frame, err := s.source.Read(s.sourceCtx)
+		if err != nil {
+			if s.sourceCtx.Err() == nil && !errors.Is(err, io.EOF) {
+				s.logger.NoCtxError(err, "failed to read audio from source")
+			}
+			return
+		}
+		if s.echoCanceller != nil {
+			frame = s.echoCanceller.Cancel(frame)
+		}
+		if err := s.forward(frame); err != nil {
+			if s.sourceCtx.Err() == nil {
+				s.logger.NoCtxError(err, "failed to write audio to transport")
+			}
+			return
+		}
+	}
+}
+
+var disableTurnDetection = map[string]any{
+	"type": "realtime",
+	"audio": map[string]any{
+		"input": map[string]any{"turn_detection": nil},
+	},
+}
+
+// forward sends a source frame to the transport if it belongs to the user's
+// turn.
+func (s *Session) forward(frame []byte) error {
+	ctx := s.sourceCtx
+	s.turnMu.Lock()
+	defer s.turnMu.Unlock()
+	switch s.turnDetection {
+	case TurnDetectionPushToTalk:
+		if !s.talking {
+			return nil
+		}
+	case TurnDetectionLocal:
+		speaking := s.detector.Detect(frame)
+		switch {
+		case speaking && !s.talking:
+			if err := s.startTurn(ctx); err != nil {
+				s.logger.NoCtxError(err, "failed to start turn")
+			}
+			s.talking = true
+			for _, held := range s.held {
+				if err := s.writeAudio(ctx, held); err != nil {
+					return err
+				}
+			}
+			s.held = nil
+		case !speaking && s.talking:
+			s.talking = false
+			// The frame ending speech holds the tail of the utterance.
+			if err := s.writeAudio(ctx, frame); err != nil {
+				return err
+			}
+			if err := s.endTurn(ctx); err != nil {
+				s.logger.NoCtxError(err, "failed to commit turn")
+			}
+			return nil
+		case !speaking:
+			s.hold(frame)
+			return nil
+		}
+	}
+	return s.writeAudio(ctx, frame)
+}
+
+func (s *Session) writeAudio(ctx context.Context, frame []byte) error {
+	if err := s.transport.WriteAudio(ctx, frame); err != nil {
+		return err
+	}
+	for _, tap := range s.tapped() {
+		tap.InputAudio(frame)
+	}
+	return nil
+}
+
+// hold keeps the last preRoll of audio before speech is detected.
+func (s *Session) hold(frame []byte) {
+	s.held = append(s.held, frame)
+	var total time.Duration
+	for i := len(s.held) - 1; i >= 0; i-- {
+		total += AudioDuration(s.held[i])
+		if total > preRoll {
+			s.held = s.held[i+1:]
+			return
+		}
+	}
+}
+
+func wait(ctx context.Context, wg *sync.WaitGroup) error {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,650 @@
+package realtime
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"gitlab.bcc-hyperdev.org/bcc-hyperdev/realtime/shared"
+	"go.uber.org/goleak"
+)
+
+func TestMain(m *testing.M) {
+	goleak.VerifyTestMain(m)
+}
+
+type fakeTransport struct {
+	events chan []byte
+	audio  chan []byte
+
+	mu       sync.Mutex
+	sent     [][]byte
+	received [][]byte
+	closed   bool
+}
+
+func newFakeTransport() *fakeTransport {
+	return &fakeTransport{
+		events: make(chan []byte, 16),
+		audio:  make(chan []byte, 16),
+	}
+}
+
+func (t *fakeTransport) Send(ctx context.Context, event []byte) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return errors.New("closed")
+	}
+	t.sent = append(t.sent, event)
+	return nil
+}
+
+func (t *fakeTransport) Events() <-chan []byte { return t.events }
+
+func (t *fakeTransport) WriteAudio(ctx context.Context, frame []byte) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return errors.New("closed")
+	}
+	t.received = append(t.received, frame)
+	return nil
+}
+
+func (t *fakeTransport) Audio() <-chan []byte { return t.audio }
+
+func (t *fakeTransport) Close(ctx context.Context) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.closed {
+		t.closed = true
+		close(t.events)
+		close(t.audio)
+	}
+	return nil
+}
+
+// fakeSource blocks like a microphone until it is closed or cancelled.
+type fakeSource struct {
+	frames chan []byte
+	closed chan struct{}
+	once   sync.Once
+}
+
+func newFakeSource() *fakeSource {
+	return &fakeSource{frames: make(chan []byte), closed: make(chan struct{})}
+}
+
+func (s *fakeSource) Read(ctx context.Context) ([]byte, error) {
+	select {
+	case frame := <-s.frames:
+		return frame, nil
+	case <-s.closed:
+		return nil, errors.New("closed")
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (s *fakeSource) Close() error {
+	s.once.Do(func() { close(s.closed) })
+	return nil
+}
+
+type fakeSink struct {
+	mu      sync.Mutex
+	frames  [][]byte
+	calls   []string
+	written chan struct{}
+}
+
+func newFakeSink() *fakeSink {
+	return &fakeSink{written: make(chan struct{}, 16)}
+}
+
+func (s *fakeSink) Write(ctx context.Context, frame []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.frames = append(s.frames, frame)
+	s.written <- struct{}{}
+	return nil
+}
+
+func (s *fakeSink) Flush(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls = append(s.calls, "flush")
+	return nil
+}
+
+func (s *fakeSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls = append(s.calls, "close")
+	return nil
+}
+
+func newTestSession(t *testing.T) (*Session, *fakeTransport, *fakeSource, *fakeSink) {
+	t.Helper()
+	transport := newFakeTransport()
+	source := newFakeSource()
+	sink := newFakeSink()
+	session, err := NewSession(shared.NewLogger(), transport, &SessionConfig{Source: source, Sink: sink})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	return session, transport, source, sink
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for condition")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestSessionClose(t *testing.T) {
+	t.Run("CancelsPendingResponses", func(t *testing.T) {
+		session, transport, _, _ := newTestSession(t)
+		if err := session.Start(); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		transport.events <- []byte(`{"type":"response.created","response":{"id":"resp_1"}}`)
+		transport.events <- []byte(`{"type":"response.created","response":{"id":"resp_2"}}`)
+		transport.events <- []byte(`{"type":"response.done","response":{"id":"resp_2"}}`)
+		waitFor(t, func() bool {
+			pending := session.PendingResponses()
+			return len(pending) == 1 && pending[0] == "resp_1"
+		})
+
+		if err := session.Close(context.Background()); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		transport.mu.Lock()
+		defer transport.mu.Unlock()
+		if len(transport.sent) != 1 {
+			t.Fatalf("Expected 1 cancel event, got %d", len(transport.sent))
+		}
+		var cancel ResponseCancelEvent
+		_ = json.Unmarshal(transport.sent[0], &cancel)
+		if cancel.Type != EventTypeResponseCancel || cancel.ResponseId != "resp_1" {
+			t.Errorf("Expected response.cancel for resp_1, got %s", transport.sent[0])
+		}
+	})
+
+	t.Run("StopsSourceAndFlushesSink", func(t *testing.T) {
+		session, transport, source, sink := newTestSession(t)
+		if err := session.Start(); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		source.frames <- []byte{1, 2}
+		transport.audio <- []byte{3, 4}
+		<-sink.written
+
+		if err := session.Close(context.Background()); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		select {
+		case <-source.closed:
+		default:
+			t.Error("Expected source to be closed")
+		}
+		if !transport.closed {
+			t.Error("Expected transport to be closed")
+		}
+		if len(transport.received) != 1 {
+			t.Errorf("Expected 1 frame sent to transport, got %d", len(transport.received))
+		}
+		if len(sink.calls) != 2 || sink.calls[0] != "flush" || sink.calls[1] != "close" {
+			t.Errorf("Expected sink to be flushed then closed, got %v", sink.calls)
+		}
+		select {
+		case <-session.Done():
+		default:
+			t.Error("Expected Done to be closed")
+		}
+	})
+
+	t.Run("WithoutStart", func(t *testing.T) {
+		session, transport, _, sink := newTestSession(t)
+		if err := session.Close(context.Background()); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if !transport.closed {
+			t.Error("Expected transport to be closed")
+		}
+		if len(sink.calls) != 2 {
+			t.Errorf("Expected sink to be flushed and closed, got %v", sink.calls)
+		}
+		<-session.Done()
+	})
+
+	t.Run("Idempotent", func(t *testing.T) {
+		session, _, _, sink := newTestSession(t)
+		if err := session.Start(); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		for range 3 {
+			if err := session.Close(context.Background()); err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+		}
+		if len(sink.calls) != 2 {
+			t.Errorf("Expected a single flush and close, got %v", sink.calls)
+		}
+	})
+
+	t.Run("RejectsUseAfterClose", func(t *testing.T) {
+		session, _, _, _ := newTestSession(t)
+		_ = session.Close(context.Background())
+		if err := session.Send(context.Background(), NewResponseCancelEvent("")); !errors.Is(err, ErrSessionClosed) {
+			t.Errorf("Expected ErrSessionClosed, got %v", err)
+		}
+		if err := session.Start(); !errors.Is(err, ErrSessionClosed) {
+			t.Errorf("Expected ErrSessionClosed, got %v", err)
+		}
+	})
+}
+
+func TestSessionOnEvent(t *testing.T) {
+	session, transport, _, _ := newTestSession(t)
+	defer func() { _ = session.Close(context.Background()) }()
+
+	var mu sync.Mutex
+	var types []string
+	remove := session.OnEvent(func(ctx context.Context, event Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		types = append(types, event.Type)
+	})
+	if err := session.Start(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	transport.events <- []byte(`{"type":"session.created"}`)
+	transport.events <- []byte(`not json`)
+	transport.events <- []byte(`{"type":"response.created","response":{"id":"resp_1"}}`)
+	waitFor(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(types) == 2
+	})
+	remove()
+	transport.events <- []byte(`{"type":"response.done","response":{"id":"resp_1"}}`)
+	waitFor(t, func() bool { return len(session.PendingResponses()) == 0 })
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(types) != 2 || types[0] != EventTypeSessionCreated || types[1] != EventTypeResponseCreated {
+		t.Errorf("Expected [session.created response.created], got %v", types)
+	}
+}
+
+type interruptibleSink struct {
+	*fakeSink
+	discarded time.Duration
+}
+
+func (s *interruptibleSink) Interrupt(ctx context.Context) (time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls = append(s.calls, "interrupt")
+	return s.discarded, nil
+}
+
+func TestSessionInterrupt(t *testing.T) {
+	t.Run("TruncatesPlayedAudio", func(t *testing.T) {
+		transport := newFakeTransport()
+		sink := &interruptibleSink{fakeSink: newFakeSink(), discarded: 100 * time.Millisecond}
+		session, err := NewSession(shared.NewLogger(), transport, &SessionConfig{Sink: sink, Interrupt: true})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		defer func() { _ = session.Close(context.Background()) }()
+		if err := session.Start(); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		transport.events <- []byte(`{"type":"response.content_part.added","item_id":"item_1","content_index":0,"part":{"type":"audio"}}`)
+		waitFor(t, func() bool {
+			session.mu.Lock()
+			defer session.mu.Unlock()
+			return session.playing != nil
+		})
+		// Three frames of 100ms each.
+		for range 3 {
+			transport.audio <- make([]byte, SampleRate/10*BytesPerSample)
+			<-sink.written
+		}
+		waitFor(t, func() bool {
+			session.mu.Lock()
+			defer session.mu.Unlock()
+			return session.playing.written == 300*time.Millisecond
+		})
+		transport.events <- []byte(`{"type":"input_audio_buffer.speech_started"}`)
+		waitFor(t, func() bool {
+			transport.mu.Lock()
+			defer transport.mu.Unlock()
+			return len(transport.sent) == 1
+		})
+
+		transport.mu.Lock()
+		defer transport.mu.Unlock()
+		var truncate ConversationItemTruncateEvent
+		_ = json.Unmarshal(transport.sent[0], &truncate)
+		if truncate.Type != EventTypeConversationItemTruncate || truncate.ItemId != "item_1" || truncate.AudioEndMs != 200 {
+			t.Errorf("Expected item_1 truncated at 200ms, got %s", transport.sent[0])
+		}
+	})
+
+	t.Run("NothingPlaying", func(t *testing.T) {
+		transport := newFakeTransport()
+		sink := &interruptibleSink{fakeSink: newFakeSink()}
+		session, err := NewSession(shared.NewLogger(), transport, &SessionConfig{Sink: sink, Interrupt: true})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if err := session.Start(); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		transport.events <- []byte(`{"type":"input_audio_buffer.speech_started"}`)
+		_ = session.Close(context.Background())
+		if len(transport.sent) != 0 {
+			t.Errorf("Expected no events sent, got %d", len(transport.sent))
+		}
+		if len(sink.calls) != 2 || sink.calls[0] != "flush" {
+			t.Errorf("Expected no interrupt, got %v", sink.calls)
+		}
+	})
+
+	t.Run("RequiresInterruptibleSink", func(t *testing.T) {
+		_, err := NewSession(shared.NewLogger(), newFakeTransport(), &SessionConfig{Sink: newFakeSink(), Interrupt: true})
+		if !errors.Is(err, ErrSinkNotInterruptible) {
+			t.Errorf("Expected ErrSinkNotInterruptible, got %v", err)
+		}
+	})
+}
+
+func sentTypes(transport *fakeTransport) []string {
+	transport.mu.Lock()
+	defer transport.mu.Unlock()
+	types := make([]string, len(transport.sent))
+	for i, data := range transport.sent {
+		event, _ := ParseEvent(data)
+		types[i] = event.Type
+	}
+	return types
+}
+
+func receivedFrames(transport *fakeTransport) [][]byte {
+	transport.mu.Lock()
+	defer transport.mu.Unlock()
+	return append([][]byte(nil), transport.received...)
+}
+
+// scriptedDetector classifies frames by their first byte.
+type scriptedDetector struct{}
+
+func (scriptedDetector) Detect(frame []byte) bool { return frame[0] == 1 }
+
+func TestSessionTurnDetection(t *testing.T) {
+	t.Run("PushToTalk", func(t *testing.T) {
+		transport := newFakeTransport()
+		source := newFakeSource()
+		session, err := NewSession(shared.NewLogger(), transport, &SessionConfig{Source: source, TurnDetection: TurnDetectionPushToTalk})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		defer func() { _ = session.Close(context.Background()) }()
+		if err := session.Start(); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		ctx := context.Background()
+
+		// The source is read sequentially, so once the second frame is taken
+		// the first one has been dropped.
+		source.frames <- []byte{0, 0}
+		source.frames <- []byte{0, 1}
+		if err := session.StartTalking(ctx); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		source.frames <- []byte{1, 0}
+		source.frames <- []byte{2, 0}
+		waitFor(t, func() bool {
+			got := receivedFrames(transport)
+			return len(got) > 0 && got[len(got)-1][0] == 2
+		})
+		if err := session.StopTalking(ctx); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		source.frames <- []byte{3, 0}
+		source.frames <- []byte{3, 1}
+
+		talked := 0
+		for _, f := range receivedFrames(transport) {
+			if (f[0] == 0 && f[1] == 0) || f[0] == 3 {
+				t.Errorf("Expected only the frames while talking, got %v", f)
+			}
+			if f[0] == 1 || f[0] == 2 {
+				talked++
+			}
+		}
+		if talked != 2 {
+			t.Errorf("Expected 2 frames while talking, got %d", talked)
+		}
+		got := sentTypes(transport)
+		if len(got) != 3 || got[0] != EventTypeSessionUpdate || got[1] != EventTypeInputAudioBufferCommit || got[2] != EventTypeResponseCreate {
+			t.Errorf("Expected [session.update input_audio_buffer.commit response.create], got %v", got)
+		}
+	})
+
+	t.Run("Local", func(t *testing.T) {
+		transport := newFakeTransport()
+		source := newFakeSource()
+		session, err := NewSession(shared.NewLogger(), transport, &SessionConfig{
+			Source:        source,
+			TurnDetection: TurnDetectionLocal,
+			Detector:      scriptedDetector{},
+		})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		defer func() { _ = session.Close(context.Background()) }()
+		if err := session.Start(); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		// 200ms frames: the 300ms pre-roll keeps the last one of silence.
+		frame := func(speech byte, id byte) []byte {
+			f := make([]byte, SampleRate/5*BytesPerSample)
+			f[0], f[1] = speech, id
+			return f
+		}
+		for i, speech := range []byte{0, 0, 0, 1, 1, 0, 0} {
+			source.frames <- frame(speech, byte(i))
+		}
+		waitFor(t, func() bool { return len(sentTypes(transport)) == 3 })
+
+		var ids []byte
+		for _, f := range receivedFrames(transport) {
+			ids = append(ids, f[1])
+		}
+		// The frame ending speech is sent before the commit.
+		if len(ids) != 4 || ids[0] != 2 || ids[1] != 3 || ids[2] != 4 || ids[3] != 5 {
+			t.Errorf("Expected frames [2 3 4 5], got %v", ids)
+		}
+		got := sentTypes(transport)
+		if got[1] != EventTypeInputAudioBufferCommit || got[2] != EventTypeResponseCreate {
+			t.Errorf("Expected a commit and a response, got %v", got)
+		}
+	})
+
+	t.Run("Validation", func(t *testing.T) {
+		if _, err := NewSession(shared.NewLogger(), newFakeTransport(), &SessionConfig{TurnDetection: TurnDetectionLocal}); !errors.Is(err, ErrSourceRequired) {
+			t.Errorf("Expected ErrSourceRequired, got %v", err)
+		}
+		session, _, _, _ := newTestSession(t)
+		defer func() { _ = session.Close(context.Background()) }()
+		if err := session.StartTalking(context.Background()); !errors.Is(err, ErrNotPushToTalk) {
+			t.Errorf("Expected ErrNotPushToTalk, got %v", err)
+		}
+	})
+}
+
+type monitoredSink struct {
+	*fakeSink
+	onPlayback func(frame []byte)
+}
+
+func (s *monitoredSink) OnPlayback(fn func(frame []byte)) { s.onPlayback = fn }
+
+// subtractingCanceller removes the last reference frame from the next capture.
+type subtractingCanceller struct {
+	mu        sync.Mutex
+	reference []byte
+}
+
+func (c *subtractingCanceller) Reference(frame []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.reference = frame
+}
+
+func (c *subtractingCanceller) Cancel(frame []byte) []byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	out := make([]byte, len(frame))
+	for i := range frame {
+		out[i] = frame[i]
+		if i < len(c.reference) {
+			out[i] -= c.reference[i]
+		}
+	}
+	return out
+}
+
+func TestSessionEchoCancellation(t *testing.T) {
+	t.Run("CancelsSourceFrames", func(t *testing.T) {
+		transport := newFakeTransport()
+		source := newFakeSource()
+		sink := &monitoredSink{fakeSink: newFakeSink()}
+		canceller := &subtractingCanceller{}
+		session, err := NewSession(shared.NewLogger(), transport, &SessionConfig{Source: source, Sink: sink, EchoCanceller: canceller})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		defer func() { _ = session.Close(context.Background()) }()
+		if err := session.Start(); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if sink.onPlayback == nil {
+			t.Fatal("Expected the canceller to be registered with the sink")
+		}
+		sink.onPlayback([]byte{3, 3})
+		source.frames <- []byte{5, 4}
+		waitFor(t, func() bool { return len(receivedFrames(transport)) == 1 })
+		if got := receivedFrames(transport)[0]; got[0] != 2 || got[1] != 1 {
+			t.Errorf("Expected [2 1], got %v", got)
+		}
+	})
+
+	t.Run("RequiresMonitoredSink", func(t *testing.T) {
+		_, err := NewSession(shared.NewLogger(), newFakeTransport(), &SessionConfig{Sink: newFakeSink(), EchoCanceller: &subtractingCanceller{}})
+		if !errors.Is(err, ErrSinkNotMonitored) {
+			t.Errorf("Expected ErrSinkNotMonitored, got %v", err)
+		}
+	})
+}
+
+type recordingTap struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (r *recordingTap) add(kind string, data []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, kind+":"+string(data))
+}
+
+func (r *recordingTap) InputAudio(frame []byte)  { r.add("input", frame) }
+func (r *recordingTap) OutputAudio(frame []byte) { r.add("output", frame) }
+func (r *recordingTap) ClientEvent(event []byte) { r.add("client", event) }
+func (r *recordingTap) ServerEvent(event []byte) { r.add("server", event) }
+
+func (r *recordingTap) seen() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.events...)
+}
+
+func TestSessionAddTap(t *testing.T) {
+	session, transport, source, _ := newTestSession(t)
+	defer func() { _ = session.Close(context.Background()) }()
+	tap := &recordingTap{}
+	remove := session.AddTap(tap)
+	if err := session.Start(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	source.frames <- []byte("in")
+	waitFor(t, func() bool { return len(tap.seen()) == 1 })
+	transport.audio <- []byte("out")
+	waitFor(t, func() bool { return len(tap.seen()) == 2 })
+	transport.events <- []byte(`{"type":"session.created"}`)
+	waitFor(t, func() bool { return len(tap.seen()) == 3 })
+	if err := session.Send(context.Background(), NewInputAudioBufferCommitEvent()); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	want := []string{"input:in", "output:out", `server:{"type":"session.created"}`, `client:{"type":"input_audio_buffer.commit"}`}
+	got := tap.seen()
+	if len(got) != len(want) {
+		t.Fatalf("Expected %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Expected %s, got %s", want[i], got[i])
+		}
+	}
+
+	remove()
+	source.frames <- []byte("late")
+	waitFor(t, func() bool { return len(receivedFrames(transport)) == 2 })
+	if got := tap.seen(); len(got) != len(want) {
+		t.Errorf("Expected no traffic after removal, got %v", got[len(want):])
+	}
+}
+
+func TestSessionTracking(t *testing.T) {
+	session, transport, _, _ := newTestSession(t)
+	if err := session.Start(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if session.Config() != nil || session.State() != "open" {
+		t.Errorf("Expected an open session without config, got %s and %s", session.Config(), session.State())
+	}
+	transport.events <- []byte(`{"type":"session.created","session":{"voice":"alloy"}}`)
+	transport.events <- []byte(`{"type":"session.updated","session":{"voice":"marin"}}`)
+	for range 2 {
+		transport.events <- []byte(`{"type":"response.done","response":{"id":"resp_1","status":"completed","usage":{"total_tokens":30,"input_tokens":10,"output_tokens":20,` +
+			`"input_token_details":{"cached_tokens":4,"text_tokens":6,"audio_tokens":4},"output_token_details":{"text_tokens":5,"audio_tokens":15}}}}`)
+	}
+	waitFor(t, func() bool { return session.Usage().TotalTokens == 60 })
+	if string(session.Config()) != `{"voice":"marin"}` {
+		t.Errorf("Expected the updated config, got %s", session.Config())
+	}
+	usage := session.Usage()
+	if usage.InputTokens != 20 || usage.InputTokenDetails.CachedTokens != 8 || usage.OutputTokenDetails.AudioTokens != 30 {
+		t.Errorf("Expected the usage of both responses, got %+v", usage)
+	}
+	_ = session.Close(context.Background())
+	if session.State() != "closed" {
+		t.Errorf("Expected closed, got %s", session.State())
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 )
 
 func getenv_(key string, required bool, defaultValue []string) (string, error) {
@@ -88,6 +90,13 @@ func GetenvUint(key string, required bool, defaultValue ...string) (uint, error)
 	})
 }
 
+func GetenvUint16(key string, required bool, defaultValue ...string) (uint16, error) {
+	return getenv(key, required, defaultValue, func(s string) (uint16, error) {
+		v, err := strconv.ParseUint(s, 10, 16)
+		return uint16(v), err
+	})
+}
+
 func GetenvUint32(key string, required bool, defaultValue ...string) (uint32, error) {
 	return getenv(key, required, defaultValue, func(s string) (uint32, error) {
 		v, err := strconv.ParseUint(s, 10, 32)
@@ -113,3 +122,25 @@ func GetenvFloat64(key string, required bool, defaultValue ...string) (float64,
 		return strconv.ParseFloat(s, 64)
 	})
 }
+
+// GetenvStrings splits a comma-separated value, dropping empty items.
+func GetenvStrings(key string, required bool, defaultValue ...string) ([]string, error) {
+	return getenv(key, required, defaultValue, func(s string) ([]string, error) {
+		var values []string
+		for _, v := range strings.Split(s, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				values = append(values, v)
+			}
+		}
+		return values, nil
+	})
+}
+
+func GetenvDuration(key string, required bool, defaultValue ...string) (time.Duration, error) {
+	return getenv(key, required, defaultValue, func(s string) (time.Duration, error) {
+		if s == "" {
+			return 0, nil
+		}
+		return time.ParseDuration(s)
+	})
+}
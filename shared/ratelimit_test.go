@@ -0,0 +1,47 @@
+package shared
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Unix(0, 0)
+	limiter := NewRateLimiter(1, 2)
+	limiter.now = func() time.Time { return now }
+
+	t.Run("Burst", func(t *testing.T) {
+		for i := range 2 {
+			if ok, _ := limiter.Allow("a"); !ok {
+				t.Errorf("Expected request %d to be allowed", i)
+			}
+		}
+		ok, retryAfter := limiter.Allow("a")
+		if ok {
+			t.Error("Expected request to be limited")
+		}
+		if retryAfter != time.Second {
+			t.Errorf("Expected retry after 1s, got %v", retryAfter)
+		}
+	})
+
+	t.Run("KeysAreIndependent", func(t *testing.T) {
+		if ok, _ := limiter.Allow("b"); !ok {
+			t.Error("Expected request for another key to be allowed")
+		}
+	})
+
+	t.Run("Refill", func(t *testing.T) {
+		now = now.Add(1500 * time.Millisecond)
+		if ok, _ := limiter.Allow("a"); !ok {
+			t.Error("Expected request to be allowed after refill")
+		}
+		ok, retryAfter := limiter.Allow("a")
+		if ok {
+			t.Error("Expected request to be limited")
+		}
+		if retryAfter != 500*time.Millisecond {
+			t.Errorf("Expected retry after 500ms, got %v", retryAfter)
+		}
+	})
+}
@@ -0,0 +1,394 @@
+package sip
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"gitlab.bcc-hyperdev.org/bcc-hyperdev/realtime"
+)
+
+const (
+	// RFC 3261 timers for retransmitting the 2xx until the ACK arrives.
+	timerT1      = 500 * time.Millisecond
+	timerT2      = 4 * time.Second
+	ackTimeout   = 64 * timerT1
+	closeTimeout = 5 * time.Second
+)
+
+// Call is an inbound SIP call bridged to a realtime session.
+type Call struct {
+	// Id is the SIP Call-ID.
+	Id        string
+	From      string
+	To        string
+	CreatedAt time.Time
+
+	ua       *UserAgent
+	invite   *Message
+	remote   *net.UDPAddr
+	localTag string
+	media    *media
+
+	mu sync.Mutex
+	// cseq is the sequence number of the last INVITE, initial or re-INVITE,
+	// and response the last response sent to it.
+	cseq      int
+	response  *Message
+	body      []byte
+	session   *realtime.Session
+	stream    *rtpStream
+	answered  bool
+	canceled  bool
+	hangingUp bool
+
+	ack     chan struct{}
+	ackOnce sync.Once
+	ended   chan struct{}
+	endOnce sync.Once
+	done    chan struct{}
+}
+
+func newCall(ua *UserAgent, invite *Message, remote *net.UDPAddr, m *media) *Call {
+	cseq, _ := invite.CSeq()
+	return &Call{
+		Id:        invite.Get("Call-ID"),
+		From:      uri(invite.Get("From")),
+		To:        uri(invite.Get("To")),
+		CreatedAt: time.Now(),
+		ua:        ua,
+		invite:    invite,
+		remote:    remote,
+		localTag:  randomToken(),
+		media:     m,
+		cseq:      cseq,
+		ack:       make(chan struct{}),
+		ended:     make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+}
+
+// Session is nil until the call is answered.
+func (c *Call) Session() *realtime.Session {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.session
+}
+
+// Codec is the negotiated G.711 variant, PCMU or PCMA.
+func (c *Call) Codec() string {
+	return codecName(c.media.payloadType)
+}
+
+// Done is closed once the call is torn down.
+func (c *Call) Done() <-chan struct{} {
+	return c.done
+}
+
+// Hangup sends a BYE and waits for the session to close.
+func (c *Call) Hangup(ctx context.Context) error {
+	c.terminate(true)
+	select {
+	case <-c.done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("failed to hang up call %s: %w", c.Id, ctx.Err())
+	}
+}
+
+func (c *Call) terminate(hangup bool) {
+	c.endOnce.Do(func() {
+		c.mu.Lock()
+		c.hangingUp = hangup
+		c.mu.Unlock()
+		close(c.ended)
+	})
+}
+
+func (c *Call) cancel() {
+	c.mu.Lock()
+	answered := c.answered
+	if !answered {
+		c.canceled = true
+	}
+	c.mu.Unlock()
+	if !answered {
+		c.terminate(false)
+	}
+}
+
+func (c *Call) acked() {
+	c.ackOnce.Do(func() { close(c.ack) })
+}
+
+// invited handles an INVITE for the call's Call-ID: a retransmission of the
+// last INVITE gets its last response again, and a re-INVITE within the
+// dialog is answered.
+func (c *Call) invited(req *Message, addr *net.UDPAddr) {
+	seq, _ := req.CSeq()
+	c.mu.Lock()
+	last := c.cseq
+	c.mu.Unlock()
+	switch {
+	case seq == last:
+		c.retransmit()
+	case seq < last:
+		c.ua.respond(req, addr, 500, "Server Internal Error")
+	case param(req.Get("To"), "tag") != c.localTag:
+		c.ua.respond(req, addr, 481, "Call/Transaction Does Not Exist")
+	default:
+		c.reinvite(req, addr, seq)
+	}
+}
+
+// reinvite answers a re-INVITE. Media cannot be renegotiated, so only session
+// refreshes keeping the codec and remote address are accepted, with the
+// original answer; holds and other changes are rejected, which leaves the
+// call as it was.
+func (c *Call) reinvite(req *Message, addr *net.UDPAddr, seq int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var res *Message
+	if c.response == nil || c.response.StatusCode < 200 {
+		// The initial INVITE is still being answered.
+		res = NewResponse(req, 491, "Request Pending")
+	} else if m, err := negotiate(req.Body); len(req.Body) > 0 &&
+		(err != nil || m.payloadType != c.media.payloadType || m.remote.String() != c.media.remote.String() || m.held()) {
+		res = NewResponse(req, 488, "Not Acceptable Here")
+	} else {
+		res = NewResponse(req, 200, "OK")
+		res.Add("Contact", fmt.Sprintf("<sip:%s>", c.ua.hostport()))
+		res.Add("Allow", allowedMethods)
+		res.Add("Content-Type", "application/sdp")
+		res.Body = c.body
+	}
+	c.cseq, c.response = seq, res
+	c.ua.send(res, addr)
+}
+
+// retransmit sends the last response to the last INVITE again.
+func (c *Call) retransmit() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.response != nil {
+		c.ua.send(c.response, c.remote)
+	}
+}
+
+// respond sends res to the initial INVITE. Responses are sent under mu, as
+// sending stamps them and they are retransmitted concurrently.
+func (c *Call) respond(res *Message) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.response = res
+	c.ua.send(res, c.remote)
+}
+
+func (c *Call) run() {
+	defer c.ua.remove(c)
+	defer close(c.done)
+
+	if err := c.answer(); err != nil {
+		c.ua.logger.NoCtxErrorf(err, "failed to answer call %s", c.Id)
+		return
+	}
+	if c.ua.cfg.OnCallStart != nil {
+		c.ua.cfg.OnCallStart(c)
+	}
+	c.awaitAck()
+
+	select {
+	case <-c.session.Done():
+		c.terminate(true)
+	case <-c.ended:
+	}
+	c.teardown()
+	if c.ua.cfg.OnCallEnd != nil {
+		c.ua.cfg.OnCallEnd(c)
+	}
+}
+
+func (c *Call) answer() (err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.ua.cfg.SetupTimeout)
+	defer cancel()
+	go func() {
+		select {
+		case <-c.ended:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	var (
+		conn      *net.UDPConn
+		transport realtime.Transport
+		stream    *rtpStream
+		session   *realtime.Session
+	)
+	defer func() {
+		if err == nil {
+			return
+		}
+		c.mu.Lock()
+		canceled := c.canceled
+		c.session, c.stream = nil, nil
+		c.mu.Unlock()
+		if canceled {
+			c.final(487, "Request Terminated")
+		} else {
+			c.final(503, "Service Unavailable")
+		}
+		closeCtx, cancel := context.WithTimeout(context.Background(), closeTimeout)
+		defer cancel()
+		switch {
+		case session != nil:
+			_ = session.Close(closeCtx)
+		case transport != nil:
+			_ = transport.Close(closeCtx)
+		}
+		switch {
+		case stream != nil:
+			stream.close()
+		case conn != nil:
+			_ = conn.Close()
+		}
+	}()
+
+	conn, err = net.ListenUDP("udp", &net.UDPAddr{IP: c.ua.mediaIP})
+	if err != nil {
+		return fmt.Errorf("failed to bind RTP socket: %w", err)
+	}
+	transport, err = c.ua.cfg.Upstream(ctx, c)
+	if err != nil {
+		return fmt.Errorf("failed to open upstream: %w", err)
+	}
+	stream, err = newRTPStream(c.ua.logger, conn, c.media, c.dtmf)
+	if err != nil {
+		return err
+	}
+	session, err = realtime.NewSession(c.ua.logger, transport, &realtime.SessionConfig{
+		Source:    streamSource{stream},
+		Sink:      streamSink{stream},
+		Interrupt: true,
+	})
+	if err != nil {
+		return err
+	}
+	body, err := answer(conn.LocalAddr().(*net.UDPAddr), c.media, uint64(c.CreatedAt.Unix()))
+	if err != nil {
+		return fmt.Errorf("failed to create SDP answer: %w", err)
+	}
+
+	c.mu.Lock()
+	if c.canceled {
+		c.mu.Unlock()
+		return fmt.Errorf("call canceled")
+	}
+	c.session, c.stream, c.answered = session, stream, true
+	c.mu.Unlock()
+
+	stream.start()
+	if err = session.Start(); err != nil {
+		return err
+	}
+	res := c.newResponse(200, "OK")
+	res.Add("Contact", fmt.Sprintf("<sip:%s>", c.ua.hostport()))
+	res.Add("Allow", allowedMethods)
+	res.Add("Content-Type", "application/sdp")
+	res.Body = body
+	c.mu.Lock()
+	c.body = body
+	c.mu.Unlock()
+	c.respond(res)
+	return nil
+}
+
+// final sends a final non-2xx response to the INVITE.
+func (c *Call) final(code int, reason string) {
+	c.respond(c.newResponse(code, reason))
+}
+
+func (c *Call) newResponse(code int, reason string) *Message {
+	res := NewResponse(c.invite, code, reason)
+	if to := res.Get("To"); param(to, "tag") == "" {
+		res.Set("To", to+";tag="+c.localTag)
+	}
+	return res
+}
+
+func (c *Call) awaitAck() {
+	interval := timerT1
+	timeout := time.NewTimer(ackTimeout)
+	defer timeout.Stop()
+	for {
+		select {
+		case <-c.ack:
+			return
+		case <-c.ended:
+			return
+		case <-timeout.C:
+			c.ua.logger.NoCtxWarnf("no ACK for call %s", c.Id)
+			c.terminate(true)
+			return
+		case <-time.After(interval):
+			c.retransmit()
+			interval = min(2*interval, timerT2)
+		}
+	}
+}
+
+func (c *Call) teardown() {
+	c.mu.Lock()
+	hangup := c.hangingUp
+	c.mu.Unlock()
+	if hangup {
+		c.bye()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), closeTimeout)
+	defer cancel()
+	if err := c.session.Close(ctx); err != nil {
+		c.ua.logger.NoCtxErrorf(err, "failed to close session of call %s", c.Id)
+	}
+	c.stream.close()
+}
+
+func (c *Call) bye() {
+	target := uri(c.invite.Get("Contact"))
+	if target == "" {
+		target = c.From
+	}
+	req := NewRequest("BYE", target)
+	req.Add("Via", fmt.Sprintf("SIP/2.0/UDP %s;branch=z9hG4bK%s;rport", c.ua.hostport(), randomToken()))
+	req.Add("Max-Forwards", "70")
+	for _, route := range c.routes() {
+		req.Add("Route", route)
+	}
+	req.Add("From", c.newResponse(200, "OK").Get("To"))
+	req.Add("To", c.invite.Get("From"))
+	req.Add("Call-ID", c.Id)
+	req.Add("CSeq", "1 BYE")
+	c.ua.send(req, c.remote)
+}
+
+// routes is the route set of the dialog: as the UAS, the Record-Route
+// headers of the INVITE in the order they arrived (RFC 3261 12.1.1).
+func (c *Call) routes() []string {
+	var routes []string
+	for _, h := range c.invite.Headers {
+		if h.Name == "Record-Route" {
+			for _, r := range strings.Split(h.Value, ",") {
+				routes = append(routes, strings.TrimSpace(r))
+			}
+		}
+	}
+	return routes
+}
+
+func (c *Call) dtmf(event DTMFEvent) {
+	if c.ua.cfg.OnDTMF != nil {
+		c.ua.cfg.OnDTMF(c, event)
+	}
+}
@@ -0,0 +1,286 @@
+package sip
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"math/rand/v2"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/pion/rtp"
+	"gitlab.bcc-hyperdev.org/bcc-hyperdev/realtime"
+	"gitlab.bcc-hyperdev.org/bcc-hyperdev/realtime/audio"
+	"gitlab.bcc-hyperdev.org/bcc-hyperdev/realtime/shared"
+)
+
+const (
+	telephonyRate = 8000
+	// packetSamples is 20ms at 8 kHz, the usual telephony ptime.
+	packetSamples = telephonyRate / 50
+	packetTime    = 20 * time.Millisecond
+	// maxBuffered bounds the audio queued for the phone; the model produces
+	// audio faster than real time.
+	maxBuffered = 120 * telephonyRate
+)
+
+var ErrStreamClosed = errors.New("RTP stream closed")
+
+const dtmfDigits = "0123456789*#ABCD"
+
+// DTMFEvent is a key press received as an RFC 4733 telephone-event.
+type DTMFEvent struct {
+	Digit    rune
+	Duration time.Duration
+}
+
+// rtpStream sends and receives G.711 over RTP, converting to and from the
+// session's 24 kHz PCM.
+type rtpStream struct {
+	logger *shared.Logger
+	conn   *net.UDPConn
+	media  *media
+	onDTMF func(DTMFEvent)
+
+	up     *audio.Resampler
+	down   *audio.Resampler
+	frames chan []byte
+
+	mu       sync.Mutex
+	remote   *net.UDPAddr
+	latched  bool
+	out      []int16
+	lastDTMF uint32
+	seenDTMF bool
+
+	sourceClosed chan struct{}
+	sourceOnce   sync.Once
+	closed       chan struct{}
+	closeOnce    sync.Once
+	wg           sync.WaitGroup
+}
+
+func newRTPStream(logger *shared.Logger, conn *net.UDPConn, m *media, onDTMF func(DTMFEvent)) (*rtpStream, error) {
+	up, err := audio.NewResampler(telephonyRate, realtime.SampleRate)
+	if err != nil {
+		return nil, err
+	}
+	down, err := audio.NewResampler(realtime.SampleRate, telephonyRate)
+	if err != nil {
+		return nil, err
+	}
+	return &rtpStream{
+		logger:       logger,
+		conn:         conn,
+		media:        m,
+		onDTMF:       onDTMF,
+		up:           up,
+		down:         down,
+		frames:       make(chan []byte, 50),
+		remote:       m.remote,
+		sourceClosed: make(chan struct{}),
+		closed:       make(chan struct{}),
+	}, nil
+}
+
+func (s *rtpStream) start() {
+	s.wg.Add(2)
+	go s.receive()
+	go s.send()
+}
+
+func (s *rtpStream) close() {
+	s.closeOnce.Do(func() {
+		close(s.closed)
+		_ = s.conn.Close()
+		s.wg.Wait()
+	})
+}
+
+func (s *rtpStream) decode(payload []byte) []int16 {
+	if s.media.payloadType == PayloadTypePCMA {
+		return audio.DecodeAlaw(payload)
+	}
+	return audio.DecodeUlaw(payload)
+}
+
+func (s *rtpStream) encode(samples []int16) []byte {
+	if s.media.payloadType == PayloadTypePCMA {
+		return audio.EncodeAlaw(samples)
+	}
+	return audio.EncodeUlaw(samples)
+}
+
+func (s *rtpStream) receive() {
+	defer s.wg.Done()
+	buf := make([]byte, 1500)
+	for {
+		n, addr, err := s.conn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		var pkt rtp.Packet
+		if err := pkt.Unmarshal(buf[:n]); err != nil {
+			continue
+		}
+		// Symmetric RTP: answer to where the media comes from, which may
+		// differ from the SDP address behind NAT.
+		s.mu.Lock()
+		if !s.latched {
+			s.remote, s.latched = addr, true
+		}
+		s.mu.Unlock()
+
+		switch {
+		case pkt.PayloadType == s.media.payloadType:
+			pcm := audio.PCM(s.up.Process(s.decode(pkt.Payload)))
+			select {
+			case s.frames <- pcm:
+			default:
+				s.logger.NoCtxWarn("dropping inbound audio, session is not keeping up")
+			}
+		case s.media.dtmfPayloadType != 0 && pkt.PayloadType == s.media.dtmfPayloadType:
+			s.handleDTMF(pkt.Timestamp, pkt.Payload)
+		}
+	}
+}
+
+// handleDTMF reports a digit once, on the first end packet of the event; the
+// end packet is retransmitted for robustness.
+func (s *rtpStream) handleDTMF(timestamp uint32, payload []byte) {
+	if len(payload) < 4 || payload[1]&0x80 == 0 || int(payload[0]) >= len(dtmfDigits) {
+		return
+	}
+	s.mu.Lock()
+	duplicate := s.seenDTMF && s.lastDTMF == timestamp
+	s.lastDTMF, s.seenDTMF = timestamp, true
+	s.mu.Unlock()
+	if duplicate || s.onDTMF == nil {
+		return
+	}
+	duration := binary.BigEndian.Uint16(payload[2:])
+	s.onDTMF(DTMFEvent{
+		Digit:    rune(dtmfDigits[payload[0]]),
+		Duration: time.Duration(duration) * time.Second / telephonyRate,
+	})
+}
+
+// send paces outbound audio in 20ms packets, filling gaps with silence so
+// that NAT bindings and jitter buffers on the far end stay alive.
+func (s *rtpStream) send() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(packetTime)
+	defer ticker.Stop()
+	header := rtp.Header{
+		Version:        2,
+		PayloadType:    s.media.payloadType,
+		SequenceNumber: uint16(rand.Uint32()),
+		Timestamp:      rand.Uint32(),
+		SSRC:           rand.Uint32(),
+		Marker:         true,
+	}
+	samples := make([]int16, packetSamples)
+	for {
+		select {
+		case <-s.closed:
+			return
+		case <-ticker.C:
+		}
+		s.mu.Lock()
+		n := copy(samples, s.out)
+		s.out = s.out[n:]
+		remote := s.remote
+		s.mu.Unlock()
+		clear(samples[n:])
+
+		pkt := rtp.Packet{Header: header, Payload: s.encode(samples)}
+		data, err := pkt.Marshal()
+		if err != nil {
+			s.logger.NoCtxError(err, "failed to marshal RTP packet")
+			continue
+		}
+		if _, err := s.conn.WriteToUDP(data, remote); err != nil {
+			select {
+			case <-s.closed:
+				return
+			default:
+			}
+			s.logger.NoCtxError(err, "failed to send RTP packet")
+		}
+		header.SequenceNumber++
+		header.Timestamp += packetSamples
+		header.Marker = false
+	}
+}
+
+func (s *rtpStream) Read(ctx context.Context) ([]byte, error) {
+	select {
+	case frame := <-s.frames:
+		return frame, nil
+	case <-s.sourceClosed:
+		return nil, ErrStreamClosed
+	case <-s.closed:
+		return nil, ErrStreamClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (s *rtpStream) Write(ctx context.Context, frame []byte) error {
+	samples := s.down.Process(audio.Samples(frame))
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.out)+len(samples) > maxBuffered {
+		return errors.New("outbound audio buffer is full")
+	}
+	s.out = append(s.out, samples...)
+	return nil
+}
+
+// Flush waits for the queued audio to be sent.
+func (s *rtpStream) Flush(ctx context.Context) error {
+	ticker := time.NewTicker(packetTime / 2)
+	defer ticker.Stop()
+	for {
+		s.mu.Lock()
+		empty := len(s.out) == 0
+		s.mu.Unlock()
+		if empty {
+			return nil
+		}
+		select {
+		case <-ticker.C:
+		case <-s.closed:
+			return ErrStreamClosed
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// The session closes its source and sink, but the socket is owned by the
+// call, which closes the stream once the session is gone.
+type streamSource struct{ *rtpStream }
+
+func (s streamSource) Close() error {
+	s.sourceOnce.Do(func() { close(s.sourceClosed) })
+	return nil
+}
+
+type streamSink struct{ *rtpStream }
+
+var _ realtime.InterruptibleSink = streamSink{}
+
+// Interrupt drops the audio not sent to the phone yet.
+func (s streamSink) Interrupt(ctx context.Context) (time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	discarded := time.Duration(len(s.out)) * time.Second / telephonyRate
+	s.out = nil
+	return discarded, nil
+}
+
+func (s streamSink) Close() error {
+	return nil
+}
@@ -0,0 +1,206 @@
+package sip
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const version = "SIP/2.0"
+
+var compactHeaders = map[string]string{
+	"v": "Via",
+	"f": "From",
+	"t": "To",
+	"i": "Call-ID",
+	"m": "Contact",
+	"l": "Content-Length",
+	"c": "Content-Type",
+}
+
+type Header struct {
+	Name  string
+	Value string
+}
+
+// Message is a SIP request or response. Headers keep their order since Via
+// and Record-Route are order sensitive.
+type Message struct {
+	Method     string
+	RequestURI string
+	StatusCode int
+	Reason     string
+	Headers    []Header
+	Body       []byte
+}
+
+func NewRequest(method, uri string) *Message {
+	return &Message{Method: method, RequestURI: uri}
+}
+
+// NewResponse builds a response to req, copying the headers that identify
+// the transaction.
+func NewResponse(req *Message, code int, reason string) *Message {
+	res := &Message{StatusCode: code, Reason: reason}
+	for _, h := range req.Headers {
+		switch h.Name {
+		case "Via", "From", "To", "Call-ID", "CSeq", "Record-Route":
+			res.Headers = append(res.Headers, h)
+		}
+	}
+	return res
+}
+
+func ParseMessage(data []byte) (m *Message, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("failed to parse SIP message: %w", err)
+		}
+	}()
+	head, body, found := bytes.Cut(data, []byte("\r\n\r\n"))
+	if !found {
+		return nil, fmt.Errorf("missing header terminator")
+	}
+	lines := strings.Split(string(head), "\r\n")
+	m = &Message{}
+	parts := strings.SplitN(lines[0], " ", 3)
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("invalid start line %q", lines[0])
+	}
+	if parts[0] == version {
+		m.StatusCode, err = strconv.Atoi(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid status code %q", parts[1])
+		}
+		m.Reason = parts[2]
+	} else {
+		if parts[2] != version {
+			return nil, fmt.Errorf("unsupported version %q", parts[2])
+		}
+		m.Method, m.RequestURI = parts[0], parts[1]
+	}
+	for _, line := range lines[1:] {
+		if line == "" {
+			continue
+		}
+		// Folded continuation lines belong to the previous header.
+		if (line[0] == ' ' || line[0] == '\t') && len(m.Headers) > 0 {
+			m.Headers[len(m.Headers)-1].Value += " " + strings.TrimSpace(line)
+			continue
+		}
+		name, value, found := strings.Cut(line, ":")
+		if !found {
+			return nil, fmt.Errorf("invalid header %q", line)
+		}
+		m.Add(name, strings.TrimSpace(value))
+	}
+	if length := m.Get("Content-Length"); length != "" {
+		n, err := strconv.Atoi(length)
+		if err != nil || n < 0 || n > len(body) {
+			return nil, fmt.Errorf("invalid content length %q", length)
+		}
+		body = body[:n]
+	}
+	m.Body = body
+	return m, nil
+}
+
+func canonicalName(name string) string {
+	name = strings.TrimSpace(name)
+	if long, ok := compactHeaders[strings.ToLower(name)]; ok {
+		return long
+	}
+	switch strings.ToLower(name) {
+	case "call-id":
+		return "Call-ID"
+	case "cseq":
+		return "CSeq"
+	case "www-authenticate":
+		return "WWW-Authenticate"
+	}
+	words := strings.Split(strings.ToLower(name), "-")
+	for i, w := range words {
+		if w != "" {
+			words[i] = strings.ToUpper(w[:1]) + w[1:]
+		}
+	}
+	return strings.Join(words, "-")
+}
+
+func (m *Message) IsRequest() bool {
+	return m.Method != ""
+}
+
+func (m *Message) Get(name string) string {
+	name = canonicalName(name)
+	for _, h := range m.Headers {
+		if h.Name == name {
+			return h.Value
+		}
+	}
+	return ""
+}
+
+func (m *Message) Add(name, value string) {
+	m.Headers = append(m.Headers, Header{Name: canonicalName(name), Value: value})
+}
+
+func (m *Message) Set(name, value string) {
+	name = canonicalName(name)
+	for i, h := range m.Headers {
+		if h.Name == name {
+			m.Headers[i].Value = value
+			return
+		}
+	}
+	m.Headers = append(m.Headers, Header{Name: name, Value: value})
+}
+
+// CSeq returns the sequence number and method of the CSeq header.
+func (m *Message) CSeq() (int, string) {
+	seq, method, _ := strings.Cut(m.Get("CSeq"), " ")
+	n, _ := strconv.Atoi(seq)
+	return n, strings.TrimSpace(method)
+}
+
+func (m *Message) Bytes() []byte {
+	var b bytes.Buffer
+	if m.IsRequest() {
+		fmt.Fprintf(&b, "%s %s %s\r\n", m.Method, m.RequestURI, version)
+	} else {
+		fmt.Fprintf(&b, "%s %d %s\r\n", version, m.StatusCode, m.Reason)
+	}
+	for _, h := range m.Headers {
+		if h.Name == "Content-Length" {
+			continue
+		}
+		fmt.Fprintf(&b, "%s: %s\r\n", h.Name, h.Value)
+	}
+	fmt.Fprintf(&b, "Content-Length: %d\r\n\r\n", len(m.Body))
+	b.Write(m.Body)
+	return b.Bytes()
+}
+
+// param returns a ;-separated parameter of a header value such as the tag of
+// From and To or the branch of Via.
+func param(value, name string) string {
+	for _, p := range strings.Split(value, ";")[1:] {
+		k, v, _ := strings.Cut(strings.TrimSpace(p), "=")
+		if strings.EqualFold(k, name) {
+			return v
+		}
+	}
+	return ""
+}
+
+// uri returns the URI of a name-addr header value like "Bob" <sip:bob@host>.
+func uri(value string) string {
+	if start := strings.Index(value, "<"); start >= 0 {
+		if end := strings.Index(value[start:], ">"); end > 0 {
+			return value[start+1 : start+end]
+		}
+	}
+	uri, _, _ := strings.Cut(value, ";")
+	return strings.TrimSpace(uri)
+}
@@ -0,0 +1,148 @@
+package sip
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/pion/sdp/v3"
+)
+
+const (
+	PayloadTypePCMU = 0
+	PayloadTypePCMA = 8
+)
+
+// media is the outcome of an offer/answer exchange.
+type media struct {
+	payloadType uint8
+	// dtmfPayloadType is zero when the remote does not support RFC 4733.
+	dtmfPayloadType uint8
+	remote          *net.UDPAddr
+	// direction is the offered direction attribute, empty for sendrecv.
+	direction string
+}
+
+// held reports whether the offer puts the call on hold.
+func (m *media) held() bool {
+	return m.direction == "sendonly" || m.direction == "inactive" || m.remote.IP.IsUnspecified()
+}
+
+func codecName(payloadType uint8) string {
+	if payloadType == PayloadTypePCMA {
+		return "PCMA"
+	}
+	return "PCMU"
+}
+
+// negotiate picks the first G.711 codec of the offer, in the caller's order
+// of preference, and telephone-event if offered.
+func negotiate(offer []byte) (m *media, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("failed to negotiate SDP: %w", err)
+		}
+	}()
+	var desc sdp.SessionDescription
+	if err := desc.Unmarshal(offer); err != nil {
+		return nil, err
+	}
+	for _, md := range desc.MediaDescriptions {
+		if md.MediaName.Media != "audio" || md.MediaName.Port.Value == 0 {
+			continue
+		}
+		conn := md.ConnectionInformation
+		if conn == nil {
+			conn = desc.ConnectionInformation
+		}
+		if conn == nil || conn.Address == nil {
+			return nil, fmt.Errorf("missing connection address")
+		}
+		ip := net.ParseIP(conn.Address.Address)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid connection address %q", conn.Address.Address)
+		}
+		m = &media{remote: &net.UDPAddr{IP: ip, Port: md.MediaName.Port.Value}}
+		found := false
+		for _, format := range md.MediaName.Formats {
+			pt, err := strconv.Atoi(format)
+			if err != nil {
+				continue
+			}
+			if !found && (pt == PayloadTypePCMU || pt == PayloadTypePCMA) {
+				m.payloadType = uint8(pt)
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("no supported codec offered")
+		}
+		// A media level direction overrides the session level one.
+		for _, attr := range append(desc.Attributes, md.Attributes...) {
+			switch attr.Key {
+			case "sendrecv", "sendonly", "recvonly", "inactive":
+				m.direction = attr.Key
+			}
+		}
+		for _, attr := range md.Attributes {
+			if attr.Key != "rtpmap" {
+				continue
+			}
+			pt, encoding, _ := strings.Cut(attr.Value, " ")
+			if strings.EqualFold(encoding, "telephone-event/8000") {
+				if n, err := strconv.Atoi(pt); err == nil && n > 95 && n < 128 {
+					m.dtmfPayloadType = uint8(n)
+				}
+			}
+		}
+		return m, nil
+	}
+	return nil, fmt.Errorf("no audio stream offered")
+}
+
+func answer(local *net.UDPAddr, m *media, sessionId uint64) ([]byte, error) {
+	addressType := "IP4"
+	if local.IP.To4() == nil {
+		addressType = "IP6"
+	}
+	formats := []string{strconv.Itoa(int(m.payloadType))}
+	attrs := []sdp.Attribute{
+		sdp.NewAttribute("rtpmap", fmt.Sprintf("%d %s/8000", m.payloadType, codecName(m.payloadType))),
+	}
+	if m.dtmfPayloadType != 0 {
+		formats = append(formats, strconv.Itoa(int(m.dtmfPayloadType)))
+		attrs = append(attrs,
+			sdp.NewAttribute("rtpmap", fmt.Sprintf("%d telephone-event/8000", m.dtmfPayloadType)),
+			sdp.NewAttribute("fmtp", fmt.Sprintf("%d 0-16", m.dtmfPayloadType)),
+		)
+	}
+	attrs = append(attrs, sdp.NewAttribute("ptime", "20"), sdp.NewPropertyAttribute("sendrecv"))
+	desc := sdp.SessionDescription{
+		Origin: sdp.Origin{
+			Username:       "-",
+			SessionID:      sessionId,
+			SessionVersion: sessionId,
+			NetworkType:    "IN",
+			AddressType:    addressType,
+			UnicastAddress: local.IP.String(),
+		},
+		SessionName: "realtime",
+		ConnectionInformation: &sdp.ConnectionInformation{
+			NetworkType: "IN",
+			AddressType: addressType,
+			Address:     &sdp.Address{Address: local.IP.String()},
+		},
+		TimeDescriptions: []sdp.TimeDescription{{}},
+		MediaDescriptions: []*sdp.MediaDescription{{
+			MediaName: sdp.MediaName{
+				Media:   "audio",
+				Port:    sdp.RangedPort{Value: local.Port},
+				Protos:  []string{"RTP", "AVP"},
+				Formats: formats,
+			},
+			Attributes: attrs,
+		}},
+	}
+	return desc.Marshal()
+}
@@ -0,0 +1,488 @@
+package sip
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pion/rtp"
+	"github.com/pion/sdp/v3"
+	"gitlab.bcc-hyperdev.org/bcc-hyperdev/realtime"
+	"gitlab.bcc-hyperdev.org/bcc-hyperdev/realtime/audio"
+	"gitlab.bcc-hyperdev.org/bcc-hyperdev/realtime/shared"
+)
+
+// fakeUpstream stands in for the provider leg.
+type fakeUpstream struct {
+	events chan []byte
+	audio  chan []byte
+	heard  chan []byte
+
+	mu     sync.Mutex
+	closed bool
+}
+
+func newFakeUpstream() *fakeUpstream {
+	return &fakeUpstream{
+		events: make(chan []byte, 16),
+		audio:  make(chan []byte, 16),
+		heard:  make(chan []byte, 1024),
+	}
+}
+
+func (u *fakeUpstream) Send(ctx context.Context, event []byte) error { return nil }
+
+func (u *fakeUpstream) Events() <-chan []byte { return u.events }
+
+func (u *fakeUpstream) WriteAudio(ctx context.Context, frame []byte) error {
+	select {
+	case u.heard <- frame:
+	default:
+	}
+	return nil
+}
+
+func (u *fakeUpstream) Audio() <-chan []byte { return u.audio }
+
+func (u *fakeUpstream) Close(ctx context.Context) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if !u.closed {
+		u.closed = true
+		close(u.events)
+		close(u.audio)
+	}
+	return nil
+}
+
+func (u *fakeUpstream) isClosed() bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.closed
+}
+
+// phone is a bare-bones SIP caller with its own RTP socket.
+type phone struct {
+	t      *testing.T
+	sip    *net.UDPConn
+	rtp    *net.UDPConn
+	server *net.UDPAddr
+	callId string
+}
+
+func newPhone(t *testing.T, server *net.UDPAddr) *phone {
+	sipConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rtpConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = sipConn.Close()
+		_ = rtpConn.Close()
+	})
+	return &phone{t: t, sip: sipConn, rtp: rtpConn, server: server, callId: randomToken()}
+}
+
+func (p *phone) request(method string, body []byte) *Message {
+	local := p.sip.LocalAddr().String()
+	req := NewRequest(method, "sip:agent@"+p.server.String())
+	req.Add("Via", fmt.Sprintf("SIP/2.0/UDP %s;branch=z9hG4bK%s", local, randomToken()))
+	req.Add("From", "<sip:caller@"+local+">;tag=caller")
+	req.Add("To", "<sip:agent@"+p.server.String()+">")
+	req.Add("Call-ID", p.callId)
+	req.Add("Contact", "<sip:caller@"+local+">")
+	req.Body = body
+	return req
+}
+
+func (p *phone) send(msg *Message) {
+	if _, err := p.sip.WriteToUDP(msg.Bytes(), p.server); err != nil {
+		p.t.Fatal(err)
+	}
+}
+
+func (p *phone) receive() *Message {
+	buf := make([]byte, 65535)
+	_ = p.sip.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := p.sip.ReadFromUDP(buf)
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	msg, err := ParseMessage(buf[:n])
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	return msg
+}
+
+// expect skips provisional responses.
+func (p *phone) expect(code int) *Message {
+	for {
+		msg := p.receive()
+		if msg.IsRequest() || msg.StatusCode >= 200 || msg.StatusCode == code {
+			if msg.StatusCode != code {
+				p.t.Fatalf("Expected %d, got %q %d", code, msg.Method, msg.StatusCode)
+			}
+			return msg
+		}
+	}
+}
+
+func (p *phone) offer() []byte {
+	port := p.rtp.LocalAddr().(*net.UDPAddr).Port
+	return []byte("v=0\r\n" +
+		"o=- 1 1 IN IP4 127.0.0.1\r\n" +
+		"s=-\r\n" +
+		"c=IN IP4 127.0.0.1\r\n" +
+		"t=0 0\r\n" +
+		fmt.Sprintf("m=audio %d RTP/AVP 0 101\r\n", port) +
+		"a=rtpmap:0 PCMU/8000\r\n" +
+		"a=rtpmap:101 telephone-event/8000\r\n")
+}
+
+// dial sends an INVITE, acknowledges the 200 OK and returns the RTP address
+// of the answer.
+func (p *phone) dial() (*Message, *net.UDPAddr) {
+	invite := p.request("INVITE", p.offer())
+	invite.Add("CSeq", "1 INVITE")
+	invite.Add("Content-Type", "application/sdp")
+	p.send(invite)
+	ok := p.expect(200)
+
+	var desc sdp.SessionDescription
+	if err := desc.Unmarshal(ok.Body); err != nil {
+		p.t.Fatal(err)
+	}
+	md := desc.MediaDescriptions[0]
+	if got := md.MediaName.Formats; len(got) != 2 || got[0] != "0" || got[1] != "101" {
+		p.t.Fatalf("Expected formats [0 101], got %v", got)
+	}
+	ack := p.request("ACK", nil)
+	ack.Set("To", ok.Get("To"))
+	ack.Add("CSeq", "1 ACK")
+	p.send(ack)
+	return ok, &net.UDPAddr{IP: net.ParseIP(desc.ConnectionInformation.Address.Address), Port: md.MediaName.Port.Value}
+}
+
+func (p *phone) sendRTP(to *net.UDPAddr, header rtp.Header, payload []byte) {
+	pkt := rtp.Packet{Header: header, Payload: payload}
+	data, err := pkt.Marshal()
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	if _, err := p.rtp.WriteToUDP(data, to); err != nil {
+		p.t.Fatal(err)
+	}
+}
+
+func dialUpstream(upstream *fakeUpstream) UpstreamFunc {
+	return func(ctx context.Context, call *Call) (realtime.Transport, error) {
+		return upstream, nil
+	}
+}
+
+func newTestUserAgent(t *testing.T, cfg *Config) *UserAgent {
+	cfg.Address = "127.0.0.1:0"
+	ua, err := NewUserAgent(shared.NewLogger(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := ua.Close(ctx); err != nil {
+			t.Error(err)
+		}
+	})
+	return ua
+}
+
+func TestUserAgent(t *testing.T) {
+	t.Run("Call", func(t *testing.T) {
+		upstream := newFakeUpstream()
+		digits := make(chan rune, 8)
+		ended := make(chan *Call, 1)
+		ua := newTestUserAgent(t, &Config{
+			Upstream:  dialUpstream(upstream),
+			OnDTMF:    func(call *Call, event DTMFEvent) { digits <- event.Digit },
+			OnCallEnd: func(call *Call) { ended <- call },
+		})
+		p := newPhone(t, ua.Addr())
+		ok, media := p.dial()
+		if tag := param(ok.Get("To"), "tag"); tag == "" {
+			t.Errorf("Expected a To tag in the 200 OK")
+		}
+
+		// Caller audio reaches the upstream resampled to 24 kHz.
+		header := rtp.Header{Version: 2, PayloadType: PayloadTypePCMU, SSRC: 1}
+		for i := 0; i < 5; i++ {
+			p.sendRTP(media, header, audio.EncodeUlaw(make([]int16, packetSamples)))
+			header.SequenceNumber++
+			header.Timestamp += packetSamples
+		}
+		select {
+		case frame := <-upstream.heard:
+			// The first frame comes a few samples short while the
+			// resampler fills its history.
+			want := 3 * packetSamples * realtime.BytesPerSample
+			if len(frame) < want-16 || len(frame) > want {
+				t.Errorf("Expected about %d bytes, got %d", want, len(frame))
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("Expected caller audio upstream")
+		}
+
+		// The end packet of a key press is sent three times but reported once.
+		for i := 0; i < 3; i++ {
+			p.sendRTP(media, rtp.Header{Version: 2, PayloadType: 101, SSRC: 1, Timestamp: 4000, SequenceNumber: uint16(100 + i)}, []byte{5, 0x80, 0x03, 0x20})
+		}
+		select {
+		case digit := <-digits:
+			if digit != '5' {
+				t.Errorf("Expected digit 5, got %q", digit)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("Expected a DTMF event")
+		}
+
+		// Upstream audio is played to the caller as PCMU.
+		upstream.audio <- make([]byte, 960)
+		buf := make([]byte, 1500)
+		_ = p.rtp.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, _, err := p.rtp.ReadFromUDP(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var pkt rtp.Packet
+		if err := pkt.Unmarshal(buf[:n]); err != nil {
+			t.Fatal(err)
+		}
+		if pkt.PayloadType != PayloadTypePCMU || len(pkt.Payload) != packetSamples {
+			t.Errorf("Expected %d bytes of PCMU, got payload type %d with %d bytes", packetSamples, pkt.PayloadType, len(pkt.Payload))
+		}
+
+		bye := p.request("BYE", nil)
+		bye.Set("To", ok.Get("To"))
+		bye.Add("CSeq", "2 BYE")
+		p.send(bye)
+		p.expect(200)
+		select {
+		case call := <-ended:
+			if call.Id != p.callId {
+				t.Errorf("Expected call %s, got %s", p.callId, call.Id)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("Expected the call to end")
+		}
+		if !upstream.isClosed() {
+			t.Errorf("Expected upstream to be closed")
+		}
+		if len(ua.Calls()) != 0 {
+			t.Errorf("Expected no calls, got %d", len(ua.Calls()))
+		}
+	})
+
+	t.Run("UpstreamHangup", func(t *testing.T) {
+		upstream := newFakeUpstream()
+		ua := newTestUserAgent(t, &Config{Upstream: dialUpstream(upstream)})
+		p := newPhone(t, ua.Addr())
+		ok, _ := p.dial()
+
+		_ = upstream.Close(context.Background())
+		bye := p.expect(0)
+		if bye.Method != "BYE" {
+			t.Fatalf("Expected BYE, got %q", bye.Method)
+		}
+		if got := bye.Get("To"); !strings.Contains(got, "tag=caller") {
+			t.Errorf("Expected To with the caller tag, got %q", got)
+		}
+		if got, want := param(bye.Get("From"), "tag"), param(ok.Get("To"), "tag"); got != want {
+			t.Errorf("Expected From tag %q, got %q", want, got)
+		}
+	})
+
+	t.Run("Cancel", func(t *testing.T) {
+		release := make(chan struct{})
+		ua := newTestUserAgent(t, &Config{
+			Upstream: func(ctx context.Context, call *Call) (realtime.Transport, error) {
+				<-ctx.Done()
+				close(release)
+				return nil, ctx.Err()
+			},
+		})
+		p := newPhone(t, ua.Addr())
+		invite := p.request("INVITE", p.offer())
+		invite.Add("CSeq", "1 INVITE")
+		p.send(invite)
+		p.expect(100)
+
+		cancel := p.request("CANCEL", nil)
+		cancel.Headers[0] = invite.Headers[0]
+		cancel.Add("CSeq", "1 CANCEL")
+		p.send(cancel)
+		p.expect(200)
+		p.expect(487)
+		<-release
+	})
+
+	t.Run("Retransmission", func(t *testing.T) {
+		release := make(chan struct{})
+		ua := newTestUserAgent(t, &Config{
+			Upstream: func(ctx context.Context, call *Call) (realtime.Transport, error) {
+				<-ctx.Done()
+				close(release)
+				return nil, ctx.Err()
+			},
+		})
+		p := newPhone(t, ua.Addr())
+		invite := p.request("INVITE", p.offer())
+		invite.Add("CSeq", "1 INVITE")
+		p.send(invite)
+		p.expect(100)
+		// A retransmission before the final response gets the provisional one.
+		p.send(invite)
+		p.expect(100)
+		// So does a re-INVITE, which must wait for the INVITE to complete.
+		reinvite := p.request("INVITE", p.offer())
+		reinvite.Set("To", reinvite.Get("To")+";tag="+ua.call(p.callId).localTag)
+		reinvite.Add("CSeq", "2 INVITE")
+		p.send(reinvite)
+		p.expect(491)
+
+		cancel := p.request("CANCEL", nil)
+		cancel.Headers[0] = invite.Headers[0]
+		cancel.Add("CSeq", "1 CANCEL")
+		p.send(cancel)
+		p.expect(200)
+		p.expect(487)
+		<-release
+	})
+
+	t.Run("ReInvite", func(t *testing.T) {
+		ua := newTestUserAgent(t, &Config{Upstream: dialUpstream(newFakeUpstream())})
+		p := newPhone(t, ua.Addr())
+		ok, _ := p.dial()
+
+		refresh := p.request("INVITE", p.offer())
+		refresh.Set("To", ok.Get("To"))
+		refresh.Add("CSeq", "2 INVITE")
+		p.send(refresh)
+		res := p.expect(200)
+		if seq, _ := res.CSeq(); seq != 2 || string(res.Body) != string(ok.Body) {
+			t.Errorf("Expected the original answer to CSeq 2, got CSeq %d with %q", seq, res.Body)
+		}
+		// A retransmitted re-INVITE gets the same response.
+		p.send(refresh)
+		if res := p.expect(200); string(res.Body) != string(ok.Body) {
+			t.Errorf("Expected the original answer, got %q", res.Body)
+		}
+
+		hold := p.request("INVITE", []byte(string(p.offer())+"a=sendonly\r\n"))
+		hold.Set("To", ok.Get("To"))
+		hold.Add("CSeq", "3 INVITE")
+		p.send(hold)
+		p.expect(488)
+
+		// An INVITE older than the last one is out of order.
+		stale := p.request("INVITE", p.offer())
+		stale.Set("To", ok.Get("To"))
+		stale.Add("CSeq", "1 INVITE")
+		p.send(stale)
+		p.expect(500)
+		if len(ua.Calls()) != 1 {
+			t.Errorf("Expected the call to go on, got %d calls", len(ua.Calls()))
+		}
+	})
+
+	t.Run("UnsupportedCodec", func(t *testing.T) {
+		ua := newTestUserAgent(t, &Config{Upstream: dialUpstream(newFakeUpstream())})
+		p := newPhone(t, ua.Addr())
+		offer := strings.ReplaceAll(string(p.offer()), "RTP/AVP 0 101", "RTP/AVP 9")
+		invite := p.request("INVITE", []byte(offer))
+		invite.Add("CSeq", "1 INVITE")
+		p.send(invite)
+		p.expect(488)
+	})
+}
+
+func TestNegotiate(t *testing.T) {
+	offer := func(formats string) []byte {
+		return []byte("v=0\r\no=- 1 1 IN IP4 10.0.0.1\r\ns=-\r\nc=IN IP4 10.0.0.1\r\nt=0 0\r\n" +
+			"m=audio 4000 RTP/AVP " + formats + "\r\na=rtpmap:101 telephone-event/8000\r\n")
+	}
+
+	t.Run("CallerPreference", func(t *testing.T) {
+		m, err := negotiate(offer("8 0 101"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.payloadType != PayloadTypePCMA {
+			t.Errorf("Expected PCMA, got %d", m.payloadType)
+		}
+		if m.dtmfPayloadType != 101 {
+			t.Errorf("Expected telephone-event 101, got %d", m.dtmfPayloadType)
+		}
+		if m.remote.String() != "10.0.0.1:4000" {
+			t.Errorf("Expected 10.0.0.1:4000, got %s", m.remote)
+		}
+	})
+
+	t.Run("NoSupportedCodec", func(t *testing.T) {
+		if _, err := negotiate(offer("9 101")); err == nil {
+			t.Errorf("Expected an error")
+		}
+	})
+}
+
+func TestCallRoutes(t *testing.T) {
+	invite := NewRequest("INVITE", "sip:agent@10.0.0.1")
+	invite.Add("Record-Route", "<sip:p1.example.com;lr>, <sip:p2.example.com;lr>")
+	invite.Add("Record-Route", "<sip:p3.example.com;lr>")
+	call := &Call{invite: invite}
+	want := []string{"<sip:p1.example.com;lr>", "<sip:p2.example.com;lr>", "<sip:p3.example.com;lr>"}
+	if got := call.routes(); strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+}
+
+func TestParseMessage(t *testing.T) {
+	data := "INVITE sip:agent@example.com SIP/2.0\r\n" +
+		"v: SIP/2.0/UDP 10.0.0.1;branch=z9hG4bKabc\r\n" +
+		"f: <sip:caller@example.com>;tag=1\r\n" +
+		"Subject: folded\r\n line\r\n" +
+		"call-id: abc\r\n" +
+		"CSeq: 7 INVITE\r\n" +
+		"Content-Length: 4\r\n\r\nbodyjunk"
+	m, err := ParseMessage([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Method != "INVITE" || m.RequestURI != "sip:agent@example.com" {
+		t.Errorf("Expected INVITE sip:agent@example.com, got %s %s", m.Method, m.RequestURI)
+	}
+	if got := param(m.Get("Via"), "branch"); got != "z9hG4bKabc" {
+		t.Errorf("Expected branch z9hG4bKabc, got %q", got)
+	}
+	if got := param(m.Get("From"), "tag"); got != "1" {
+		t.Errorf("Expected tag 1, got %q", got)
+	}
+	if got := m.Get("Subject"); got != "folded line" {
+		t.Errorf("Expected folded line, got %q", got)
+	}
+	if got := m.Get("Call-ID"); got != "abc" {
+		t.Errorf("Expected abc, got %q", got)
+	}
+	if seq, method := m.CSeq(); seq != 7 || method != "INVITE" {
+		t.Errorf("Expected 7 INVITE, got %d %s", seq, method)
+	}
+	if string(m.Body) != "body" {
+		t.Errorf("Expected body, got %q", m.Body)
+	}
+}
@@ -0,0 +1,260 @@
+package sip
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"gitlab.bcc-hyperdev.org/bcc-hyperdev/realtime"
+	"gitlab.bcc-hyperdev.org/bcc-hyperdev/realtime/shared"
+)
+
+const (
+	DefaultUserAgent    = "realtime-sip"
+	DefaultSetupTimeout = 15 * time.Second
+	allowedMethods      = "INVITE, ACK, BYE, CANCEL, OPTIONS"
+)
+
+var ErrUserAgentClosed = errors.New("user agent closed")
+
+// UpstreamFunc opens the realtime transport an inbound call is bridged to.
+type UpstreamFunc func(ctx context.Context, call *Call) (realtime.Transport, error)
+
+type Config struct {
+	// Address is the UDP address to listen on for SIP, e.g. ":5060".
+	Address string
+	// MediaIP is the address RTP is bound to and advertised in SDP and
+	// Contact. It is required when Address does not name a specific IP.
+	MediaIP  string
+	Upstream UpstreamFunc
+	// OnDTMF receives key presses; use call.Session to act on them.
+	OnDTMF       func(call *Call, event DTMFEvent)
+	OnCallStart  func(call *Call)
+	OnCallEnd    func(call *Call)
+	UserAgent    string
+	SetupTimeout time.Duration
+}
+
+// UserAgent is a minimal SIP user agent server over UDP: it answers inbound
+// INVITEs with G.711 and bridges each call to its own realtime session.
+type UserAgent struct {
+	logger  *shared.Logger
+	cfg     *Config
+	conn    *net.UDPConn
+	mediaIP net.IP
+
+	mu     sync.Mutex
+	calls  map[string]*Call
+	closed bool
+	wg     sync.WaitGroup
+}
+
+func NewUserAgent(logger *shared.Logger, cfg *Config) (ua *UserAgent, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("failed to create SIP user agent: %w", err)
+		}
+	}()
+	if cfg == nil || cfg.Upstream == nil {
+		return nil, fmt.Errorf("upstream is required")
+	}
+	if cfg.UserAgent == "" {
+		cfg.UserAgent = DefaultUserAgent
+	}
+	if cfg.SetupTimeout <= 0 {
+		cfg.SetupTimeout = DefaultSetupTimeout
+	}
+	addr, err := net.ResolveUDPAddr("udp", cfg.Address)
+	if err != nil {
+		return nil, err
+	}
+	mediaIP := addr.IP
+	if cfg.MediaIP != "" {
+		mediaIP = net.ParseIP(cfg.MediaIP)
+		if mediaIP == nil {
+			return nil, fmt.Errorf("invalid media IP %q", cfg.MediaIP)
+		}
+	}
+	if mediaIP == nil || mediaIP.IsUnspecified() {
+		return nil, fmt.Errorf("media IP is required when listening on all interfaces")
+	}
+	conn, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	ua = &UserAgent{
+		logger:  logger,
+		cfg:     cfg,
+		conn:    conn,
+		mediaIP: mediaIP,
+		calls:   make(map[string]*Call),
+	}
+	ua.wg.Add(1)
+	go ua.serve()
+	return ua, nil
+}
+
+func (ua *UserAgent) Addr() *net.UDPAddr {
+	return ua.conn.LocalAddr().(*net.UDPAddr)
+}
+
+func (ua *UserAgent) Calls() []*Call {
+	ua.mu.Lock()
+	defer ua.mu.Unlock()
+	calls := make([]*Call, 0, len(ua.calls))
+	for _, call := range ua.calls {
+		calls = append(calls, call)
+	}
+	return calls
+}
+
+// Close hangs up every call and stops listening.
+func (ua *UserAgent) Close(ctx context.Context) error {
+	ua.mu.Lock()
+	ua.closed = true
+	ua.mu.Unlock()
+	var errs []error
+	for _, call := range ua.Calls() {
+		if err := call.Hangup(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := ua.conn.Close(); err != nil {
+		errs = append(errs, err)
+	}
+	done := make(chan struct{})
+	go func() {
+		ua.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		errs = append(errs, ctx.Err())
+	}
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("failed to close SIP user agent: %w", err)
+	}
+	return nil
+}
+
+func (ua *UserAgent) serve() {
+	defer ua.wg.Done()
+	buf := make([]byte, 65535)
+	for {
+		n, addr, err := ua.conn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		msg, err := ParseMessage(buf[:n])
+		if err != nil {
+			ua.logger.NoCtxWarnf("dropping SIP message from %s: %v", addr, err)
+			continue
+		}
+		if msg.IsRequest() {
+			ua.handleRequest(msg, addr)
+		}
+	}
+}
+
+func (ua *UserAgent) handleRequest(req *Message, addr *net.UDPAddr) {
+	call := ua.call(req.Get("Call-ID"))
+	switch req.Method {
+	case "INVITE":
+		if call != nil {
+			call.invited(req, addr)
+			return
+		}
+		ua.handleInvite(req, addr)
+	case "ACK":
+		if call != nil {
+			call.acked()
+		}
+	case "BYE":
+		if call == nil {
+			ua.respond(req, addr, 481, "Call/Transaction Does Not Exist")
+			return
+		}
+		ua.respond(req, addr, 200, "OK")
+		call.terminate(false)
+	case "CANCEL":
+		if call == nil {
+			ua.respond(req, addr, 481, "Call/Transaction Does Not Exist")
+			return
+		}
+		ua.respond(req, addr, 200, "OK")
+		call.cancel()
+	case "OPTIONS":
+		res := NewResponse(req, 200, "OK")
+		res.Add("Allow", allowedMethods)
+		ua.send(res, addr)
+	default:
+		res := NewResponse(req, 405, "Method Not Allowed")
+		res.Add("Allow", allowedMethods)
+		ua.send(res, addr)
+	}
+}
+
+func (ua *UserAgent) handleInvite(req *Message, addr *net.UDPAddr) {
+	m, err := negotiate(req.Body)
+	if err != nil {
+		ua.logger.NoCtxWarnf("rejecting INVITE: %v", err)
+		ua.respond(req, addr, 488, "Not Acceptable Here")
+		return
+	}
+	ua.mu.Lock()
+	if ua.closed {
+		ua.mu.Unlock()
+		ua.respond(req, addr, 503, "Service Unavailable")
+		return
+	}
+	call := newCall(ua, req, addr, m)
+	// Retransmissions get the provisional response until the final one.
+	call.response = NewResponse(req, 100, "Trying")
+	ua.calls[call.Id] = call
+	ua.wg.Add(1)
+	ua.mu.Unlock()
+
+	ua.send(call.response, addr)
+	go call.run()
+}
+
+func (ua *UserAgent) call(id string) *Call {
+	ua.mu.Lock()
+	defer ua.mu.Unlock()
+	return ua.calls[id]
+}
+
+func (ua *UserAgent) remove(call *Call) {
+	ua.mu.Lock()
+	delete(ua.calls, call.Id)
+	ua.mu.Unlock()
+	ua.wg.Done()
+}
+
+func (ua *UserAgent) respond(req *Message, addr *net.UDPAddr, code int, reason string) {
+	ua.send(NewResponse(req, code, reason), addr)
+}
+
+func (ua *UserAgent) send(msg *Message, addr *net.UDPAddr) {
+	msg.Set("User-Agent", ua.cfg.UserAgent)
+	if _, err := ua.conn.WriteToUDP(msg.Bytes(), addr); err != nil {
+		ua.logger.NoCtxError(err, "failed to send SIP message")
+	}
+}
+
+func (ua *UserAgent) hostport() string {
+	return net.JoinHostPort(ua.mediaIP.String(), strconv.Itoa(ua.Addr().Port))
+}
+
+func randomToken() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,132 @@
+package realtime
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"gitlab.bcc-hyperdev.org/bcc-hyperdev/realtime/shared"
+)
+
+// SendText adds a user message with text to the conversation and asks for a
+// response, e.g. to inject typed input into a voice conversation or to drive
+// a text-only session. Only events are sent, so it works over any Transport,
+// the data channel of an rtc.Transport as well as an openai.WebsocketTransport.
+func (s *Session) SendText(ctx context.Context, text string) error {
+	if text == "" {
+		return fmt.Errorf("text is required")
+	}
+	item := Item{
+		Type:    ItemTypeMessage,
+		Role:    RoleUser,
+		Content: []ContentPart{{Type: ContentTypeInputText, Text: text}},
+	}
+	if err := s.Send(ctx, NewConversationItemCreateEvent("", item)); err != nil {
+		return fmt.Errorf("failed to send text: %w", err)
+	}
+	if err := s.Send(ctx, NewResponseCreateEvent()); err != nil {
+		return fmt.Errorf("failed to request response: %w", err)
+	}
+	return nil
+}
+
+// TextOutput is the text of an output_text content part as it streams in.
+type TextOutput struct {
+	ResponseId   string
+	ItemId       string
+	ContentIndex int
+	// Delta is the text added by this update, empty once final.
+	Delta string
+	// Text is the text so far, or all of it once final.
+	Text  string
+	Final bool
+}
+
+type TextHandler func(output TextOutput)
+
+type textKey struct {
+	itemId       string
+	contentIndex int
+}
+
+type textEvent struct {
+	ResponseId   string `json:"response_id"`
+	ItemId       string `json:"item_id"`
+	ContentIndex int    `json:"content_index"`
+	Delta        string `json:"delta"`
+	Text         string `json:"text"`
+}
+
+// TextStream aggregates the response.output_text events of a session, the
+// output of responses in the text modality. The output of out-of-band
+// responses is left out; OutOfBandResponse delivers it.
+type TextStream struct {
+	logger *shared.Logger
+	remove func()
+	// outOfBand holds the out-of-band responses in flight.
+	outOfBand *outOfBandResponses
+
+	mu       sync.Mutex
+	pending  map[textKey]string
+	handlers handlers[TextHandler]
+}
+
+// NewTextStream follows the text output of session. session may be nil to
+// feed events through Handle, e.g. from a recording.
+func NewTextStream(logger *shared.Logger, session *Session) *TextStream {
+	t := &TextStream{logger: logger, outOfBand: newOutOfBandResponses(), pending: make(map[textKey]string)}
+	if session != nil {
+		t.remove = session.OnEvent(t.Handle)
+	}
+	return t
+}
+
+// Close stops following the session.
+func (t *TextStream) Close() {
+	if t.remove != nil {
+		t.remove()
+	}
+}
+
+// OnText registers a handler called for every delta and once more when the
+// text is final. Handlers run on the session's event loop and must not
+// block.
+func (t *TextStream) OnText(handler TextHandler) (remove func()) {
+	return t.handlers.add(handler)
+}
+
+// Handle applies a server event to the stream.
+func (t *TextStream) Handle(ctx context.Context, event Event) {
+	switch event.Type {
+	case EventTypeResponseCreated, EventTypeResponseDone:
+		if err := t.outOfBand.track(event); err != nil {
+			t.logger.NoCtxWarnf("failed to track text output: %v", err)
+		}
+		return
+	case EventTypeResponseOutputTextDelta, EventTypeResponseOutputTextDone:
+	default:
+		return
+	}
+	var payload textEvent
+	if err := event.Decode(&payload); err != nil {
+		t.logger.NoCtxWarnf("failed to track text output: %v", err)
+		return
+	}
+	if t.outOfBand.contains(payload.ResponseId) {
+		return
+	}
+	output := TextOutput{ResponseId: payload.ResponseId, ItemId: payload.ItemId, ContentIndex: payload.ContentIndex}
+	key := textKey{payload.ItemId, payload.ContentIndex}
+	t.mu.Lock()
+	if event.Type == EventTypeResponseOutputTextDone {
+		output.Text, output.Final = payload.Text, true
+		delete(t.pending, key)
+	} else {
+		t.pending[key] += payload.Delta
+		output.Delta, output.Text = payload.Delta, t.pending[key]
+	}
+	t.mu.Unlock()
+	for _, handler := range t.handlers.snapshot() {
+		handler(output)
+	}
+}
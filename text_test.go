@@ -0,0 +1,90 @@
+package realtime
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+
+	"gitlab.bcc-hyperdev.org/bcc-hyperdev/realtime/shared"
+)
+
+func TestSessionSendText(t *testing.T) {
+	t.Run("Sends", func(t *testing.T) {
+		session, transport, _, _ := newTestSession(t)
+		defer func() { _ = session.Close(context.Background()) }()
+		if err := session.SendText(context.Background(), "What time is it?"); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if got := sentTypes(transport); len(got) != 2 || got[0] != EventTypeConversationItemCreate || got[1] != EventTypeResponseCreate {
+			t.Fatalf("Expected [conversation.item.create response.create], got %v", got)
+		}
+		var create ConversationItemCreateEvent
+		if err := json.Unmarshal(transport.sent[0], &create); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		item := create.Item
+		if item.Type != ItemTypeMessage || item.Role != RoleUser || len(item.Content) != 1 ||
+			item.Content[0].Type != ContentTypeInputText || item.Content[0].Text != "What time is it?" {
+			t.Errorf("Expected a user text message, got %+v", item)
+		}
+	})
+
+	t.Run("Empty", func(t *testing.T) {
+		session, transport, _, _ := newTestSession(t)
+		defer func() { _ = session.Close(context.Background()) }()
+		if err := session.SendText(context.Background(), ""); err == nil {
+			t.Error("Expected an error, got nil")
+		}
+		if got := sentTypes(transport); len(got) != 0 {
+			t.Errorf("Expected nothing sent, got %v", got)
+		}
+	})
+
+	t.Run("Closed", func(t *testing.T) {
+		session, _, _, _ := newTestSession(t)
+		_ = session.Close(context.Background())
+		if err := session.SendText(context.Background(), "Hi"); err == nil {
+			t.Error("Expected an error, got nil")
+		}
+	})
+}
+
+func TestTextStream(t *testing.T) {
+	session, transport, _, _ := newTestSession(t)
+	defer func() { _ = session.Close(context.Background()) }()
+	stream := NewTextStream(shared.NewLogger(), session)
+	defer stream.Close()
+
+	var mu sync.Mutex
+	var outputs []TextOutput
+	stream.OnText(func(output TextOutput) {
+		mu.Lock()
+		defer mu.Unlock()
+		outputs = append(outputs, output)
+	})
+	if err := session.Start(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	transport.events <- []byte(`{"type":"response.output_text.delta","response_id":"resp_1","item_id":"a","content_index":0,"delta":"It is "}`)
+	transport.events <- []byte(`{"type":"response.output_text.delta","response_id":"resp_2","item_id":"b","content_index":0,"delta":"Hello"}`)
+	transport.events <- []byte(`{"type":"response.output_text.delta","response_id":"resp_1","item_id":"a","content_index":0,"delta":"noon."}`)
+	transport.events <- []byte(`{"type":"response.output_text.done","response_id":"resp_1","item_id":"a","content_index":0,"text":"It is noon."}`)
+	waitFor(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(outputs) == 4
+	})
+
+	mu.Lock()
+	defer mu.Unlock()
+	if outputs[2].Delta != "noon." || outputs[2].Text != "It is noon." || outputs[2].Final {
+		t.Errorf("Expected the aggregated partial text, got %+v", outputs[2])
+	}
+	if outputs[1].ItemId != "b" || outputs[1].Text != "Hello" {
+		t.Errorf("Expected a separate text per item, got %+v", outputs[1])
+	}
+	if last := outputs[3]; !last.Final || last.Text != "It is noon." || last.ResponseId != "resp_1" || last.Delta != "" {
+		t.Errorf("Expected the final text, got %+v", last)
+	}
+}
@@ -0,0 +1,302 @@
+package realtime
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"gitlab.bcc-hyperdev.org/bcc-hyperdev/realtime/shared"
+)
+
+type Speaker string
+
+const (
+	SpeakerUser      Speaker = RoleUser
+	SpeakerAssistant Speaker = RoleAssistant
+)
+
+func (s Speaker) label() string {
+	if s == SpeakerAssistant {
+		return "Assistant"
+	}
+	return "User"
+}
+
+// minCue is the duration given to segments that ended as soon as they
+// started, e.g. a transcript delivered in a single event.
+const minCue = time.Second
+
+// Segment is the transcript of the audio of one item content part.
+type Segment struct {
+	ItemId       string
+	ContentIndex int
+	Speaker      Speaker
+	Text         string
+	// Final is set once the transcript is complete; until then Text grows
+	// with every delta. A failed transcription is final with what was
+	// received.
+	Final bool
+	// Start and End are offsets from the start of the transcript at which
+	// the server reported the speech. User speech spans the server's speech
+	// detection when it is on. Assistant speech is generated faster than it
+	// is played, so its segments end early.
+	Start time.Duration
+	End   time.Duration
+}
+
+type SegmentHandler func(segment Segment)
+
+type transcriptSegment struct {
+	Segment
+	// stopped is set once speech detection ended the segment.
+	stopped bool
+	// redacted is set once Redact replaced the text, which the raw text of
+	// later events then leaves alone.
+	redacted bool
+}
+
+type speechEvent struct {
+	ItemId string `json:"item_id"`
+}
+
+// Transcript combines the input transcription and the output audio
+// transcript events of a session into speaker-tagged segments in the order
+// they started. Out-of-band responses are left out.
+type Transcript struct {
+	logger *shared.Logger
+	remove func()
+	start  time.Time
+	now    func() time.Time
+	// outOfBand holds the out-of-band responses in flight.
+	outOfBand *outOfBandResponses
+
+	mu       sync.Mutex
+	segments []transcriptSegment
+	handlers handlers[SegmentHandler]
+}
+
+// NewTranscript transcribes session from now on. session may be nil to feed
+// events through Handle, e.g. from a recording.
+func NewTranscript(logger *shared.Logger, session *Session) *Transcript {
+	t := &Transcript{logger: logger, now: time.Now, outOfBand: newOutOfBandResponses()}
+	t.start = t.now()
+	if session != nil {
+		t.remove = session.OnEvent(t.Handle)
+	}
+	return t
+}
+
+// Close stops transcribing the session.
+func (t *Transcript) Close() {
+	if t.remove != nil {
+		t.remove()
+	}
+}
+
+// Segments returns a snapshot of the segments in order, partial ones
+// included.
+func (t *Transcript) Segments() []Segment {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	segments := make([]Segment, len(t.segments))
+	for i, s := range t.segments {
+		segments[i] = s.Segment
+	}
+	return segments
+}
+
+// OnSegment registers a handler called with a snapshot of a segment each
+// time its text changes or it becomes final. Handlers run on the session's
+// event loop and must not block.
+func (t *Transcript) OnSegment(handler SegmentHandler) (remove func()) {
+	return t.handlers.add(handler)
+}
+
+// Handle applies a server event to the transcript.
+func (t *Transcript) Handle(ctx context.Context, event Event) {
+	var changed *Segment
+	var err error
+	switch event.Type {
+	case EventTypeInputAudioBufferSpeechStarted, EventTypeInputAudioBufferSpeechStopped:
+		var payload speechEvent
+		if err = event.Decode(&payload); err == nil && payload.ItemId != "" {
+			t.update(SpeakerUser, payload.ItemId, 0, func(s *transcriptSegment, now time.Duration) bool {
+				if event.Type == EventTypeInputAudioBufferSpeechStopped {
+					s.End, s.stopped = now, true
+				}
+				return false
+			})
+		}
+	case EventTypeInputTranscriptionDelta, EventTypeInputTranscriptionCompleted, EventTypeInputTranscriptionFailed:
+		var payload itemRefEvent
+		if err = event.Decode(&payload); err == nil {
+			changed = t.update(SpeakerUser, payload.ItemId, payload.ContentIndex, func(s *transcriptSegment, now time.Duration) bool {
+				switch {
+				case event.Type != EventTypeInputTranscriptionDelta:
+					s.Final = true
+					if event.Type == EventTypeInputTranscriptionCompleted && !s.redacted {
+						s.Text = payload.Transcript
+					}
+				case !s.redacted:
+					s.Text += payload.Delta
+				}
+				if !s.stopped {
+					s.End = now
+				}
+				return true
+			})
+		}
+	case EventTypeResponseCreated, EventTypeResponseDone:
+		err = t.outOfBand.track(event)
+	case EventTypeResponseOutputAudioTranscriptDelta, EventTypeResponseOutputAudioTranscriptDone:
+		var payload itemRefEvent
+		if err = event.Decode(&payload); err == nil && !t.outOfBand.contains(payload.ResponseId) {
+			changed = t.update(SpeakerAssistant, payload.ItemId, payload.ContentIndex, func(s *transcriptSegment, now time.Duration) bool {
+				switch {
+				case event.Type == EventTypeResponseOutputAudioTranscriptDone:
+					s.Final = true
+					if !s.redacted {
+						s.Text = payload.Transcript
+					}
+				case !s.redacted:
+					s.Text += payload.Delta
+				}
+				s.End = now
+				return true
+			})
+		}
+	}
+	if err != nil {
+		t.logger.NoCtxWarnf("failed to track transcript: %v", err)
+		return
+	}
+	if changed != nil {
+		t.notify(*changed)
+	}
+}
+
+// Redact replaces the text of the segment of an item content part, final or
+// not, e.g. with the Decision.Redacted of a guardrail. The raw text of later
+// events is dropped, so the segment keeps the redacted text until the next
+// call.
+func (t *Transcript) Redact(speaker Speaker, itemId string, contentIndex int, text string) {
+	now := t.now().Sub(t.start)
+	t.mu.Lock()
+	s := t.segment(speaker, itemId, contentIndex, now)
+	s.Text, s.redacted = text, true
+	segment := s.Segment
+	t.mu.Unlock()
+	t.notify(segment)
+}
+
+// update applies apply to the segment of an item content part, starting it
+// if needed, and returns a snapshot if apply reports a change.
+func (t *Transcript) update(speaker Speaker, itemId string, contentIndex int, apply func(s *transcriptSegment, now time.Duration) bool) *Segment {
+	now := t.now().Sub(t.start)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s := t.segment(speaker, itemId, contentIndex, now)
+	if s.Final || !apply(s, now) {
+		return nil
+	}
+	segment := s.Segment
+	return &segment
+}
+
+// segment returns the segment of an item content part, starting it at now if
+// needed.
+func (t *Transcript) segment(speaker Speaker, itemId string, contentIndex int, now time.Duration) *transcriptSegment {
+	i := t.index(itemId, contentIndex)
+	if i < 0 {
+		i = len(t.segments)
+		t.segments = append(t.segments, transcriptSegment{Segment: Segment{
+			ItemId:       itemId,
+			ContentIndex: contentIndex,
+			Speaker:      speaker,
+			Start:        now,
+			End:          now,
+		}})
+	}
+	return &t.segments[i]
+}
+
+func (t *Transcript) index(itemId string, contentIndex int) int {
+	for i, s := range t.segments {
+		if s.ItemId == itemId && s.ContentIndex == contentIndex {
+			return i
+		}
+	}
+	return -1
+}
+
+func (t *Transcript) notify(segment Segment) {
+	for _, handler := range t.handlers.snapshot() {
+		handler(segment)
+	}
+}
+
+// cues returns the segments with text, their text on a single line and
+// their end at least minCue after their start.
+func cues(segments []Segment) []Segment {
+	var cues []Segment
+	for _, s := range segments {
+		s.Text = strings.Join(strings.Fields(s.Text), " ")
+		if s.Text == "" {
+			continue
+		}
+		s.End = max(s.End, s.Start+minCue)
+		cues = append(cues, s)
+	}
+	return cues
+}
+
+func timestamp(d time.Duration, sep string) string {
+	ms := d.Milliseconds()
+	return fmt.Sprintf("%02d:%02d:%02d%s%03d", ms/3600000, ms/60000%60, ms/1000%60, sep, ms%1000)
+}
+
+// WriteSRT writes segments, typically from Segments, as SubRip subtitles
+// with the speaker ahead of the text. Segments without text are left out.
+func WriteSRT(w io.Writer, segments []Segment) error {
+	b := bufio.NewWriter(w)
+	for i, s := range cues(segments) {
+		fmt.Fprintf(b, "%d\n%s --> %s\n%s: %s\n\n", i+1, timestamp(s.Start, ","), timestamp(s.End, ","), s.Speaker.label(), s.Text)
+	}
+	if err := b.Flush(); err != nil {
+		return fmt.Errorf("failed to write SRT: %w", err)
+	}
+	return nil
+}
+
+var vttEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// WriteVTT writes segments as WebVTT subtitles with the speaker as the
+// cue's voice. Segments without text are left out.
+func WriteVTT(w io.Writer, segments []Segment) error {
+	b := bufio.NewWriter(w)
+	b.WriteString("WEBVTT\n\n")
+	for _, s := range cues(segments) {
+		fmt.Fprintf(b, "%s --> %s\n<v %s>%s\n\n", timestamp(s.Start, "."), timestamp(s.End, "."), s.Speaker.label(), vttEscaper.Replace(s.Text))
+	}
+	if err := b.Flush(); err != nil {
+		return fmt.Errorf("failed to write VTT: %w", err)
+	}
+	return nil
+}
+
+// WriteText writes segments as plain text, a line per segment with the
+// speaker ahead of the text. Segments without text are left out.
+func WriteText(w io.Writer, segments []Segment) error {
+	b := bufio.NewWriter(w)
+	for _, s := range cues(segments) {
+		fmt.Fprintf(b, "%s: %s\n", s.Speaker.label(), s.Text)
+	}
+	if err := b.Flush(); err != nil {
+		return fmt.Errorf("failed to write transcript: %w", err)
+	}
+	return nil
+}
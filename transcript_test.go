@@ -0,0 +1,118 @@
+package realtime
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"gitlab.bcc-hyperdev.org/bcc-hyperdev/realtime/shared"
+)
+
+// newTestTranscript returns a transcript whose clock advances by a second
+// for every event handled.
+func newTestTranscript() (*Transcript, func(t *testing.T, events ...string)) {
+	tr := NewTranscript(shared.NewLogger(), nil)
+	var elapsed time.Duration
+	tr.now = func() time.Time { return tr.start.Add(elapsed) }
+	return tr, func(t *testing.T, events ...string) {
+		t.Helper()
+		for _, data := range events {
+			elapsed += time.Second
+			event, err := ParseEvent([]byte(data))
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			tr.Handle(context.Background(), event)
+		}
+	}
+}
+
+var transcriptEvents = []string{
+	`{"type":"input_audio_buffer.speech_started","audio_start_ms":0,"item_id":"user"}`,
+	`{"type":"input_audio_buffer.speech_stopped","audio_end_ms":1000,"item_id":"user"}`,
+	`{"type":"response.output_audio_transcript.delta","item_id":"bot","content_index":0,"delta":"Hi "}`,
+	`{"type":"conversation.item.input_audio_transcription.delta","item_id":"user","content_index":0,"delta":"Hel"}`,
+	`{"type":"conversation.item.input_audio_transcription.completed","item_id":"user","content_index":0,"transcript":"Hello"}`,
+	`{"type":"response.output_audio_transcript.delta","item_id":"bot","content_index":0,"delta":"there <3"}`,
+	`{"type":"response.output_audio_transcript.done","item_id":"bot","content_index":0,"transcript":"Hi there <3"}`,
+}
+
+func TestTranscript(t *testing.T) {
+	t.Run("Segments", func(t *testing.T) {
+		tr, handle := newTestTranscript()
+		var updates []Segment
+		remove := tr.OnSegment(func(segment Segment) { updates = append(updates, segment) })
+		handle(t, transcriptEvents...)
+		remove()
+		handle(t, `{"type":"response.output_audio_transcript.delta","item_id":"bot","content_index":0,"delta":" late"}`)
+
+		segments := tr.Segments()
+		if len(segments) != 2 {
+			t.Fatalf("Expected 2 segments, got %+v", segments)
+		}
+		user, bot := segments[0], segments[1]
+		if user.Speaker != SpeakerUser || user.Text != "Hello" || !user.Final || user.Start != time.Second || user.End != 2*time.Second {
+			t.Errorf("Expected the user segment spanning the speech, got %+v", user)
+		}
+		if bot.Speaker != SpeakerAssistant || bot.Text != "Hi there <3" || !bot.Final || bot.Start != 3*time.Second || bot.End != 7*time.Second {
+			t.Errorf("Expected the final assistant segment, got %+v", bot)
+		}
+		if len(updates) != 5 {
+			t.Fatalf("Expected 5 updates, got %+v", updates)
+		}
+		if updates[1].Text != "Hel" || updates[1].Final {
+			t.Errorf("Expected a partial user segment, got %+v", updates[1])
+		}
+	})
+
+	t.Run("WithoutSpeechDetection", func(t *testing.T) {
+		tr, handle := newTestTranscript()
+		handle(t,
+			`{"type":"conversation.item.input_audio_transcription.delta","item_id":"user","content_index":0,"delta":"Hel"}`,
+			`{"type":"conversation.item.input_audio_transcription.failed","item_id":"user","content_index":0,"error":{"message":"failed"}}`,
+		)
+		segments := tr.Segments()
+		if len(segments) != 1 || segments[0].Text != "Hel" || !segments[0].Final || segments[0].Start != time.Second || segments[0].End != 2*time.Second {
+			t.Errorf("Expected a final segment with the partial text, got %+v", segments)
+		}
+	})
+
+	t.Run("Export", func(t *testing.T) {
+		tr, handle := newTestTranscript()
+		handle(t, transcriptEvents...)
+		segments := append(tr.Segments(), Segment{Speaker: SpeakerUser, Text: " \n"})
+
+		for _, c := range []struct {
+			name  string
+			write func(b *strings.Builder) error
+			want  string
+		}{
+			{"SRT", func(b *strings.Builder) error { return WriteSRT(b, segments) },
+				"1\n00:00:01,000 --> 00:00:02,000\nUser: Hello\n\n" +
+					"2\n00:00:03,000 --> 00:00:07,000\nAssistant: Hi there <3\n\n"},
+			{"VTT", func(b *strings.Builder) error { return WriteVTT(b, segments) },
+				"WEBVTT\n\n" +
+					"00:00:01.000 --> 00:00:02.000\n<v User>Hello\n\n" +
+					"00:00:03.000 --> 00:00:07.000\n<v Assistant>Hi there &lt;3\n\n"},
+			{"Text", func(b *strings.Builder) error { return WriteText(b, segments) },
+				"User: Hello\nAssistant: Hi there <3\n"},
+		} {
+			t.Run(c.name, func(t *testing.T) {
+				var b strings.Builder
+				if err := c.write(&b); err != nil {
+					t.Fatalf("Expected no error, got %v", err)
+				}
+				if b.String() != c.want {
+					t.Errorf("Expected %q, got %q", c.want, b.String())
+				}
+			})
+		}
+	})
+
+	t.Run("Timestamp", func(t *testing.T) {
+		if got := timestamp(time.Hour+2*time.Minute+3*time.Second+45*time.Millisecond, ","); got != "01:02:03,045" {
+			t.Errorf("Expected 01:02:03,045, got %s", got)
+		}
+	})
+}
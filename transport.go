@@ -0,0 +1,20 @@
+package realtime
+
+import "context"
+
+// Transport carries client events, server events and audio between a Session
+// and a provider. Events and Audio are closed once the transport is closed.
+type Transport interface {
+	Send(ctx context.Context, event []byte) error
+	Events() <-chan []byte
+	WriteAudio(ctx context.Context, frame []byte) error
+	Audio() <-chan []byte
+	Close(ctx context.Context) error
+}
+
+// StatefulTransport reports the state of its connection, e.g. the
+// PeerConnection state of an rtc.Transport.
+type StatefulTransport interface {
+	Transport
+	State() string
+}
@@ -0,0 +1,215 @@
+package realtime
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// eventLoopKey marks the context of event handlers with their session.
+type eventLoopKey struct{}
+
+// SessionMismatch is a field of a session update the server did not apply as
+// sent.
+type SessionMismatch struct {
+	// Path is the field in the session config, e.g. audio.output.voice or
+	// tools[0].name.
+	Path string
+	Want any
+	Got  any
+}
+
+// SessionMismatchError is returned by Update when the session the server
+// confirmed differs from the update, e.g. because a field was ignored or
+// clamped.
+type SessionMismatchError struct {
+	Mismatches []SessionMismatch
+}
+
+func (e *SessionMismatchError) Error() string {
+	paths := make([]string, len(e.Mismatches))
+	for i, m := range e.Mismatches {
+		paths[i] = m.Path
+	}
+	return fmt.Sprintf("server did not apply %s", strings.Join(paths, ", "))
+}
+
+// Update sends patch, a partial session config, as session.update and waits
+// for the server to confirm it with session.updated. It returns the full
+// session config the server reports in effect. A rejected update fails with
+// a *ServerError, and an update the server applied differently fails with a
+// *SessionMismatchError along with the config in effect.
+//
+// session.updated does not tell which update it confirms, so calls to Update
+// are serialized and skip the confirmations of the session's own updates; a
+// session.update sent with Send meanwhile may still be mistaken for the one
+// awaited.
+//
+// Update must not be called from an event handler: it fails with
+// ErrEventLoop when given the handler's context, and blocks until ctx ends
+// otherwise. Handlers call it from a goroutine instead.
+func (s *Session) Update(ctx context.Context, patch any) (session json.RawMessage, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("failed to update session: %w", err)
+		}
+	}()
+	if ctx.Value(eventLoopKey{}) == s {
+		return nil, ErrEventLoop
+	}
+	want, err := jsonValue(patch)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := want.(map[string]any); !ok {
+		return nil, fmt.Errorf("session must be a JSON object")
+	}
+
+	s.updateMu.Lock()
+	defer s.updateMu.Unlock()
+
+	eventId := "event_" + strings.ReplaceAll(uuid.NewString(), "-", "")
+	replies := make(chan Event, 1)
+	remove := s.OnEvent(func(_ context.Context, event Event) {
+		switch event.Type {
+		case EventTypeSessionUpdated:
+			if s.isInternalReply() {
+				return
+			}
+		case EventTypeError:
+			var payload ErrorEvent
+			if event.Decode(&payload) != nil || payload.Error.EventId != eventId {
+				return
+			}
+		default:
+			return
+		}
+		select {
+		case replies <- event:
+		default:
+		}
+	})
+	defer remove()
+
+	update := NewSessionUpdateEvent(patch)
+	update.EventId = eventId
+	if err := s.Send(ctx, update); err != nil {
+		return nil, err
+	}
+	var reply Event
+	select {
+	case reply = <-replies:
+	case <-s.done:
+		return nil, ErrSessionClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	if reply.Type == EventTypeError {
+		var payload ErrorEvent
+		if err := reply.Decode(&payload); err != nil {
+			return nil, err
+		}
+		return nil, &ServerError{payload.Error}
+	}
+	var payload SessionUpdatedEvent
+	if err := reply.Decode(&payload); err != nil {
+		return nil, err
+	}
+	got, err := jsonValue(payload.Session)
+	if err != nil {
+		return nil, err
+	}
+	if mismatches := diffSession("", want, got); len(mismatches) > 0 {
+		return payload.Session, &SessionMismatchError{Mismatches: mismatches}
+	}
+	return payload.Session, nil
+}
+
+// internalUpdatePrefix starts the event ids of the session's own updates.
+const internalUpdatePrefix = "event_internal_"
+
+// sendInternalUpdate sends a session.update of the session's own, such as
+// disabling server turn detection. Update skips its confirmation: taking
+// updateMu, it is sent before or after a whole Update round trip, so the
+// server confirms the updates in the order they were sent.
+func (s *Session) sendInternalUpdate(ctx context.Context, patch any) error {
+	s.updateMu.Lock()
+	defer s.updateMu.Unlock()
+	update := NewSessionUpdateEvent(patch)
+	update.EventId = internalUpdatePrefix + strings.ReplaceAll(uuid.NewString(), "-", "")
+	s.mu.Lock()
+	s.internalUpdates++
+	s.mu.Unlock()
+	if err := s.send(ctx, update); err != nil {
+		s.mu.Lock()
+		s.internalUpdates--
+		s.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// isInternalReply reports whether the session.updated being dispatched
+// confirms an internal update.
+func (s *Session) isInternalReply() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.internalReply
+}
+
+// jsonValue returns v as decoded from its JSON into an any.
+func jsonValue(v any) (any, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal session: %w", err)
+	}
+	var value any
+	if err := json.Unmarshal(data, &value); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal session: %w", err)
+	}
+	return value, nil
+}
+
+// diffSession returns the fields of want that differ in got. Objects only
+// need to match on the fields of want, since the server fills in defaults,
+// while arrays must have the same length.
+func diffSession(path string, want, got any) []SessionMismatch {
+	mismatch := []SessionMismatch{{Path: path, Want: want, Got: got}}
+	switch w := want.(type) {
+	case map[string]any:
+		g, ok := got.(map[string]any)
+		if !ok {
+			return mismatch
+		}
+		var mismatches []SessionMismatch
+		for _, key := range slices.Sorted(maps.Keys(w)) {
+			field := key
+			if path != "" {
+				field = path + "." + key
+			}
+			mismatches = append(mismatches, diffSession(field, w[key], g[key])...)
+		}
+		return mismatches
+	case []any:
+		g, ok := got.([]any)
+		if !ok || len(g) != len(w) {
+			return mismatch
+		}
+		var mismatches []SessionMismatch
+		for i := range w {
+			mismatches = append(mismatches, diffSession(fmt.Sprintf("%s[%d]", path, i), w[i], g[i])...)
+		}
+		return mismatches
+	default:
+		if want != got {
+			return mismatch
+		}
+		return nil
+	}
+}
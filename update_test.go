@@ -0,0 +1,215 @@
+package realtime
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"gitlab.bcc-hyperdev.org/bcc-hyperdev/realtime/shared"
+)
+
+// awaitUpdate waits for the session.update sent by Update and returns its
+// event_id.
+func awaitUpdate(t *testing.T, transport *fakeTransport) string {
+	t.Helper()
+	var eventId string
+	waitFor(t, func() bool {
+		transport.mu.Lock()
+		defer transport.mu.Unlock()
+		for _, data := range transport.sent {
+			var update struct {
+				Type    string `json:"type"`
+				EventId string `json:"event_id"`
+			}
+			if json.Unmarshal(data, &update) == nil && update.Type == EventTypeSessionUpdate {
+				eventId = update.EventId
+				return true
+			}
+		}
+		return false
+	})
+	if eventId == "" {
+		t.Fatal("Expected the update to carry an event_id")
+	}
+	return eventId
+}
+
+type updateResult struct {
+	session json.RawMessage
+	err     error
+}
+
+func startUpdate(ctx context.Context, session *Session, patch any) <-chan updateResult {
+	result := make(chan updateResult, 1)
+	go func() {
+		s, err := session.Update(ctx, patch)
+		result <- updateResult{s, err}
+	}()
+	return result
+}
+
+func TestSessionUpdate(t *testing.T) {
+	patch := map[string]any{
+		"type":         "realtime",
+		"instructions": "Be brief.",
+		"audio": map[string]any{
+			"input":  map[string]any{"turn_detection": nil},
+			"output": map[string]any{"voice": "marin"},
+		},
+		"tools": []map[string]any{{"type": "function", "name": "lookup"}},
+	}
+
+	t.Run("Applied", func(t *testing.T) {
+		session, transport, _, _ := newTestSession(t)
+		defer func() { _ = session.Close(context.Background()) }()
+		if err := session.Start(); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		result := startUpdate(context.Background(), session, patch)
+		awaitUpdate(t, transport)
+		updated := `{"type":"realtime","model":"gpt-realtime","instructions":"Be brief.","audio":{"input":{"turn_detection":null},"output":{"voice":"marin","speed":1}},"tools":[{"type":"function","name":"lookup","parameters":{}}]}`
+		transport.events <- []byte(`{"type":"session.updated","session":` + updated + `}`)
+		r := <-result
+		if r.err != nil {
+			t.Fatalf("Expected no error, got %v", r.err)
+		}
+		if string(r.session) != updated {
+			t.Errorf("Expected %s, got %s", updated, r.session)
+		}
+	})
+
+	t.Run("Rejected", func(t *testing.T) {
+		session, transport, _, _ := newTestSession(t)
+		defer func() { _ = session.Close(context.Background()) }()
+		if err := session.Start(); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		result := startUpdate(context.Background(), session, patch)
+		eventId := awaitUpdate(t, transport)
+		transport.events <- []byte(`{"type":"error","error":{"type":"invalid_request_error","message":"unrelated","event_id":"event_other"}}`)
+		transport.events <- []byte(`{"type":"error","error":{"type":"invalid_request_error","code":"invalid_value","message":"Invalid voice.","param":"session.audio.output.voice","event_id":"` + eventId + `"}}`)
+		r := <-result
+		var serverErr *ServerError
+		if !errors.As(r.err, &serverErr) {
+			t.Fatalf("Expected a ServerError, got %v", r.err)
+		}
+		if serverErr.Param != "session.audio.output.voice" || serverErr.Message != "Invalid voice." {
+			t.Errorf("Expected the error for the update, got %+v", serverErr.ErrorDetail)
+		}
+	})
+
+	t.Run("Mismatch", func(t *testing.T) {
+		session, transport, _, _ := newTestSession(t)
+		defer func() { _ = session.Close(context.Background()) }()
+		if err := session.Start(); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		result := startUpdate(context.Background(), session, patch)
+		awaitUpdate(t, transport)
+		transport.events <- []byte(`{"type":"session.updated","session":{"type":"realtime","instructions":"Be brief.","audio":{"input":{"turn_detection":{"type":"server_vad"}},"output":{"voice":"alloy"}},"tools":[]}}`)
+		r := <-result
+		var mismatchErr *SessionMismatchError
+		if !errors.As(r.err, &mismatchErr) {
+			t.Fatalf("Expected a SessionMismatchError, got %v", r.err)
+		}
+		var paths []string
+		for _, m := range mismatchErr.Mismatches {
+			paths = append(paths, m.Path)
+		}
+		if len(paths) != 3 || paths[0] != "audio.input.turn_detection" || paths[1] != "audio.output.voice" || paths[2] != "tools" {
+			t.Errorf("Expected [audio.input.turn_detection audio.output.voice tools], got %v", paths)
+		}
+		if mismatchErr.Mismatches[1].Want != "marin" || mismatchErr.Mismatches[1].Got != "alloy" {
+			t.Errorf("Expected marin and alloy, got %+v", mismatchErr.Mismatches[1])
+		}
+		if r.session == nil {
+			t.Error("Expected the session in effect along with the error")
+		}
+	})
+
+	t.Run("InternalUpdate", func(t *testing.T) {
+		transport := newFakeTransport()
+		session, err := NewSession(shared.NewLogger(), transport, &SessionConfig{
+			Source:        newFakeSource(),
+			TurnDetection: TurnDetectionLocal,
+			Detector:      scriptedDetector{},
+		})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		defer func() { _ = session.Close(context.Background()) }()
+		if err := session.Start(); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		// The session disables server turn detection itself at Start.
+		awaitUpdate(t, transport)
+		result := startUpdate(context.Background(), session, patch)
+		waitFor(t, func() bool { return len(sentTypes(transport)) == 2 })
+		transport.events <- []byte(`{"type":"session.updated","session":{"type":"realtime","audio":{"input":{"turn_detection":null},"output":{"voice":"alloy"}}}}`)
+		updated := `{"type":"realtime","instructions":"Be brief.","audio":{"input":{"turn_detection":null},"output":{"voice":"marin"}},"tools":[{"type":"function","name":"lookup"}]}`
+		transport.events <- []byte(`{"type":"session.updated","session":` + updated + `}`)
+		r := <-result
+		if r.err != nil {
+			t.Fatalf("Expected the reply to the internal update to be skipped, got %v", r.err)
+		}
+		if string(r.session) != updated {
+			t.Errorf("Expected %s, got %s", updated, r.session)
+		}
+	})
+
+	t.Run("Timeout", func(t *testing.T) {
+		session, _, _, _ := newTestSession(t)
+		defer func() { _ = session.Close(context.Background()) }()
+		if err := session.Start(); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		if _, err := session.Update(ctx, patch); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Expected %v, got %v", context.DeadlineExceeded, err)
+		}
+	})
+
+	t.Run("Closed", func(t *testing.T) {
+		session, transport, _, _ := newTestSession(t)
+		if err := session.Start(); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		result := startUpdate(context.Background(), session, patch)
+		awaitUpdate(t, transport)
+		_ = transport.Close(context.Background())
+		if r := <-result; !errors.Is(r.err, ErrSessionClosed) {
+			t.Errorf("Expected %v, got %v", ErrSessionClosed, r.err)
+		}
+		_ = session.Close(context.Background())
+	})
+
+	t.Run("EventLoop", func(t *testing.T) {
+		session, transport, _, _ := newTestSession(t)
+		defer func() { _ = session.Close(context.Background()) }()
+		result := make(chan error, 1)
+		session.OnEvent(func(ctx context.Context, event Event) {
+			if event.Type == EventTypeSessionCreated {
+				_, err := session.Update(ctx, patch)
+				result <- err
+			}
+		})
+		if err := session.Start(); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		transport.events <- []byte(`{"type":"session.created","session":{}}`)
+		if err := <-result; !errors.Is(err, ErrEventLoop) {
+			t.Errorf("Expected %v, got %v", ErrEventLoop, err)
+		}
+	})
+
+	t.Run("NotAnObject", func(t *testing.T) {
+		session, _, _, _ := newTestSession(t)
+		defer func() { _ = session.Close(context.Background()) }()
+		if _, err := session.Update(context.Background(), "voice"); err == nil {
+			t.Error("Expected an error, got nil")
+		}
+	})
+}